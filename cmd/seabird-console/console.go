@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	irc "gopkg.in/irc.v3"
+
+	"github.com/belak/go-seabird-plugins/internal"
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+const consoleHelp = `Anything not starting with a / is sent to the current channel.
+
+  /join <channel>                Join a channel and make it the current one
+  /part [channel] [reason]       Leave a channel
+  /nick <nick>                   Change your nick
+  /mode <target> <modes> [args]  Set a mode, like "/mode #seabird +o someone"
+  /me <action>                   Send an action to the current channel
+  /msg <target> <text>           Send a message to a nick or channel
+  /raw <line>                    Send a line to the bot as if from the server
+  /quit                          Shut the bot down and exit
+  //text                         Send text starting with a / to the channel`
+
+// console turns lines typed at the terminal into what a server would send
+// the bot and prints everything the bot sends back.
+type console struct {
+	server *testbot.FakeServer
+	out    io.Writer
+	raw    bool
+
+	// lock protects out, which is written to from the server and stdin.
+	lock sync.Mutex
+
+	// These are only used while reading input.
+	nick    string
+	channel string
+}
+
+func (c *console) printf(format string, args ...interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	fmt.Fprintf(c.out, format+"\n", args...)
+}
+
+func (c *console) prefix() string {
+	return (&irc.Prefix{Name: c.nick, User: "console", Host: "localhost"}).String()
+}
+
+// send sends a line from the console user.
+func (c *console) send(format string, args ...interface{}) {
+	c.server.Send(":" + c.prefix() + " " + fmt.Sprintf(format, args...))
+}
+
+// printLine prints a line from the bot.
+func (c *console) printLine(m *irc.Message) {
+	if c.raw {
+		c.printf("--> %s", m)
+		return
+	}
+
+	switch m.Command {
+	case "CAP", "USER", "PING", "PONG":
+		// These are just noise.
+	case "PRIVMSG":
+		text := internal.StripFormatting(m.Trailing())
+
+		if action := strings.TrimPrefix(text, "\x01ACTION "); action != text {
+			c.printf("[%s] * %s %s", m.Params[0], c.server.Nick(), strings.TrimSuffix(action, "\x01"))
+		} else {
+			c.printf("[%s] <%s> %s", m.Params[0], c.server.Nick(), text)
+		}
+	case "NOTICE":
+		c.printf("[%s] -%s- %s", m.Params[0], c.server.Nick(), internal.StripFormatting(m.Trailing()))
+	default:
+		c.printf("--> %s", m)
+	}
+}
+
+// handle handles a single line of input. It returns false once the console
+// should exit.
+func (c *console) handle(line string) bool {
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return true
+	}
+
+	if !strings.HasPrefix(line, "/") || strings.HasPrefix(line, "//") {
+		c.send("PRIVMSG %s :%s", c.channel, strings.TrimPrefix(line, "/"))
+		return true
+	}
+
+	var (
+		command = strings.SplitN(line[1:], " ", 2)
+		name    = strings.ToLower(command[0])
+		args    string
+	)
+
+	if len(command) > 1 {
+		args = strings.TrimSpace(command[1])
+	}
+
+	fields := strings.Fields(args)
+
+	switch {
+	case name == "quit":
+		return false
+	case name == "help":
+		c.printf("%s", consoleHelp)
+	case name == "join" && len(fields) == 1:
+		if !c.isMember(fields[0]) {
+			c.send("JOIN %s", fields[0])
+		}
+
+		c.channel = fields[0]
+	case name == "part":
+		channel, reason := c.channel, ""
+		if len(fields) > 0 {
+			channel = fields[0]
+			reason = strings.TrimSpace(strings.TrimPrefix(args, channel))
+		}
+
+		c.send("PART %s :%s", channel, reason)
+	case name == "nick" && len(fields) == 1:
+		c.send("NICK :%s", fields[0])
+		c.nick = fields[0]
+	case name == "mode" && len(fields) >= 2:
+		c.send("MODE %s", args)
+	case name == "me" && args != "":
+		c.send("PRIVMSG %s :\x01ACTION %s\x01", c.channel, args)
+	case name == "msg" && len(fields) >= 2:
+		c.send("PRIVMSG %s :%s", fields[0], strings.TrimSpace(strings.TrimPrefix(args, fields[0])))
+	case name == "raw" && args != "":
+		c.server.Send(args)
+	default:
+		c.printf("Unknown command or missing arguments, try /help")
+	}
+
+	return true
+}
+
+func (c *console) isMember(channel string) bool {
+	for _, nick := range c.server.Members(channel) {
+		if strings.EqualFold(nick, c.nick) {
+			return true
+		}
+	}
+
+	return false
+}
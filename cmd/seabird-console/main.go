@@ -0,0 +1,144 @@
+package main // import "github.com/belak/go-seabird/cmd/seabird-console"
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	// Officially supported DB drivers
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	// Load plugins
+	_ "github.com/belak/go-seabird-plugins/core/all"
+	_ "github.com/belak/go-seabird-plugins/extra/all"
+	_ "github.com/belak/go-seabird-plugins/url/all"
+
+	// Load the core
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+func failIfErr(err error, desc string) {
+	if err != nil {
+		logrus.WithError(err).Fatalln(desc)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "Runs the bot from your config against a fake server. Every line you type\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "is sent to it as a message. Type /help for more.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	// Seed the random number generator for plugins to use.
+	rand.Seed(time.Now().UTC().UnixNano())
+
+	c := &console{out: os.Stdout}
+
+	flag.StringVar(&c.nick, "nick", "someone", "Nick to send messages as")
+	flag.StringVar(&c.channel, "channel", "#seabird", "Channel to start in")
+	flag.BoolVar(&c.raw, "raw", false, "Print every line the bot sends exactly as it was sent")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	conf := os.Getenv("SEABIRD_CONFIG")
+	if conf == "" {
+		conf = "config.toml"
+		_, err := os.Stat(conf)
+		failIfErr(err, "Failed to load config")
+	}
+
+	confReader, err := os.Open(conf)
+	failIfErr(err, "Failed to load config")
+
+	// Create the bot
+	b, err := seabird.NewBot(confReader)
+	failIfErr(err, "Failed to create new bot")
+
+	shutdownConfig, err := internal.LoadShutdownConfig(b)
+	failIfErr(err, "Failed to load shutdown config")
+
+	lifecycle := internal.BotLifecycle(b)
+
+	c.server = testbot.NewFakeServer("console", c.printLine)
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- internal.RunBot(b, c.server.Conn())
+	}()
+
+	select {
+	case <-c.server.Registered():
+	case err = <-done:
+		failIfErr(err, "Failed to run bot")
+	}
+
+	// The bot has to be in the channel to see anything, even if it isn't
+	// one it would normally join.
+	c.server.ForceJoin(c.channel)
+	c.send("JOIN %s", c.channel)
+
+	c.printf("Talking to %s in %s as %s. Type /help for commands.", c.server.Nick(), c.channel, c.nick)
+
+	input := make(chan string)
+
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			input <- scanner.Text()
+		}
+
+		close(input)
+	}()
+
+loop:
+	for {
+		select {
+		case line, ok := <-input:
+			if !ok || !c.handle(line) {
+				break loop
+			}
+		case err = <-done:
+			failIfErr(err, "Bot stopped")
+			return
+		}
+	}
+
+	// Shut down the same way the bot would, so anything in flight is
+	// finished and the db is closed. When input is piped in, we can get
+	// here before the bot has seen all of it, so we wait for it to catch up
+	// first.
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownConfig.Timeout.Duration)
+	defer cancel()
+
+	if err = c.server.Sync(ctx); err != nil {
+		logrus.WithError(err).Warn("Bot didn't handle every line")
+	}
+
+	if err = lifecycle.Quit(shutdownConfig.QuitMessage); err == nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			_ = lifecycle.CloseConn()
+		}
+	}
+
+	err = lifecycle.Shutdown(ctx)
+	failIfErr(err, "Failed to shut down")
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"xorm.io/xorm/schemas"
+)
+
+// Archives are a logical copy of every plugin table. Table names are stored
+// without a prefix and values are stored by what the plugin's model says
+// they are, rather than how a particular database happened to store them,
+// so an archive from one database can be loaded into any other.
+const (
+	archiveFormat  = "seabird-archive"
+	archiveVersion = 1
+)
+
+type archiveHeader struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+}
+
+func newArchiveHeader() archiveHeader {
+	return archiveHeader{
+		Format:  archiveFormat,
+		Version: archiveVersion,
+		Created: time.Now().UTC(),
+	}
+}
+
+func (h archiveHeader) validate() error {
+	if h.Format != archiveFormat {
+		return errors.New("not a seabird archive")
+	}
+
+	if h.Version < 1 || h.Version > archiveVersion {
+		return fmt.Errorf("unsupported archive version %d", h.Version)
+	}
+
+	return nil
+}
+
+// archiveTable describes a table and is followed by its rows.
+type archiveTable struct {
+	Name    string   `json:"name"`
+	Plugin  string   `json:"plugin"`
+	Columns []string `json:"columns"`
+}
+
+// tableSink is somewhere tables can be copied to.
+type tableSink interface {
+	Table(t archiveTable) error
+	Row(row map[string]interface{}) error
+	Close() error
+}
+
+// archiveFormatFor picks an archive format, guessing from the filename if
+// one wasn't given.
+func archiveFormatFor(format, filename string) (string, error) {
+	if format == "" {
+		switch filepath.Ext(filename) {
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		default:
+			format = "json"
+		}
+	}
+
+	if format != "json" && format != "ndjson" {
+		return "", fmt.Errorf("unknown archive format %q", format)
+	}
+
+	return format, nil
+}
+
+// The json format is a single document. It's easier to read, but the whole
+// archive has to fit in memory.
+
+type jsonTable struct {
+	archiveTable
+	Rows []map[string]interface{} `json:"rows"`
+}
+
+type jsonArchive struct {
+	archiveHeader
+	Tables []*jsonTable `json:"tables"`
+}
+
+type jsonSink struct {
+	w       io.Writer
+	archive jsonArchive
+}
+
+func newJSONSink(w io.Writer) *jsonSink {
+	return &jsonSink{w: w, archive: jsonArchive{archiveHeader: newArchiveHeader()}}
+}
+
+func (s *jsonSink) Table(t archiveTable) error {
+	s.archive.Tables = append(s.archive.Tables, &jsonTable{
+		archiveTable: t,
+		Rows:         []map[string]interface{}{},
+	})
+
+	return nil
+}
+
+func (s *jsonSink) Row(row map[string]interface{}) error {
+	t := s.archive.Tables[len(s.archive.Tables)-1]
+	t.Rows = append(t.Rows, row)
+
+	return nil
+}
+
+func (s *jsonSink) Close() error {
+	enc := json.NewEncoder(s.w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(s.archive)
+}
+
+func readJSONArchive(r io.Reader, sink tableSink) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var archive jsonArchive
+	if err := dec.Decode(&archive); err != nil {
+		return err
+	}
+
+	if err := archive.validate(); err != nil {
+		return err
+	}
+
+	for _, t := range archive.Tables {
+		if err := sink.Table(t.archiveTable); err != nil {
+			return err
+		}
+
+		for _, row := range t.Rows {
+			if err := sink.Row(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// The ndjson format has the header on the first line, followed by a line
+// for each table and each row. It can be written and read a row at a time.
+
+type ndjsonLine struct {
+	Table *archiveTable          `json:"table,omitempty"`
+	Row   map[string]interface{} `json:"row,omitempty"`
+}
+
+type ndjsonSink struct {
+	enc *json.Encoder
+}
+
+func newNDJSONSink(w io.Writer) (*ndjsonSink, error) {
+	s := &ndjsonSink{enc: json.NewEncoder(w)}
+
+	if err := s.enc.Encode(newArchiveHeader()); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *ndjsonSink) Table(t archiveTable) error {
+	return s.enc.Encode(ndjsonLine{Table: &t})
+}
+
+func (s *ndjsonSink) Row(row map[string]interface{}) error {
+	return s.enc.Encode(ndjsonLine{Row: row})
+}
+
+func (s *ndjsonSink) Close() error {
+	return nil
+}
+
+func readNDJSONArchive(r io.Reader, sink tableSink) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var header archiveHeader
+	if err := dec.Decode(&header); err != nil {
+		return err
+	}
+
+	if err := header.validate(); err != nil {
+		return err
+	}
+
+	inTable := false
+
+	for {
+		var line ndjsonLine
+
+		err := dec.Decode(&line)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case line.Table != nil:
+			inTable = true
+			err = sink.Table(*line.Table)
+		case line.Row != nil && inTable:
+			err = sink.Row(line.Row)
+		default:
+			err = errors.New("unexpected line in archive")
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// convertValue converts a value read from a database or an archive to the
+// type the column holds in the plugin's model. Blobs are base64 encoded in
+// archives, which is what encoding/json does with a []byte.
+func convertValue(col *schemas.Column, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch {
+	case col.SQLType.Name == schemas.Bool || col.SQLType.Name == schemas.Boolean:
+		return convertBool(v)
+	case col.SQLType.IsTime():
+		return convertTime(v)
+	case col.SQLType.IsBlob():
+		return convertBlob(v)
+	case col.SQLType.IsNumeric():
+		return convertNumber(v)
+	default:
+		return convertText(v)
+	}
+}
+
+func convertBool(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case int64:
+		return v != 0, nil
+	case json.Number:
+		n, err := v.Int64()
+		return n != 0, err
+	case []byte:
+		return strconv.ParseBool(string(v))
+	case string:
+		return strconv.ParseBool(v)
+	}
+
+	return nil, fmt.Errorf("can't convert %T to a bool", v)
+}
+
+// timeLayouts are the formats databases hand back times in, when the driver
+// doesn't convert them for us.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func convertTime(v interface{}) (interface{}, error) {
+	var s string
+
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return nil, fmt.Errorf("can't convert %T to a time", v)
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("can't parse %q as a time", s)
+}
+
+func convertBlob(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return base64.StdEncoding.DecodeString(v)
+	}
+
+	return nil, fmt.Errorf("can't convert %T to bytes", v)
+}
+
+func convertNumber(v interface{}) (interface{}, error) {
+	var s string
+
+	switch v := v.(type) {
+	case int64, float64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case json.Number:
+		s = v.String()
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return nil, fmt.Errorf("can't convert %T to a number", v)
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+func convertText(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
@@ -12,6 +12,31 @@ type dbConfig struct {
 	// Filename comes from the original version of the plugin and is needed to
 	// load nutdb.
 	Filename string
+
+	TablePrefix string
+}
+
+func openXorm(b *seabird.Bot) (*xorm.Engine, error) {
+	err := db.NewDBPlugin(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.CtxDB(b.Context()), nil
+}
+
+// openXormWithPrefix opens the configured database and returns the table
+// prefix it uses.
+func openXormWithPrefix(b *seabird.Bot) (*xorm.Engine, string, error) {
+	dbc := &dbConfig{}
+
+	if err := b.Config("db", dbc); err != nil {
+		return nil, "", err
+	}
+
+	x, err := openXorm(b)
+
+	return x, dbc.TablePrefix, err
 }
 
 func openDBs(b *seabird.Bot) (*nut.DB, *xorm.Engine, error) {
@@ -21,13 +46,11 @@ func openDBs(b *seabird.Bot) (*nut.DB, *xorm.Engine, error) {
 		return nil, nil, err
 	}
 
-	err := db.NewDBPlugin(b)
+	xdb, err := openXorm(b)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	xdb := db.CtxDB(b.Context())
-
 	ndb, err := nut.Open(dbc.Filename, 0700)
 	if err != nil {
 		return nil, nil, err
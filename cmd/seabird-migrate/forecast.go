@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/belak/nut"
+)
+
+// ForecastLocation is the v1 xorm model for forecast
+type ForecastLocation struct {
+	ID      int64
+	Nick    string `xorm:"unique"`
+	Address string
+	Lat     float64
+	Lon     float64
+}
+
+// forecastBucket is the old nut.DB forecast store, keyed by nick.
+type forecastBucket struct {
+	Nick    string
+	Address string
+	Lat     float64
+	Lon     float64
+}
+
+// loadForecastLocations reads the forecast bucket. If more than one nick
+// folds to the same thing, the last one wins.
+func loadForecastLocations(bucket *nut.Bucket) ([]nutEntry, error) {
+	locations := make(map[string]*forecastBucket)
+
+	err := eachNutEntry(bucket, func() interface{} { return &forecastBucket{} }, func(key string, v interface{}) error {
+		locations[cleanName(key)] = v.(*forecastBucket)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []nutEntry
+
+	for nick, data := range locations {
+		ret = append(ret, nutEntry{
+			key: nick,
+			rows: []nutRow{{
+				bean: &ForecastLocation{
+					Nick:    nick,
+					Address: data.Address,
+					Lat:     data.Lat,
+					Lon:     data.Lon,
+				},
+				match: &ForecastLocation{Nick: nick},
+			}},
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].key < ret[j].key })
+
+	return ret, nil
+}
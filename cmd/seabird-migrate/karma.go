@@ -1,10 +1,9 @@
 package main
 
 import (
-	"github.com/belak/nut"
-	"xorm.io/xorm"
+	"sort"
 
-	seabird "github.com/belak/go-seabird"
+	"github.com/belak/nut"
 )
 
 // Karma is the v1 xorm model for karma
@@ -14,61 +13,39 @@ type Karma struct {
 	Score int
 }
 
-func migrateKarma(b *seabird.Bot, ndb *nut.DB, xdb *xorm.Engine) error {
-	l := seabird.CtxLogger(b.Context(), "migrate")
-
-	// Migrate any relevant tables
-	err := xdb.Sync(Karma{})
-	if err != nil {
-		return err
-	}
+// karmaBucket is the old nut.DB karma store
+type karmaBucket struct {
+	Name  string
+	Score int
+}
 
-	rowCount, err := xdb.Count(Karma{})
-	if err != nil {
-		return err
-	}
+// loadKarma reads the karma bucket. Names are cleaned the same way the
+// karma plugin does and the scores of names which end up the same are
+// added together.
+func loadKarma(bucket *nut.Bucket) ([]nutEntry, error) {
+	scores := make(map[string]int)
 
-	if rowCount != 0 {
-		l.Warn("Skipping karma migration because target table is non-empty")
+	err := eachNutEntry(bucket, func() interface{} { return &karmaBucket{} }, func(key string, v interface{}) error {
+		scores[cleanName(key)] += v.(*karmaBucket).Score
 		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// If a nut DB exists, we need to migrate all the data
-	l.Info("Migrating karma from nut to xorm")
-
-	// This is a bit gross, but it's the simplest way to get a transaction for both nut and xorm.
-	return ndb.View(func(tx *nut.Tx) error {
-		_, innerErr := xdb.Transaction(func(s *xorm.Session) (interface{}, error) {
-			// We only need to migrate data if there's a karma bucket.
-			bucket := tx.Bucket("karma")
-			if bucket == nil {
-				l.Info("Skipping karma migration because of missing bucket")
-				return nil, nil
-			}
-
-			karma := &Karma{}
-
-			c := bucket.Cursor()
-			for k, e := c.First(&karma); e == nil; k, e = c.Next(&karma) {
-				l.Infof("Migrating karma entry for %s", karma.Name)
-
-				if karma.Name != k {
-					l.Warnf("Karma name (%s) does not match key (%s)", karma.Name, k)
-				}
+	var ret []nutEntry
 
-				// Reset the ID before inserting
-				karma.ID = 0
-
-				// Actually insert
-				_, err = s.InsertOne(karma)
-				if err != nil {
-					return nil, err
-				}
-			}
-
-			return nil, err
+	for name, score := range scores {
+		ret = append(ret, nutEntry{
+			key: name,
+			rows: []nutRow{{
+				bean:  &Karma{Name: name, Score: score},
+				match: &Karma{Name: name},
+			}},
 		})
+	}
 
-		return innerErr
-	})
+	sort.Slice(ret, func(i, j int) bool { return ret[i].key < ret[j].key })
+
+	return ret, nil
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/belak/nut"
+)
+
+// LastSeen is the v1 xorm model for lastseen
+type LastSeen struct {
+	ID      int64
+	Channel string `xorm:"unique(channel_nick)"`
+	Nick    string `xorm:"unique(channel_nick)"`
+	Time    time.Time
+}
+
+// lastSeenBucket is the old nut.DB lastseen store, with an entry for each
+// channel.
+type lastSeenBucket struct {
+	Key   string
+	Nicks map[string]time.Time
+}
+
+// loadLastSeen reads the lastseen bucket. Channels and nicks are folded
+// the same way the lastseen plugin does and only the latest time is kept
+// for each.
+func loadLastSeen(bucket *nut.Bucket) ([]nutEntry, error) {
+	seen := make(map[string]map[string]time.Time)
+
+	err := eachNutEntry(bucket, func() interface{} { return &lastSeenBucket{} }, func(key string, v interface{}) error {
+		channel := cleanName(key)
+
+		if seen[channel] == nil {
+			seen[channel] = make(map[string]time.Time)
+		}
+
+		for nick, t := range v.(*lastSeenBucket).Nicks {
+			nick = cleanName(nick)
+
+			if t.After(seen[channel][nick]) {
+				seen[channel][nick] = t
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []nutEntry
+
+	for channel, nicks := range seen {
+		entry := nutEntry{key: channel}
+
+		for nick, t := range nicks {
+			entry.rows = append(entry.rows, nutRow{
+				bean:  &LastSeen{Channel: channel, Nick: nick, Time: t},
+				match: &LastSeen{Channel: channel, Nick: nick},
+			})
+		}
+
+		sort.Slice(entry.rows, func(i, j int) bool {
+			return entry.rows[i].bean.(*LastSeen).Nick < entry.rows[j].bean.(*LastSeen).Nick
+		})
+
+		ret = append(ret, entry)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].key < ret[j].key })
+
+	return ret, nil
+}
@@ -1,8 +1,11 @@
 package main // import "github.com/belak/go-seabird/cmd/seabird"
 
 import (
+	"flag"
+	"fmt"
 	"math/rand"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -22,16 +25,99 @@ import (
 	seabird "github.com/belak/go-seabird"
 )
 
+type options struct {
+	dryRun bool
+
+	// These are used by export, import and copy.
+	format       string
+	file         string
+	toDriver     string
+	toDataSource string
+	toPrefix     string
+}
+
+type command struct {
+	description string
+	run         func(b *seabird.Bot, opts *options) error
+}
+
+var commands = map[string]command{
+	"copy": {
+		description: "Copy every plugin table to another database",
+		run:         copyDatabase,
+	},
+	"export": {
+		description: "Write every plugin table to an archive",
+		run:         exportArchive,
+	},
+	"import": {
+		description: "Load an archive into an empty database",
+		run:         importArchive,
+	},
+	"nut": {
+		description: "Copy anything not yet copied from the old nut database (the default)",
+		run:         migrateNut,
+	},
+	"status": {
+		description: "Show which schema migrations have been applied",
+		run:         showStatus,
+	},
+	"up": {
+		description: "Apply any pending schema migrations",
+		run:         applyMigrations,
+	},
+}
+
 func failIfErr(err error, desc string) {
 	if err != nil {
 		logrus.WithError(err).Fatalln(desc)
 	}
 }
 
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\nCommands:\n", os.Args[0])
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-8s %s\n", name, commands[name].description)
+	}
+
+	fmt.Fprintf(flag.CommandLine.Output(), "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
 func main() {
 	// Seed the random number generator for plugins to use.
 	rand.Seed(time.Now().UTC().UnixNano())
 
+	opts := &options{}
+
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "Report what would change without changing anything")
+	flag.StringVar(&opts.format, "format", "", "Archive format, json or ndjson (defaults to guessing from -file)")
+	flag.StringVar(&opts.file, "file", "-", "Archive to export to or import from")
+	flag.StringVar(&opts.toDriver, "to-driver", "", "Database driver to copy to")
+	flag.StringVar(&opts.toDataSource, "to-datasource", "", "Database to copy to")
+	flag.StringVar(&opts.toPrefix, "to-prefix", "", "Table prefix to use when copying")
+	flag.Usage = usage
+	flag.Parse()
+
+	name := "nut"
+	if flag.NArg() > 0 {
+		name = flag.Arg(0)
+	}
+
+	cmd, ok := commands[name]
+	if !ok || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	conf := os.Getenv("SEABIRD_CONFIG")
 	if conf == "" {
 		conf = "config.toml"
@@ -46,15 +132,6 @@ func main() {
 	b, err := seabird.NewBot(confReader)
 	failIfErr(err, "Failed to create new bot")
 
-	// Load the relevant databases
-	nutdb, xormdb, err := openDBs(b)
-	failIfErr(err, "Failed to open databases")
-
-	// Migrate karma
-	err = migrateKarma(b, nutdb, xormdb)
-	failIfErr(err, "Failed to migrate karma")
-
-	// Migrate phrases
-	err = migratePhrases(b, nutdb, xormdb)
-	failIfErr(err, "Failed to migrate phrases")
+	err = cmd.run(b, opts)
+	failIfErr(err, fmt.Sprintf("Failed to run %s", name))
 }
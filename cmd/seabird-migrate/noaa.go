@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/belak/nut"
+)
+
+// NOAAStation is the v1 xorm model for noaa
+type NOAAStation struct {
+	ID      int64
+	Nick    string `xorm:"unique"`
+	Station string
+}
+
+// noaaBucket is the old nut.DB metar store, keyed by nick.
+type noaaBucket struct {
+	Nick    string
+	Station string
+}
+
+// loadNOAAStations reads the metar bucket. If more than one nick folds to
+// the same thing, the last one wins.
+func loadNOAAStations(bucket *nut.Bucket) ([]nutEntry, error) {
+	stations := make(map[string]string)
+
+	err := eachNutEntry(bucket, func() interface{} { return &noaaBucket{} }, func(key string, v interface{}) error {
+		stations[cleanName(key)] = v.(*noaaBucket).Station
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []nutEntry
+
+	for nick, station := range stations {
+		ret = append(ret, nutEntry{
+			key: nick,
+			rows: []nutRow{{
+				bean:  &NOAAStation{Nick: nick, Station: station},
+				match: &NOAAStation{Nick: nick},
+			}},
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].key < ret[j].key })
+
+	return ret, nil
+}
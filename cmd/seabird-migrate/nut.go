@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/belak/nut"
+	"github.com/sirupsen/logrus"
+	"xorm.io/xorm"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/core/isupport"
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+// NutCheckpoint records a nut entry which has been migrated, so the
+// migration can be run again after it fails or new data shows up without
+// anything being copied twice.
+type NutCheckpoint struct {
+	ID         int64
+	Bucket     string `xorm:"unique(bucket_key)"`
+	Key        string `xorm:"unique(bucket_key)"`
+	MigratedAt time.Time
+}
+
+// nutEntry is a single key from a nut bucket and the rows it becomes.
+type nutEntry struct {
+	key  string
+	rows []nutRow
+}
+
+// nutRow is a row to insert. Match is used to look for the same row in the
+// target table, so data which was migrated before checkpoints existed isn't
+// copied again. Only its non-zero fields are compared.
+type nutRow struct {
+	bean  interface{}
+	match interface{}
+}
+
+// nutMigrator copies a single nut bucket.
+type nutMigrator struct {
+	bucket string
+
+	// plugin is the plugin whose schema migrations create the table.
+	plugin string
+	model  interface{}
+
+	// load reads every entry from the bucket.
+	load func(bucket *nut.Bucket) ([]nutEntry, error)
+}
+
+var nutMigrators = []nutMigrator{
+	{bucket: "karma", plugin: "karma", model: Karma{}, load: loadKarma},
+	{bucket: "phrases", plugin: "phrases", model: Phrase{}, load: loadPhrases},
+	{bucket: "lastseen", plugin: "lastseen", model: LastSeen{}, load: loadLastSeen},
+	{bucket: "remind_reminders", plugin: "remind", model: Reminder{}, load: loadReminders},
+	{bucket: "forecast_location", plugin: "forecast", model: ForecastLocation{}, load: loadForecastLocations},
+	{bucket: "metar_station", plugin: "noaa", model: NOAAStation{}, load: loadNOAAStations},
+}
+
+// nutReport is what happened to a single bucket.
+type nutReport struct {
+	bucket string
+
+	// entries and rows are how much is in the nut bucket.
+	entries int
+	rows    int
+
+	// done is how many entries were migrated by an earlier run.
+	done int
+
+	// present is how many rows were already in the target table.
+	present int
+
+	// inserted is how many rows were (or with -dry-run, would be) inserted.
+	inserted int
+}
+
+// cleanName folds a nick or channel the same way the plugins do. We don't
+// know the server's CASEMAPPING here, so the default is used.
+func cleanName(name string) string {
+	return strings.TrimFunc(isupport.FoldCase(isupport.CaseMappingRFC1459, name), unicode.IsSpace)
+}
+
+// eachNutEntry decodes every value in a bucket into a fresh value from
+// newValue, so nothing is left over from the previous entry.
+func eachNutEntry(bucket *nut.Bucket, newValue func() interface{}, f func(key string, v interface{}) error) error {
+	c := bucket.Cursor().Raw()
+
+	for k, raw := c.First(); k != nil; k, raw = c.Next() {
+		// Nested buckets don't have a value.
+		if raw == nil {
+			continue
+		}
+
+		v := newValue()
+		if err := bucket.Get(string(k), v); err != nil {
+			return fmt.Errorf("failed to decode %q: %w", k, err)
+		}
+
+		if err := f(string(k), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prepare makes sure the target table exists and is up to date.
+func (m nutMigrator) prepare(l *logrus.Entry, x *xorm.Engine) error {
+	_, err := db.ApplyMigrations(x, l, m.plugin, false)
+
+	return err
+}
+
+func (m nutMigrator) run(l *logrus.Entry, tx *nut.Tx, x *xorm.Engine, dryRun bool) (*nutReport, error) {
+	l = l.WithField("bucket", m.bucket)
+	report := &nutReport{bucket: m.bucket}
+
+	bucket := tx.Bucket(m.bucket)
+	if bucket == nil {
+		l.Info("Skipping migration because of missing bucket")
+		return report, nil
+	}
+
+	entries, err := m.load(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	report.entries = len(entries)
+
+	// A dry run can't create anything, so missing tables are treated as
+	// empty.
+	tableExists, checkpointsExist := true, true
+
+	if dryRun {
+		if tableExists, err = x.IsTableExist(m.model); err != nil {
+			return nil, err
+		}
+
+		if checkpointsExist, err = x.IsTableExist(NutCheckpoint{}); err != nil {
+			return nil, err
+		}
+	} else if err = m.prepare(l, x); err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		report.rows += len(e.rows)
+
+		if checkpointsExist {
+			done, err := x.Exist(&NutCheckpoint{Bucket: m.bucket, Key: e.key})
+			if err != nil {
+				return nil, err
+			}
+
+			if done {
+				report.done++
+				continue
+			}
+		}
+
+		var present, inserted int
+
+		if dryRun {
+			for _, row := range e.rows {
+				found := false
+
+				if tableExists {
+					if found, err = x.Exist(row.match); err != nil {
+						return nil, err
+					}
+				}
+
+				if found {
+					present++
+				} else {
+					inserted++
+				}
+			}
+
+			if inserted > 0 {
+				l.Infof("Would insert %d rows for %s", inserted, e.key)
+			}
+		} else {
+			// Each entry is copied in its own transaction along with its
+			// checkpoint, so a failure never leaves one half copied.
+			_, err = x.Transaction(func(s *xorm.Session) (interface{}, error) {
+				for _, row := range e.rows {
+					found, err := s.Exist(row.match)
+					if err != nil {
+						return nil, err
+					}
+
+					if found {
+						present++
+						continue
+					}
+
+					if _, err = s.InsertOne(row.bean); err != nil {
+						return nil, err
+					}
+
+					inserted++
+				}
+
+				return s.InsertOne(&NutCheckpoint{
+					Bucket:     m.bucket,
+					Key:        e.key,
+					MigratedAt: time.Now(),
+				})
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to migrate %q: %w", e.key, err)
+			}
+
+			l.Infof("Migrated %s (%d rows inserted, %d already present)", e.key, inserted, present)
+		}
+
+		report.present += present
+		report.inserted += inserted
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	// Every entry should have a checkpoint now. If not, something else is
+	// writing to the table or the bucket has keys we can't tell apart.
+	count, err := x.Where("bucket = ?", m.bucket).Count(&NutCheckpoint{})
+	if err != nil {
+		return nil, err
+	}
+
+	if int(count) != len(entries) {
+		return nil, fmt.Errorf("%d entries in bucket but %d checkpoints", len(entries), count)
+	}
+
+	return report, nil
+}
+
+// migrateNut copies everything from the old nut database. It can be run
+// more than once. Entries which were already copied are skipped.
+func migrateNut(b *seabird.Bot, opts *options) error {
+	l := seabird.CtxLogger(b.Context(), "migrate")
+
+	// Load the relevant databases
+	nutdb, xormdb, err := openDBs(b)
+	if err != nil {
+		return err
+	}
+	defer nutdb.Close()
+
+	if opts.dryRun {
+		l.Info("Dry run, nothing will be inserted")
+	} else if err = xormdb.Sync2(NutCheckpoint{}); err != nil {
+		return err
+	}
+
+	var reports []*nutReport
+
+	err = nutdb.View(func(tx *nut.Tx) error {
+		for _, m := range nutMigrators {
+			report, err := m.run(l, tx, xormdb, opts.dryRun)
+			if err != nil {
+				return fmt.Errorf("failed to migrate %s: %w", m.bucket, err)
+			}
+
+			reports = append(reports, report)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	inserted := "INSERTED"
+	if opts.dryRun {
+		inserted = "TO INSERT"
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "BUCKET\tENTRIES\tROWS\tDONE BEFORE\tALREADY PRESENT\t%s\n", inserted)
+
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\n", r.bucket, r.entries, r.rows, r.done, r.present, r.inserted)
+	}
+
+	return w.Flush()
+}
@@ -2,9 +2,6 @@ package main
 
 import (
 	"github.com/belak/nut"
-	"xorm.io/xorm"
-
-	seabird "github.com/belak/go-seabird"
 )
 
 // Phrase is the v1 xorm model for phrases
@@ -26,65 +23,31 @@ type phraseBucket struct {
 	}
 }
 
-func migratePhrases(b *seabird.Bot, ndb *nut.DB, xdb *xorm.Engine) error {
-	l := seabird.CtxLogger(b.Context(), "migrate")
-
-	err := xdb.Sync(Phrase{})
-	if err != nil {
-		return err
-	}
-
-	rowCount, err := xdb.Count(Phrase{})
-	if err != nil {
-		return err
-	}
+// loadPhrases reads the phrases bucket. Every version of a phrase is kept,
+// including the deleted ones, so the history is the same as before.
+func loadPhrases(bucket *nut.Bucket) ([]nutEntry, error) {
+	var ret []nutEntry
+
+	err := eachNutEntry(bucket, func() interface{} { return &phraseBucket{} }, func(key string, v interface{}) error {
+		data := v.(*phraseBucket)
+		entry := nutEntry{key: key}
+
+		for _, e := range data.Entries {
+			entry.rows = append(entry.rows, nutRow{
+				bean: &Phrase{
+					Name:      key,
+					Value:     e.Value,
+					Submitter: e.Submitter,
+					Deleted:   e.Deleted,
+				},
+				match: &Phrase{Name: key, Value: e.Value, Submitter: e.Submitter},
+			})
+		}
+
+		ret = append(ret, entry)
 
-	if rowCount != 0 {
-		l.Warn("Skipping phrases migration because target table is non-empty")
 		return nil
-	}
-
-	l.Info("Migrating phrases from nut to xorm")
-
-	// This is a bit gross, but it's the simplest way to get a transaction for both nut and xorm.
-	l.Info("Migrating phrases from nut to xorm")
-
-	// This is a bit gross, but it's the simplest way to get a transaction for both nut and xorm.
-	return ndb.View(func(tx *nut.Tx) error {
-		_, innerErr := xdb.Transaction(func(s *xorm.Session) (interface{}, error) {
-			bucket := tx.Bucket("phrases")
-			if bucket == nil {
-				l.Info("Skipping phrases migration because of missing bucket")
-				return nil, nil
-			}
-
-			data := &phraseBucket{}
-			c := bucket.Cursor()
-			for k, e := c.First(&data); e == nil; k, e = c.Next(&data) {
-				l.Infof("Migrating phrase entry for %s", data.Key)
-
-				if data.Key != k {
-					l.Warnf("Phrase name (%s) does not match key (%s)", data.Key, k)
-				}
-
-				for _, entry := range data.Entries {
-					phrase := Phrase{
-						Name:      data.Key,
-						Value:     entry.Value,
-						Submitter: entry.Submitter,
-						Deleted:   entry.Deleted,
-					}
-
-					_, err = s.InsertOne(phrase)
-					if err != nil {
-						return nil, err
-					}
-				}
-			}
-
-			return nil, err
-		})
-
-		return innerErr
 	})
+
+	return ret, err
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"time"
+
+	"github.com/belak/nut"
+)
+
+// Reminder is the v1 xorm model for remind
+type Reminder struct {
+	ID           int64
+	Target       string
+	TargetType   int
+	Content      string
+	ReminderTime time.Time
+}
+
+// reminderBucket is the old nut.DB reminder store, keyed by ID. Reminders
+// were removed once they were sent, so everything left is still pending.
+type reminderBucket struct {
+	Target       string
+	TargetType   int
+	Content      string
+	ReminderTime time.Time
+}
+
+func loadReminders(bucket *nut.Bucket) ([]nutEntry, error) {
+	var ret []nutEntry
+
+	err := eachNutEntry(bucket, func() interface{} { return &reminderBucket{} }, func(key string, v interface{}) error {
+		data := v.(*reminderBucket)
+
+		ret = append(ret, nutEntry{
+			key: key,
+			rows: []nutRow{{
+				bean: &Reminder{
+					Target:       data.Target,
+					TargetType:   data.TargetType,
+					Content:      data.Content,
+					ReminderTime: data.ReminderTime,
+				},
+				match: &Reminder{Target: data.Target, Content: data.Content},
+			}},
+		})
+
+		return nil
+	})
+
+	return ret, err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+// showStatus prints every registered migration and whether it has been
+// applied.
+func showStatus(b *seabird.Bot, opts *options) error {
+	xdb, err := openXorm(b)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PLUGIN\tVERSION\tAPPLIED\tDESCRIPTION")
+
+	for _, plugin := range db.MigrationPlugins() {
+		statuses, err := db.MigrationStatuses(xdb, plugin)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", status.Plugin, status.Version, applied, status.Description)
+		}
+	}
+
+	return w.Flush()
+}
+
+// applyMigrations runs every pending migration. With -dry-run, they're all
+// rolled back afterwards.
+func applyMigrations(b *seabird.Bot, opts *options) error {
+	l := seabird.CtxLogger(b.Context(), "migrate")
+
+	xdb, err := openXorm(b)
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		l.Info("Dry run, no changes will be kept")
+	}
+
+	for _, plugin := range db.MigrationPlugins() {
+		applied, err := db.ApplyMigrations(xdb, l, plugin, opts.dryRun)
+		if err != nil {
+			return err
+		}
+
+		if len(applied) == 0 {
+			l.Infof("No pending migrations for %s", plugin)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+// tableModel is a registered model and the table it's stored in.
+type tableModel struct {
+	plugin string
+	bean   interface{}
+	info   *schemas.Table
+
+	// name is the table name without a prefix, which is what archives use.
+	name string
+
+	// table is the real table name.
+	table string
+}
+
+func tableModels(x *xorm.Engine, prefix string) ([]*tableModel, error) {
+	var ret []*tableModel
+
+	for _, m := range db.Models() {
+		info, err := x.TableInfo(m.Bean)
+		if err != nil {
+			return nil, err
+		}
+
+		table := x.TableName(m.Bean)
+
+		ret = append(ret, &tableModel{
+			plugin: m.Plugin,
+			bean:   m.Bean,
+			info:   info,
+			name:   strings.TrimPrefix(table, prefix),
+			table:  table,
+		})
+	}
+
+	return ret, nil
+}
+
+// checkMigrated makes sure no plugin with tables has pending migrations, as
+// tables are copied using the current models.
+func checkMigrated(x *xorm.Engine, models []*tableModel) error {
+	for _, plugin := range db.MigrationPlugins() {
+		statuses, err := db.MigrationStatuses(x, plugin)
+		if err != nil {
+			return err
+		}
+
+		pending := false
+
+		for _, status := range statuses {
+			pending = pending || !status.Applied
+		}
+
+		if !pending {
+			continue
+		}
+
+		for _, m := range models {
+			if m.plugin != plugin {
+				continue
+			}
+
+			exists, err := x.IsTableExist(m.table)
+			if err != nil {
+				return err
+			}
+
+			if exists {
+				return fmt.Errorf("%s has pending migrations, run the up command first", plugin)
+			}
+		}
+	}
+
+	return nil
+}
+
+// exportTables copies every table with a registered model to the sink.
+// Tables which don't exist yet are skipped.
+func exportTables(x *xorm.Engine, prefix string, sink tableSink) error {
+	models, err := tableModels(x, prefix)
+	if err != nil {
+		return err
+	}
+
+	if err = checkMigrated(x, models); err != nil {
+		return err
+	}
+
+	for _, m := range models {
+		logger := logrus.WithField("table", m.name)
+
+		exists, err := x.IsTableExist(m.table)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			logger.Info("Skipping missing table")
+			continue
+		}
+
+		cols := m.info.Columns()
+
+		names := make([]string, 0, len(cols))
+		quoted := make([]string, 0, len(cols))
+
+		for _, col := range cols {
+			names = append(names, col.Name)
+			quoted = append(quoted, x.Quote(col.Name))
+		}
+
+		err = sink.Table(archiveTable{Name: m.name, Plugin: m.plugin, Columns: names})
+		if err != nil {
+			return err
+		}
+
+		query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), x.Quote(m.table))
+
+		if pks := m.info.PrimaryKeys; len(pks) > 0 {
+			order := make([]string, 0, len(pks))
+			for _, pk := range pks {
+				order = append(order, x.Quote(pk))
+			}
+
+			query += " ORDER BY " + strings.Join(order, ", ")
+		}
+
+		rows, err := x.QueryInterface(query)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			out := make(map[string]interface{}, len(cols))
+
+			for _, col := range cols {
+				out[col.Name], err = convertValue(col, row[col.Name])
+				if err != nil {
+					return fmt.Errorf("%s.%s: %w", m.name, col.Name, err)
+				}
+			}
+
+			if err = sink.Row(out); err != nil {
+				return err
+			}
+		}
+
+		logger.WithField("rows", len(rows)).Info("Exported table")
+	}
+
+	return nil
+}
+
+// dbSink loads tables into a database. Everything is loaded in a single
+// transaction, so a failed import doesn't leave anything half done. Tables
+// are created from the current models, so they match what the plugins
+// would have created on this database.
+type dbSink struct {
+	x      *xorm.Engine
+	s      *xorm.Session
+	models map[string]*tableModel
+
+	current *tableModel
+	rows    int
+	loaded  []*tableModel
+}
+
+func newDBSink(x *xorm.Engine, prefix string) (*dbSink, error) {
+	models, err := tableModels(x, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dbSink{x: x, models: make(map[string]*tableModel)}
+
+	// Sync2 looks at the existing tables outside of any transaction, so
+	// the tables have to be created before we start one.
+	for _, m := range models {
+		if err = x.Sync2(m.bean); err != nil {
+			return nil, err
+		}
+
+		d.models[m.name] = m
+	}
+
+	d.s = x.NewSession()
+
+	if err = d.s.Begin(); err != nil {
+		d.s.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *dbSink) finishTable() {
+	if d.current != nil {
+		logrus.WithFields(logrus.Fields{
+			"table": d.current.name,
+			"rows":  d.rows,
+		}).Info("Imported table")
+	}
+
+	d.current = nil
+	d.rows = 0
+}
+
+func (d *dbSink) Table(t archiveTable) error {
+	d.finishTable()
+
+	m, ok := d.models[t.Name]
+	if !ok {
+		logrus.WithField("table", t.Name).Warn("Skipping table with no model")
+		return nil
+	}
+
+	count, err := d.s.Table(m.table).Count()
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return fmt.Errorf("table %s isn't empty", m.table)
+	}
+
+	d.current = m
+	d.loaded = append(d.loaded, m)
+
+	return nil
+}
+
+func (d *dbSink) Row(row map[string]interface{}) error {
+	if d.current == nil {
+		return nil
+	}
+
+	out := make(map[string]interface{}, len(row))
+
+	// Columns which aren't in the model any more are dropped and missing
+	// columns are left to their defaults.
+	for _, col := range d.current.info.Columns() {
+		v, ok := row[col.Name]
+		if !ok {
+			continue
+		}
+
+		var err error
+
+		out[col.Name], err = convertValue(col, v)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", d.current.name, col.Name, err)
+		}
+	}
+
+	if len(out) == 0 {
+		return nil
+	}
+
+	d.rows++
+
+	_, err := d.s.Table(d.current.table).Insert(out)
+
+	return err
+}
+
+// resetSequences moves postgres sequences past the IDs we inserted,
+// otherwise the next insert from a plugin would fail.
+func (d *dbSink) resetSequences() error {
+	if d.x.Dialect().URI().DBType != schemas.POSTGRES {
+		return nil
+	}
+
+	for _, m := range d.loaded {
+		col := m.info.AutoIncrColumn()
+		if col == nil {
+			continue
+		}
+
+		_, err := d.s.Exec(fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 0) + 1, false) FROM %s",
+			m.table, col.Name, d.x.Quote(col.Name), d.x.Quote(m.table),
+		))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close commits everything which was loaded.
+func (d *dbSink) Close() error {
+	defer d.s.Close()
+
+	d.finishTable()
+
+	if err := d.resetSequences(); err != nil {
+		_ = d.s.Rollback()
+		return err
+	}
+
+	return d.s.Commit()
+}
+
+// Rollback throws away everything which was loaded.
+func (d *dbSink) Rollback() {
+	_ = d.s.Rollback()
+	d.s.Close()
+}
+
+// load runs read into a dbSink, committing only if it succeeds.
+func load(sink *dbSink, read func(tableSink) error) error {
+	if err := read(sink); err != nil {
+		sink.Rollback()
+		return err
+	}
+
+	return sink.Close()
+}
+
+// exportArchive writes every plugin table to an archive.
+func exportArchive(b *seabird.Bot, opts *options) error {
+	format, err := archiveFormatFor(opts.format, opts.file)
+	if err != nil {
+		return err
+	}
+
+	x, prefix, err := openXormWithPrefix(b)
+	if err != nil {
+		return err
+	}
+
+	var (
+		w io.Writer = os.Stdout
+		f *os.File
+	)
+
+	if opts.file != "" && opts.file != "-" {
+		f, err = os.Create(opts.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	var sink tableSink
+
+	if format == "ndjson" {
+		sink, err = newNDJSONSink(w)
+		if err != nil {
+			return err
+		}
+	} else {
+		sink = newJSONSink(w)
+	}
+
+	if err = exportTables(x, prefix, sink); err != nil {
+		return err
+	}
+
+	if err = sink.Close(); err != nil {
+		return err
+	}
+
+	if f != nil {
+		return f.Close()
+	}
+
+	return nil
+}
+
+// importArchive loads an archive into the configured database, which must
+// not have any data in the archived tables.
+func importArchive(b *seabird.Bot, opts *options) error {
+	if opts.dryRun {
+		return errors.New("import doesn't support -dry-run")
+	}
+
+	format, err := archiveFormatFor(opts.format, opts.file)
+	if err != nil {
+		return err
+	}
+
+	x, prefix, err := openXormWithPrefix(b)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+
+	if opts.file != "" && opts.file != "-" {
+		f, err := os.Open(opts.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	read := readJSONArchive
+	if format == "ndjson" {
+		read = readNDJSONArchive
+	}
+
+	sink, err := newDBSink(x, prefix)
+	if err != nil {
+		return err
+	}
+
+	return load(sink, func(s tableSink) error {
+		return read(r, s)
+	})
+}
+
+// copyDatabase copies every plugin table from the configured database to
+// another one.
+func copyDatabase(b *seabird.Bot, opts *options) error {
+	if opts.dryRun {
+		return errors.New("copy doesn't support -dry-run")
+	}
+
+	if opts.toDriver == "" || opts.toDataSource == "" {
+		return errors.New("copy needs -to-driver and -to-datasource")
+	}
+
+	src, prefix, err := openXormWithPrefix(b)
+	if err != nil {
+		return err
+	}
+
+	dest, err := db.NewEngine(opts.toDriver, opts.toDataSource, opts.toPrefix)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	sink, err := newDBSink(dest, opts.toPrefix)
+	if err != nil {
+		return err
+	}
+
+	return load(sink, func(s tableSink) error {
+		return exportTables(src, prefix, s)
+	})
+}
@@ -1,8 +1,11 @@
 package main // import "github.com/belak/go-seabird/cmd/seabird"
 
 import (
+	"context"
 	"math/rand"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -18,6 +21,7 @@ import (
 
 	// Load the core
 	"github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func failIfErr(err error, desc string) {
@@ -26,6 +30,51 @@ func failIfErr(err error, desc string) {
 	}
 }
 
+// reload re-reads the config file and passes it to every plugin which can
+// change its settings without reconnecting.
+func reload(l *internal.Lifecycle, conf string) (*internal.ShutdownConfig, error) {
+	confReader, err := os.Open(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer confReader.Close()
+
+	// This bot is never run. It's only used for its config.
+	newBot, err := seabird.NewBot(confReader)
+	if err != nil {
+		return nil, err
+	}
+
+	shutdownConfig, err := internal.LoadShutdownConfig(newBot)
+	if err != nil {
+		return nil, err
+	}
+
+	return shutdownConfig, l.Reload(newBot)
+}
+
+// shutdown sends QUIT, waits for the server to close the connection and then
+// waits for running work to finish. done is the result of ConnectAndRun.
+func shutdown(l *internal.Lifecycle, config *internal.ShutdownConfig, done <-chan error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout.Duration)
+	defer cancel()
+
+	if err := l.Quit(config.QuitMessage); err != nil {
+		logrus.WithError(err).Warn("Failed to send QUIT")
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logrus.Warn("Server didn't close the connection in time")
+
+		_ = l.CloseConn()
+		<-done
+	}
+
+	return l.Shutdown(ctx)
+}
+
 func main() {
 	// Seed the random number generator for plugins to use.
 	rand.Seed(time.Now().UTC().UnixNano())
@@ -44,7 +93,59 @@ func main() {
 	b, err := seabird.NewBot(confReader)
 	failIfErr(err, "Failed to create new bot")
 
-	// Run the bot
-	err = b.ConnectAndRun()
-	failIfErr(err, "Failed to create run bot")
+	shutdownConfig, err := internal.LoadShutdownConfig(b)
+	failIfErr(err, "Failed to load shutdown config")
+
+	// This has to be created before the bot starts running, so we never
+	// touch the bot's context while plugins are loading.
+	lifecycle := internal.BotLifecycle(b)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	// Run the bot. We use our own connection handling so plugins can send
+	// messages before registration.
+	done := make(chan error, 1)
+
+	go func() {
+		done <- internal.ConnectAndRun(b)
+	}()
+
+	for {
+		select {
+		case err = <-done:
+			// We lost the connection, but everything still needs to be
+			// cleaned up.
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownConfig.Timeout.Duration)
+			shutdownErr := lifecycle.Shutdown(ctx)
+			cancel()
+
+			failIfErr(err, "Failed to run bot")
+			failIfErr(shutdownErr, "Failed to shut down")
+
+			return
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				logrus.Info("Reloading config")
+
+				newConfig, err := reload(lifecycle, conf)
+				if err != nil {
+					logrus.WithError(err).Error("Failed to reload config")
+				}
+
+				if newConfig != nil {
+					shutdownConfig = newConfig
+				}
+
+				continue
+			}
+
+			logrus.Infof("Got %s, shutting down", sig)
+
+			err = shutdown(lifecycle, shutdownConfig, done)
+			failIfErr(err, "Failed to shut down")
+
+			return
+		}
+	}
 }
@@ -0,0 +1,283 @@
+package adminhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/irc.v3"
+
+	seabird "github.com/belak/go-seabird"
+	channeltrack "github.com/belak/go-seabird-plugins/core/channel_track"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+func init() {
+	seabird.RegisterPlugin("admin_http", newAdminHTTPPlugin)
+}
+
+const contextKeyAdminHTTP = internal.ContextKey("seabird-admin-http")
+
+// CtxAdminHTTP returns the admin_http plugin for the bot.
+func CtxAdminHTTP(ctx context.Context) *Plugin {
+	return ctx.Value(contextKeyAdminHTTP).(*Plugin)
+}
+
+// checkTimeout is how long health checks get before they're treated as
+// failures.
+const checkTimeout = 5 * time.Second
+
+type adminHTTPConfig struct {
+	// Listen is the address to serve on.
+	Listen string
+
+	// Channels are the channels the bot has to be in before it's ready. If
+	// this is empty, the channels joined by the cmds in [core] are used.
+	Channels []string
+
+	// MaxIdle is how long we can go without hearing from the server before
+	// the connection is treated as dead. 0 disables the check.
+	MaxIdle internal.Duration
+}
+
+type coreConfig struct {
+	Cmds []string
+}
+
+// Plugin serves health checks and metrics over HTTP. /healthz fails if
+// we're not connected or any health check fails, /readyz fails until we've
+// joined every channel and /metrics is in the Prometheus text format.
+type Plugin struct {
+	ctx      context.Context
+	tracker  *channeltrack.ChannelTracker
+	metrics  *internal.Metrics
+	channels []string
+	maxIdle  time.Duration
+	listener net.Listener
+
+	lock        sync.RWMutex
+	connected   bool
+	lastMessage time.Time
+}
+
+func newAdminHTTPPlugin(b *seabird.Bot) error {
+	config := &adminHTTPConfig{
+		Listen:  "localhost:9090",
+		MaxIdle: internal.Duration{Duration: 5 * time.Minute},
+	}
+
+	// The admin_http section is optional.
+	err := internal.OptionalConfig(b, "admin_http", config)
+	if err != nil {
+		return err
+	}
+
+	if err = b.EnsurePlugin("channel_track"); err != nil {
+		return err
+	}
+
+	channels := config.Channels
+	if len(channels) == 0 {
+		core := &coreConfig{}
+		if err = b.Config("core", core); err != nil {
+			return err
+		}
+
+		channels = joinedChannels(core.Cmds)
+	}
+
+	p := &Plugin{
+		ctx:      b.Context(),
+		tracker:  channeltrack.CtxChannelTracker(b.Context()),
+		metrics:  internal.BotMetrics(b),
+		channels: channels,
+		maxIdle:  config.MaxIdle.Duration,
+	}
+
+	p.metrics.GaugeFunc("seabird_irc_connected", "Whether the bot is connected to IRC.", func() float64 {
+		if p.ircError() != nil {
+			return 0
+		}
+
+		return 1
+	})
+
+	p.metrics.GaugeFunc("seabird_irc_channels", "How many channels the bot is in.", func() float64 {
+		return float64(len(p.tracker.Channels()))
+	})
+
+	bm := b.BasicMux()
+	bm.Event("*", p.messageCallback)
+	bm.Event("001", p.connectCallback)
+	bm.Event("ERROR", p.errorCallback)
+
+	// We listen right away so a bad address stops the bot from starting.
+	p.listener, err = net.Listen("tcp", config.Listen)
+	if err != nil {
+		return fmt.Errorf("admin_http: %w", err)
+	}
+
+	logger := seabird.CtxLogger(b.Context(), "admin_http")
+	logger.Infof("Listening on %s", p.listener.Addr())
+
+	server := &http.Server{
+		Handler:     p.Handler(),
+		ReadTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := server.Serve(p.listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			logger.WithError(err).Error("Admin HTTP server stopped")
+		}
+	}()
+
+	internal.BotLifecycle(b).OnShutdown("admin_http", func(ctx context.Context) error {
+		// If requests are still running at the deadline, they're cut off.
+		if err := server.Shutdown(ctx); err != nil {
+			return server.Close()
+		}
+
+		return nil
+	})
+
+	b.SetValue(contextKeyAdminHTTP, p)
+
+	return nil
+}
+
+// joinedChannels returns every channel joined by the given commands.
+func joinedChannels(cmds []string) []string {
+	var ret []string
+
+	for _, cmd := range cmds {
+		m, err := irc.ParseMessage(cmd)
+		if err != nil || m.Command != "JOIN" || len(m.Params) == 0 {
+			continue
+		}
+
+		for _, channel := range strings.Split(m.Params[0], ",") {
+			if channel != "" && channel != "0" {
+				ret = append(ret, channel)
+			}
+		}
+	}
+
+	return ret
+}
+
+// Addr returns the address the server is listening on.
+func (p *Plugin) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+func (p *Plugin) messageCallback(r *seabird.Request) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.lastMessage = time.Now()
+}
+
+func (p *Plugin) connectCallback(r *seabird.Request) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.connected = true
+}
+
+func (p *Plugin) errorCallback(r *seabird.Request) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.connected = false
+}
+
+// ircError returns an error if we're not connected to IRC.
+func (p *Plugin) ircError() error {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if !p.connected {
+		return errors.New("not connected")
+	}
+
+	if idle := time.Since(p.lastMessage); p.maxIdle > 0 && idle > p.maxIdle {
+		return fmt.Errorf("nothing received for %s", idle.Round(time.Second))
+	}
+
+	return nil
+}
+
+// Health runs every health check, including whether we're connected to
+// IRC.
+func (p *Plugin) Health() []internal.HealthResult {
+	ctx, cancel := context.WithTimeout(p.ctx, checkTimeout)
+	defer cancel()
+
+	results := []internal.HealthResult{{Name: "irc", Err: p.ircError()}}
+
+	return append(results, internal.CheckHealth(ctx)...)
+}
+
+// Ready returns whether we're in every channel we're supposed to be.
+func (p *Plugin) Ready() []internal.HealthResult {
+	results := []internal.HealthResult{{Name: "irc", Err: p.ircError()}}
+
+	for _, channel := range p.channels {
+		var err error
+		if p.tracker.LookupChannel(channel) == nil {
+			err = errors.New("not joined")
+		}
+
+		results = append(results, internal.HealthResult{Name: channel, Err: err})
+	}
+
+	return results
+}
+
+// Handler returns the handler for every admin endpoint.
+func (p *Plugin) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		writeResults(w, p.Health())
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, req *http.Request) {
+		writeResults(w, p.Ready())
+	})
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = p.metrics.WriteTo(w)
+	})
+
+	return mux
+}
+
+// writeResults writes a line for every result. If any of them failed, the
+// status is 503.
+func writeResults(w http.ResponseWriter, results []internal.HealthResult) {
+	status := http.StatusOK
+
+	var buf strings.Builder
+
+	for _, result := range results {
+		if result.Err != nil {
+			status = http.StatusServiceUnavailable
+			fmt.Fprintf(&buf, "%s: %s\n", result.Name, result.Err)
+		} else {
+			fmt.Fprintf(&buf, "%s: ok\n", result.Name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+
+	_, _ = w.Write([]byte(buf.String()))
+}
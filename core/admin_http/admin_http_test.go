@@ -0,0 +1,84 @@
+package adminhttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+	"github.com/belak/go-seabird-plugins/testbot"
+
+	_ "github.com/belak/go-seabird-plugins/core/cap"
+	_ "github.com/belak/go-seabird-plugins/core/channel_track"
+	_ "github.com/belak/go-seabird-plugins/core/isupport"
+)
+
+const testConfig = `
+cmds = ["JOIN #seabird"]
+
+[admin_http]
+listen = "127.0.0.1:0"
+`
+
+func get(t *testing.T, url string) (int, string) {
+	res, err := http.Get(url) //nolint:gosec
+	require.NoError(t, err)
+
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return res.StatusCode, string(body)
+}
+
+func TestAdminHTTP(t *testing.T) {
+	s := testbot.Start(t, []string{"cap", "isupport", "channel_track", "admin_http"}, testConfig, func(b *seabird.Bot) {
+		internal.NewCommandMux(b).Event("echo", func(r *seabird.Request) {}, nil)
+	})
+	s.Register()
+
+	p := CtxAdminHTTP(s.Bot.Context())
+
+	base := "http://" + p.Addr().String()
+
+	status, body := get(t, base+"/healthz")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "irc: ok\n", body)
+
+	// We're connected, but not in the channel from the cmds yet.
+	status, body = get(t, base+"/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, "irc: ok\n#seabird: not joined\n", body)
+
+	s.Send(":seabird!seabird@example.com JOIN #seabird")
+	s.Send(":someone!user@example.com PRIVMSG #seabird :!echo hi")
+
+	require.Eventually(t, func() bool {
+		status, _ := get(t, base+"/readyz")
+		return status == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		_, body := get(t, base+"/metrics")
+		return strings.Contains(body, `seabird_commands_total{command="echo"} 1`)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, body = get(t, base+"/metrics")
+	require.Contains(t, body, "seabird_irc_connected 1\n")
+	require.Contains(t, body, "seabird_irc_channels 1\n")
+	require.Contains(t, body, `seabird_command_duration_seconds_count{command="echo"} 1`)
+
+	// An ERROR means the server is about to close the connection.
+	s.Send("ERROR :Closing link")
+
+	require.Eventually(t, func() bool {
+		status, _ := get(t, base+"/healthz")
+		return status == http.StatusServiceUnavailable
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -2,6 +2,14 @@ package all
 
 import (
 	// This package is used as a meta-import for all core plugins.
+	_ "github.com/belak/go-seabird-plugins/core/admin_http"
+	_ "github.com/belak/go-seabird-plugins/core/cap"
 	_ "github.com/belak/go-seabird-plugins/core/channel_track"
+	_ "github.com/belak/go-seabird-plugins/core/formatting"
+	_ "github.com/belak/go-seabird-plugins/core/ignore"
 	_ "github.com/belak/go-seabird-plugins/core/isupport"
+	_ "github.com/belak/go-seabird-plugins/core/permissions"
+	_ "github.com/belak/go-seabird-plugins/core/ratelimit"
+	_ "github.com/belak/go-seabird-plugins/core/sasl"
+	_ "github.com/belak/go-seabird-plugins/core/templates"
 )
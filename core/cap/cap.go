@@ -0,0 +1,456 @@
+// Package cap implements IRCv3 capability negotiation. Note that the package
+// name shadows the builtin, so importers will generally want to alias it.
+package cap
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+func init() {
+	seabird.RegisterPlugin("cap", newCapPlugin)
+}
+
+const contextKeyCap = internal.ContextKey("seabird-cap")
+
+// maxReqLength is how long we let the list of capabilities in a single
+// CAP REQ get, which keeps the whole line well under 512 bytes.
+const maxReqLength = 400
+
+func CtxCap(ctx context.Context) *Plugin {
+	return ctx.Value(contextKeyCap).(*Plugin)
+}
+
+// Plugin negotiates IRCv3 capabilities with the server. Other plugins should
+// call Request when they are loaded for any capabilities they want, then
+// check Enabled before relying on them.
+//
+// All public methods are safe to call from any goroutine.
+type Plugin struct {
+	lock sync.Mutex
+
+	// wanted holds everything plugins have requested.
+	wanted map[string]bool
+
+	// available maps the capabilities the server offers to their values.
+	available map[string]string
+	enabled   map[string]bool
+
+	// State for the current negotiation. We only send CAP END if we're
+	// negotiating during registration, once the full LS has come in and
+	// nothing is waiting on a reply or holding it open.
+	sentLS      bool
+	negotiating bool
+	lsDone      bool
+	pendingReqs int
+	holds       int
+
+	ackCallbacks map[string][]func(r *seabird.Request)
+	delCallbacks map[string][]func(r *seabird.Request)
+}
+
+func newCapPlugin(b *seabird.Bot) error {
+	bm := b.BasicMux()
+
+	p := &Plugin{
+		wanted: map[string]bool{
+			// cap-notify is implied by CAP LS 302, but older servers need us
+			// to ask for it.
+			"cap-notify": true,
+		},
+		available:    make(map[string]string),
+		enabled:      make(map[string]bool),
+		ackCallbacks: make(map[string][]func(r *seabird.Request)),
+		delCallbacks: make(map[string][]func(r *seabird.Request)),
+	}
+
+	// If we have access to the connection, we can start negotiating before
+	// we register, which is what the spec wants. Otherwise we fall back to
+	// starting as soon as we hear from the server.
+	if conn := internal.CtxConn(b.Context()); conn != nil {
+		conn.BeforeRegistration(p.beforeRegistration)
+	}
+
+	bm.Event("*", p.fallbackCallback)
+	bm.Event("CAP", p.capCallback)
+	bm.Event("001", p.welcomeCallback)
+	bm.Event("410", p.invalidCapCallback)
+	bm.Event("421", p.unknownCommandCallback)
+
+	b.SetValue(contextKeyCap, p)
+
+	return nil
+}
+
+// Public interfaces
+
+// Request marks the given capabilities as wanted. They will be requested
+// if the server supports them. This should be called when a plugin is
+// loaded so they can be requested while registering.
+func (p *Plugin) Request(caps ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, name := range caps {
+		p.wanted[name] = true
+	}
+}
+
+// Enabled returns true if the given capability has been acknowledged by the
+// server.
+func (p *Plugin) Enabled(name string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.enabled[name]
+}
+
+// Available returns true if the server offers the given capability.
+func (p *Plugin) Available(name string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	_, ok := p.available[name]
+
+	return ok
+}
+
+// Value returns the value the server sent for the given capability, like
+// the mechanisms for sasl. The bool will be false if the capability isn't
+// available.
+func (p *Plugin) Value(name string) (string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	ret, ok := p.available[name]
+
+	return ret, ok
+}
+
+// OnAck registers a callback for when the given capability is enabled.
+func (p *Plugin) OnAck(name string, f func(r *seabird.Request)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.ackCallbacks[name] = append(p.ackCallbacks[name], f)
+}
+
+// OnDel registers a callback for when the server removes the given
+// capability.
+func (p *Plugin) OnDel(name string, f func(r *seabird.Request)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.delCallbacks[name] = append(p.delCallbacks[name], f)
+}
+
+// Hold keeps negotiation open so registration doesn't finish. It should be
+// called from an OnAck callback for things like SASL which have to happen
+// before registration. Every Hold must be followed by a Release.
+func (p *Plugin) Hold() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.holds++
+}
+
+// Release undoes a Hold, ending negotiation if nothing else is holding it
+// open.
+func (p *Plugin) Release(r *seabird.Request) {
+	p.lock.Lock()
+	if p.holds > 0 {
+		p.holds--
+	}
+	p.lock.Unlock()
+
+	p.maybeEnd(r)
+}
+
+// Private functions
+
+func (p *Plugin) beforeRegistration() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.resetLocked()
+
+	p.sentLS = true
+	p.negotiating = true
+
+	return []string{"CAP LS 302"}
+}
+
+// resetLocked clears out the state from any previous connection. It must be
+// called with the lock held.
+func (p *Plugin) resetLocked() {
+	p.available = make(map[string]string)
+	p.enabled = make(map[string]bool)
+	p.lsDone = false
+	p.pendingReqs = 0
+	p.holds = 0
+}
+
+func (p *Plugin) fallbackCallback(r *seabird.Request) {
+	p.lock.Lock()
+
+	if p.sentLS {
+		p.lock.Unlock()
+		return
+	}
+
+	p.sentLS = true
+
+	// If this is the welcome message, registration is already done, so
+	// there's nothing to end.
+	p.negotiating = r.Message.Command != "001"
+
+	p.lock.Unlock()
+
+	r.GetLogger("cap").Debug("Starting capability negotiation late")
+
+	r.Writef("CAP LS 302")
+}
+
+func (p *Plugin) welcomeCallback(r *seabird.Request) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// Registration is done, so there's nothing left to end.
+	p.negotiating = false
+}
+
+func (p *Plugin) invalidCapCallback(r *seabird.Request) {
+	r.GetLogger("cap").WithField("params", r.Message.Params).Warn("Server rejected CAP command")
+}
+
+func (p *Plugin) unknownCommandCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 2 || r.Message.Params[1] != "CAP" {
+		return
+	}
+
+	r.GetLogger("cap").Info("Server does not support capability negotiation")
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.negotiating = false
+}
+
+// capCallback handles all the CAP subcommands.
+//
+// <client> <subcommand> [*] :<capabilities>
+func (p *Plugin) capCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 3 {
+		return
+	}
+
+	subcommand := r.Message.Params[1]
+	caps := strings.Fields(r.Message.Trailing())
+
+	// A * before the list means there are more lines coming.
+	more := len(r.Message.Params) > 3 && r.Message.Params[2] == "*"
+
+	logger := r.GetLogger("cap").WithFields(logrus.Fields{
+		"subcommand": subcommand,
+		"caps":       caps,
+	})
+
+	switch subcommand {
+	case "LS":
+		p.lsCallback(r, caps, more)
+	case "ACK":
+		logger.Info("Capabilities acknowledged")
+		p.ackCallback(r, caps)
+	case "NAK":
+		logger.Warn("Capabilities rejected")
+		p.nakCallback(r)
+	case "NEW":
+		logger.Info("New capabilities available")
+		p.newCallback(r, caps)
+	case "DEL":
+		logger.Info("Capabilities removed")
+		p.delCallback(r, caps)
+	default:
+		logger.Debug("Ignoring CAP message")
+	}
+}
+
+func (p *Plugin) lsCallback(r *seabird.Request, caps []string, more bool) {
+	p.lock.Lock()
+
+	p.addAvailableLocked(caps)
+
+	if more {
+		p.lock.Unlock()
+		return
+	}
+
+	p.lsDone = true
+
+	reqs := p.missingLocked()
+
+	p.lock.Unlock()
+
+	p.request(r, reqs)
+	p.maybeEnd(r)
+}
+
+func (p *Plugin) ackCallback(r *seabird.Request, caps []string) {
+	var callbacks []func(r *seabird.Request)
+
+	p.lock.Lock()
+
+	for _, name := range caps {
+		// A - prefix means the capability was disabled.
+		if strings.HasPrefix(name, "-") {
+			delete(p.enabled, name[1:])
+			continue
+		}
+
+		p.enabled[name] = true
+		callbacks = append(callbacks, p.ackCallbacks[name]...)
+	}
+
+	if p.pendingReqs > 0 {
+		p.pendingReqs--
+	}
+
+	p.lock.Unlock()
+
+	// Callbacks are run before we check if negotiation is done so they have
+	// a chance to Hold it.
+	for _, f := range callbacks {
+		f(r)
+	}
+
+	p.maybeEnd(r)
+}
+
+func (p *Plugin) nakCallback(r *seabird.Request) {
+	p.lock.Lock()
+
+	if p.pendingReqs > 0 {
+		p.pendingReqs--
+	}
+
+	p.lock.Unlock()
+
+	p.maybeEnd(r)
+}
+
+func (p *Plugin) newCallback(r *seabird.Request, caps []string) {
+	p.lock.Lock()
+
+	p.addAvailableLocked(caps)
+	reqs := p.missingLocked()
+
+	p.lock.Unlock()
+
+	p.request(r, reqs)
+}
+
+func (p *Plugin) delCallback(r *seabird.Request, caps []string) {
+	var callbacks []func(r *seabird.Request)
+
+	p.lock.Lock()
+
+	for _, name := range caps {
+		delete(p.available, name)
+
+		if p.enabled[name] {
+			delete(p.enabled, name)
+			callbacks = append(callbacks, p.delCallbacks[name]...)
+		}
+	}
+
+	p.lock.Unlock()
+
+	for _, f := range callbacks {
+		f(r)
+	}
+}
+
+// addAvailableLocked adds capabilities from an LS or NEW to the available
+// set. It must be called with the lock held.
+func (p *Plugin) addAvailableLocked(caps []string) {
+	for _, name := range caps {
+		var value string
+		if i := strings.IndexByte(name, '='); i != -1 {
+			name, value = name[:i], name[i+1:]
+		}
+
+		p.available[name] = value
+	}
+}
+
+// missingLocked returns the wanted capabilities which are available but not
+// enabled. It must be called with the lock held.
+func (p *Plugin) missingLocked() []string {
+	var ret []string
+
+	for name := range p.wanted {
+		if _, ok := p.available[name]; ok && !p.enabled[name] {
+			ret = append(ret, name)
+		}
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+// request sends CAP REQs for the given capabilities, split up so each line
+// stays under the length limit.
+func (p *Plugin) request(r *seabird.Request, caps []string) {
+	var lines []string
+
+	var current string
+
+	for _, name := range caps {
+		if current != "" && len(current)+1+len(name) > maxReqLength {
+			lines = append(lines, current)
+			current = ""
+		}
+
+		if current != "" {
+			current += " "
+		}
+
+		current += name
+	}
+
+	if current != "" {
+		lines = append(lines, current)
+	}
+
+	p.lock.Lock()
+	p.pendingReqs += len(lines)
+	p.lock.Unlock()
+
+	for _, line := range lines {
+		r.Writef("CAP REQ :%s", line)
+	}
+}
+
+// maybeEnd sends CAP END if we're done negotiating.
+func (p *Plugin) maybeEnd(r *seabird.Request) {
+	p.lock.Lock()
+
+	done := p.negotiating && p.lsDone && p.pendingReqs == 0 && p.holds == 0
+	if done {
+		p.negotiating = false
+	}
+
+	p.lock.Unlock()
+
+	if done {
+		r.Writef("CAP END")
+	}
+}
@@ -0,0 +1,169 @@
+package cap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+func TestNegotiation(t *testing.T) {
+	acked := make(chan struct{}, 1)
+
+	s := testbot.Start(t, []string{"cap"}, "", func(b *seabird.Bot) {
+		p := CtxCap(b.Context())
+		p.Request("multi-prefix", "sasl", "missing")
+		p.OnAck("sasl", func(r *seabird.Request) {
+			acked <- struct{}{}
+		})
+	})
+
+	// CAP LS has to come before registration.
+	s.Expect("CAP LS 302")
+	s.Expect("NICK :seabird")
+	s.Expect("USER seabird 0 * :seabird")
+
+	s.Send(
+		":irc.example.com CAP * LS * :multi-prefix cap-notify",
+		":irc.example.com CAP * LS :sasl=PLAIN,EXTERNAL away-notify",
+	)
+	s.Expect("CAP REQ :cap-notify multi-prefix sasl")
+
+	s.Send(":irc.example.com CAP * ACK :cap-notify multi-prefix sasl")
+	s.Expect("CAP END")
+
+	select {
+	case <-acked:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "ack callback not called")
+	}
+
+	p := CtxCap(s.Bot.Context())
+	require.True(t, p.Enabled("multi-prefix"))
+	require.True(t, p.Available("away-notify"))
+	require.False(t, p.Enabled("away-notify"))
+	require.False(t, p.Available("missing"))
+
+	value, ok := p.Value("sasl")
+	require.True(t, ok)
+	require.Equal(t, "PLAIN,EXTERNAL", value)
+}
+
+func TestNegotiationNak(t *testing.T) {
+	s := testbot.Start(t, []string{"cap"}, "", func(b *seabird.Bot) {
+		p := CtxCap(b.Context())
+		p.Request("multi-prefix")
+	})
+
+	s.Expect("CAP LS 302")
+	s.Expect("NICK :seabird")
+	s.Expect("USER seabird 0 * :seabird")
+
+	s.Send(":irc.example.com CAP * LS :multi-prefix")
+	s.Expect("CAP REQ :multi-prefix")
+
+	s.Send(":irc.example.com CAP * NAK :multi-prefix")
+	s.Expect("CAP END")
+
+	require.False(t, CtxCap(s.Bot.Context()).Enabled("multi-prefix"))
+}
+
+func TestHold(t *testing.T) {
+	var held *seabird.Request
+
+	s := testbot.Start(t, []string{"cap"}, "", func(b *seabird.Bot) {
+		p := CtxCap(b.Context())
+		p.Request("sasl")
+		p.OnAck("sasl", func(r *seabird.Request) {
+			p.Hold()
+			held = r
+		})
+	})
+
+	s.Expect("CAP LS 302")
+	s.Expect("NICK :seabird")
+	s.Expect("USER seabird 0 * :seabird")
+
+	s.Send(":irc.example.com CAP * LS :sasl")
+	s.Expect("CAP REQ :sasl")
+
+	// CAP END should wait until the hold is released, so the PONG has to
+	// come first.
+	s.Send(":irc.example.com CAP * ACK :sasl", "PING :sync")
+	s.Expect("PONG sync")
+
+	CtxCap(s.Bot.Context()).Release(held)
+	s.Expect("CAP END")
+}
+
+func TestNotify(t *testing.T) {
+	deleted := make(chan struct{}, 1)
+
+	s := testbot.Start(t, []string{"cap"}, "", func(b *seabird.Bot) {
+		p := CtxCap(b.Context())
+		p.Request("away-notify")
+		p.OnDel("away-notify", func(r *seabird.Request) {
+			deleted <- struct{}{}
+		})
+	})
+
+	s.Expect("CAP LS 302")
+	s.Expect("NICK :seabird")
+	s.Expect("USER seabird 0 * :seabird")
+
+	s.Send(":irc.example.com CAP * LS :cap-notify")
+	s.Expect("CAP REQ :cap-notify")
+	s.Send(":irc.example.com CAP * ACK :cap-notify")
+	s.Expect("CAP END")
+
+	s.Send(":irc.example.com 001 seabird :Welcome")
+
+	// New capabilities we want should be requested, but negotiation is
+	// already over so there's no CAP END.
+	s.Send(":irc.example.com CAP seabird NEW :away-notify")
+	s.Expect("CAP REQ :away-notify")
+	s.Send(":irc.example.com CAP seabird ACK :away-notify")
+	s.Sync()
+
+	p := CtxCap(s.Bot.Context())
+	require.True(t, p.Enabled("away-notify"))
+
+	s.Send(":irc.example.com CAP seabird DEL :away-notify")
+	s.Sync()
+
+	require.False(t, p.Enabled("away-notify"))
+	require.False(t, p.Available("away-notify"))
+
+	select {
+	case <-deleted:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "del callback not called")
+	}
+}
+
+func TestFallback(t *testing.T) {
+	// Without RunBot, the plugin doesn't have access to the connection.
+	b := testbot.NewBot(t, []string{"cap"}, "")
+	s := testbot.NewServer(t, func(conn net.Conn) error {
+		return b.Run(conn)
+	})
+
+	s.Expect("NICK :seabird")
+	s.Expect("USER seabird 0 * :seabird")
+
+	CtxCap(b.Context()).Request("multi-prefix")
+
+	// Without the connection, we start as soon as the server sends
+	// anything.
+	s.Send(":irc.example.com NOTICE * :*** Looking up your hostname")
+	s.Expect("CAP LS 302")
+
+	s.Send(":irc.example.com CAP * LS :multi-prefix")
+	s.Expect("CAP REQ :multi-prefix")
+	s.Send(":irc.example.com CAP * ACK :multi-prefix")
+	s.Expect("CAP END")
+}
@@ -0,0 +1,273 @@
+package channeltrack
+
+import (
+	"strconv"
+	"time"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+// ListEntry is a single entry in one of a channel's list modes, such as a
+// ban. Setter and Time may be empty if the server didn't tell us.
+type ListEntry struct {
+	Mask   string
+	Setter string
+	Time   time.Time
+}
+
+// Topic returns the current topic of this channel.
+func (c *Channel) Topic() string {
+	return c.topic
+}
+
+// TopicSetter returns who set the current topic, if known.
+func (c *Channel) TopicSetter() string {
+	return c.topicSetter
+}
+
+// TopicTime returns when the current topic was set, if known.
+func (c *Channel) TopicTime() time.Time {
+	return c.topicTime
+}
+
+// Modes returns all non-list modes set on this channel, mapped to their
+// parameter. Flags which don't take a parameter map to an empty string.
+func (c *Channel) Modes() map[rune]string {
+	ret := make(map[rune]string)
+	for k, v := range c.modes {
+		ret[k] = v
+	}
+
+	return ret
+}
+
+// HasMode returns true if the given non-list mode is set on this channel.
+func (c *Channel) HasMode(mode rune) bool {
+	_, ok := c.modes[mode]
+	return ok
+}
+
+// Key returns the channel key (+k) or an empty string if none is set.
+func (c *Channel) Key() string {
+	return c.modes['k']
+}
+
+// List returns the entries for the given list mode.
+func (c *Channel) List(mode rune) []ListEntry {
+	return append([]ListEntry(nil), c.lists[mode]...)
+}
+
+// Bans returns the channel ban list (+b).
+func (c *Channel) Bans() []ListEntry {
+	return c.List('b')
+}
+
+// BanExceptions returns the channel ban exception list (+e).
+func (c *Channel) BanExceptions() []ListEntry {
+	return c.List('e')
+}
+
+// InviteExceptions returns the channel invite exception list (+I).
+func (c *Channel) InviteExceptions() []ListEntry {
+	return c.List('I')
+}
+
+// applyMode updates the channel state for a single non-prefix mode change.
+func (c *trackedChannel) applyMode(change modeChange, setter string, now time.Time) {
+	switch change.Type {
+	case modeTypeList:
+		if change.Adding {
+			c.lists[change.Mode] = append(c.lists[change.Mode], ListEntry{
+				Mask:   change.Param,
+				Setter: setter,
+				Time:   now,
+			})
+
+			return
+		}
+
+		var entries []ListEntry
+
+		for _, entry := range c.lists[change.Mode] {
+			if entry.Mask != change.Param {
+				entries = append(entries, entry)
+			}
+		}
+
+		c.lists[change.Mode] = entries
+	case modeTypePrefix:
+		// Prefix modes are tracked on the user
+	default:
+		if change.Adding {
+			c.modes[change.Mode] = change.Param
+		} else {
+			delete(c.modes, change.Mode)
+		}
+	}
+}
+
+// channelModeCallback handles RPL_CHANNELMODEIS, which is the reply to the
+// MODE query we send on join.
+//
+// <client> <channel> <modestring> <mode arguments>...
+func (p *ChannelTracker) channelModeCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 3 {
+		return
+	}
+
+	channel := r.Message.Params[1]
+
+	changes := p.parseModeParams(r.Message.Params[2], r.Message.Params[3:])
+
+	p.update(func() {
+		c := p.lookupChannel(channel)
+		if c == nil {
+			return
+		}
+
+		// This is the full set of modes, so anything we had before is stale.
+		c.modes = make(map[rune]string)
+
+		for _, change := range changes {
+			c.applyMode(change, "", time.Time{})
+		}
+	})
+}
+
+func (p *ChannelTracker) topicCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 1 {
+		return
+	}
+
+	channel := r.Message.Params[0]
+
+	var topic string
+	if len(r.Message.Params) > 1 {
+		topic = r.Message.Trailing()
+	}
+
+	p.setTopic(channel, topic, r.Message.Prefix.String(), time.Now())
+}
+
+// noTopicCallback handles RPL_NOTOPIC.
+//
+// <client> <channel> :No topic is set
+func (p *ChannelTracker) noTopicCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 2 {
+		return
+	}
+
+	p.setTopic(r.Message.Params[1], "", "", time.Time{})
+}
+
+// topicReplyCallback handles RPL_TOPIC. The setter and time come separately
+// in RPL_TOPICWHOTIME, so they're cleared here.
+//
+// <client> <channel> :<topic>
+func (p *ChannelTracker) topicReplyCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 3 {
+		return
+	}
+
+	p.setTopic(r.Message.Params[1], r.Message.Trailing(), "", time.Time{})
+}
+
+// topicWhoTimeCallback handles RPL_TOPICWHOTIME.
+//
+// <client> <channel> <nick> <setat>
+func (p *ChannelTracker) topicWhoTimeCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 4 {
+		return
+	}
+
+	channel := r.Message.Params[1]
+	setter := r.Message.Params[2]
+	setAt := parseUnixTime(r.Message.Params[3])
+
+	p.update(func() {
+		c := p.lookupChannel(channel)
+		if c == nil {
+			return
+		}
+
+		c.topicSetter = setter
+		c.topicTime = setAt
+	})
+}
+
+func (p *ChannelTracker) setTopic(channel, topic, setter string, setAt time.Time) {
+	p.update(func() {
+		c := p.lookupChannel(channel)
+		if c == nil {
+			return
+		}
+
+		c.topic = topic
+		c.topicSetter = setter
+		c.topicTime = setAt
+	})
+}
+
+// listEntryCallback returns a handler for the numeric used to send entries in
+// the given list mode.
+//
+// <client> <channel> <mask> [<who> <set-ts>]
+func (p *ChannelTracker) listEntryCallback(mode rune) seabird.HandlerFunc {
+	return func(r *seabird.Request) {
+		if len(r.Message.Params) < 3 {
+			return
+		}
+
+		channel := r.Message.Params[1]
+		entry := ListEntry{Mask: r.Message.Params[2]}
+
+		if len(r.Message.Params) >= 5 {
+			entry.Setter = r.Message.Params[3]
+			entry.Time = parseUnixTime(r.Message.Params[4])
+		}
+
+		p.update(func() {
+			c := p.lookupChannel(channel)
+			if c == nil {
+				return
+			}
+
+			c.listBuffers[mode] = append(c.listBuffers[mode], entry)
+		})
+	}
+}
+
+// endOfListCallback returns a handler for the numeric which ends the given
+// list mode. It replaces the list with everything we got since the last one.
+//
+// <client> <channel> :End of list
+func (p *ChannelTracker) endOfListCallback(mode rune) seabird.HandlerFunc {
+	return func(r *seabird.Request) {
+		if len(r.Message.Params) < 2 {
+			return
+		}
+
+		channel := r.Message.Params[1]
+
+		p.update(func() {
+			c := p.lookupChannel(channel)
+			if c == nil {
+				return
+			}
+
+			c.lists[mode] = c.listBuffers[mode]
+			delete(c.listBuffers, mode)
+		})
+	}
+}
+
+// parseUnixTime converts a timestamp from a numeric into a time.Time,
+// returning the zero time if it's invalid.
+func parseUnixTime(raw string) time.Time {
+	ts, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(ts, 0)
+}
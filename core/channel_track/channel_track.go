@@ -2,13 +2,17 @@ package channeltrack
 
 import (
 	"context"
-	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	irc "gopkg.in/irc.v3"
 
 	seabird "github.com/belak/go-seabird"
+	capPlugin "github.com/belak/go-seabird-plugins/core/cap"
 	"github.com/belak/go-seabird-plugins/core/isupport"
 	"github.com/belak/go-seabird-plugins/internal"
 )
@@ -19,44 +23,108 @@ func init() {
 
 const contextKeyChannelTracker = internal.ContextKey("seabird-channel-tracker")
 
+// whoxToken is used to recognize replies to the WHOX requests we send.
+const whoxToken = "152"
+
 func CtxChannelTracker(ctx context.Context) *ChannelTracker {
 	return ctx.Value(contextKeyChannelTracker).(*ChannelTracker)
 }
 
-// Channel is an internal type for representing a channel.
+// Channel is a snapshot of a channel the bot is in. It will not change
+// after it has been returned, so it is safe to use from any goroutine.
 type Channel struct {
+	name  string
 	users map[string]bool
+	nicks []string
+
+	// foldedNicks is the set of nicks in the channel, case folded using the
+	// server's CASEMAPPING.
+	foldedNicks map[string]bool
+	fold        func(string) string
+
+	topic       string
+	topicSetter string
+	topicTime   time.Time
+
+	modes map[rune]string
+	lists map[rune][]ListEntry
 }
 
-// HasUser returns true if the user is in the channel, otherwise
-// false.
-func (c *Channel) HasUser(user string) bool {
-	return c.users[user]
+// Name returns the name of this channel.
+func (c *Channel) Name() string {
+	return c.name
+}
+
+// Users returns a sorted list of the nicks in this channel.
+func (c *Channel) Users() []string {
+	return append([]string(nil), c.nicks...)
+}
+
+// HasUser returns true if the user with the given UUID is in the
+// channel, otherwise false.
+func (c *Channel) HasUser(userUUID string) bool {
+	return c.users[userUUID]
 }
 
-// User is an type for representing a user.
+// HasNick returns true if a user with the given nick is in the channel,
+// otherwise false.
+func (c *Channel) HasNick(nick string) bool {
+	return c.foldedNicks[c.fold(nick)]
+}
+
+// User is a snapshot of a user the bot can see. It will not change after it
+// has been returned, so it is safe to use from any goroutine. The UUID will
+// stay the same for this user even if they change nicks, so it can be used to
+// look them up again later.
+//
+// Ident, Host and RealName are filled in from JOINs and WHO replies. Account
+// and away status are only kept up to date if the server supports WHOX and
+// the extended-join, account-notify, away-notify and chghost capabilities.
+// Account will be empty if the user is not logged in or if we don't know.
+// Bot is only known if the server advertises its bot mode with BOT and
+// includes it in WHO replies.
 type User struct {
-	channels map[string]map[rune]bool
-	Nick     string
-	UUID     string
+	// channels is keyed on the case folded channel name. channelNames
+	// holds the names as we first saw them.
+	channels     map[string]map[rune]bool
+	channelNames []string
+	fold         func(string) string
+
+	Nick string
+	UUID string
+
+	Ident    string
+	Host     string
+	RealName string
+	Account  string
+
+	Away        bool
+	AwayMessage string
+
+	Bot bool
 }
 
-// Channels returns which channels the user is currently in.
-func (u *User) Channels() []string {
-	var ret []string
-	for k := range u.channels {
-		ret = append(ret, k)
+// Hostmask returns the nick!ident@host form of this user. If we haven't
+// seen the ident or host yet, only the nick is returned.
+func (u *User) Hostmask() string {
+	if u.Ident == "" || u.Host == "" {
+		return u.Nick
 	}
 
-	return ret
+	return u.Nick + "!" + u.Ident + "@" + u.Host
+}
+
+// Channels returns a sorted list of channels the user is currently in.
+func (u *User) Channels() []string {
+	return append([]string(nil), u.channelNames...)
 }
 
 // ModesInChannel returns a mapping of channel modes to a bool indicating if
 // it's on or not for this user in this channel.
 func (u *User) ModesInChannel(channel string) map[rune]bool {
-	ret, ok := u.channels[channel]
-	if !ok {
-		ret = make(map[rune]bool)
+	ret := make(map[rune]bool)
+	for k, v := range u.channels[u.fold(channel)] {
+		ret[k] = v
 	}
 
 	return ret
@@ -65,33 +133,110 @@ func (u *User) ModesInChannel(channel string) map[rune]bool {
 // InChannel returns true if the user is in the channel, otherwise
 // false.
 func (u *User) InChannel(channel string) bool {
-	_, ok := u.channels[channel]
+	_, ok := u.channels[u.fold(channel)]
 	return ok
 }
 
+// trackedChannel is the internal, mutable representation of a channel.
+type trackedChannel struct {
+	// name is the name of the channel as we first saw it. The tracker's
+	// channels map is keyed on the case folded name.
+	name  string
+	users map[string]bool
+
+	topic       string
+	topicSetter string
+	topicTime   time.Time
+
+	// modes holds every non-list channel mode which is set, mapped to its
+	// parameter (or an empty string for flags).
+	modes map[rune]string
+
+	// lists holds list modes like bans. Replies to list queries are
+	// collected in listBuffers until the end of the list so a refresh
+	// replaces the whole list.
+	lists       map[rune][]ListEntry
+	listBuffers map[rune][]ListEntry
+}
+
+// trackedUser is the internal, mutable representation of a user.
+type trackedUser struct {
+	// channels is keyed on the case folded channel name.
+	channels map[string]map[rune]bool
+	nick     string
+	uuid     string
+
+	ident    string
+	host     string
+	realName string
+	account  string
+
+	away        bool
+	awayMessage string
+
+	bot bool
+}
+
+type trackerConfig struct {
+	// SplitTimeout is how long to hold on to the sessions of users lost in
+	// a netsplit before they are considered gone.
+	SplitTimeout internal.Duration
+
+	// SplitNotices enables a notice to affected channels summarizing how
+	// many users split and rejoined.
+	SplitNotices bool
+}
+
 // ChannelTracker is a simple plugin which is only meant to track what
 // channels the bot is in, and what users are in a channel. It also
 // provides a uuid mapping to a user, so if a user's nick changes,
 // we'll still have a sort of "session" to keep track of them.
+//
+// All public methods are safe to call from any goroutine.
 type ChannelTracker struct {
 	// Notes for internal fields. Be very careful when modifying the
 	// state. Because we control all of this, it is valid to make the
 	// assumption that if a user is in p.uuids, it will be possible to
-	// find them in p.users.
+	// find them in p.users. All of these must only be accessed while
+	// holding lock.
+	lock sync.RWMutex
+
+	// All nicks and channel names used as keys are case folded using
+	// isupport, so lookups follow the server's CASEMAPPING.
+	isupport *isupport.Plugin
 
 	// Channels can't be renamed, so it's just a mapping of name to
 	// channel object.
-	channels map[string]*Channel
+	channels map[string]*trackedChannel
 
 	// Users can be renamed so we key them on uuid. There's also a
 	// separate nick to uuid mapping.
-	users map[string]*User
+	users map[string]*trackedUser
 
 	// This simply maps the nick to the uuid
 	uuids map[string]string
 
-	// Session cleanup callbacks
+	// Session cleanup callbacks and the sessions which have been removed
+	// since they were last run.
 	cleanupCallbacks []func(u *User)
+	pendingCleanup   []*User
+
+	// Sessions lost in netsplits, keyed on the servers which split and on
+	// the case folded nick.
+	splits     map[string]*netsplit
+	splitUsers map[string]*netsplit
+
+	// Netsplits with a notice waiting to be sent. A split can end before
+	// its last notice goes out, so these are tracked separately.
+	splitNotices map[*netsplit]bool
+
+	config    *trackerConfig
+	lifecycle *internal.Lifecycle
+
+	// Presence event handlers and the events which have been queued since
+	// they were last dispatched.
+	subs          subscriptions
+	pendingEvents []func()
 }
 
 func newChannelTracker(b *seabird.Bot) error {
@@ -102,10 +247,43 @@ func newChannelTracker(b *seabird.Bot) error {
 		return err
 	}
 
+	err = b.EnsurePlugin("cap")
+	if err != nil {
+		return err
+	}
+
+	// These all let us keep user and channel state up to date without
+	// having to ask the server.
+	capPlugin.CtxCap(b.Context()).Request(
+		"extended-join",
+		"account-notify",
+		"away-notify",
+		"chghost",
+		"multi-prefix",
+		"userhost-in-names",
+	)
+
+	config := &trackerConfig{
+		SplitTimeout: internal.Duration{Duration: 15 * time.Minute},
+	}
+
+	// The channel_track section is optional.
+	err = internal.OptionalConfig(b, "channel_track", config)
+	if err != nil {
+		return err
+	}
+
 	p := &ChannelTracker{
-		channels: make(map[string]*Channel),
-		users:    make(map[string]*User),
-		uuids:    make(map[string]string),
+		config:     config,
+		lifecycle:  internal.BotLifecycle(b),
+		isupport:   isupport.CtxISupport(b.Context()),
+		channels:   make(map[string]*trackedChannel),
+		users:      make(map[string]*trackedUser),
+		uuids:      make(map[string]string),
+		splits:     make(map[string]*netsplit),
+		splitUsers: make(map[string]*netsplit),
+
+		splitNotices: make(map[*netsplit]bool),
 	}
 
 	bm.Event("JOIN", p.joinCallback)
@@ -115,290 +293,785 @@ func newChannelTracker(b *seabird.Bot) error {
 	bm.Event("NICK", p.nickCallback)
 	bm.Event("MODE", p.modeCallback)
 
+	// IRCv3 extensions
+	bm.Event("ACCOUNT", p.accountCallback)
+	bm.Event("AWAY", p.awayCallback)
+	bm.Event("CHGHOST", p.chghostCallback)
+
+	bm.Event("TOPIC", p.topicCallback)
+
 	bm.Event("352", p.whoCallback)
+	bm.Event("354", p.whoxCallback)
 	bm.Event("353", p.namesCallback)
 	bm.Event("366", p.endOfNamesCallback)
 
+	bm.Event("324", p.channelModeCallback)
+	bm.Event("331", p.noTopicCallback)
+	bm.Event("332", p.topicReplyCallback)
+	bm.Event("333", p.topicWhoTimeCallback)
+
+	// Ban, ban exception and invite exception lists
+	bm.Event("367", p.listEntryCallback('b'))
+	bm.Event("368", p.endOfListCallback('b'))
+	bm.Event("348", p.listEntryCallback('e'))
+	bm.Event("349", p.endOfListCallback('e'))
+	bm.Event("346", p.listEntryCallback('I'))
+	bm.Event("347", p.endOfListCallback('I'))
+
 	b.SetValue(contextKeyChannelTracker, p)
 
+	p.lifecycle.OnShutdown("channel_track", func(ctx context.Context) error {
+		p.stopSplitTimers()
+		return nil
+	})
+
+	// We see our own hostmask when we join a channel, which lets replies be
+	// split up without wasting space.
+	internal.SetHostmaskLookup(b, func(nick string) string {
+		if u := p.LookupUser(nick); u != nil {
+			return u.Hostmask()
+		}
+
+		return ""
+	})
+
 	return nil
 }
 
 // Public interfaces
 
-// LookupUser will return the User object for the given nick or nil if
-// we don't know about this user. The returned value can be stored and
-// will track this user even if they change nicks.
+// LookupUser will return a snapshot of the User with the given nick or nil
+// if we don't know about this user. The UUID of the returned value can be
+// stored and passed to LookupUserByUUID to find this user again, even if they
+// change nicks.
 func (p *ChannelTracker) LookupUser(user string) *User {
-	userUUID, ok := p.uuids[user]
-	if !ok {
-		return nil
-	}
+	p.lock.RLock()
+	defer p.lock.RUnlock()
 
-	return p.users[userUUID]
+	return p.snapshotUser(p.lookupUser(user))
 }
 
-// UsersInChannel will return all the users in the given channel name
-// or nil if we're not in that channel.
+// LookupUserByUUID will return a snapshot of the User with the given UUID or
+// nil if that session no longer exists.
+func (p *ChannelTracker) LookupUserByUUID(userUUID string) *User {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.snapshotUser(p.users[userUUID])
+}
+
+// UsersInChannel will return snapshots of all the users in the given
+// channel name, sorted by nick, or nil if we're not in that channel.
 func (p *ChannelTracker) UsersInChannel(channel string) []*User {
-	c := p.LookupChannel(channel)
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	c := p.lookupChannel(channel)
 	if c == nil {
 		return nil
 	}
 
 	var ret []*User
 	for userUUID := range c.users {
-		ret = append(ret, p.users[userUUID])
+		ret = append(ret, p.snapshotUser(p.users[userUUID]))
 	}
 
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Nick < ret[j].Nick
+	})
+
 	return ret
 }
 
-// LookupChannel will return the Channel object for the given channel
-// name or nil if we're not in that channel.
+// LookupChannel will return a snapshot of the Channel with the given name
+// or nil if we're not in that channel.
 func (p *ChannelTracker) LookupChannel(channel string) *Channel {
-	return p.channels[channel]
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.snapshotChannel(p.lookupChannel(channel))
 }
 
-// Channels will return all the channel objects this bot knows about.
+// Channels will return snapshots of all the channels this bot knows about,
+// sorted by name.
 func (p *ChannelTracker) Channels() []*Channel {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
 	var ret []*Channel
 	for _, v := range p.channels {
-		ret = append(ret, v)
+		ret = append(ret, p.snapshotChannel(v))
 	}
 
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].name < ret[j].name
+	})
+
 	return ret
 }
 
 // RegisterSessionCleanupCallback lets you register a function to be
-// called when a session is removed.
+// called when a session is removed. The given User is the last snapshot
+// of that session before it was removed. Sessions lost in a netsplit are
+// only removed once the split times out.
 func (p *ChannelTracker) RegisterSessionCleanupCallback(f func(u *User)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
 	p.cleanupCallbacks = append(p.cleanupCallbacks, f)
 }
 
 // Private functions
 
+// update runs f with the state locked for writing and then runs any events
+// and session cleanup callbacks which were queued while it was locked. The
+// callbacks are run after the lock has been released so they can query the
+// tracker.
+func (p *ChannelTracker) update(f func()) {
+	p.lock.Lock()
+
+	f()
+
+	events := p.pendingEvents
+	cleanup := p.pendingCleanup
+	callbacks := p.cleanupCallbacks
+	p.pendingEvents = nil
+	p.pendingCleanup = nil
+
+	p.lock.Unlock()
+
+	for _, e := range events {
+		e()
+	}
+
+	for _, u := range cleanup {
+		for _, f := range callbacks {
+			f(u)
+		}
+	}
+}
+
+// snapshotUser needs access to the tracker to resolve channel names, so it
+// must be called with the lock held.
+func (p *ChannelTracker) snapshotUser(u *trackedUser) *User {
+	if u == nil {
+		return nil
+	}
+
+	ret := &User{
+		fold:        p.fold,
+		Nick:        u.nick,
+		UUID:        u.uuid,
+		Ident:       u.ident,
+		Host:        u.host,
+		RealName:    u.realName,
+		Account:     u.account,
+		Away:        u.away,
+		AwayMessage: u.awayMessage,
+		Bot:         u.bot,
+		channels:    make(map[string]map[rune]bool),
+	}
+
+	for channel, modes := range u.channels {
+		ret.channels[channel] = make(map[rune]bool)
+		for k, v := range modes {
+			ret.channels[channel][k] = v
+		}
+
+		name := channel
+		if c := p.channels[channel]; c != nil {
+			name = c.name
+		}
+
+		ret.channelNames = append(ret.channelNames, name)
+	}
+
+	sort.Strings(ret.channelNames)
+
+	return ret
+}
+
+// snapshotChannel needs access to the tracker to resolve nicks, so it must be
+// called with the lock held.
+func (p *ChannelTracker) snapshotChannel(c *trackedChannel) *Channel {
+	if c == nil {
+		return nil
+	}
+
+	ret := &Channel{
+		name:        c.name,
+		users:       make(map[string]bool),
+		foldedNicks: make(map[string]bool),
+		fold:        p.fold,
+		topic:       c.topic,
+		topicSetter: c.topicSetter,
+		topicTime:   c.topicTime,
+		modes:       make(map[rune]string),
+		lists:       make(map[rune][]ListEntry),
+	}
+
+	for k, v := range c.modes {
+		ret.modes[k] = v
+	}
+
+	for k, v := range c.lists {
+		ret.lists[k] = append([]ListEntry(nil), v...)
+	}
+
+	for userUUID := range c.users {
+		nick := p.users[userUUID].nick
+
+		ret.users[userUUID] = true
+		ret.nicks = append(ret.nicks, nick)
+		ret.foldedNicks[p.fold(nick)] = true
+	}
+
+	sort.Strings(ret.nicks)
+
+	return ret
+}
+
+// fold returns the key used for a nick or channel name in the tracker's
+// maps, based on the server's CASEMAPPING.
+func (p *ChannelTracker) fold(name string) string {
+	return p.isupport.CaseFold(name)
+}
+
+func (p *ChannelTracker) isCurrentNick(r *seabird.Request, nick string) bool {
+	return p.fold(nick) == p.fold(r.CurrentNick())
+}
+
+func (p *ChannelTracker) lookupChannel(channel string) *trackedChannel {
+	return p.channels[p.fold(channel)]
+}
+
+func (p *ChannelTracker) lookupUser(user string) *trackedUser {
+	userUUID, ok := p.uuids[p.fold(user)]
+	if !ok {
+		return nil
+	}
+
+	return p.users[userUUID]
+}
+
 func (p *ChannelTracker) joinCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 1 {
+		return
+	}
+
 	user := r.Message.Prefix.Name
-	channel := r.Message.Trailing()
+	channel := r.Message.Params[0]
+
+	p.update(func() {
+		// If this user was lost in a netsplit, they should get their old
+		// session back.
+		p.restoreSplitUser(r, user)
+
+		p.addUserToChannel(r, user, channel)
+
+		u := p.lookupUser(user)
+		if u == nil {
+			return
+		}
+
+		u.ident = r.Message.Prefix.User
+		u.host = r.Message.Prefix.Host
+
+		// With extended-join, we also get the account name and real name.
+		// An account of * means they aren't logged in.
+		if len(r.Message.Params) >= 3 {
+			u.account = normalizeAccount(r.Message.Params[1], "*")
+			u.realName = r.Message.Params[2]
+		}
+
+		snapshot := p.snapshotUser(u)
+
+		p.emitUserJoined(r, &UserJoinedEvent{
+			User:    snapshot,
+			Channel: channel,
+			Actor:   snapshot,
+		})
+
+		if p.isCurrentNick(r, user) {
+			p.emitBotJoinedChannel(r, &BotJoinedChannelEvent{
+				User:    snapshot,
+				Channel: channel,
+				Actor:   snapshot,
+			})
+		}
+	})
+
+	// When we join a channel we need to look up everyone in it to get their
+	// hostmasks and accounts. WHOX lets us get everything in one request.
+	// We also need the channel modes and lists, as the topic is the only
+	// thing the server sends us on its own.
+	if p.isCurrentNick(r, user) {
+		if p.isupport.IsEnabled("WHOX") {
+			r.Writef("WHO %s %%tcuhnfar,%s", channel, whoxToken)
+		} else {
+			r.Writef("WHO %s", channel)
+		}
 
-	p.addUserToChannel(r, user, channel)
+		r.Writef("MODE %s", channel)
+		r.Writef("MODE %s +b", channel)
 
-	//fmt.Printf("%s (%s) joined %s\n", user, p.uuids[user], channel)
-} //nolint:wsl
+		if p.isupport.IsEnabled("EXCEPTS") {
+			r.Writef("MODE %s +e", channel)
+		}
+
+		if p.isupport.IsEnabled("INVEX") {
+			r.Writef("MODE %s +I", channel)
+		}
+	}
+}
 
 func (p *ChannelTracker) partCallback(r *seabird.Request) {
 	user := r.Message.Prefix.Name
 	channel := r.Message.Params[0]
 
-	p.removeUserFromChannel(r, user, channel)
+	var reason string
+	if len(r.Message.Params) > 1 {
+		reason = r.Message.Params[1]
+	}
+
+	p.update(func() {
+		if u := p.lookupUser(user); u != nil && u.channels[p.fold(channel)] != nil {
+			snapshot := p.snapshotUser(u)
+
+			p.emitUserParted(r, &UserPartedEvent{
+				User:    snapshot,
+				Channel: channel,
+				Actor:   snapshot,
+				Reason:  reason,
+			})
+		}
 
-	//fmt.Printf("%s (%s) left %s\n", user, p.uuids[user], channel)
-} //nolint:wsl
+		p.removeUserFromChannel(r, user, channel)
+	})
+}
 
 func (p *ChannelTracker) kickCallback(r *seabird.Request) {
 	//actor := m.Prefix.Name
 	user := r.Message.Params[1]
 	channel := r.Message.Params[0]
 
-	p.removeUserFromChannel(r, user, channel)
+	var reason string
+	if len(r.Message.Params) > 2 {
+		reason = r.Message.Params[2]
+	}
 
-	//fmt.Printf("%s (%s) kicked %s (%s) from %s\n", actor, p.uuids[actor], user, p.uuids[user], channel)
-} //nolint:wsl
+	p.update(func() {
+		if u := p.lookupUser(user); u != nil && u.channels[p.fold(channel)] != nil {
+			p.emitUserKicked(r, &UserKickedEvent{
+				User:    p.snapshotUser(u),
+				Channel: channel,
+				Actor:   p.actor(r),
+				Reason:  reason,
+			})
+		}
+
+		p.removeUserFromChannel(r, user, channel)
+	})
+}
 
 func (p *ChannelTracker) quitCallback(r *seabird.Request) {
 	user := r.Message.Prefix.Name
 
-	p.removeUser(r, user)
+	var reason string
+	if len(r.Message.Params) > 0 {
+		reason = r.Message.Trailing()
+	}
 
-	//fmt.Printf("%s (%s) quit\n", user, p.uuids[user])
-} //nolint:wsl
+	split := isNetsplitQuit(reason)
+
+	p.update(func() {
+		if u := p.lookupUser(user); u != nil {
+			snapshot := p.snapshotUser(u)
+
+			p.emitUserQuit(r, &UserQuitEvent{
+				User:   snapshot,
+				Actor:  snapshot,
+				Reason: reason,
+				Split:  split,
+			})
+		}
+
+		if split {
+			p.splitUser(r, user, reason)
+		} else {
+			p.removeUser(r, user)
+		}
+	})
+}
 
 func (p *ChannelTracker) nickCallback(r *seabird.Request) {
 	oldUser := r.Message.Prefix.Name
 	newUser := r.Message.Params[0]
 
-	p.renameUser(r, oldUser, newUser)
+	p.update(func() {
+		p.renameUser(r, oldUser, newUser)
+
+		if u := p.lookupUser(newUser); u != nil {
+			snapshot := p.snapshotUser(u)
 
-	//fmt.Printf("%s (%s) changed their name to %s\n", oldUser, p.uuids[newUser], newUser)
-} //nolint:wsl
+			p.emitNickChanged(r, &NickChangedEvent{
+				User:    snapshot,
+				OldNick: oldUser,
+				Actor:   snapshot,
+			})
+		}
+	})
+}
 
 func (p *ChannelTracker) modeCallback(r *seabird.Request) {
-	// We only care about MODE messages where a specific user is
-	// changed.
-	if len(r.Message.Params) < 3 {
+	// We mostly care about MODE messages for channels we're in. User modes
+	// (such as the bot's own +i) are targeted at a nick and only the bot
+	// mode is tracked.
+	if len(r.Message.Params) < 2 {
 		return
 	}
 
-	logger := r.GetLogger("channel_track")
+	if !p.isupport.IsChannel(r.Message.Params[0]) {
+		p.userModeCallback(r)
+		return
+	}
 
-	channel := r.Message.Params[0]
-	target := r.Message.Params[2]
+	changes := p.parseModeParams(r.Message.Params[1], r.Message.Params[2:])
 
-	// Ensure we know about this user and this channel
-	u := p.LookupUser(target)
-	c := p.LookupChannel(channel)
+	logger := r.GetLogger("channel_track")
 
-	if u == nil || c == nil {
-		logger.Warnf("Got MODE callback for %s on %s but we aren't tracking both", target, channel)
-		return
-	}
+	channel := r.Message.Params[0]
 
-	// Just send a WHO request and clear out the modes for this user because
-	// mode parsing is hard.
-	u.channels[channel] = make(map[rune]bool)
+	p.update(func() {
+		c := p.lookupChannel(channel)
+		if c == nil {
+			return
+		}
 
-	r.Writef("WHO :%s", target)
+		actor := p.actor(r)
+
+		for _, change := range changes {
+			event := &ModeChangedEvent{
+				Channel: channel,
+				Actor:   actor,
+				Adding:  change.Adding,
+				Mode:    change.Mode,
+				Param:   change.Param,
+			}
+
+			// Only membership modes are tracked on the user. Everything else
+			// is a channel setting.
+			if change.Type != modeTypePrefix {
+				c.applyMode(change, r.Message.Prefix.String(), time.Now())
+				p.emitModeChanged(r, event)
+
+				continue
+			}
+
+			u := p.lookupUser(change.Param)
+			if u == nil || u.channels[p.fold(channel)] == nil {
+				logger.Warnf("Got MODE callback for %s on %s but we aren't tracking both", change.Param, channel)
+				continue
+			}
+
+			if change.Adding {
+				u.channels[p.fold(channel)][change.Mode] = true
+			} else {
+				delete(u.channels[p.fold(channel)], change.Mode)
+			}
+
+			event.User = p.snapshotUser(u)
+			p.emitModeChanged(r, event)
+
+			logger.WithFields(logrus.Fields{
+				"user":    change.Param,
+				"channel": channel,
+				"modes":   u.channels[p.fold(channel)],
+			}).Debug("User modes updated")
+		}
+	})
 }
 
-func (p *ChannelTracker) whoCallback(r *seabird.Request) {
-	// Filter out broken messages
-	if len(r.Message.Params) < 7 {
+// userModeCallback tracks the bot mode being set or unset on a user. Servers
+// usually only tell us about our own user modes.
+func (p *ChannelTracker) userModeCallback(r *seabird.Request) {
+	botMode := p.isupport.BotMode()
+	if botMode == 0 {
 		return
 	}
 
-	prefixes, ok := p.getSymbolToPrefixMapping(r)
-	if !ok {
-		return
-	}
-
-	var (
-		channel = r.Message.Params[0]
-		nick    = r.Message.Params[4]
-		modes   = r.Message.Params[5]
-	)
+	nick := r.Message.Params[0]
 
-	logger := r.GetLogger("channel_track")
+	p.update(func() {
+		u := p.lookupUser(nick)
+		if u == nil {
+			return
+		}
 
-	u := p.LookupUser(nick)
-	c := p.LookupChannel(channel)
+		adding := true
+
+		for _, mode := range r.Message.Params[1] {
+			switch mode {
+			case '+':
+				adding = true
+			case '-':
+				adding = false
+			case botMode:
+				u.bot = adding
+			}
+		}
+	})
+}
 
-	if u == nil || c == nil {
-		logger.Warnf("Got WHO callback for %s on %s but we aren't tracking both", nick, channel)
+func (p *ChannelTracker) accountCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 1 {
 		return
 	}
 
-	// Modes starts with H/G for here/gone, so we skip that because we don't
-	// care too much about tracking it for now.
-	userPrefixes := modes[1:]
+	nick := r.Message.Prefix.Name
 
-	// Clear out the modes and reset them
-	u.channels[channel] = make(map[rune]bool)
+	p.update(func() {
+		u := p.lookupUser(nick)
+		if u == nil {
+			return
+		}
 
-	for _, v := range userPrefixes {
-		mode := prefixes[v]
-		u.channels[channel][mode] = true
-	}
+		u.account = normalizeAccount(r.Message.Params[0], "*")
+	})
 }
 
-// getSymbolToPrefixMapping gets the isupport info from the bot and
-// parses prefix into a mapping of the symbol to the mode. Eventually
-// this should be moved into the isupport plugin with a few more prefix
-// helper functions.
-func (p *ChannelTracker) getSymbolToPrefixMapping(r *seabird.Request) (map[rune]rune, bool) {
-	logger := r.GetLogger("channel_track")
+func (p *ChannelTracker) awayCallback(r *seabird.Request) {
+	nick := r.Message.Prefix.Name
 
-	isupportPlugin := isupport.CtxISupport(r.Context())
+	p.update(func() {
+		u := p.lookupUser(nick)
+		if u == nil {
+			return
+		}
 
-	// Sample: (qaohv)~&@%+
-	prefix, _ := isupportPlugin.GetRaw("PREFIX")
+		// An AWAY with no message means they came back.
+		u.away = len(r.Message.Params) > 0
+		u.awayMessage = ""
 
-	logger = logger.WithField("prefix", prefix)
+		if u.away {
+			u.awayMessage = r.Message.Trailing()
+		}
+	})
+}
 
-	// We only care about the symbols
-	i := strings.IndexByte(prefix, ')')
-	if len(prefix) == 0 || prefix[0] != '(' || i < 0 {
-		logger.Warnf("Invalid prefix format")
-		return nil, false
+func (p *ChannelTracker) chghostCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 2 {
+		return
 	}
 
-	// We loop through the string using range so we get bytes, then we throw the
-	// two results together in the map.
-	var symbols []rune // ~&@%+
-	for _, r := range prefix[i+1:] {
-		symbols = append(symbols, r)
-	}
+	nick := r.Message.Prefix.Name
 
-	var modes []rune // qaohv
-	for _, r := range prefix[1:i] {
-		modes = append(modes, r)
-	}
+	p.update(func() {
+		u := p.lookupUser(nick)
+		if u == nil {
+			return
+		}
 
-	if len(modes) != len(symbols) {
-		logger.WithFields(logrus.Fields{
-			"modes":   modes,
-			"symbols": symbols,
-		}).Warnf("Mismatched modes and symbols")
+		u.ident = r.Message.Params[0]
+		u.host = r.Message.Params[1]
+	})
+}
 
-		return nil, false
+// whoCallback handles RPL_WHOREPLY.
+//
+// <client> <channel> <user> <host> <server> <nick> <flags> :<hopcount> <realname>
+func (p *ChannelTracker) whoCallback(r *seabird.Request) {
+	// Filter out broken messages
+	if len(r.Message.Params) < 8 {
+		return
 	}
 
-	prefixes := make(map[rune]rune)
-	for k := range symbols {
-		prefixes[symbols[k]] = modes[k]
+	var realName string
+	if split := strings.SplitN(r.Message.Params[7], " ", 2); len(split) == 2 {
+		realName = split[1]
 	}
 
-	return prefixes, true
+	p.updateFromWho(r, whoReply{
+		channel:  r.Message.Params[1],
+		ident:    r.Message.Params[2],
+		host:     r.Message.Params[3],
+		nick:     r.Message.Params[5],
+		flags:    r.Message.Params[6],
+		realName: realName,
+	})
 }
 
-func (p *ChannelTracker) namesCallback(r *seabird.Request) {
-	prefixes, ok := p.getSymbolToPrefixMapping(r)
-	if !ok {
+// whoxCallback handles RPL_WHOSPCRPL for the WHOX request we send on join.
+//
+// <client> <token> <channel> <user> <host> <nick> <flags> <account> :<realname>
+func (p *ChannelTracker) whoxCallback(r *seabird.Request) {
+	// Filter out broken messages and replies to WHOX requests other plugins
+	// may have made.
+	if len(r.Message.Params) < 9 || r.Message.Params[1] != whoxToken {
 		return
 	}
 
-	logger := r.GetLogger("channel_track")
+	account := normalizeAccount(r.Message.Params[7], "0")
 
-	channel := r.Message.Params[2]
+	p.updateFromWho(r, whoReply{
+		channel:  r.Message.Params[2],
+		ident:    r.Message.Params[3],
+		host:     r.Message.Params[4],
+		nick:     r.Message.Params[5],
+		flags:    r.Message.Params[6],
+		account:  &account,
+		realName: r.Message.Params[8],
+	})
+}
 
-	users := strings.Split(strings.TrimSpace(r.Message.Trailing()), " ")
-	for _, user := range users {
-		i := strings.IndexFunc(user, func(r rune) bool {
-			_, ok := prefixes[r]
-			return !ok
-		})
+// whoReply is the information we care about from WHO and WHOX replies.
+// account is a pointer because plain WHO replies don't include it.
+type whoReply struct {
+	channel  string
+	ident    string
+	host     string
+	nick     string
+	flags    string
+	account  *string
+	realName string
+}
+
+func (p *ChannelTracker) updateFromWho(r *seabird.Request, reply whoReply) {
+	prefixes := p.isupport.PrefixSymbols()
+	botMode := p.isupport.BotMode()
+
+	logger := r.GetLogger("channel_track")
+
+	p.update(func() {
+		u := p.lookupUser(reply.nick)
+		c := p.lookupChannel(reply.channel)
 
-		var userPrefixes string
-		if i != -1 {
-			userPrefixes = user[:i]
-			user = user[i:]
+		if u == nil || c == nil || u.channels[p.fold(reply.channel)] == nil {
+			logger.Warnf("Got WHO callback for %s on %s but we aren't tracking both", reply.nick, reply.channel)
+			return
 		}
 
-		// The bot user should be added via JOIN
-		if user == r.CurrentNick() {
-			continue
+		u.ident = reply.ident
+		u.host = reply.host
+		u.realName = reply.realName
+
+		if reply.account != nil {
+			u.account = *reply.account
 		}
 
-		p.addUserToChannel(r, user, channel)
+		// Flags start with H/G for here/gone, followed by an optional * for
+		// opers and the channel prefixes. We don't get the away message here,
+		// so we only clear it if they're back.
+		if strings.HasPrefix(reply.flags, "G") {
+			u.away = true
+		} else if strings.HasPrefix(reply.flags, "H") {
+			u.away = false
+			u.awayMessage = ""
+		}
 
-		u := p.LookupUser(user)
-		if u == nil {
-			continue
+		// Servers with a bot mode add it to the flags.
+		if botMode != 0 {
+			u.bot = strings.ContainsRune(reply.flags, botMode)
 		}
 
 		// Clear out the modes and reset them
-		u.channels[channel] = make(map[rune]bool)
+		u.channels[p.fold(reply.channel)] = make(map[rune]bool)
 
-		for _, v := range userPrefixes {
-			mode := prefixes[v]
-			u.channels[channel][mode] = true
+		for _, v := range reply.flags {
+			if mode, ok := prefixes[v]; ok {
+				u.channels[p.fold(reply.channel)][mode] = true
+			}
 		}
+	})
+}
 
-		logger.WithFields(logrus.Fields{
-			"user":    user,
-			"channel": channel,
-			"modes":   u.channels[channel],
-		}).Debug("User modes updated")
+// normalizeAccount converts the placeholder servers use for "not logged in"
+// into an empty string.
+func normalizeAccount(account, placeholder string) string {
+	if account == placeholder {
+		return ""
 	}
+
+	return account
+}
+
+// parseModeParams parses a mode string and its params using the PREFIX and
+// CHANMODES values from isupport.
+func (p *ChannelTracker) parseModeParams(modeString string, params []string) []modeChange {
+	return parseModes(modeString, params, p.isupport.PrefixModes(), p.isupport.ChanModes())
+}
+
+func (p *ChannelTracker) namesCallback(r *seabird.Request) {
+	prefixes := p.isupport.PrefixSymbols()
+
+	logger := r.GetLogger("channel_track")
+
+	channel := r.Message.Params[2]
+
+	users := strings.Split(strings.TrimSpace(r.Message.Trailing()), " ")
+
+	p.update(func() {
+		for _, user := range users {
+			i := strings.IndexFunc(user, func(r rune) bool {
+				_, ok := prefixes[r]
+				return !ok
+			})
+
+			var userPrefixes string
+			if i != -1 {
+				userPrefixes = user[:i]
+				user = user[i:]
+			}
+
+			// With userhost-in-names we get the full hostmask.
+			var ident, host string
+			if strings.IndexByte(user, '!') != -1 {
+				prefix := irc.ParsePrefix(user)
+				user, ident, host = prefix.Name, prefix.User, prefix.Host
+			}
+
+			// The bot user should be added via JOIN
+			if p.isCurrentNick(r, user) {
+				continue
+			}
+
+			p.addUserToChannel(r, user, channel)
+
+			u := p.lookupUser(user)
+			if u == nil || u.channels[p.fold(channel)] == nil {
+				continue
+			}
+
+			if ident != "" && host != "" {
+				u.ident = ident
+				u.host = host
+			}
+
+			// Clear out the modes and reset them
+			u.channels[p.fold(channel)] = make(map[rune]bool)
+
+			for _, v := range userPrefixes {
+				mode := prefixes[v]
+				u.channels[p.fold(channel)][mode] = true
+			}
+
+			logger.WithFields(logrus.Fields{
+				"user":    user,
+				"channel": channel,
+				"modes":   u.channels[p.fold(channel)],
+			}).Debug("User modes updated")
+		}
+	})
 }
 
 func (p *ChannelTracker) endOfNamesCallback(r *seabird.Request) {
 	channel := r.Message.Params[1]
 
-	fmt.Printf("Got all names for %s\n", channel)
+	r.GetLogger("channel_track").WithField("channel", channel).Debug("Got all names")
 }
 
-// Implementation below
+// Implementation below. All of these functions must be called with the lock
+// held for writing.
 
 func (p *ChannelTracker) addUserToChannel(r *seabird.Request, user, channel string) {
 	logger := r.GetLogger("channel_track").WithFields(logrus.Fields{
@@ -408,40 +1081,40 @@ func (p *ChannelTracker) addUserToChannel(r *seabird.Request, user, channel stri
 
 	// If the current user is joining a channel, we need to add it
 	// before adding our user.
-	if user == r.CurrentNick() {
+	if p.isCurrentNick(r, user) {
 		p.addChannel(r, channel)
 	}
 
 	// If we're not in this channel, issue a warning and bail.
-	c, ok := p.channels[channel]
-	if !ok {
+	c := p.lookupChannel(channel)
+	if c == nil {
 		logger.Warn("Error adding user: bot not in channel")
 		return
 	}
 
-	u := p.LookupUser(user)
+	u := p.lookupUser(user)
 	if u == nil {
-		u = &User{
-			Nick:     user,
-			UUID:     uuid.Must(uuid.NewRandom()).String(),
+		u = &trackedUser{
+			nick:     user,
+			uuid:     uuid.Must(uuid.NewRandom()).String(),
 			channels: make(map[string]map[rune]bool),
 		}
-		p.users[u.UUID] = u
-		p.uuids[user] = u.UUID
+		p.users[u.uuid] = u
+		p.uuids[p.fold(user)] = u.uuid
 	}
 
 	logger = logger.WithFields(logrus.Fields{
 		"user": user,
-		"uuid": u.UUID,
+		"uuid": u.uuid,
 	})
 
-	if _, ok := u.channels[channel]; ok {
+	if _, ok := u.channels[p.fold(channel)]; ok {
 		logger.Warn("User already in channel")
 		return
 	}
 
-	u.channels[channel] = make(map[rune]bool)
-	c.users[u.UUID] = true
+	u.channels[p.fold(channel)] = make(map[rune]bool)
+	c.users[u.uuid] = true
 
 	logger.Info("User added to channel")
 }
@@ -449,23 +1122,27 @@ func (p *ChannelTracker) addUserToChannel(r *seabird.Request, user, channel stri
 func (p *ChannelTracker) removeUserFromChannel(r *seabird.Request, user, channel string) {
 	logger := r.GetLogger("channel_track").WithField("channel", channel)
 
-	if user == r.CurrentNick() {
+	if p.isCurrentNick(r, user) {
 		p.removeChannel(r, channel)
 	} else {
-		u := p.LookupUser(user)
+		u := p.lookupUser(user)
 		if u == nil {
 			logger.Warn("Can't remove unknown user")
 			return
 		}
 
-		logger = logger.WithField("userUUID", u.UUID)
+		logger = logger.WithField("userUUID", u.uuid)
 
-		if _, ok := u.channels[channel]; !ok {
+		if _, ok := u.channels[p.fold(channel)]; !ok {
 			logger.Warn("Can only remove users from users they are in")
 			return
 		}
 
-		delete(u.channels, channel)
+		delete(u.channels, p.fold(channel))
+
+		if c := p.lookupChannel(channel); c != nil {
+			delete(c.users, u.uuid)
+		}
 
 		logger.Info("Removing user from channel")
 
@@ -480,13 +1157,17 @@ func (p *ChannelTracker) removeUserFromChannel(r *seabird.Request, user, channel
 func (p *ChannelTracker) addChannel(r *seabird.Request, channel string) {
 	logger := r.GetLogger("channel_track").WithField("channel", channel)
 
-	if _, ok := p.channels[channel]; ok {
+	if p.lookupChannel(channel) != nil {
 		logger.Warn("Already in channel")
 		return
 	}
 
-	p.channels[channel] = &Channel{
-		users: make(map[string]bool),
+	p.channels[p.fold(channel)] = &trackedChannel{
+		name:        channel,
+		users:       make(map[string]bool),
+		modes:       make(map[rune]string),
+		lists:       make(map[rune][]ListEntry),
+		listBuffers: make(map[rune][]ListEntry),
 	}
 
 	logger.Info("Added channel")
@@ -495,8 +1176,8 @@ func (p *ChannelTracker) addChannel(r *seabird.Request, channel string) {
 func (p *ChannelTracker) removeChannel(r *seabird.Request, channel string) {
 	logger := r.GetLogger("channel_track").WithField("channel", channel)
 
-	c, ok := p.channels[channel]
-	if !ok {
+	c := p.lookupChannel(channel)
+	if c == nil {
 		logger.Warn("Can only remove channels we are in")
 		return
 	}
@@ -507,11 +1188,11 @@ func (p *ChannelTracker) removeChannel(r *seabird.Request, channel string) {
 	// Remove all users currently in this channel from this channel.
 	for userUUID := range c.users {
 		u := p.users[userUUID]
-		delete(u.channels, channel)
+		delete(u.channels, p.fold(channel))
 
 		// If this user has no more channels, they need to be removed.
 		if len(u.channels) == 0 {
-			p.removeUser(r, u.Nick)
+			p.removeUser(r, u.nick)
 		}
 	}
 
@@ -519,7 +1200,7 @@ func (p *ChannelTracker) removeChannel(r *seabird.Request, channel string) {
 	c.users = make(map[string]bool)
 
 	// Remove the channel from tracking
-	delete(p.channels, channel)
+	delete(p.channels, p.fold(channel))
 
 	logger.Info("Removed channel")
 }
@@ -527,30 +1208,34 @@ func (p *ChannelTracker) removeChannel(r *seabird.Request, channel string) {
 func (p *ChannelTracker) removeUser(r *seabird.Request, user string) {
 	logger := r.GetLogger("channel_track").WithField("user", user)
 
-	u := p.LookupUser(user)
+	u := p.lookupUser(user)
 	if u == nil {
 		logger.Warn("User does not exist")
 		return
 	}
 
+	// Grab the final state of this session so cleanup callbacks can see
+	// where the user was.
+	final := p.snapshotUser(u)
+
 	// We need to clear out the channels and Nick to show this session
 	// is invalid.
-	u.Nick = ""
+	u.nick = ""
 
+	// The keys of u.channels are already folded.
 	for channel := range u.channels {
-		delete(p.channels[channel].users, u.UUID)
+		delete(p.channels[channel].users, u.uuid)
 	}
 
 	u.channels = make(map[string]map[rune]bool)
 
 	// Now that the User is empty, delete all internal traces.
-	delete(p.uuids, user)
-	delete(p.users, u.UUID)
+	delete(p.uuids, p.fold(user))
+	delete(p.users, u.uuid)
 
-	// Run any cleanup callbacks
-	for _, f := range p.cleanupCallbacks {
-		f(u)
-	}
+	// Queue up the cleanup callbacks. They will be run once the lock is
+	// released.
+	p.pendingCleanup = append(p.pendingCleanup, final)
 
 	logger.Info("Removed user")
 }
@@ -561,20 +1246,20 @@ func (p *ChannelTracker) renameUser(r *seabird.Request, oldNick, newNick string)
 		"newNick": newNick,
 	})
 
-	u := p.LookupUser(oldNick)
+	u := p.lookupUser(oldNick)
 	if u == nil {
 		logger.Warn("Can't rename user that doesn't exist")
 		return
 	}
 
-	logger = logger.WithField("userUUID", u.UUID)
+	logger = logger.WithField("userUUID", u.uuid)
 
 	// Rename the user object
-	u.Nick = newNick
+	u.nick = newNick
 
 	// Swap where the UUID points to
-	delete(p.uuids, oldNick)
-	p.uuids[newNick] = u.UUID
+	delete(p.uuids, p.fold(oldNick))
+	p.uuids[p.fold(newNick)] = u.uuid
 
 	logger.Info("Renamed user")
 }
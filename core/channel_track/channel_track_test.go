@@ -0,0 +1,556 @@
+package channeltrack
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+// testServer is a bot connection which has been set up with the
+// channel_track plugin.
+type testServer struct {
+	*testbot.Server
+	tracker *ChannelTracker
+}
+
+// newTestServer starts a bot with the channel_track plugin and the given
+// config and gets it through registration.
+func newTestServer(t *testing.T, config string) *testServer {
+	s := &testServer{Server: testbot.Start(t, []string{"cap", "channel_track", "isupport"}, config, nil)}
+
+	// Plugins are loaded before the client sends anything, so once we have
+	// the NICK we know the tracker is available.
+	s.WaitForPrefix("NICK ")
+
+	s.tracker = CtxChannelTracker(s.Bot.Context())
+
+	s.Send(":irc.example.com 001 seabird :Welcome")
+
+	return s
+}
+
+func TestTrackerSnapshots(t *testing.T) {
+	s := newTestServer(t, "")
+
+	s.Send(
+		":seabird!seabird@example.com JOIN #chan",
+		":irc.example.com 353 seabird = #chan :seabird @op +voice user",
+		":irc.example.com 366 seabird #chan :End of /NAMES list.",
+	)
+	s.Sync()
+
+	c := s.tracker.LookupChannel("#chan")
+	require.NotNil(t, c)
+	require.Equal(t, "#chan", c.Name())
+	require.Equal(t, []string{"op", "seabird", "user", "voice"}, c.Users())
+
+	op := s.tracker.LookupUser("op")
+	require.NotNil(t, op)
+	require.Equal(t, map[rune]bool{'o': true}, op.ModesInChannel("#chan"))
+
+	// Snapshots shouldn't change when the state changes.
+	s.Send(
+		":op!op@example.com MODE #chan -o+v op op",
+		":op!op@example.com NICK newop",
+	)
+	s.Sync()
+
+	require.Equal(t, "op", op.Nick)
+	require.Equal(t, map[rune]bool{'o': true}, op.ModesInChannel("#chan"))
+	require.Equal(t, []string{"op", "seabird", "user", "voice"}, c.Users())
+
+	newOp := s.tracker.LookupUserByUUID(op.UUID)
+	require.NotNil(t, newOp)
+	require.Equal(t, "newop", newOp.Nick)
+	require.Equal(t, map[rune]bool{'v': true}, newOp.ModesInChannel("#chan"))
+	require.Nil(t, s.tracker.LookupUser("op"))
+
+	s.Send(":user!user@example.com PART #chan")
+	s.Sync()
+
+	c = s.tracker.LookupChannel("#chan")
+	require.Equal(t, []string{"newop", "seabird", "voice"}, c.Users())
+	require.False(t, c.HasNick("user"))
+	require.True(t, c.HasUser(newOp.UUID))
+}
+
+func TestTrackerConcurrentAccess(t *testing.T) {
+	s := newTestServer(t, "")
+
+	s.Send(":seabird!seabird@example.com JOIN #chan")
+	s.Sync()
+
+	var (
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+
+	// Hammer the query API from a number of goroutines while the state is
+	// being changed so the race detector can catch unsafe access.
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				for _, c := range s.tracker.Channels() {
+					c.Users()
+
+					for _, u := range s.tracker.UsersInChannel(c.Name()) {
+						u.Channels()
+						u.ModesInChannel(c.Name())
+					}
+				}
+
+				if u := s.tracker.LookupUser("user0"); u != nil {
+					s.tracker.LookupUserByUUID(u.UUID)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		nick := fmt.Sprintf("user%d", i%5)
+
+		s.Send(
+			fmt.Sprintf(":%s!user@example.com JOIN #chan", nick),
+			fmt.Sprintf(":seabird!seabird@example.com MODE #chan +v %s", nick),
+			fmt.Sprintf(":%s!user@example.com NICK %s_", nick, nick),
+			fmt.Sprintf(":%s_!user@example.com PART #chan", nick),
+		)
+	}
+
+	s.Sync()
+	close(done)
+	wg.Wait()
+
+	require.Equal(t, []string{"seabird"}, s.tracker.LookupChannel("#chan").Users())
+}
+
+func TestTrackerSessionCleanup(t *testing.T) {
+	s := newTestServer(t, "")
+
+	removed := make(chan *User, 1)
+	s.tracker.RegisterSessionCleanupCallback(func(u *User) {
+		// Callbacks are run outside the lock, so querying the tracker here
+		// must not deadlock.
+		s.tracker.Channels()
+		removed <- u
+	})
+
+	s.Send(
+		":seabird!seabird@example.com JOIN #chan",
+		":user!user@example.com JOIN #chan",
+		":user!user@example.com QUIT :Bye",
+	)
+	s.Sync()
+
+	select {
+	case u := <-removed:
+		require.Equal(t, "user", u.Nick)
+		require.Equal(t, []string{"#chan"}, u.Channels())
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "cleanup callback not called")
+	}
+}
+
+func TestTrackerHostmasks(t *testing.T) {
+	s := newTestServer(t, "")
+
+	s.Send(
+		":irc.example.com 005 seabird WHOX :are supported by this server",
+		":seabird!bot@bot.example.com JOIN #chan * :Seabird Bot",
+	)
+	require.Equal(t, "WHO #chan %tcuhnfar,152", s.WaitForPrefix("WHO "))
+
+	s.Send(
+		":irc.example.com 353 seabird = #chan :seabird @op user",
+		":irc.example.com 354 seabird 152 #chan ident op.example.com op H@ opaccount :Op User",
+		":irc.example.com 354 seabird 152 #chan user user.example.com user G 0 :Some User",
+		":new!new@new.example.com JOIN #chan newaccount :New User",
+	)
+	s.Sync()
+
+	op := s.tracker.LookupUser("op")
+	require.Equal(t, "op!ident@op.example.com", op.Hostmask())
+	require.Equal(t, "opaccount", op.Account)
+	require.Equal(t, "Op User", op.RealName)
+	require.False(t, op.Away)
+	require.Equal(t, map[rune]bool{'o': true}, op.ModesInChannel("#chan"))
+
+	user := s.tracker.LookupUser("user")
+	require.Equal(t, "", user.Account)
+	require.True(t, user.Away)
+
+	newUser := s.tracker.LookupUser("new")
+	require.Equal(t, "new!new@new.example.com", newUser.Hostmask())
+	require.Equal(t, "newaccount", newUser.Account)
+	require.Equal(t, "New User", newUser.RealName)
+
+	s.Send(
+		":user!user@user.example.com AWAY",
+		":op!ident@op.example.com AWAY :Getting lunch",
+		":op!ident@op.example.com ACCOUNT *",
+		":new!new@new.example.com CHGHOST newer newer.example.com",
+	)
+	s.Sync()
+
+	require.False(t, s.tracker.LookupUser("user").Away)
+
+	op = s.tracker.LookupUser("op")
+	require.True(t, op.Away)
+	require.Equal(t, "Getting lunch", op.AwayMessage)
+	require.Equal(t, "", op.Account)
+
+	require.Equal(t, "new!newer@newer.example.com", s.tracker.LookupUser("new").Hostmask())
+}
+
+func TestTrackerPlainWho(t *testing.T) {
+	s := newTestServer(t, "")
+
+	s.Send(":seabird!bot@bot.example.com JOIN #chan")
+	require.Equal(t, "WHO #chan", s.WaitForPrefix("WHO "))
+
+	s.Send(
+		":irc.example.com 353 seabird = #chan :seabird user",
+		":irc.example.com 352 seabird #chan ident user.example.com irc.example.com user H*+ :0 Some User",
+	)
+	s.Sync()
+
+	user := s.tracker.LookupUser("user")
+	require.Equal(t, "user!ident@user.example.com", user.Hostmask())
+	require.Equal(t, "Some User", user.RealName)
+	require.Equal(t, map[rune]bool{'v': true}, user.ModesInChannel("#chan"))
+}
+
+func TestTrackerBotMode(t *testing.T) {
+	s := newTestServer(t, "")
+
+	s.Send(":irc.example.com 005 seabird BOT=B :are supported by this server")
+	s.Send(":seabird!bot@bot.example.com JOIN #chan")
+	require.Equal(t, "WHO #chan", s.WaitForPrefix("WHO "))
+
+	s.Send(
+		":irc.example.com 353 seabird = #chan :seabird user helper",
+		":irc.example.com 352 seabird #chan ident user.example.com irc.example.com user H :0 Some User",
+		":irc.example.com 352 seabird #chan ident helper.example.com irc.example.com helper HB+ :0 Helper",
+	)
+	s.Sync()
+
+	require.False(t, s.tracker.LookupUser("user").Bot)
+	require.True(t, s.tracker.LookupUser("helper").Bot)
+
+	// The bot mode can also change on a user.
+	s.Send(
+		":user MODE user :+iB",
+		":helper MODE helper :-B",
+	)
+	s.Sync()
+
+	require.True(t, s.tracker.LookupUser("user").Bot)
+	require.False(t, s.tracker.LookupUser("helper").Bot)
+}
+
+func TestTrackerChannelInfo(t *testing.T) {
+	s := newTestServer(t, "")
+
+	s.Send(
+		":irc.example.com 005 seabird CHANMODES=beI,k,l,imnpst EXCEPTS INVEX :are supported by this server",
+		":seabird!bot@bot.example.com JOIN #chan",
+	)
+	require.Equal(t, "MODE #chan", s.WaitForPrefix("MODE "))
+	require.Equal(t, "MODE #chan +b", s.WaitForPrefix("MODE "))
+	require.Equal(t, "MODE #chan +e", s.WaitForPrefix("MODE "))
+	require.Equal(t, "MODE #chan +I", s.WaitForPrefix("MODE "))
+
+	s.Send(
+		":irc.example.com 332 seabird #chan :Welcome to the channel",
+		":irc.example.com 333 seabird #chan op!op@example.com 1500000000",
+		":irc.example.com 324 seabird #chan +ntkl secret 10",
+		":irc.example.com 367 seabird #chan *!*@bad.example.com op 1500000000",
+		":irc.example.com 367 seabird #chan *!*@worse.example.com",
+		":irc.example.com 368 seabird #chan :End of channel ban list",
+		":irc.example.com 349 seabird #chan :End of channel exception list",
+		":irc.example.com 346 seabird #chan *!*@friend.example.com op 1500000000",
+		":irc.example.com 347 seabird #chan :End of channel invite list",
+	)
+	s.Sync()
+
+	c := s.tracker.LookupChannel("#chan")
+	require.Equal(t, "Welcome to the channel", c.Topic())
+	require.Equal(t, "op!op@example.com", c.TopicSetter())
+	require.Equal(t, time.Unix(1500000000, 0), c.TopicTime())
+	require.Equal(t, map[rune]string{'n': "", 't': "", 'k': "secret", 'l': "10"}, c.Modes())
+	require.Equal(t, "secret", c.Key())
+	require.Equal(t, []ListEntry{
+		{Mask: "*!*@bad.example.com", Setter: "op", Time: time.Unix(1500000000, 0)},
+		{Mask: "*!*@worse.example.com"},
+	}, c.Bans())
+	require.Empty(t, c.BanExceptions())
+	require.Equal(t, "*!*@friend.example.com", c.InviteExceptions()[0].Mask)
+
+	s.Send(
+		":op!op@example.com TOPIC #chan :New topic",
+		":op!op@example.com MODE #chan -k-l+mb-b secret *!*@new.example.com *!*@bad.example.com",
+	)
+	s.Sync()
+
+	c = s.tracker.LookupChannel("#chan")
+	require.Equal(t, "New topic", c.Topic())
+	require.Equal(t, "op!op@example.com", c.TopicSetter())
+	require.Equal(t, map[rune]string{'n': "", 't': "", 'm': ""}, c.Modes())
+	require.Equal(t, "", c.Key())
+
+	bans := c.Bans()
+	require.Len(t, bans, 2)
+	require.Equal(t, "*!*@worse.example.com", bans[0].Mask)
+	require.Equal(t, "*!*@new.example.com", bans[1].Mask)
+	require.Equal(t, "op!op@example.com", bans[1].Setter)
+}
+
+func TestTrackerEvents(t *testing.T) {
+	s := newTestServer(t, "")
+
+	events := make(chan interface{}, 20)
+
+	s.tracker.OnUserJoined(func(r *seabird.Request, e *UserJoinedEvent) { events <- e })
+	s.tracker.OnUserParted(func(r *seabird.Request, e *UserPartedEvent) { events <- e })
+	s.tracker.OnUserKicked(func(r *seabird.Request, e *UserKickedEvent) { events <- e })
+	s.tracker.OnUserQuit(func(r *seabird.Request, e *UserQuitEvent) { events <- e })
+	s.tracker.OnNickChanged(func(r *seabird.Request, e *NickChangedEvent) { events <- e })
+	s.tracker.OnModeChanged(func(r *seabird.Request, e *ModeChangedEvent) { events <- e })
+	s.tracker.OnBotJoinedChannel(func(r *seabird.Request, e *BotJoinedChannelEvent) {
+		// Handlers are run outside the lock, so querying the tracker here
+		// must not deadlock.
+		require.NotNil(t, s.tracker.LookupChannel(e.Channel))
+		events <- e
+	})
+
+	next := func() interface{} {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for event")
+		}
+
+		return nil
+	}
+
+	s.Send(":seabird!bot@bot.example.com JOIN #chan")
+
+	joined := next().(*UserJoinedEvent)
+	require.Equal(t, "seabird", joined.User.Nick)
+	require.Equal(t, "#chan", joined.Channel)
+
+	botJoined := next().(*BotJoinedChannelEvent)
+	require.Equal(t, "seabird", botJoined.User.Nick)
+	require.Equal(t, "#chan", botJoined.Channel)
+
+	s.Send(":user!user@example.com JOIN #chan")
+
+	joined = next().(*UserJoinedEvent)
+	require.Equal(t, "user", joined.User.Nick)
+	require.Equal(t, "user!user@example.com", joined.Actor.Hostmask())
+
+	s.Send(":seabird!bot@bot.example.com MODE #chan +om user")
+
+	mode := next().(*ModeChangedEvent)
+	require.Equal(t, 'o', mode.Mode)
+	require.True(t, mode.Adding)
+	require.Equal(t, "user", mode.User.Nick)
+	require.Equal(t, map[rune]bool{'o': true}, mode.User.ModesInChannel("#chan"))
+	require.Equal(t, "seabird", mode.Actor.Nick)
+
+	mode = next().(*ModeChangedEvent)
+	require.Equal(t, 'm', mode.Mode)
+	require.Nil(t, mode.User)
+
+	s.Send(":user!user@example.com NICK user2")
+
+	nick := next().(*NickChangedEvent)
+	require.Equal(t, "user", nick.OldNick)
+	require.Equal(t, "user2", nick.User.Nick)
+	require.Equal(t, joined.User.UUID, nick.User.UUID)
+
+	s.Send(":seabird!bot@bot.example.com KICK #chan user2 :Go away")
+
+	kicked := next().(*UserKickedEvent)
+	require.Equal(t, "user2", kicked.User.Nick)
+	require.Equal(t, []string{"#chan"}, kicked.User.Channels())
+	require.Equal(t, "seabird", kicked.Actor.Nick)
+	require.Equal(t, "Go away", kicked.Reason)
+
+	s.Send(
+		":other!other@example.com JOIN #chan",
+		":other!other@example.com PART #chan :Leaving",
+		":quitter!quitter@example.com JOIN #chan",
+		":quitter!quitter@example.com QUIT :Bye",
+	)
+
+	next()
+
+	parted := next().(*UserPartedEvent)
+	require.Equal(t, "other", parted.User.Nick)
+	require.Equal(t, "Leaving", parted.Reason)
+
+	next()
+
+	quit := next().(*UserQuitEvent)
+	require.Equal(t, "quitter", quit.User.Nick)
+	require.Equal(t, []string{"#chan"}, quit.User.Channels())
+	require.Equal(t, "Bye", quit.Reason)
+}
+
+func TestTrackerCaseMapping(t *testing.T) {
+	s := newTestServer(t, "")
+
+	s.Send(
+		":seabird!bot@bot.example.com JOIN #Chan[1]",
+		":Foo[m]!foo@example.com JOIN #chan{1}",
+	)
+	s.Sync()
+
+	c := s.tracker.LookupChannel("#CHAN{1}")
+	require.NotNil(t, c)
+	require.Equal(t, "#Chan[1]", c.Name())
+	require.True(t, c.HasNick("foo{m}"))
+
+	u := s.tracker.LookupUser("FOO{M}")
+	require.NotNil(t, u)
+	require.Equal(t, "Foo[m]", u.Nick)
+	require.Equal(t, []string{"#Chan[1]"}, u.Channels())
+	require.True(t, u.InChannel("#chan[1]"))
+
+	s.Send(":foo{m}!foo@example.com PART #CHAN[1]")
+	s.Sync()
+
+	require.Nil(t, s.tracker.LookupUser("Foo[m]"))
+	require.Equal(t, []string{"seabird"}, s.tracker.LookupChannel("#chan[1]").Users())
+}
+
+func TestTrackerNetsplit(t *testing.T) {
+	splitNoticeDelay = 10 * time.Millisecond
+
+	s := newTestServer(t, `
+[channel_track]
+splittimeout = "1h"
+splitnotices = true
+`)
+
+	removed := make(chan *User, 10)
+	s.tracker.RegisterSessionCleanupCallback(func(u *User) {
+		removed <- u
+	})
+
+	s.Send(
+		":seabird!bot@bot.example.com JOIN #chan",
+		":one!one@one.example.com JOIN #chan",
+		":two!two@two.example.com JOIN #chan",
+	)
+	s.Sync()
+
+	one := s.tracker.LookupUser("one")
+	two := s.tracker.LookupUser("two")
+
+	s.Send(
+		":one!one@one.example.com QUIT :hub.example.com leaf.example.com",
+		":two!two@two.example.com QUIT :hub.example.com leaf.example.com",
+	)
+	s.Sync()
+
+	require.Equal(t, []string{"seabird"}, s.tracker.LookupChannel("#chan").Users())
+	require.Nil(t, s.tracker.LookupUser("one"))
+	require.Equal(t, "NOTICE #chan :Netsplit between hub.example.com and leaf.example.com: 2 split", s.WaitForPrefix("NOTICE "))
+
+	s.Send(":one!one@one.example.com JOIN #chan")
+	s.Sync()
+
+	rejoined := s.tracker.LookupUser("one")
+	require.NotNil(t, rejoined)
+	require.Equal(t, one.UUID, rejoined.UUID)
+	require.Equal(t, []string{"#chan"}, rejoined.Channels())
+	require.Equal(t, "NOTICE #chan :Netsplit between hub.example.com and leaf.example.com: 1 rejoined", s.WaitForPrefix("NOTICE "))
+
+	// Someone else taking a split user's nick shouldn't get their session.
+	s.Send(":two!other@other.example.com JOIN #chan")
+	s.Sync()
+
+	require.NotEqual(t, two.UUID, s.tracker.LookupUser("two").UUID)
+
+	// If we never saw a user's hostmask, we can't tell who's rejoining, so
+	// their session is dropped.
+	s.Send(
+		":irc.example.com 353 seabird = #chan :three",
+		":irc.example.com 366 seabird #chan :End of /NAMES list.",
+	)
+	s.Sync()
+
+	three := s.tracker.LookupUser("three")
+	require.NotNil(t, three)
+	require.Equal(t, "three", three.Hostmask())
+
+	s.Send(
+		":three!three@three.example.com QUIT :hub.example.com leaf.example.com",
+		":three!three@three.example.com JOIN #chan",
+	)
+	s.Sync()
+
+	require.NotEqual(t, three.UUID, s.tracker.LookupUser("three").UUID)
+
+	select {
+	case u := <-removed:
+		require.Equal(t, three.UUID, u.UUID)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "cleanup callback not called")
+	}
+
+	// Normal quits should still remove the session right away.
+	s.Send(":one!one@one.example.com QUIT :Quit: bye")
+	s.Sync()
+
+	select {
+	case u := <-removed:
+		require.Equal(t, one.UUID, u.UUID)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "cleanup callback not called")
+	}
+}
+
+func TestTrackerFakeServer(t *testing.T) {
+	b := testbot.New(t, []string{"cap", "isupport", "channel_track"}, "")
+	tracker := CtxChannelTracker(b.Context())
+
+	b.Join("someone", testbot.Channel)
+	b.Join("other", testbot.Channel)
+	b.Join("other", "#elsewhere")
+	b.Sync()
+
+	require.Equal(t, b.Members(testbot.Channel), tracker.LookupChannel(testbot.Channel).Users())
+	require.Nil(t, tracker.LookupChannel("#elsewhere"))
+
+	user := tracker.LookupUser("someone")
+	require.NotNil(t, user)
+	require.Equal(t, "someone!someone@someone.example.com", user.Hostmask())
+
+	b.Rename("someone", "Renamed")
+	b.Part("other", testbot.Channel, "bye")
+	b.Sync()
+
+	require.Equal(t, b.Members(testbot.Channel), tracker.LookupChannel(testbot.Channel).Users())
+	require.Equal(t, user.UUID, tracker.LookupUser("renamed").UUID)
+	require.Nil(t, tracker.LookupUser("other"))
+}
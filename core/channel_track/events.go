@@ -0,0 +1,223 @@
+package channeltrack
+
+import (
+	seabird "github.com/belak/go-seabird"
+)
+
+// UserJoinedEvent is sent when any user, including the bot, joins a
+// channel. User is the state after they were added to the channel.
+type UserJoinedEvent struct {
+	User    *User
+	Channel string
+	Actor   *User
+}
+
+// UserPartedEvent is sent when any user, including the bot, leaves a
+// channel. User is the last state before they were removed from the
+// channel.
+type UserPartedEvent struct {
+	User    *User
+	Channel string
+	Actor   *User
+	Reason  string
+}
+
+// UserKickedEvent is sent when any user, including the bot, is kicked from a
+// channel. User is the last state before they were removed from the channel
+// and Actor is the user who kicked them, or nil if it was the server.
+type UserKickedEvent struct {
+	User    *User
+	Channel string
+	Actor   *User
+	Reason  string
+}
+
+// UserQuitEvent is sent when a user disconnects. User is the last state
+// before they were removed, so User.Channels can be used to see which
+// channels they were in. Split is true if they were lost in a netsplit, in
+// which case they will keep their UUID if they rejoin.
+type UserQuitEvent struct {
+	User   *User
+	Actor  *User
+	Reason string
+	Split  bool
+}
+
+// NickChangedEvent is sent when a user changes their nick. User is the state
+// after the change.
+type NickChangedEvent struct {
+	User    *User
+	OldNick string
+	Actor   *User
+}
+
+// ModeChangedEvent is sent for every mode which is changed on a channel. If
+// it is a membership mode like +o or +v, User is the user it was applied to,
+// otherwise it is nil. Actor is nil if the mode was set by the server.
+type ModeChangedEvent struct {
+	User    *User
+	Channel string
+	Actor   *User
+
+	Adding bool
+	Mode   rune
+	Param  string
+}
+
+// BotJoinedChannelEvent is sent when the bot joins a channel. It is sent
+// before the channel's user list has been received.
+type BotJoinedChannelEvent struct {
+	User    *User
+	Channel string
+	Actor   *User
+}
+
+// subscriptions holds the handlers registered for each type of event.
+type subscriptions struct {
+	userJoined       []func(r *seabird.Request, e *UserJoinedEvent)
+	userParted       []func(r *seabird.Request, e *UserPartedEvent)
+	userKicked       []func(r *seabird.Request, e *UserKickedEvent)
+	userQuit         []func(r *seabird.Request, e *UserQuitEvent)
+	nickChanged      []func(r *seabird.Request, e *NickChangedEvent)
+	modeChanged      []func(r *seabird.Request, e *ModeChangedEvent)
+	botJoinedChannel []func(r *seabird.Request, e *BotJoinedChannelEvent)
+}
+
+// OnUserJoined registers a handler to be called when a user joins a
+// channel.
+func (p *ChannelTracker) OnUserJoined(h func(r *seabird.Request, e *UserJoinedEvent)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.subs.userJoined = append(p.subs.userJoined, h)
+}
+
+// OnUserParted registers a handler to be called when a user leaves a
+// channel.
+func (p *ChannelTracker) OnUserParted(h func(r *seabird.Request, e *UserPartedEvent)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.subs.userParted = append(p.subs.userParted, h)
+}
+
+// OnUserKicked registers a handler to be called when a user is kicked from
+// a channel.
+func (p *ChannelTracker) OnUserKicked(h func(r *seabird.Request, e *UserKickedEvent)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.subs.userKicked = append(p.subs.userKicked, h)
+}
+
+// OnUserQuit registers a handler to be called when a user disconnects.
+func (p *ChannelTracker) OnUserQuit(h func(r *seabird.Request, e *UserQuitEvent)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.subs.userQuit = append(p.subs.userQuit, h)
+}
+
+// OnNickChanged registers a handler to be called when a user changes their
+// nick.
+func (p *ChannelTracker) OnNickChanged(h func(r *seabird.Request, e *NickChangedEvent)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.subs.nickChanged = append(p.subs.nickChanged, h)
+}
+
+// OnModeChanged registers a handler to be called for every channel mode
+// change.
+func (p *ChannelTracker) OnModeChanged(h func(r *seabird.Request, e *ModeChangedEvent)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.subs.modeChanged = append(p.subs.modeChanged, h)
+}
+
+// OnBotJoinedChannel registers a handler to be called when the bot joins a
+// channel.
+func (p *ChannelTracker) OnBotJoinedChannel(h func(r *seabird.Request, e *BotJoinedChannelEvent)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.subs.botJoinedChannel = append(p.subs.botJoinedChannel, h)
+}
+
+// The emit functions queue up an event to be dispatched once the lock is
+// released. They must be called with the lock held for writing.
+
+func (p *ChannelTracker) emitUserJoined(r *seabird.Request, e *UserJoinedEvent) {
+	handlers := p.subs.userJoined
+	p.pendingEvents = append(p.pendingEvents, func() {
+		for _, h := range handlers {
+			h(r, e)
+		}
+	})
+}
+
+func (p *ChannelTracker) emitUserParted(r *seabird.Request, e *UserPartedEvent) {
+	handlers := p.subs.userParted
+	p.pendingEvents = append(p.pendingEvents, func() {
+		for _, h := range handlers {
+			h(r, e)
+		}
+	})
+}
+
+func (p *ChannelTracker) emitUserKicked(r *seabird.Request, e *UserKickedEvent) {
+	handlers := p.subs.userKicked
+	p.pendingEvents = append(p.pendingEvents, func() {
+		for _, h := range handlers {
+			h(r, e)
+		}
+	})
+}
+
+func (p *ChannelTracker) emitUserQuit(r *seabird.Request, e *UserQuitEvent) {
+	handlers := p.subs.userQuit
+	p.pendingEvents = append(p.pendingEvents, func() {
+		for _, h := range handlers {
+			h(r, e)
+		}
+	})
+}
+
+func (p *ChannelTracker) emitNickChanged(r *seabird.Request, e *NickChangedEvent) {
+	handlers := p.subs.nickChanged
+	p.pendingEvents = append(p.pendingEvents, func() {
+		for _, h := range handlers {
+			h(r, e)
+		}
+	})
+}
+
+func (p *ChannelTracker) emitModeChanged(r *seabird.Request, e *ModeChangedEvent) {
+	handlers := p.subs.modeChanged
+	p.pendingEvents = append(p.pendingEvents, func() {
+		for _, h := range handlers {
+			h(r, e)
+		}
+	})
+}
+
+func (p *ChannelTracker) emitBotJoinedChannel(r *seabird.Request, e *BotJoinedChannelEvent) {
+	handlers := p.subs.botJoinedChannel
+	p.pendingEvents = append(p.pendingEvents, func() {
+		for _, h := range handlers {
+			h(r, e)
+		}
+	})
+}
+
+// actor returns a snapshot of the user who sent the current message, or nil
+// if it came from a server or someone we aren't tracking. It must be called
+// with the lock held.
+func (p *ChannelTracker) actor(r *seabird.Request) *User {
+	if r.Message.Prefix == nil {
+		return nil
+	}
+
+	return p.snapshotUser(p.lookupUser(r.Message.Prefix.Name))
+}
@@ -0,0 +1,90 @@
+package channeltrack
+
+import (
+	"strings"
+
+	"github.com/belak/go-seabird-plugins/core/isupport"
+)
+
+// modeType is which kind of mode a mode change is for. This determines both
+// whether it takes a parameter and how it should be tracked.
+type modeType int
+
+const (
+	modeTypeUnknown modeType = iota
+	modeTypePrefix
+	modeTypeList
+	modeTypeParam
+	modeTypeSetParam
+	modeTypeFlag
+)
+
+// modeChange represents a single mode being set or unset by a MODE message.
+type modeChange struct {
+	Adding bool
+	Mode   rune
+	Type   modeType
+	Param  string
+}
+
+// parseModes splits a MODE message into the individual mode changes it
+// contains. The mode string can contain multiple +/- groups and each mode
+// which takes a parameter consumes the next entry from params.
+//
+// prefixModes are the channel membership modes (the modes half of PREFIX,
+// such as "ov") which always take a parameter. chanModes describes which of
+// the other modes take a parameter.
+//
+// Modes we don't know about are assumed to take no parameter, which is the
+// safest option because it doesn't steal targets from later modes.
+func parseModes(modeString string, params []string, prefixModes string, chanModes isupport.ChanModes) []modeChange {
+	var (
+		ret    []modeChange
+		adding = true
+	)
+
+	for _, mode := range modeString {
+		switch mode {
+		case '+':
+			adding = true
+			continue
+		case '-':
+			adding = false
+			continue
+		}
+
+		change := modeChange{Adding: adding, Mode: mode}
+
+		switch {
+		case strings.ContainsRune(prefixModes, mode):
+			change.Type = modeTypePrefix
+		case strings.ContainsRune(chanModes.A, mode):
+			change.Type = modeTypeList
+		case strings.ContainsRune(chanModes.B, mode):
+			change.Type = modeTypeParam
+		case strings.ContainsRune(chanModes.C, mode):
+			change.Type = modeTypeSetParam
+		case strings.ContainsRune(chanModes.D, mode):
+			change.Type = modeTypeFlag
+		}
+
+		takesParam := change.Type == modeTypePrefix ||
+			change.Type == modeTypeList ||
+			change.Type == modeTypeParam ||
+			(change.Type == modeTypeSetParam && adding)
+
+		if takesParam {
+			// If the server sent us a broken message, bail with what we have
+			// rather than applying modes to the wrong targets.
+			if len(params) == 0 {
+				return ret
+			}
+
+			change.Param, params = params[0], params[1:]
+		}
+
+		ret = append(ret, change)
+	}
+
+	return ret
+}
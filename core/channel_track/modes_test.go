@@ -0,0 +1,50 @@
+package channeltrack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/belak/go-seabird-plugins/core/isupport"
+)
+
+var testChanModes = isupport.ChanModes{A: "beI", B: "k", C: "l", D: "imnpst"}
+
+func TestParseModesPrefixes(t *testing.T) {
+	changes := parseModes("+ov-v", []string{"nick1", "nick2", "nick3"}, "qaohv", testChanModes)
+	require.Equal(t, []modeChange{
+		{Adding: true, Mode: 'o', Type: modeTypePrefix, Param: "nick1"},
+		{Adding: true, Mode: 'v', Type: modeTypePrefix, Param: "nick2"},
+		{Adding: false, Mode: 'v', Type: modeTypePrefix, Param: "nick3"},
+	}, changes)
+}
+
+func TestParseModesClasses(t *testing.T) {
+	// Limit only takes a param when it's being set, key always takes one and
+	// flags never do.
+	changes := parseModes("+lkn-l+b-k", []string{"10", "secret", "*!*@host", "secret"}, "ov", testChanModes)
+	require.Equal(t, []modeChange{
+		{Adding: true, Mode: 'l', Type: modeTypeSetParam, Param: "10"},
+		{Adding: true, Mode: 'k', Type: modeTypeParam, Param: "secret"},
+		{Adding: true, Mode: 'n', Type: modeTypeFlag},
+		{Adding: false, Mode: 'l', Type: modeTypeSetParam},
+		{Adding: true, Mode: 'b', Type: modeTypeList, Param: "*!*@host"},
+		{Adding: false, Mode: 'k', Type: modeTypeParam, Param: "secret"},
+	}, changes)
+}
+
+func TestParseModesMissingParams(t *testing.T) {
+	changes := parseModes("+oo", []string{"nick1"}, "ov", testChanModes)
+	require.Equal(t, []modeChange{
+		{Adding: true, Mode: 'o', Type: modeTypePrefix, Param: "nick1"},
+	}, changes)
+}
+
+func TestParseModesUnknown(t *testing.T) {
+	// Unknown modes shouldn't consume params meant for later modes.
+	changes := parseModes("+Zo", []string{"nick1"}, "ov", testChanModes)
+	require.Equal(t, []modeChange{
+		{Adding: true, Mode: 'Z', Type: modeTypeUnknown},
+		{Adding: true, Mode: 'o', Type: modeTypePrefix, Param: "nick1"},
+	}, changes)
+}
@@ -0,0 +1,315 @@
+package channeltrack
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+// netsplitRegexp matches the QUIT reason servers use for users lost in a
+// netsplit, which is the names of the two servers that split. Servers
+// prefix normal QUIT reasons, so users can't fake this.
+var netsplitRegexp = regexp.MustCompile(`^[\w-]+(\.[\w-]+)+ [\w-]+(\.[\w-]+)+$`)
+
+// Sent to each channel involved in a netsplit with the users lost and
+// rejoined since the last notice. Either count may be zero.
+var splitNoticeTemplate = internal.TemplateMustCompile("channelTrackNetsplit", `
+Netsplit between {{ index .servers 0 }} and {{ index .servers 1 }}:
+{{- if .split }} {{ .split }} split{{ end }}
+{{- if and .split .rejoined }},{{ end }}
+{{- if .rejoined }} {{ .rejoined }} rejoined{{ end }}
+`).WithSample(map[string]interface{}{
+	"channel":  "#seabird",
+	"servers":  []string{"hub.example.com", "leaf.example.com"},
+	"split":    3,
+	"rejoined": 1,
+})
+
+// splitNoticeDelay is how long we wait after the last split or rejoin before
+// sending a summary, so a whole split is reported at once.
+var splitNoticeDelay = 5 * time.Second
+
+// netsplit holds the sessions lost when two servers split until the users
+// rejoin or the split times out.
+type netsplit struct {
+	servers string
+
+	// users is keyed on the case folded nick.
+	users  map[string]*splitUser
+	expire *time.Timer
+
+	// Counts for the next summary notice, keyed on channel name, along with
+	// the most recent request so we have something to send it with.
+	quits   map[string]int
+	rejoins map[string]int
+	notice  *time.Timer
+	r       *seabird.Request
+}
+
+type splitUser struct {
+	user *trackedUser
+
+	// channels holds the names of the channels the user was in when they
+	// split.
+	channels []string
+
+	// final is the snapshot passed to session cleanup callbacks if the
+	// user doesn't come back.
+	final *User
+}
+
+func isNetsplitQuit(reason string) bool {
+	return netsplitRegexp.MatchString(reason)
+}
+
+// Implementation below. All of these functions must be called with the lock
+// held for writing.
+
+// splitUser removes a user who was lost in a netsplit from all channels,
+// but holds on to their session so it can be restored if they rejoin.
+func (p *ChannelTracker) splitUser(r *seabird.Request, user, servers string) {
+	logger := r.GetLogger("channel_track").WithFields(logrus.Fields{
+		"user":    user,
+		"servers": servers,
+	})
+
+	u := p.lookupUser(user)
+	if u == nil {
+		logger.Warn("User does not exist")
+		return
+	}
+
+	ns := p.splits[servers]
+	if ns == nil {
+		ns = &netsplit{
+			servers: servers,
+			users:   make(map[string]*splitUser),
+			quits:   make(map[string]int),
+			rejoins: make(map[string]int),
+		}
+		ns.expire = time.AfterFunc(p.config.SplitTimeout.Duration, func() {
+			p.update(func() {
+				p.expireSplit(ns)
+			})
+		})
+		p.splits[servers] = ns
+
+		logger.Info("Netsplit detected")
+	} else {
+		// The timeout is from the last user we saw split.
+		ns.expire.Reset(p.config.SplitTimeout.Duration)
+	}
+
+	su := &splitUser{
+		user:  u,
+		final: p.snapshotUser(u),
+	}
+
+	for channel := range u.channels {
+		c := p.channels[channel]
+		delete(c.users, u.uuid)
+
+		su.channels = append(su.channels, c.name)
+		ns.quits[c.name]++
+	}
+
+	u.channels = make(map[string]map[rune]bool)
+
+	key := p.fold(user)
+
+	delete(p.uuids, key)
+	delete(p.users, u.uuid)
+
+	ns.users[key] = su
+	p.splitUsers[key] = ns
+
+	p.queueSplitNotice(r, ns)
+
+	logger.WithField("userUUID", u.uuid).Info("Split user")
+}
+
+// restoreSplitUser brings back the session of a user who was lost in a
+// netsplit if they are joining with the same hostmask. If we never learned
+// their hostmask, there's no way to tell it's the same person, so the
+// session is dropped instead.
+func (p *ChannelTracker) restoreSplitUser(r *seabird.Request, user string) {
+	if p.lookupUser(user) != nil {
+		return
+	}
+
+	key := p.fold(user)
+
+	ns := p.splitUsers[key]
+	if ns == nil {
+		return
+	}
+
+	su := ns.users[key]
+	u := su.user
+
+	logger := r.GetLogger("channel_track").WithFields(logrus.Fields{
+		"user":     user,
+		"userUUID": u.uuid,
+		"servers":  ns.servers,
+	})
+
+	if u.ident == "" || u.host == "" {
+		p.removeSplitUser(ns, key)
+		p.pendingCleanup = append(p.pendingCleanup, su.final)
+
+		logger.Info("Dropped split user with unknown hostmask")
+
+		return
+	}
+
+	// Make sure this is the same person rather than someone who took their
+	// nick during the split.
+	if u.ident != r.Message.Prefix.User || u.host != r.Message.Prefix.Host {
+		return
+	}
+
+	p.removeSplitUser(ns, key)
+
+	u.nick = user
+	p.users[u.uuid] = u
+	p.uuids[key] = u.uuid
+
+	// When the servers rejoin, users are put back into all of their
+	// channels, so we count the rejoin everywhere now.
+	for _, channel := range su.channels {
+		ns.rejoins[channel]++
+	}
+
+	p.queueSplitNotice(r, ns)
+
+	logger.Info("Restored split user")
+}
+
+// removeSplitUser stops holding a split user's session. Once nobody is left,
+// the split is over.
+func (p *ChannelTracker) removeSplitUser(ns *netsplit, key string) {
+	delete(ns.users, key)
+	delete(p.splitUsers, key)
+
+	if len(ns.users) == 0 {
+		ns.expire.Stop()
+		delete(p.splits, ns.servers)
+	}
+}
+
+// expireSplit removes all sessions from a netsplit which haven't come back.
+func (p *ChannelTracker) expireSplit(ns *netsplit) {
+	// If everyone came back, this split is already gone.
+	if p.splits[ns.servers] != ns {
+		return
+	}
+
+	for key, su := range ns.users {
+		delete(p.splitUsers, key)
+		p.pendingCleanup = append(p.pendingCleanup, su.final)
+	}
+
+	ns.users = make(map[string]*splitUser)
+
+	delete(p.splits, ns.servers)
+}
+
+func (p *ChannelTracker) queueSplitNotice(r *seabird.Request, ns *netsplit) {
+	if !p.config.SplitNotices {
+		return
+	}
+
+	ns.r = r
+	p.splitNotices[ns] = true
+
+	if ns.notice == nil {
+		ns.notice = time.AfterFunc(splitNoticeDelay, func() {
+			// This won't run once the bot is shutting down.
+			p.lifecycle.Go(func(ctx context.Context) {
+				p.sendSplitNotices(ns)
+			})
+		})
+	} else {
+		ns.notice.Reset(splitNoticeDelay)
+	}
+}
+
+// sendSplitNotices sends a summary of the splits and rejoins since the last
+// summary to every channel involved. It must be called without the lock
+// held.
+func (p *ChannelTracker) sendSplitNotices(ns *netsplit) {
+	p.lock.Lock()
+
+	delete(p.splitNotices, ns)
+
+	r := ns.r
+	quits := ns.quits
+	rejoins := ns.rejoins
+
+	ns.quits = make(map[string]int)
+	ns.rejoins = make(map[string]int)
+
+	var channels []string
+
+	for channel := range quits {
+		channels = append(channels, channel)
+	}
+
+	for channel := range rejoins {
+		if _, ok := quits[channel]; !ok {
+			channels = append(channels, channel)
+		}
+	}
+
+	// Only send notices to channels we're still in.
+	var active []string
+
+	for _, channel := range channels {
+		if c := p.lookupChannel(channel); c != nil {
+			active = append(active, c.name)
+		}
+	}
+
+	p.lock.Unlock()
+
+	sort.Strings(active)
+
+	servers := strings.SplitN(ns.servers, " ", 2)
+
+	for _, channel := range active {
+		text, err := internal.RenderTemplate(splitNoticeTemplate, map[string]interface{}{
+			"channel":  channel,
+			"servers":  servers,
+			"split":    quits[channel],
+			"rejoined": rejoins[channel],
+		})
+		if err != nil {
+			r.GetLogger("channel_track").WithError(err).Error("Failed to render template")
+			return
+		}
+
+		r.Writef("NOTICE %s :%s", channel, text)
+	}
+}
+
+// stopSplitTimers stops every netsplit timer when the bot shuts down, so
+// nothing is sent or cleaned up after that.
+func (p *ChannelTracker) stopSplitTimers() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, ns := range p.splits {
+		ns.expire.Stop()
+	}
+
+	for ns := range p.splitNotices {
+		ns.notice.Stop()
+	}
+}
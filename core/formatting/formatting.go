@@ -0,0 +1,87 @@
+package formatting
+
+import (
+	seabird "github.com/belak/go-seabird"
+	channeltrack "github.com/belak/go-seabird-plugins/core/channel_track"
+	"github.com/belak/go-seabird-plugins/core/isupport"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+func init() {
+	seabird.RegisterPlugin("formatting", newFormattingPlugin)
+}
+
+type formattingConfig struct {
+	// Disable strips formatting from everything we send.
+	Disable bool
+
+	// DisableChannels lists channels which formatting is always stripped
+	// from.
+	DisableChannels []string
+
+	// RespectNoColors strips formatting from channels with +c set. This is
+	// on by default and needs the channel_track plugin.
+	RespectNoColors bool
+}
+
+type formattingPlugin struct {
+	config   *formattingConfig
+	isupport *isupport.Plugin
+	tracker  *channeltrack.ChannelTracker
+}
+
+func newFormattingPlugin(b *seabird.Bot) error {
+	config := &formattingConfig{RespectNoColors: true}
+
+	// The formatting section is optional.
+	err := internal.OptionalConfig(b, "formatting", config)
+	if err != nil {
+		return err
+	}
+
+	if err = b.EnsurePlugin("isupport"); err != nil {
+		return err
+	}
+
+	p := &formattingPlugin{
+		config:   config,
+		isupport: isupport.CtxISupport(b.Context()),
+	}
+
+	if config.RespectNoColors {
+		if err = b.EnsurePlugin("channel_track"); err != nil {
+			return err
+		}
+
+		p.tracker = channeltrack.CtxChannelTracker(b.Context())
+	}
+
+	internal.SetFormattingCheck(b, p.allowed)
+
+	return nil
+}
+
+// allowed returns true if formatting can be sent to target.
+func (p *formattingPlugin) allowed(target string) bool {
+	if p.config.Disable {
+		return false
+	}
+
+	// The case mapping can change when we connect, so we fold both sides
+	// every time.
+	folded := p.isupport.CaseFold(target)
+
+	for _, channel := range p.config.DisableChannels {
+		if p.isupport.CaseFold(channel) == folded {
+			return false
+		}
+	}
+
+	if p.tracker != nil {
+		if channel := p.tracker.LookupChannel(target); channel != nil && channel.HasMode('c') {
+			return false
+		}
+	}
+
+	return true
+}
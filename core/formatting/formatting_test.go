@@ -0,0 +1,52 @@
+package formatting
+
+import (
+	"testing"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+	"github.com/belak/go-seabird-plugins/testbot"
+
+	_ "github.com/belak/go-seabird-plugins/core/cap"
+	_ "github.com/belak/go-seabird-plugins/core/channel_track"
+	_ "github.com/belak/go-seabird-plugins/core/isupport"
+)
+
+const testConfig = `
+[formatting]
+disablechannels = ["#Plain"]
+`
+
+func TestFormatting(t *testing.T) {
+	// The bot replies to !bold with some bold text.
+	s := testbot.Start(t, []string{"cap", "isupport", "channel_track", "formatting"}, testConfig, func(b *seabird.Bot) {
+		b.CommandMux().Event("bold", func(r *seabird.Request) {
+			_ = internal.Replyf(r, "%s text", internal.Bold("bold"))
+		}, nil)
+	})
+	s.Register()
+
+	s.Send(
+		":seabird!seabird@example.com JOIN #seabird",
+		":seabird!seabird@example.com JOIN #plain",
+		":seabird!seabird@example.com JOIN #nocolors",
+		":irc.example.com MODE #nocolors +c",
+	)
+
+	s.Send(":belak!belak@example.com PRIVMSG #seabird :!bold")
+	s.WaitFor("PRIVMSG #seabird :\x02bold\x02 text")
+
+	// Channels in the config are matched case insensitively.
+	s.Send(":belak!belak@example.com PRIVMSG #plain :!bold")
+	s.WaitFor("PRIVMSG #plain :bold text")
+
+	s.Send(":belak!belak@example.com PRIVMSG #nocolors :!bold")
+	s.WaitFor("PRIVMSG #nocolors :bold text")
+
+	// Once +c is gone, formatting should come back.
+	s.Send(
+		":irc.example.com MODE #nocolors -c",
+		":belak!belak@example.com PRIVMSG #nocolors :!bold",
+	)
+	s.WaitFor("PRIVMSG #nocolors :\x02bold\x02 text")
+}
@@ -0,0 +1,137 @@
+package ignore
+
+import (
+	"errors"
+	"strings"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/core/permissions"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+var (
+	ignoredTemplate = internal.TemplateMustCompile("ignoreAdded", `
+Ignoring {{ .pattern }}.
+`).WithSample(map[string]interface{}{
+		"pattern": "*bot",
+	})
+
+	unignoredTemplate = internal.TemplateMustCompile("ignoreRemoved", `
+No longer ignoring {{ .pattern }}.
+`).WithSample(map[string]interface{}{
+		"pattern": "*bot",
+	})
+
+	listTemplate = internal.TemplateMustCompile("ignoreList", `
+{{ if .patterns }}Ignoring: {{ range $i, $p := .patterns }}{{ if $i }}, {{ end }}{{ $p }}{{ end }}{{ else }}Not ignoring anyone{{ end }}{{ if .bots }} (and all bots){{ end }}
+`).WithSample(map[string]interface{}{
+		"patterns": []string{"*bot", "account:gonzobot"},
+		"bots":     true,
+	})
+
+	patternRequiredTemplate = internal.TemplateMustCompile("ignorePatternRequired", `
+A single pattern is required
+`).WithSample(map[string]interface{}{})
+
+	notIgnoredTemplate = internal.TemplateMustCompile("ignoreNotIgnored", `
+{{ .pattern }} isn't being ignored
+`).WithSample(map[string]interface{}{
+		"pattern": "*bot",
+	})
+
+	addErrorTemplate = internal.TemplateMustCompile("ignoreAddError", `
+Error storing ignore: {{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("database is locked"),
+	})
+
+	removeErrorTemplate = internal.TemplateMustCompile("ignoreRemoveError", `
+Error removing ignore: {{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("database is locked"),
+	})
+)
+
+func (p *Plugin) registerCommands(cm *internal.CommandMux) {
+	cm.Event("ignore", p.perms.Require(permissions.RoleAdmin, p.ignoreCallback), &seabird.HelpInfo{
+		Usage:       "<nick pattern|hostmask|account:name>",
+		Description: "Stops the bot from responding to a user. Patterns can use * and ? wildcards.",
+	})
+
+	cm.Event("unignore", p.perms.Require(permissions.RoleAdmin, p.unignoreCallback), &seabird.HelpInfo{
+		Usage:       "<pattern>",
+		Description: "Removes a pattern added with ignore.",
+	})
+
+	cm.Event("ignores", p.perms.Require(permissions.RoleAdmin, p.ignoresCallback), &seabird.HelpInfo{
+		Description: "Lists everyone the bot is ignoring.",
+	})
+}
+
+// parsePattern normalizes the pattern given to ignore or unignore so it
+// matches what we stored.
+func (p *Plugin) parsePattern(r *seabird.Request) string {
+	pattern := strings.TrimSpace(r.Message.Trailing())
+
+	if strings.HasPrefix(pattern, accountPrefix) {
+		return accountPrefix + p.isupport.CaseFold(strings.TrimPrefix(pattern, accountPrefix))
+	}
+
+	return p.isupport.CaseFold(pattern)
+}
+
+func (p *Plugin) ignoreCallback(r *seabird.Request) {
+	pattern := p.parsePattern(r)
+	if pattern == "" || pattern == accountPrefix || strings.Contains(pattern, " ") {
+		internal.MentionReplyTemplate(r, patternRequiredTemplate, nil)
+		return
+	}
+
+	if err := p.AddIgnore(pattern); err != nil {
+		internal.MentionReplyTemplate(r, addErrorTemplate, map[string]interface{}{
+			"error": err,
+		})
+
+		return
+	}
+
+	internal.MentionReplyTemplate(r, ignoredTemplate, map[string]interface{}{
+		"pattern": pattern,
+	})
+}
+
+func (p *Plugin) unignoreCallback(r *seabird.Request) {
+	pattern := p.parsePattern(r)
+	if pattern == "" {
+		internal.MentionReplyTemplate(r, patternRequiredTemplate, nil)
+		return
+	}
+
+	removed, err := p.RemoveIgnore(pattern)
+	if err != nil {
+		internal.MentionReplyTemplate(r, removeErrorTemplate, map[string]interface{}{
+			"error": err,
+		})
+
+		return
+	}
+
+	if !removed {
+		internal.MentionReplyTemplate(r, notIgnoredTemplate, map[string]interface{}{
+			"pattern": pattern,
+		})
+
+		return
+	}
+
+	internal.MentionReplyTemplate(r, unignoredTemplate, map[string]interface{}{
+		"pattern": pattern,
+	})
+}
+
+func (p *Plugin) ignoresCallback(r *seabird.Request) {
+	internal.MentionReplyTemplate(r, listTemplate, map[string]interface{}{
+		"patterns": p.Ignores(),
+		"bots":     p.bots,
+	})
+}
@@ -0,0 +1,252 @@
+package ignore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	seabird "github.com/belak/go-seabird"
+	capPlugin "github.com/belak/go-seabird-plugins/core/cap"
+	channeltrack "github.com/belak/go-seabird-plugins/core/channel_track"
+	"github.com/belak/go-seabird-plugins/core/isupport"
+	"github.com/belak/go-seabird-plugins/core/permissions"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+func init() {
+	seabird.RegisterPlugin("ignore", newIgnorePlugin)
+}
+
+const contextKeyIgnore = internal.ContextKey("seabird-ignore")
+
+// CtxIgnore returns the ignore plugin for the bot.
+func CtxIgnore(ctx context.Context) *Plugin {
+	return ctx.Value(contextKeyIgnore).(*Plugin)
+}
+
+// accountPrefix marks a pattern as a services account.
+const accountPrefix = "account:"
+
+type ignoreConfig struct {
+	// Store is where ignores added from IRC are kept. The default is
+	// "memory", which loses them on restart. "db" keeps them in the db
+	// plugin's database, but only if extra/db is built in.
+	Store string
+
+	// Patterns are ignores which can't be removed from IRC. These can be
+	// nicks or nick patterns, nick!user@host masks or "account:name".
+	Patterns []string
+
+	// Bots ignores anyone with the +B bot mode. The server has to send the
+	// bot message tag, or the mode has to show up in WHO replies or MODE
+	// changes the channel tracker sees.
+	Bots bool
+}
+
+// Plugin keeps a list of users the bot shouldn't respond to. Every command,
+// mention and message handler registered through the internal muxes skips
+// messages from them.
+type Plugin struct {
+	isupport *isupport.Plugin
+	tracker  *channeltrack.ChannelTracker
+	perms    *permissions.Plugin
+	store    Store
+	bots     bool
+
+	lock     sync.RWMutex
+	fixed    []string
+	patterns []string
+}
+
+func newIgnorePlugin(b *seabird.Bot) error {
+	config := &ignoreConfig{Store: "memory"}
+
+	// The ignore section is optional.
+	err := internal.OptionalConfig(b, "ignore", config)
+	if err != nil {
+		return err
+	}
+
+	if err = b.EnsurePlugin("isupport"); err != nil {
+		return err
+	}
+
+	if err = b.EnsurePlugin("channel_track"); err != nil {
+		return err
+	}
+
+	if err = b.EnsurePlugin("permissions"); err != nil {
+		return err
+	}
+
+	p := &Plugin{
+		isupport: isupport.CtxISupport(b.Context()),
+		tracker:  channeltrack.CtxChannelTracker(b.Context()),
+		perms:    permissions.CtxPermissions(b.Context()),
+		bots:     config.Bots,
+		fixed:    config.Patterns,
+	}
+
+	// The bot tag is only sent to clients which support message tags.
+	if p.bots {
+		capPlugin.CtxCap(b.Context()).Request("message-tags")
+	}
+
+	storesLock.Lock()
+	factory, ok := stores[config.Store]
+	storesLock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("ignore: unknown store %q", config.Store)
+	}
+
+	p.store, err = factory(b)
+	if err != nil {
+		return err
+	}
+
+	p.patterns, err = p.store.Ignores()
+	if err != nil {
+		return err
+	}
+
+	b.SetValue(contextKeyIgnore, p)
+
+	internal.AddMessageFilter(b, func(r *seabird.Request) bool {
+		return !p.Ignored(r)
+	})
+
+	p.registerCommands(internal.NewCommandMux(b))
+
+	return nil
+}
+
+// isBot returns true if the message was sent by a user with the bot mode.
+func (p *Plugin) isBot(r *seabird.Request) bool {
+	for _, tag := range []string{"bot", "draft/bot"} {
+		if _, ok := r.Message.Tags.GetTag(tag); ok {
+			return true
+		}
+	}
+
+	if u := p.tracker.LookupUser(r.Message.Prefix.Name); u != nil {
+		return u.Bot
+	}
+
+	return false
+}
+
+// account returns the services account of whoever sent the request, or an
+// empty string if they aren't logged in or we don't know.
+func (p *Plugin) account(r *seabird.Request) string {
+	if account, ok := r.Message.Tags.GetTag("account"); ok && account != "*" {
+		return account
+	}
+
+	if u := p.tracker.LookupUser(r.Message.Prefix.Name); u != nil {
+		return u.Account
+	}
+
+	return ""
+}
+
+// matches returns true if the pattern refers to the sender of the request.
+// Patterns with a ! or @ are matched against the whole hostmask and
+// anything else is matched against the nick.
+func (p *Plugin) matches(pattern string, r *seabird.Request) bool {
+	if strings.HasPrefix(pattern, accountPrefix) {
+		account := p.account(r)
+		return account != "" && p.isupport.CaseEqual(strings.TrimPrefix(pattern, accountPrefix), account)
+	}
+
+	target := r.Message.Prefix.Name
+	if strings.ContainsAny(pattern, "!@") {
+		target = r.Message.Prefix.String()
+	}
+
+	return internal.MatchMask(p.isupport.CaseFold(pattern), p.isupport.CaseFold(target))
+}
+
+// Ignored returns true if the bot should ignore the sender of the request.
+// Admins are never ignored, so they can always fix the list.
+func (p *Plugin) Ignored(r *seabird.Request) bool {
+	if r.Message.Prefix == nil {
+		return false
+	}
+
+	if !(p.bots && p.isBot(r)) && !p.matchesAny(r) {
+		return false
+	}
+
+	return !p.perms.HasRole(r, permissions.RoleAdmin)
+}
+
+// matchesAny returns true if any pattern refers to the sender of the
+// request.
+func (p *Plugin) matchesAny(r *seabird.Request) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, patterns := range [][]string{p.fixed, p.patterns} {
+		for _, pattern := range patterns {
+			if p.matches(pattern, r) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Ignores returns the fixed patterns from the config followed by the stored
+// patterns.
+func (p *Plugin) Ignores() []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	ret := append([]string(nil), p.fixed...)
+
+	return append(ret, p.patterns...)
+}
+
+// AddIgnore stores a new pattern.
+func (p *Plugin) AddIgnore(pattern string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if err := p.store.AddIgnore(pattern); err != nil {
+		return err
+	}
+
+	for _, existing := range p.patterns {
+		if existing == pattern {
+			return nil
+		}
+	}
+
+	p.patterns = append(p.patterns, pattern)
+
+	return nil
+}
+
+// RemoveIgnore removes a stored pattern. Patterns from the config can't be
+// removed. It returns false if there was no matching pattern.
+func (p *Plugin) RemoveIgnore(pattern string) (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	removed, err := p.store.RemoveIgnore(pattern)
+	if err != nil || !removed {
+		return removed, err
+	}
+
+	for i, existing := range p.patterns {
+		if existing == pattern {
+			p.patterns = append(p.patterns[:i], p.patterns[i+1:]...)
+			break
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,97 @@
+package ignore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+	"github.com/belak/go-seabird-plugins/testbot"
+
+	_ "github.com/belak/go-seabird-plugins/core/cap"
+	_ "github.com/belak/go-seabird-plugins/core/channel_track"
+	_ "github.com/belak/go-seabird-plugins/core/isupport"
+	_ "github.com/belak/go-seabird-plugins/core/permissions"
+)
+
+var testPlugins = []string{"cap", "isupport", "channel_track", "permissions", "ignore"}
+
+const testConfig = `
+[permissions.grants]
+admin = ["admin!*@example.com"]
+
+[ignore]
+patterns = ["*Bot", "account:spammer"]
+bots = true
+`
+
+// addHandlers adds an echo command and a handler which replies to hello.
+func addHandlers(b *seabird.Bot) {
+	internal.NewCommandMux(b).Event("echo", func(r *seabird.Request) {
+		_ = internal.Replyf(r, "echo %s", r.Message.Trailing())
+	}, nil)
+
+	internal.NewBasicMux(b).Event("PRIVMSG", func(r *seabird.Request) {
+		if r.Message.Trailing() == "hello" {
+			_ = internal.Replyf(r, "hello %s", r.Message.Prefix.Name)
+		}
+	})
+}
+
+func TestIgnore(t *testing.T) {
+	s := testbot.Start(t, testPlugins, testConfig, addHandlers)
+	s.Register()
+
+	// Everything here is sent privately, so the channel tracker doesn't
+	// send anything of its own.
+	s.Send(
+		":otherbot!bot@example.com PRIVMSG seabird :!echo one",
+		":OTHERBOT!bot@example.com PRIVMSG seabird :hello",
+		"@bot :helper!helper@example.com PRIVMSG seabird :!echo two",
+		"@account=spammer :someone!someone@example.com PRIVMSG seabird :hello",
+		":user!user@example.com PRIVMSG seabird :!echo three",
+	)
+	s.Expect("PRIVMSG user :echo three")
+
+	// Admins are never ignored, even if they're bots.
+	s.Send("@bot :admin!admin@example.com PRIVMSG seabird :!ignore User!*@*")
+	s.Expect("PRIVMSG admin :Ignoring user!*@*.")
+
+	s.Send(
+		":user!user@example.com PRIVMSG seabird :hello",
+		":admin!admin@example.com PRIVMSG seabird :!ignores",
+	)
+	s.Expect("PRIVMSG admin :Ignoring: *Bot, account:spammer, user!*@* (and all bots)")
+
+	// Only admins can change the list.
+	s.Send(":friend!friend@example.com PRIVMSG seabird :!unignore user!*@*")
+	s.Expect("PRIVMSG friend :You need to be admin to do that.")
+
+	s.Send(":admin!admin@example.com PRIVMSG seabird :!unignore user!*@*")
+	s.Expect("PRIVMSG admin :No longer ignoring user!*@*.")
+
+	s.Send(":user!user@example.com PRIVMSG seabird :hello")
+	s.Expect("PRIVMSG user :hello user")
+}
+
+func TestIgnoreBotMode(t *testing.T) {
+	s := testbot.Start(t, testPlugins, testConfig, addHandlers)
+	s.Register()
+
+	// Without the bot tag, the bot mode can only come from the tracker.
+	s.Send(
+		":irc.example.com 005 seabird BOT=B :are supported by this server",
+		":seabird!seabird@example.com JOIN #chan",
+	)
+	s.WaitFor("WHO #chan")
+	s.Send(
+		":irc.example.com 353 seabird = #chan :seabird helper user",
+		":irc.example.com 352 seabird #chan helper example.com irc.example.com helper HB :0 Helper",
+		":irc.example.com 352 seabird #chan user example.com irc.example.com user H :0 User",
+		":irc.example.com 315 seabird #chan :End of WHO list",
+		":helper!helper@example.com PRIVMSG #chan :hello",
+		":user!user@example.com PRIVMSG #chan :hello",
+	)
+	require.Equal(t, "PRIVMSG #chan :hello user", s.WaitForPrefix("PRIVMSG "))
+}
@@ -0,0 +1,87 @@
+package ignore
+
+import (
+	"sync"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+// Store is where ignores added from IRC are kept. All methods must be safe
+// to call from multiple goroutines.
+type Store interface {
+	// Ignores returns every stored pattern.
+	Ignores() ([]string, error)
+
+	// AddIgnore stores a pattern. Adding a pattern which already exists is
+	// not an error.
+	AddIgnore(pattern string) error
+
+	// RemoveIgnore removes a pattern, returning false if it didn't exist.
+	RemoveIgnore(pattern string) (bool, error)
+}
+
+// StoreFactory creates a Store. It is called when the ignore plugin is
+// loaded, so it can depend on other plugins.
+type StoreFactory func(b *seabird.Bot) (Store, error)
+
+var (
+	storesLock sync.Mutex
+	stores     = map[string]StoreFactory{
+		"memory": newMemoryStore,
+	}
+)
+
+// RegisterStore makes a store available to use in the ignore config. It
+// should be called from init.
+func RegisterStore(name string, factory StoreFactory) {
+	storesLock.Lock()
+	defer storesLock.Unlock()
+
+	stores[name] = factory
+}
+
+// memoryStore keeps ignores until the bot is restarted.
+type memoryStore struct {
+	lock     sync.Mutex
+	patterns []string
+}
+
+func newMemoryStore(b *seabird.Bot) (Store, error) {
+	return &memoryStore{}, nil
+}
+
+func (s *memoryStore) Ignores() ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string(nil), s.patterns...), nil
+}
+
+func (s *memoryStore) AddIgnore(pattern string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, existing := range s.patterns {
+		if existing == pattern {
+			return nil
+		}
+	}
+
+	s.patterns = append(s.patterns, pattern)
+
+	return nil
+}
+
+func (s *memoryStore) RemoveIgnore(pattern string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, existing := range s.patterns {
+		if existing == pattern {
+			s.patterns = append(s.patterns[:i], s.patterns[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
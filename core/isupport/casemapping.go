@@ -0,0 +1,51 @@
+package isupport
+
+import "strings"
+
+// Known values for the CASEMAPPING ISupport token.
+const (
+	CaseMappingASCII         = "ascii"
+	CaseMappingRFC1459       = "rfc1459"
+	CaseMappingRFC1459Strict = "rfc1459-strict"
+)
+
+// FoldCase returns the canonical form of a nick or channel name under the
+// given CASEMAPPING, so two names are equal on the server if their folded
+// forms are equal. Unknown mappings are lowercased as unicode.
+func FoldCase(caseMapping, name string) string {
+	var upper byte
+
+	switch caseMapping {
+	case CaseMappingASCII:
+		upper = 'Z'
+	case CaseMappingRFC1459:
+		// rfc1459 also considers []\~ to be the uppercase forms of {}|^
+		upper = '^'
+	case CaseMappingRFC1459Strict:
+		// rfc1459-strict is the same as rfc1459, but without ~ and ^
+		upper = ']'
+	default:
+		return strings.ToLower(name)
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= rune(upper) {
+			return r + ('a' - 'A')
+		}
+
+		return r
+	}, name)
+}
+
+// CaseFold returns the canonical form of a nick or channel name using the
+// CASEMAPPING of the current connection. It should be used whenever names
+// are compared or used as keys.
+func (p *Plugin) CaseFold(name string) string {
+	return FoldCase(p.CaseMapping(), name)
+}
+
+// CaseEqual returns true if the two names are the same using the
+// CASEMAPPING of the current connection.
+func (p *Plugin) CaseEqual(a, b string) bool {
+	return p.CaseFold(a) == p.CaseFold(b)
+}
@@ -0,0 +1,24 @@
+package isupport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldCase(t *testing.T) {
+	var testCases = []struct {
+		caseMapping string
+		input       string
+		expected    string
+	}{
+		{CaseMappingASCII, "Foo[m]~", "foo[m]~"},
+		{CaseMappingRFC1459, "Foo[m]\\^", "foo{m}|~"},
+		{CaseMappingRFC1459Strict, "Foo[m]\\^", "foo{m}|^"},
+		{"", "FÖO[m]", "föo[m]"},
+	}
+
+	for _, testCase := range testCases {
+		require.Equal(t, testCase.expected, FoldCase(testCase.caseMapping, testCase.input))
+	}
+}
@@ -2,7 +2,9 @@ package isupport
 
 import (
 	"context"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 
@@ -21,19 +23,19 @@ func CtxISupport(ctx context.Context) *Plugin {
 }
 
 // Plugin tracks which ISupport features are enabled on the
-// current connection.
+// current connection. It is safe to use from any goroutine.
 type Plugin struct {
-	raw map[string]string
+	lock sync.RWMutex
+	raw  map[string]string
 }
 
 func newISupportPlugin(b *seabird.Bot) error {
 	bm := b.BasicMux()
 
 	p := &Plugin{
-		raw: map[string]string{
-			"PREFIX": "(ov)@+",
-		},
+		raw: copyDefaults(),
 	}
+	bm.Event("001", p.handle001)
 	bm.Event("005", p.handle005)
 
 	b.SetValue(contextKeyISupport, p)
@@ -41,6 +43,24 @@ func newISupportPlugin(b *seabird.Bot) error {
 	return nil
 }
 
+func copyDefaults() map[string]string {
+	ret := make(map[string]string)
+	for k, v := range defaults {
+		ret[k] = v
+	}
+
+	return ret
+}
+
+// handle001 resets everything when we connect so values from a previous
+// connection don't stick around.
+func (p *Plugin) handle001(r *seabird.Request) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.raw = copyDefaults()
+}
+
 func (p *Plugin) handle005(r *seabird.Request) {
 	logger := r.GetLogger("isupport")
 
@@ -55,13 +75,34 @@ func (p *Plugin) handle005(r *seabird.Request) {
 		return
 	}
 
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
 	for _, param := range r.Message.Params[1 : len(r.Message.Params)-1] {
+		// -KEY means the server no longer supports something, so we go
+		// back to the default if there is one.
+		if strings.HasPrefix(param, "-") {
+			key := param[1:]
+
+			if v, ok := defaults[key]; ok {
+				p.raw[key] = v
+			} else {
+				delete(p.raw, key)
+			}
+
+			logger.WithField("key", key).Debug("Unsetting ISupport value")
+
+			continue
+		}
+
 		data := strings.SplitN(param, "=", 2)
 		if len(data) < 2 {
 			p.raw[data[0]] = ""
 			continue
 		}
 
+		data[1] = unescapeValue(data[1])
+
 		p.raw[data[0]] = data[1]
 
 		logger.WithFields(logrus.Fields{
@@ -71,15 +112,43 @@ func (p *Plugin) handle005(r *seabird.Request) {
 	}
 }
 
+// unescapeValue converts the \xHH escapes servers use for special
+// characters in values.
+func unescapeValue(value string) string {
+	if !strings.Contains(value, "\\x") {
+		return value
+	}
+
+	var ret strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) && value[i+1] == 'x' {
+			if b, err := strconv.ParseUint(value[i+2:i+4], 16, 8); err == nil {
+				ret.WriteByte(byte(b))
+				i += 3
+
+				continue
+			}
+		}
+
+		ret.WriteByte(value[i])
+	}
+
+	return ret.String()
+}
+
 // IsEnabled will check for boolean ISupport values
 func (p *Plugin) IsEnabled(key string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
 	_, ok := p.raw[key]
 	return ok
 }
 
 // GetList will check for list ISupportValues
 func (p *Plugin) GetList(key string) ([]string, bool) {
-	data, ok := p.raw[key]
+	data, ok := p.GetRaw(key)
 	if !ok {
 		return nil, false
 	}
@@ -89,7 +158,7 @@ func (p *Plugin) GetList(key string) ([]string, bool) {
 
 // GetMap will check for map ISupport values
 func (p *Plugin) GetMap(key string) (map[string]string, bool) {
-	data, ok := p.raw[key]
+	data, ok := p.GetRaw(key)
 	if !ok {
 		return nil, false
 	}
@@ -110,6 +179,9 @@ func (p *Plugin) GetMap(key string) (map[string]string, bool) {
 
 // GetRaw will get the raw ISupport values
 func (p *Plugin) GetRaw(key string) (string, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
 	ret, ok := p.raw[key]
 	return ret, ok
 }
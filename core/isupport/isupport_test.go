@@ -0,0 +1,105 @@
+package isupport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	irc "gopkg.in/irc.v3"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+func newTestPlugin(t *testing.T) (*seabird.Bot, *Plugin) {
+	b := testbot.NewBot(t, []string{"isupport"}, "")
+
+	require.NoError(t, newISupportPlugin(b))
+
+	return b, CtxISupport(b.Context())
+}
+
+func handle(b *seabird.Bot, f func(r *seabird.Request), line string) {
+	f(seabird.NewRequest(b.Context(), b, "seabird", irc.MustParseMessage(line)))
+}
+
+func TestDefaults(t *testing.T) {
+	_, p := newTestPlugin(t)
+
+	require.Equal(t, []PrefixMode{{'o', '@'}, {'v', '+'}}, p.Prefix())
+	require.Equal(t, ChanModes{A: "b", B: "k", C: "l", D: "imnpst"}, p.ChanModes())
+	require.Equal(t, "#&", p.ChanTypes())
+	require.Equal(t, CaseMappingRFC1459, p.CaseMapping())
+	require.Equal(t, 0, p.NickLen())
+	require.Equal(t, "", p.Network())
+	require.Equal(t, rune(0), p.BotMode())
+
+	_, ok := p.TargMax("PRIVMSG")
+	require.False(t, ok)
+}
+
+func TestTypedValues(t *testing.T) {
+	b, p := newTestPlugin(t)
+
+	handle(b, p.handle005, ":irc.example.com 005 seabird PREFIX=(qaohv)~&@%+ CHANMODES=beI,k,l,imnpst,XYZ "+
+		"CHANTYPES=# NICKLEN=30 TOPICLEN=390 :are supported by this server")
+	handle(b, p.handle005, ":irc.example.com 005 seabird TARGMAX=PRIVMSG:4,JOIN: MAXLIST=beI:100,q:10 "+
+		"CASEMAPPING=ascii NETWORK=Example\\x20Net STATUSMSG=@+ BOT=B :are supported by this server")
+
+	require.Equal(t, []PrefixMode{
+		{'q', '~'}, {'a', '&'}, {'o', '@'}, {'h', '%'}, {'v', '+'},
+	}, p.Prefix())
+	require.Equal(t, "qaohv", p.PrefixModes())
+	require.Equal(t, 'h', p.PrefixSymbols()['%'])
+	require.Equal(t, ChanModes{A: "beI", B: "k", C: "l", D: "imnpst"}, p.ChanModes())
+	require.Equal(t, "#", p.ChanTypes())
+	require.True(t, p.IsChannel("#chan"))
+	require.False(t, p.IsChannel("&chan"))
+	require.Equal(t, 30, p.NickLen())
+	require.Equal(t, 390, p.TopicLen())
+	require.Equal(t, CaseMappingASCII, p.CaseMapping())
+	require.Equal(t, "Example Net", p.Network())
+	require.Equal(t, "@+", p.StatusMsg())
+	require.Equal(t, 'B', p.BotMode())
+	require.ElementsMatch(t, []ListLimit{{"beI", 100}, {"q", 10}}, p.MaxList())
+
+	limit, ok := p.TargMax("privmsg")
+	require.True(t, ok)
+	require.Equal(t, 4, limit)
+
+	_, ok = p.TargMax("JOIN")
+	require.False(t, ok)
+}
+
+func TestInvalidPrefix(t *testing.T) {
+	b, p := newTestPlugin(t)
+
+	handle(b, p.handle005, ":irc.example.com 005 seabird PREFIX=(ov)@ :are supported by this server")
+	require.Equal(t, "ov", p.PrefixModes())
+
+	handle(b, p.handle005, ":irc.example.com 005 seabird PREFIX= :are supported by this server")
+	require.Empty(t, p.Prefix())
+}
+
+func TestNegation(t *testing.T) {
+	b, p := newTestPlugin(t)
+
+	handle(b, p.handle005, ":irc.example.com 005 seabird WHOX CHANTYPES=# NICKLEN=30 :are supported by this server")
+	require.True(t, p.IsEnabled("WHOX"))
+
+	handle(b, p.handle005, ":irc.example.com 005 seabird -WHOX -CHANTYPES -NICKLEN :are supported by this server")
+	require.False(t, p.IsEnabled("WHOX"))
+	require.Equal(t, "#&", p.ChanTypes())
+	require.Equal(t, 0, p.NickLen())
+}
+
+func TestResetOnConnect(t *testing.T) {
+	b, p := newTestPlugin(t)
+
+	handle(b, p.handle005, ":irc.example.com 005 seabird WHOX NETWORK=Example CASEMAPPING=ascii :are supported by this server")
+	require.Equal(t, "Example", p.Network())
+
+	handle(b, p.handle001, ":irc.example.com 001 seabird :Welcome")
+	require.False(t, p.IsEnabled("WHOX"))
+	require.Equal(t, "", p.Network())
+	require.Equal(t, CaseMappingRFC1459, p.CaseMapping())
+}
@@ -0,0 +1,228 @@
+package isupport
+
+import (
+	"strconv"
+	"strings"
+)
+
+// defaults are the values we assume before the server tells us otherwise.
+// These are what RFC1459 servers support.
+var defaults = map[string]string{
+	"PREFIX":      "(ov)@+",
+	"CHANMODES":   "b,k,l,imnpst",
+	"CHANTYPES":   "#&",
+	"CASEMAPPING": CaseMappingRFC1459,
+}
+
+// PrefixMode is a channel membership mode along with the symbol used for it
+// in NAMES and WHO replies.
+type PrefixMode struct {
+	Mode   rune
+	Symbol rune
+}
+
+// ChanModes is the CHANMODES value split into its classes.
+type ChanModes struct {
+	// A are list modes which always take a parameter, like bans.
+	A string
+
+	// B are settings which always take a parameter, like the channel key.
+	B string
+
+	// C are settings which only take a parameter when being set, like the
+	// user limit.
+	C string
+
+	// D are flags which never take a parameter.
+	D string
+}
+
+// ListLimit is the maximum number of entries allowed in a group of list
+// modes. The limit is shared between all of the modes in the group.
+type ListLimit struct {
+	Modes string
+	Limit int
+}
+
+// Prefix returns the channel membership modes in order from highest to
+// lowest. If the server sent an invalid PREFIX, the RFC1459 modes are
+// returned.
+func (p *Plugin) Prefix() []PrefixMode {
+	raw, _ := p.GetRaw("PREFIX")
+
+	ret, ok := parsePrefix(raw)
+	if !ok {
+		ret, _ = parsePrefix(defaults["PREFIX"])
+	}
+
+	return ret
+}
+
+func parsePrefix(raw string) ([]PrefixMode, bool) {
+	// Servers with no membership modes send an empty PREFIX.
+	if raw == "" {
+		return nil, true
+	}
+
+	// Sample: (qaohv)~&@%+
+	i := strings.IndexByte(raw, ')')
+	if raw[0] != '(' || i < 0 {
+		return nil, false
+	}
+
+	modes := []rune(raw[1:i])
+	symbols := []rune(raw[i+1:])
+
+	if len(modes) != len(symbols) {
+		return nil, false
+	}
+
+	ret := make([]PrefixMode, len(modes))
+	for k := range modes {
+		ret[k] = PrefixMode{Mode: modes[k], Symbol: symbols[k]}
+	}
+
+	return ret, true
+}
+
+// PrefixModes returns the channel membership modes, like "ov".
+func (p *Plugin) PrefixModes() string {
+	var ret []rune
+	for _, prefix := range p.Prefix() {
+		ret = append(ret, prefix.Mode)
+	}
+
+	return string(ret)
+}
+
+// PrefixSymbols returns a mapping of membership symbols, like @, to the
+// mode they represent.
+func (p *Plugin) PrefixSymbols() map[rune]rune {
+	ret := make(map[rune]rune)
+	for _, prefix := range p.Prefix() {
+		ret[prefix.Symbol] = prefix.Mode
+	}
+
+	return ret
+}
+
+// ChanModes returns the channel modes supported by the server.
+func (p *Plugin) ChanModes() ChanModes {
+	raw, _ := p.GetRaw("CHANMODES")
+
+	// There may be more than 4 classes in the future, but we can't know
+	// how they work, so they're ignored.
+	classes := make([]string, 4)
+	copy(classes, strings.Split(raw, ","))
+
+	return ChanModes{
+		A: classes[0],
+		B: classes[1],
+		C: classes[2],
+		D: classes[3],
+	}
+}
+
+// ChanTypes returns the characters channel names can start with.
+func (p *Plugin) ChanTypes() string {
+	ret, _ := p.GetRaw("CHANTYPES")
+	return ret
+}
+
+// IsChannel returns true if the given target is a channel name.
+func (p *Plugin) IsChannel(target string) bool {
+	return target != "" && strings.ContainsRune(p.ChanTypes(), rune(target[0]))
+}
+
+// NickLen returns the maximum length of a nick, or 0 if we don't know.
+func (p *Plugin) NickLen() int {
+	return p.getInt("NICKLEN")
+}
+
+// TopicLen returns the maximum length of a topic, or 0 if there is no limit
+// or we don't know.
+func (p *Plugin) TopicLen() int {
+	return p.getInt("TOPICLEN")
+}
+
+// TargMax returns the maximum number of targets for the given command. The
+// bool will be false if there is no limit or the server didn't tell us.
+func (p *Plugin) TargMax(command string) (int, bool) {
+	targets, ok := p.GetMap("TARGMAX")
+	if !ok {
+		return 0, false
+	}
+
+	limit, err := strconv.Atoi(targets[strings.ToUpper(command)])
+	if err != nil {
+		return 0, false
+	}
+
+	return limit, true
+}
+
+// MaxList returns the limits on the number of entries in list modes.
+func (p *Plugin) MaxList() []ListLimit {
+	limits, ok := p.GetMap("MAXLIST")
+	if !ok {
+		return nil
+	}
+
+	var ret []ListLimit
+
+	for modes, rawLimit := range limits {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil {
+			continue
+		}
+
+		ret = append(ret, ListLimit{Modes: modes, Limit: limit})
+	}
+
+	return ret
+}
+
+// CaseMapping returns the CASEMAPPING the server uses to compare names.
+func (p *Plugin) CaseMapping() string {
+	ret, _ := p.GetRaw("CASEMAPPING")
+	return ret
+}
+
+// Network returns the name of the network, or an empty string if the server
+// didn't tell us.
+func (p *Plugin) Network() string {
+	ret, _ := p.GetRaw("NETWORK")
+	return ret
+}
+
+// StatusMsg returns the membership symbols which can be used to send a
+// message to only the users with that status in a channel, like @#channel.
+func (p *Plugin) StatusMsg() string {
+	ret, _ := p.GetRaw("STATUSMSG")
+	return ret
+}
+
+// BotMode returns the user mode the server uses to mark bots, or 0 if the
+// server didn't tell us.
+func (p *Plugin) BotMode() rune {
+	raw, _ := p.GetRaw("BOT")
+	for _, mode := range raw {
+		return mode
+	}
+
+	return 0
+}
+
+func (p *Plugin) getInt(key string) int {
+	raw, ok := p.GetRaw(key)
+	if !ok {
+		return 0
+	}
+
+	ret, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0
+	}
+
+	return ret
+}
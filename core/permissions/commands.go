@@ -0,0 +1,293 @@
+package permissions
+
+import (
+	"errors"
+	"strings"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+var sampleGrant = Grant{
+	Role:    RoleTrusted,
+	Subject: "account:belak",
+	Channel: "#seabird",
+}
+
+var (
+	grantedTemplate = internal.TemplateMustCompile("permissionsGranted", `
+Granted {{ .grant.Role }} to {{ .grant.Subject }}{{ with .grant.Channel }} in {{ . }}{{ end }}.
+`).WithSample(map[string]interface{}{
+		"grant": sampleGrant,
+	})
+
+	revokedTemplate = internal.TemplateMustCompile("permissionsRevoked", `
+Revoked {{ .grant.Role }} from {{ .grant.Subject }}{{ with .grant.Channel }} in {{ . }}{{ end }}.
+`).WithSample(map[string]interface{}{
+		"grant": sampleGrant,
+	})
+
+	grantTemplate = internal.TemplateMustCompile("permissionsGrant", `
+{{ .grant.Role }}: {{ .grant.Subject }}{{ with .grant.Channel }} in {{ . }}{{ end }}{{ if .fixed }} (from config){{ end }}
+`).WithSample(map[string]interface{}{
+		"grant": sampleGrant,
+		"fixed": false,
+	})
+
+	whoamiTemplate = internal.TemplateMustCompile("permissionsWhoami", `
+{{ if .role }}You are {{ .role }}{{ else }}You don't have any roles{{ end }}{{ with .channel }} in {{ . }}{{ end }}.
+`).WithSample(map[string]interface{}{
+		"role":    RoleAdmin,
+		"channel": "#seabird",
+	})
+
+	noGrantsTemplate = internal.TemplateMustCompile("permissionsNoGrants", `
+No roles have been granted
+`).WithSample(map[string]interface{}{})
+
+	notGrantedTemplate = internal.TemplateMustCompile("permissionsNotGranted", `
+{{ .grant.Subject }} doesn't have that grant
+`).WithSample(map[string]interface{}{
+		"grant": sampleGrant,
+	})
+
+	addErrorTemplate = internal.TemplateMustCompile("permissionsAddError", `
+Error storing grant: {{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("database is locked"),
+	})
+
+	removeErrorTemplate = internal.TemplateMustCompile("permissionsRemoveError", `
+Error removing grant: {{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("database is locked"),
+	})
+)
+
+// Replies for invalid arguments to grant and revoke.
+var (
+	grantUsageTemplate = internal.TemplateMustCompile("permissionsGrantUsage", `
+usage: <role> <nick|account:name|hostmask> [#channel]
+`).WithSample(map[string]interface{}{})
+
+	unknownRoleTemplate = internal.TemplateMustCompile("permissionsUnknownRole", `
+unknown role {{ printf "%q" .role }}
+`).WithSample(map[string]interface{}{
+		"role": "wizard",
+	})
+
+	ownerOnlyTemplate = internal.TemplateMustCompile("permissionsOwnerOnly", `
+only owners can change the {{ .role }} role
+`).WithSample(map[string]interface{}{
+		"role": RoleAdmin,
+	})
+
+	missingAccountTemplate = internal.TemplateMustCompile("permissionsMissingAccount", `
+missing account name
+`).WithSample(map[string]interface{}{})
+
+	unknownUserTemplate = internal.TemplateMustCompile("permissionsUnknownUser", `
+I don't know who {{ .nick }} is
+`).WithSample(map[string]interface{}{
+		"nick": "belak",
+	})
+
+	notLoggedInTemplate = internal.TemplateMustCompile("permissionsNotLoggedIn", `
+{{ .nick }} isn't logged in to services, use a hostmask instead
+`).WithSample(map[string]interface{}{
+		"nick": "belak",
+	})
+
+	notChannelTemplate = internal.TemplateMustCompile("permissionsNotChannel", `
+{{ printf "%q" .channel }} is not a channel
+`).WithSample(map[string]interface{}{
+		"channel": "seabird",
+	})
+)
+
+func (p *Plugin) registerCommands(cm *internal.CommandMux) {
+	cm.Event("grant", p.Require(RoleAdmin, p.grantCallback), &seabird.HelpInfo{
+		Usage:       "<role> <nick|account:name|hostmask> [#channel]",
+		Description: "Grants a role to a user. Roles are owner, admin, channel-op and trusted. Only owners can grant admin or owner.",
+	})
+
+	cm.Event("revoke", p.Require(RoleAdmin, p.revokeCallback), &seabird.HelpInfo{
+		Usage:       "<role> <nick|account:name|hostmask> [#channel]",
+		Description: "Revokes a role granted with grant.",
+	})
+
+	cm.Event("grants", p.Require(RoleAdmin, p.grantsCallback), &seabird.HelpInfo{
+		Description: "Lists every role which has been granted.",
+	})
+
+	cm.Event("whoami", p.whoamiCallback, &seabird.HelpInfo{
+		Description: "Tells you what role you have.",
+	})
+}
+
+// parseGrant reads a grant from the arguments to grant or revoke and checks
+// the sender is allowed to change it. If it can't, it replies saying why
+// and returns false.
+func (p *Plugin) parseGrant(r *seabird.Request) (Grant, bool) {
+	args := strings.Fields(r.Message.Trailing())
+	if len(args) < 2 || len(args) > 3 {
+		internal.MentionReplyTemplate(r, grantUsageTemplate, nil)
+		return Grant{}, false
+	}
+
+	role, err := ParseRole(args[0])
+	if err != nil {
+		internal.MentionReplyTemplate(r, unknownRoleTemplate, map[string]interface{}{
+			"role": strings.ToLower(args[0]),
+		})
+
+		return Grant{}, false
+	}
+
+	// Owners can do anything, but everyone else can only hand out roles
+	// below their own.
+	if sender := p.Role(r); sender != RoleOwner && role >= sender {
+		internal.MentionReplyTemplate(r, ownerOnlyTemplate, map[string]interface{}{
+			"role": role,
+		})
+
+		return Grant{}, false
+	}
+
+	subject, ok := p.resolveSubject(r, args[1])
+	if !ok {
+		return Grant{}, false
+	}
+
+	g := Grant{Role: role, Subject: subject}
+
+	if len(args) == 3 {
+		if !p.isupport.IsChannel(args[2]) {
+			internal.MentionReplyTemplate(r, notChannelTemplate, map[string]interface{}{
+				"channel": args[2],
+			})
+
+			return Grant{}, false
+		}
+
+		g.Channel = p.isupport.CaseFold(args[2])
+	}
+
+	return g, true
+}
+
+// resolveSubject turns a grant argument into a subject. Nicks are looked up
+// and converted to their services account, as a nick on its own can be
+// used by anyone. If that isn't possible, it replies saying why and returns
+// false.
+func (p *Plugin) resolveSubject(r *seabird.Request, arg string) (string, bool) {
+	if strings.HasPrefix(arg, accountPrefix) {
+		account := strings.TrimPrefix(arg, accountPrefix)
+		if account == "" {
+			internal.MentionReplyTemplate(r, missingAccountTemplate, nil)
+			return "", false
+		}
+
+		return accountPrefix + p.isupport.CaseFold(account), true
+	}
+
+	if strings.ContainsAny(arg, "!@*?") {
+		return p.isupport.CaseFold(arg), true
+	}
+
+	u := p.tracker.LookupUser(arg)
+	if u == nil {
+		internal.MentionReplyTemplate(r, unknownUserTemplate, map[string]interface{}{
+			"nick": arg,
+		})
+
+		return "", false
+	}
+
+	if u.Account == "" {
+		internal.MentionReplyTemplate(r, notLoggedInTemplate, map[string]interface{}{
+			"nick": u.Nick,
+		})
+
+		return "", false
+	}
+
+	return accountPrefix + p.isupport.CaseFold(u.Account), true
+}
+
+func (p *Plugin) grantCallback(r *seabird.Request) {
+	g, ok := p.parseGrant(r)
+	if !ok {
+		return
+	}
+
+	if err := p.AddGrant(g); err != nil {
+		internal.MentionReplyTemplate(r, addErrorTemplate, map[string]interface{}{
+			"error": err,
+		})
+
+		return
+	}
+
+	internal.MentionReplyTemplate(r, grantedTemplate, map[string]interface{}{
+		"grant": g,
+	})
+}
+
+func (p *Plugin) revokeCallback(r *seabird.Request) {
+	g, ok := p.parseGrant(r)
+	if !ok {
+		return
+	}
+
+	removed, err := p.RemoveGrant(g)
+	if err != nil {
+		internal.MentionReplyTemplate(r, removeErrorTemplate, map[string]interface{}{
+			"error": err,
+		})
+
+		return
+	}
+
+	if !removed {
+		internal.MentionReplyTemplate(r, notGrantedTemplate, map[string]interface{}{
+			"grant": g,
+		})
+
+		return
+	}
+
+	internal.MentionReplyTemplate(r, revokedTemplate, map[string]interface{}{
+		"grant": g,
+	})
+}
+
+func (p *Plugin) grantsCallback(r *seabird.Request) {
+	// Fixed grants never change, so they're always first.
+	fixed := len(p.fixed)
+
+	grants := p.Grants()
+	if len(grants) == 0 {
+		internal.MentionReplyTemplate(r, noGrantsTemplate, nil)
+		return
+	}
+
+	for i, g := range grants {
+		internal.ReplyTemplate(r, grantTemplate, map[string]interface{}{
+			"grant": g,
+			"fixed": i < fixed,
+		})
+	}
+}
+
+func (p *Plugin) whoamiCallback(r *seabird.Request) {
+	var channel string
+	if r.FromChannel() {
+		channel = r.Message.Params[0]
+	}
+
+	internal.MentionReplyTemplate(r, whoamiTemplate, map[string]interface{}{
+		"role":    p.Role(r),
+		"channel": channel,
+	})
+}
@@ -0,0 +1,348 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	seabird "github.com/belak/go-seabird"
+	capPlugin "github.com/belak/go-seabird-plugins/core/cap"
+	channeltrack "github.com/belak/go-seabird-plugins/core/channel_track"
+	"github.com/belak/go-seabird-plugins/core/isupport"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+func init() {
+	seabird.RegisterPlugin("permissions", newPermissionsPlugin)
+}
+
+const contextKeyPermissions = internal.ContextKey("seabird-permissions")
+
+// CtxPermissions returns the permissions plugin for the bot.
+func CtxPermissions(ctx context.Context) *Plugin {
+	return ctx.Value(contextKeyPermissions).(*Plugin)
+}
+
+// accountPrefix marks a subject as a services account rather than a
+// hostmask.
+const accountPrefix = "account:"
+
+var deniedTemplate = internal.TemplateMustCompile("permissionsDenied", `
+You need to be {{ .role }} to do that.
+`).WithSample(map[string]interface{}{
+	"role": RoleTrusted,
+})
+
+// Role is a level of access. Each role includes everything the roles below
+// it can do.
+type Role int
+
+// The available roles, from least to most access.
+const (
+	RoleNone Role = iota
+	RoleTrusted
+	RoleChannelOp
+	RoleAdmin
+	RoleOwner
+)
+
+var roleNames = map[Role]string{
+	RoleNone:      "none",
+	RoleTrusted:   "trusted",
+	RoleChannelOp: "channel-op",
+	RoleAdmin:     "admin",
+	RoleOwner:     "owner",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole looks up a role by name. RoleNone can't be parsed, as it can't
+// be granted.
+func ParseRole(name string) (Role, error) {
+	name = strings.ToLower(name)
+
+	for role, roleName := range roleNames {
+		if role != RoleNone && roleName == name {
+			return role, nil
+		}
+	}
+
+	return RoleNone, fmt.Errorf("unknown role %q", name)
+}
+
+type permissionsConfig struct {
+	// Store is where grants made from IRC are kept. The default is
+	// "memory", which loses them on restart. "db" keeps them in the db
+	// plugin's database, but only if extra/db is built in.
+	Store string
+
+	// Grants are fixed grants keyed by role name. Subjects are either
+	// "account:name" or a hostmask. These can't be revoked from IRC, so
+	// this is where the first owner should go.
+	Grants map[string][]string
+}
+
+// Plugin decides which role a user has and lets commands require one.
+type Plugin struct {
+	isupport *isupport.Plugin
+	tracker  *channeltrack.ChannelTracker
+	store    GrantStore
+
+	lock   sync.RWMutex
+	fixed  []Grant
+	grants []Grant
+}
+
+func newPermissionsPlugin(b *seabird.Bot) error {
+	config := &permissionsConfig{Store: "memory"}
+
+	err := internal.OptionalConfig(b, "permissions", config)
+	if err != nil {
+		return err
+	}
+
+	if err = b.EnsurePlugin("isupport"); err != nil {
+		return err
+	}
+
+	if err = b.EnsurePlugin("channel_track"); err != nil {
+		return err
+	}
+
+	// channel_track already needs cap. The account tag tells us who sent
+	// a message even if the tracker hasn't caught up yet.
+	capPlugin.CtxCap(b.Context()).Request("account-tag")
+
+	p := &Plugin{
+		isupport: isupport.CtxISupport(b.Context()),
+		tracker:  channeltrack.CtxChannelTracker(b.Context()),
+	}
+
+	for name, subjects := range config.Grants {
+		role, err := ParseRole(name)
+		if err != nil {
+			return fmt.Errorf("permissions: %w", err)
+		}
+
+		for _, subject := range subjects {
+			p.fixed = append(p.fixed, Grant{Role: role, Subject: subject})
+		}
+	}
+
+	// Map order is random, so sort the fixed grants to keep !grants stable.
+	sort.Slice(p.fixed, func(i, j int) bool {
+		if p.fixed[i].Role != p.fixed[j].Role {
+			return p.fixed[i].Role > p.fixed[j].Role
+		}
+
+		return p.fixed[i].Subject < p.fixed[j].Subject
+	})
+
+	grantStoresLock.Lock()
+	factory, ok := grantStores[config.Store]
+	grantStoresLock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("permissions: unknown store %q", config.Store)
+	}
+
+	p.store, err = factory(b)
+	if err != nil {
+		return err
+	}
+
+	p.grants, err = p.store.Grants()
+	if err != nil {
+		return err
+	}
+
+	b.SetValue(contextKeyPermissions, p)
+
+	p.registerCommands(internal.NewCommandMux(b))
+
+	return nil
+}
+
+// sender is everything we know about who sent a request.
+type sender struct {
+	hostmask string
+	account  string
+	modes    map[rune]bool
+}
+
+// lookupSender finds the account and channel modes of the user who sent the
+// request. The account tag is preferred when the server sends it, as it
+// can't be out of date.
+func (p *Plugin) lookupSender(r *seabird.Request, channel string) sender {
+	s := sender{hostmask: r.Message.Prefix.String()}
+
+	if account, ok := r.Message.Tags.GetTag("account"); ok && account != "*" {
+		s.account = account
+	}
+
+	if u := p.tracker.LookupUser(r.Message.Prefix.Name); u != nil {
+		if s.account == "" {
+			s.account = u.Account
+		}
+
+		if channel != "" {
+			s.modes = u.ModesInChannel(channel)
+		}
+	}
+
+	return s
+}
+
+// matches returns true if the subject of a grant refers to the sender.
+func (p *Plugin) matches(subject string, s sender) bool {
+	if strings.HasPrefix(subject, accountPrefix) {
+		account := strings.TrimPrefix(subject, accountPrefix)
+		return s.account != "" && p.isupport.CaseEqual(account, s.account)
+	}
+
+	return internal.MatchMask(p.isupport.CaseFold(subject), p.isupport.CaseFold(s.hostmask))
+}
+
+// modeRole returns the role given by a user's modes in a channel. Anything
+// at or above op counts as channel-op and anything below it, like voice,
+// counts as trusted.
+func (p *Plugin) modeRole(modes map[rune]bool) Role {
+	role := RoleNone
+	aboveOp := true
+
+	for _, prefix := range p.isupport.Prefix() {
+		if modes[prefix.Mode] {
+			if aboveOp {
+				return RoleChannelOp
+			}
+
+			role = RoleTrusted
+		}
+
+		if prefix.Mode == 'o' {
+			aboveOp = false
+		}
+	}
+
+	return role
+}
+
+// Role returns the highest role the sender of the request has. Commands
+// sent in a channel also count grants for that channel and the sender's
+// status in it.
+func (p *Plugin) Role(r *seabird.Request) Role {
+	if r.Message.Prefix == nil {
+		return RoleNone
+	}
+
+	var channel string
+	if r.FromChannel() {
+		channel = r.Message.Params[0]
+	}
+
+	s := p.lookupSender(r, channel)
+	role := p.modeRole(s.modes)
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, grants := range [][]Grant{p.fixed, p.grants} {
+		for _, g := range grants {
+			if g.Role <= role {
+				continue
+			}
+
+			if g.Channel != "" && !p.isupport.CaseEqual(g.Channel, channel) {
+				continue
+			}
+
+			if p.matches(g.Subject, s) {
+				role = g.Role
+			}
+		}
+	}
+
+	return role
+}
+
+// HasRole returns true if the sender of the request has at least the given
+// role.
+func (p *Plugin) HasRole(r *seabird.Request, role Role) bool {
+	return p.Role(r) >= role
+}
+
+// Require wraps a handler so it only runs if the sender has at least the
+// given role. Everyone else is told what role they need.
+func (p *Plugin) Require(role Role, h seabird.HandlerFunc) seabird.HandlerFunc {
+	return func(r *seabird.Request) {
+		if !p.HasRole(r, role) {
+			internal.MentionReplyTemplate(r, deniedTemplate, map[string]interface{}{
+				"role": role,
+			})
+
+			return
+		}
+
+		h(r)
+	}
+}
+
+// Grants returns the fixed grants from the config followed by the stored
+// grants.
+func (p *Plugin) Grants() []Grant {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	ret := append([]Grant(nil), p.fixed...)
+
+	return append(ret, p.grants...)
+}
+
+// AddGrant stores a new grant.
+func (p *Plugin) AddGrant(g Grant) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if err := p.store.AddGrant(g); err != nil {
+		return err
+	}
+
+	for _, existing := range p.grants {
+		if existing == g {
+			return nil
+		}
+	}
+
+	p.grants = append(p.grants, g)
+
+	return nil
+}
+
+// RemoveGrant removes a stored grant. Fixed grants can't be removed. It
+// returns false if there was no matching grant.
+func (p *Plugin) RemoveGrant(g Grant) (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	removed, err := p.store.RemoveGrant(g)
+	if err != nil || !removed {
+		return removed, err
+	}
+
+	for i, existing := range p.grants {
+		if existing == g {
+			p.grants = append(p.grants[:i], p.grants[i+1:]...)
+			break
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,95 @@
+package permissions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+	"github.com/belak/go-seabird-plugins/testbot"
+
+	_ "github.com/belak/go-seabird-plugins/core/cap"
+	_ "github.com/belak/go-seabird-plugins/core/channel_track"
+	_ "github.com/belak/go-seabird-plugins/core/isupport"
+)
+
+const testConfig = `
+[permissions.grants]
+owner = ["account:Belak"]
+admin = ["admin!*@example.com"]
+`
+
+func TestParseRole(t *testing.T) {
+	for _, role := range []Role{RoleTrusted, RoleChannelOp, RoleAdmin, RoleOwner} {
+		parsed, err := ParseRole(role.String())
+		require.NoError(t, err)
+		require.Equal(t, role, parsed)
+	}
+
+	_, err := ParseRole("none")
+	require.Error(t, err)
+
+	_, err = ParseRole("wizard")
+	require.Error(t, err)
+}
+
+func TestPermissions(t *testing.T) {
+	// The bot replies to !secret if the sender is trusted.
+	s := testbot.Start(t, []string{"cap", "isupport", "channel_track", "permissions"}, testConfig, func(b *seabird.Bot) {
+		b.CommandMux().Event("secret", CtxPermissions(b.Context()).Require(RoleTrusted, func(r *seabird.Request) {
+			_ = internal.Replyf(r, "the secret")
+		}), nil)
+	})
+	s.Register()
+
+	s.Send(
+		":seabird!seabird@example.com JOIN #seabird",
+		":random!random@other.com JOIN #seabird",
+		":voice!voice@other.com JOIN #seabird",
+		":irc.example.com MODE #seabird +v voice",
+	)
+
+	s.Send(":random!random@other.com PRIVMSG #seabird :!secret")
+	s.WaitFor("PRIVMSG #seabird :random: You need to be trusted to do that.")
+
+	// Voice only counts in the channel it was given in.
+	s.Send(":voice!voice@other.com PRIVMSG #seabird :!secret")
+	s.WaitFor("PRIVMSG #seabird :the secret")
+
+	s.Send(":voice!voice@other.com PRIVMSG seabird :!secret")
+	s.WaitFor("PRIVMSG voice :You need to be trusted to do that.")
+
+	// Accounts are compared case insensitively.
+	s.Send("@account=belak :belak!belak@example.com PRIVMSG #seabird :!whoami")
+	s.WaitFor("PRIVMSG #seabird :belak: You are owner in #seabird.")
+
+	// Only the owner can hand out admin.
+	s.Send(":admin!admin@example.com PRIVMSG #seabird :!grant admin *!*@other.com")
+	s.WaitFor("PRIVMSG #seabird :admin: only owners can change the admin role")
+
+	s.Send(":random!random@other.com PRIVMSG #seabird :!grant trusted *!random@*")
+	s.WaitFor("PRIVMSG #seabird :random: You need to be admin to do that.")
+
+	s.Send(":admin!admin@example.com PRIVMSG #seabird :!grant trusted random")
+	s.WaitFor("PRIVMSG #seabird :admin: random isn't logged in to services, use a hostmask instead")
+
+	s.Send(":admin!admin@example.com PRIVMSG #seabird :!grant trusted *!random@* #Seabird")
+	s.WaitFor("PRIVMSG #seabird :admin: Granted trusted to *!random@* in #seabird.")
+
+	s.Send(":random!random@other.com PRIVMSG #seabird :!secret")
+	s.WaitFor("PRIVMSG #seabird :the secret")
+
+	s.Send(":admin!admin@example.com PRIVMSG #seabird :!grants")
+	s.WaitFor("PRIVMSG #seabird :admin: admin!*@example.com (from config)")
+	s.WaitFor("PRIVMSG #seabird :trusted: *!random@* in #seabird")
+
+	s.Send(":admin!admin@example.com PRIVMSG #seabird :!revoke trusted *!random@* #seabird")
+	s.WaitFor("PRIVMSG #seabird :admin: Revoked trusted from *!random@* in #seabird.")
+
+	s.Send(":admin!admin@example.com PRIVMSG #seabird :!revoke trusted *!random@* #seabird")
+	s.WaitFor("PRIVMSG #seabird :admin: *!random@* doesn't have that grant")
+
+	s.Send(":random!random@other.com PRIVMSG #seabird :!whoami")
+	s.WaitFor("PRIVMSG #seabird :random: You don't have any roles in #seabird.")
+}
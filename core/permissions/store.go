@@ -0,0 +1,97 @@
+package permissions
+
+import (
+	"sync"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+// Grant gives a role to anyone matching Subject. Subjects are either a
+// services account, written as "account:name", or a nick!user@host mask
+// which may use * and ? wildcards. Grants with a Channel only apply to
+// commands sent in that channel.
+type Grant struct {
+	Role    Role
+	Subject string
+	Channel string
+}
+
+// GrantStore is where grants made from IRC are kept. All methods must be
+// safe to call from multiple goroutines.
+type GrantStore interface {
+	// Grants returns every stored grant.
+	Grants() ([]Grant, error)
+
+	// AddGrant stores a grant. Adding a grant which already exists is not
+	// an error.
+	AddGrant(g Grant) error
+
+	// RemoveGrant removes a grant, returning false if it didn't exist.
+	RemoveGrant(g Grant) (bool, error)
+}
+
+// GrantStoreFactory creates a GrantStore. It is called when the permissions
+// plugin is loaded, so it can depend on other plugins.
+type GrantStoreFactory func(b *seabird.Bot) (GrantStore, error)
+
+var (
+	grantStoresLock sync.Mutex
+	grantStores     = map[string]GrantStoreFactory{
+		"memory": newMemoryGrantStore,
+	}
+)
+
+// RegisterGrantStore makes a store available to use in the permissions
+// config. It should be called from init.
+func RegisterGrantStore(name string, factory GrantStoreFactory) {
+	grantStoresLock.Lock()
+	defer grantStoresLock.Unlock()
+
+	grantStores[name] = factory
+}
+
+// memoryGrantStore keeps grants until the bot is restarted.
+type memoryGrantStore struct {
+	lock   sync.Mutex
+	grants []Grant
+}
+
+func newMemoryGrantStore(b *seabird.Bot) (GrantStore, error) {
+	return &memoryGrantStore{}, nil
+}
+
+func (s *memoryGrantStore) Grants() ([]Grant, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]Grant(nil), s.grants...), nil
+}
+
+func (s *memoryGrantStore) AddGrant(g Grant) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, existing := range s.grants {
+		if existing == g {
+			return nil
+		}
+	}
+
+	s.grants = append(s.grants, g)
+
+	return nil
+}
+
+func (s *memoryGrantStore) RemoveGrant(g Grant) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, existing := range s.grants {
+		if existing == g {
+			s.grants = append(s.grants[:i], s.grants[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
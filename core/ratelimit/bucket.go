@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+// maxIdleBuckets is how many buckets we keep before clearing out the ones
+// which have refilled.
+const maxIdleBuckets = 1000
+
+// Limit is a token bucket. Each command takes a token and one token is
+// added back every Interval, up to Burst. A limit with no burst or interval
+// is disabled.
+type Limit struct {
+	Burst    int
+	Interval internal.Duration
+}
+
+func (l Limit) enabled() bool {
+	return l.Burst > 0 && l.Interval.Duration > 0
+}
+
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+
+	// warned is set once we've told someone about this limit. It is
+	// cleared as soon as a command gets through again.
+	warned bool
+}
+
+// refill adds any tokens earned since the bucket was last used.
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	if elapsed > 0 {
+		b.tokens += float64(elapsed) / float64(b.limit.Interval.Duration)
+		b.last = now
+	}
+
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+}
+
+// wait returns how long until the bucket has a token.
+func (b *bucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) * float64(b.limit.Interval.Duration))
+}
+
+// limiter holds a set of buckets, keyed by what they limit.
+type limiter struct {
+	lock    sync.Mutex
+	buckets map[string]*bucket
+}
+
+func newLimiter() *limiter {
+	return &limiter{buckets: make(map[string]*bucket)}
+}
+
+// check is used to see if a command can run.
+type check struct {
+	key   string
+	limit Limit
+}
+
+// denial is returned when a command hits a limit.
+type denial struct {
+	// Wait is how long until the command could run.
+	Wait time.Duration
+
+	// FirstDenial is true if this is the first time the limit was hit
+	// since a command last got through.
+	FirstDenial bool
+}
+
+// take takes a token from every bucket in checks, but only if all of them
+// have one. Otherwise it returns the limit which was hit.
+func (l *limiter) take(now time.Time, checks ...check) *denial {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.buckets) > maxIdleBuckets {
+		l.cleanup(now)
+	}
+
+	buckets := make([]*bucket, 0, len(checks))
+
+	for _, c := range checks {
+		if !c.limit.enabled() {
+			continue
+		}
+
+		b, ok := l.buckets[c.key]
+		if !ok || b.limit != c.limit {
+			b = &bucket{limit: c.limit, tokens: float64(c.limit.Burst), last: now}
+			l.buckets[c.key] = b
+		}
+
+		b.refill(now)
+
+		if b.tokens < 1 {
+			first := !b.warned
+			b.warned = true
+
+			return &denial{Wait: b.wait(), FirstDenial: first}
+		}
+
+		buckets = append(buckets, b)
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+		b.warned = false
+	}
+
+	return nil
+}
+
+// cleanup removes full buckets, as they're the same as new ones.
+func (l *limiter) cleanup(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package ratelimit
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/core/isupport"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+func init() {
+	seabird.RegisterPlugin("ratelimit", newRateLimitPlugin)
+}
+
+var cooldownTemplate = internal.TemplateMustCompile("ratelimitCooldown", `
+Slow down! Try again in {{ .wait }}.
+`).WithSample(map[string]interface{}{
+	"wait": 5 * time.Second,
+})
+
+type rateLimitConfig struct {
+	// User limits how many commands a single user can run.
+	User Limit
+
+	// Channel limits how many commands can be run in a single channel.
+	Channel Limit
+
+	// Commands sets limits for single commands, keyed by the command
+	// name. These are counted separately for each user.
+	Commands map[string]Limit
+}
+
+type rateLimitPlugin struct {
+	isupport *isupport.Plugin
+	limiter  *limiter
+
+	lock   sync.RWMutex
+	config *rateLimitConfig
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+func loadRateLimitConfig(b *seabird.Bot) (*rateLimitConfig, error) {
+	config := &rateLimitConfig{
+		User:    Limit{Burst: 5, Interval: internal.Duration{Duration: 10 * time.Second}},
+		Channel: Limit{Burst: 10, Interval: internal.Duration{Duration: 5 * time.Second}},
+	}
+
+	// The ratelimit section is optional.
+	err := internal.OptionalConfig(b, "ratelimit", config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Command names are case insensitive.
+	commands := make(map[string]Limit, len(config.Commands))
+	for name, limit := range config.Commands {
+		commands[strings.ToLower(name)] = limit
+	}
+
+	config.Commands = commands
+
+	return config, nil
+}
+
+func newRateLimitPlugin(b *seabird.Bot) error {
+	config, err := loadRateLimitConfig(b)
+	if err != nil {
+		return err
+	}
+
+	if err = b.EnsurePlugin("isupport"); err != nil {
+		return err
+	}
+
+	p := &rateLimitPlugin{
+		config:   config,
+		isupport: isupport.CtxISupport(b.Context()),
+		limiter:  newLimiter(),
+		now:      time.Now,
+	}
+
+	internal.UseMiddleware(b, p.middleware)
+	internal.BotLifecycle(b).OnReload("ratelimit", p.reload)
+
+	return nil
+}
+
+// reload swaps in the new limits. Buckets are reset the next time they're
+// used with a different limit.
+func (p *rateLimitPlugin) reload(conf *seabird.Bot) error {
+	config, err := loadRateLimitConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.config = config
+
+	return nil
+}
+
+// checks returns the buckets a command has to take a token from. Users are
+// identified by their host, so changing nicks doesn't get around a limit.
+func (p *rateLimitPlugin) checks(r *seabird.Request, command string) []check {
+	user := r.Message.Prefix.Host
+	if user == "" {
+		user = p.isupport.CaseFold(r.Message.Prefix.Name)
+	}
+
+	user = strings.ToLower(user)
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	checks := []check{
+		{key: "command:" + command + ":" + user, limit: p.config.Commands[command]},
+		{key: "user:" + user, limit: p.config.User},
+	}
+
+	if r.FromChannel() {
+		checks = append(checks, check{
+			key:   "channel:" + p.isupport.CaseFold(r.Message.Params[0]),
+			limit: p.config.Channel,
+		})
+	}
+
+	return checks
+}
+
+func (p *rateLimitPlugin) middleware(command string, next seabird.HandlerFunc) seabird.HandlerFunc {
+	return func(r *seabird.Request) {
+		if r.Message.Prefix == nil {
+			next(r)
+			return
+		}
+
+		d := p.limiter.take(p.now(), p.checks(r, command)...)
+		if d == nil {
+			next(r)
+			return
+		}
+
+		logger := r.GetLogger("ratelimit")
+		logger.WithField("command", command).Debug("Command rate limited")
+
+		// Only say something the first time, otherwise the warnings
+		// could get us flooded off just as easily.
+		if !d.FirstDenial {
+			return
+		}
+
+		wait := d.Wait.Round(time.Second)
+		if wait < time.Second {
+			wait = time.Second
+		}
+
+		internal.MentionReplyTemplate(r, cooldownTemplate, map[string]interface{}{
+			"wait": wait,
+		})
+	}
+}
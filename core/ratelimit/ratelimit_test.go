@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter()
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	user := check{key: "user", limit: Limit{Burst: 2, Interval: internal.Duration{Duration: 10 * time.Second}}}
+	channel := check{key: "channel", limit: Limit{Burst: 3, Interval: internal.Duration{Duration: time.Second}}}
+	disabled := check{key: "disabled", limit: Limit{}}
+
+	require.Nil(t, l.take(now, user, channel, disabled))
+	require.Nil(t, l.take(now, user, channel, disabled))
+
+	// The user is out of tokens, so only the first denial should be
+	// reported.
+	d := l.take(now, user, channel)
+	require.NotNil(t, d)
+	require.Equal(t, 10*time.Second, d.Wait)
+	require.True(t, d.FirstDenial)
+
+	d = l.take(now.Add(4*time.Second), user, channel)
+	require.NotNil(t, d)
+	require.Equal(t, 6*time.Second, d.Wait)
+	require.False(t, d.FirstDenial)
+
+	// A denied command shouldn't use up tokens from the other buckets.
+	require.Nil(t, l.take(now, channel))
+	require.NotNil(t, l.take(now, channel))
+
+	// Once a token is back, commands get through and the next denial is
+	// reported again.
+	now = now.Add(10 * time.Second)
+
+	require.Nil(t, l.take(now, user, channel))
+
+	d = l.take(now, user, channel)
+	require.NotNil(t, d)
+	require.True(t, d.FirstDenial)
+
+	// Buckets never hold more than the burst.
+	now = now.Add(time.Hour)
+
+	require.Nil(t, l.take(now, user))
+	require.Nil(t, l.take(now, user))
+	require.NotNil(t, l.take(now, user))
+}
+
+func TestLimiterCleanup(t *testing.T) {
+	l := newLimiter()
+	now := time.Now()
+	limit := Limit{Burst: 1, Interval: internal.Duration{Duration: time.Second}}
+
+	for i := 0; i <= maxIdleBuckets; i++ {
+		require.Nil(t, l.take(now, check{key: string(rune('a' + i)), limit: limit}))
+	}
+
+	require.Len(t, l.buckets, maxIdleBuckets+1)
+
+	// Once the buckets have refilled, they can be thrown away.
+	require.Nil(t, l.take(now.Add(time.Second), check{key: "new", limit: limit}))
+	require.Len(t, l.buckets, 1)
+}
@@ -0,0 +1,228 @@
+package sasl
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	seabird "github.com/belak/go-seabird"
+	capPlugin "github.com/belak/go-seabird-plugins/core/cap"
+)
+
+func init() {
+	seabird.RegisterPlugin("sasl", newSASLPlugin)
+}
+
+// chunkSize is the largest AUTHENTICATE payload allowed in a single message.
+const chunkSize = 400
+
+type saslConfig struct {
+	// Mechanism is either PLAIN or EXTERNAL. EXTERNAL uses the client
+	// certificate from tlscert and tlskey in the core config.
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+type saslPlugin struct {
+	config *saslConfig
+	cap    *capPlugin.Plugin
+
+	lock sync.Mutex
+
+	// authenticating is true while we are holding registration open.
+	authenticating bool
+}
+
+func newSASLPlugin(b *seabird.Bot) error {
+	if err := b.EnsurePlugin("cap"); err != nil {
+		return err
+	}
+
+	config := &saslConfig{}
+	if err := b.Config("sasl", config); err != nil {
+		return err
+	}
+
+	config.Mechanism = strings.ToUpper(config.Mechanism)
+
+	switch config.Mechanism {
+	case "PLAIN":
+		if config.Username == "" || config.Password == "" {
+			return fmt.Errorf("sasl: PLAIN requires a username and password")
+		}
+	case "EXTERNAL":
+	default:
+		return fmt.Errorf("sasl: unsupported mechanism %q", config.Mechanism)
+	}
+
+	p := &saslPlugin{
+		config: config,
+		cap:    capPlugin.CtxCap(b.Context()),
+	}
+
+	p.cap.Request("sasl")
+	p.cap.OnAck("sasl", p.startCallback)
+
+	bm := b.BasicMux()
+
+	bm.Event("AUTHENTICATE", p.authenticateCallback)
+
+	// Results which end the exchange
+	bm.Event("903", p.successCallback)
+	bm.Event("902", p.failureCallback)
+	bm.Event("904", p.failureCallback)
+	bm.Event("905", p.failureCallback)
+	bm.Event("906", p.failureCallback)
+	bm.Event("907", p.failureCallback)
+
+	// Informational
+	bm.Event("900", p.loggedInCallback)
+	bm.Event("901", p.loggedOutCallback)
+	bm.Event("908", p.mechanismsCallback)
+
+	return nil
+}
+
+// startCallback is called when the server acknowledges the sasl capability.
+// Registration is held until the exchange is done.
+func (p *saslPlugin) startCallback(r *seabird.Request) {
+	logger := r.GetLogger("sasl").WithField("mechanism", p.config.Mechanism)
+
+	// With CAP LS 302, the server tells us which mechanisms it supports.
+	if mechanisms, _ := p.cap.Value("sasl"); mechanisms != "" {
+		supported := false
+
+		for _, mechanism := range strings.Split(mechanisms, ",") {
+			if strings.EqualFold(mechanism, p.config.Mechanism) {
+				supported = true
+				break
+			}
+		}
+
+		if !supported {
+			logger.WithField("supported", mechanisms).Error("SASL authentication failed: mechanism not supported by server")
+			return
+		}
+	}
+
+	p.lock.Lock()
+	if p.authenticating {
+		p.lock.Unlock()
+		return
+	}
+	p.authenticating = true
+	p.lock.Unlock()
+
+	p.cap.Hold()
+
+	logger.Info("Starting SASL authentication")
+
+	r.Writef("AUTHENTICATE %s", p.config.Mechanism)
+}
+
+// authenticateCallback sends our credentials once the server is ready. They
+// are only sent during an exchange we started, so nobody can ask for them
+// later.
+func (p *saslPlugin) authenticateCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 1 || r.Message.Params[0] != "+" {
+		return
+	}
+
+	p.lock.Lock()
+	authenticating := p.authenticating
+	p.lock.Unlock()
+
+	if !authenticating {
+		r.GetLogger("sasl").Warn("Ignoring AUTHENTICATE when we didn't start authenticating")
+		return
+	}
+
+	var payload []byte
+
+	if p.config.Mechanism == "PLAIN" {
+		payload = []byte(p.config.Username + "\x00" + p.config.Username + "\x00" + p.config.Password)
+	}
+
+	for _, chunk := range chunkPayload(payload) {
+		r.Writef("AUTHENTICATE %s", chunk)
+	}
+}
+
+// chunkPayload base64 encodes the payload and splits it up into messages. An
+// empty message is sent as +, and if the last chunk is full, a + is sent
+// after it so the server knows we're done.
+func chunkPayload(payload []byte) []string {
+	encoded := base64.StdEncoding.EncodeToString(payload)
+
+	var ret []string
+
+	for len(encoded) >= chunkSize {
+		ret = append(ret, encoded[:chunkSize])
+		encoded = encoded[chunkSize:]
+	}
+
+	if encoded == "" {
+		encoded = "+"
+	}
+
+	return append(ret, encoded)
+}
+
+func (p *saslPlugin) successCallback(r *seabird.Request) {
+	r.GetLogger("sasl").Info("SASL authentication succeeded")
+
+	p.finish(r)
+}
+
+func (p *saslPlugin) failureCallback(r *seabird.Request) {
+	r.GetLogger("sasl").WithFields(logrus.Fields{
+		"mechanism": p.config.Mechanism,
+		"numeric":   r.Message.Command,
+		"reason":    r.Message.Trailing(),
+	}).Error("SASL authentication failed")
+
+	p.finish(r)
+}
+
+// finish releases registration if we were holding it.
+func (p *saslPlugin) finish(r *seabird.Request) {
+	p.lock.Lock()
+	authenticating := p.authenticating
+	p.authenticating = false
+	p.lock.Unlock()
+
+	if authenticating {
+		p.cap.Release(r)
+	}
+}
+
+// loggedInCallback handles RPL_LOGGEDIN.
+//
+// <client> <nick>!<user>@<host> <account> :You are now logged in as <user>
+func (p *saslPlugin) loggedInCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 3 {
+		return
+	}
+
+	r.GetLogger("sasl").WithField("account", r.Message.Params[2]).Info("Logged in")
+}
+
+func (p *saslPlugin) loggedOutCallback(r *seabird.Request) {
+	r.GetLogger("sasl").Info("Logged out")
+}
+
+// mechanismsCallback handles RPL_SASLMECHS, which is sent along with a
+// failure when we asked for a mechanism the server doesn't support.
+//
+// <client> <mechanisms> :are available SASL mechanisms
+func (p *saslPlugin) mechanismsCallback(r *seabird.Request) {
+	if len(r.Message.Params) < 2 {
+		return
+	}
+
+	r.GetLogger("sasl").WithField("supported", r.Message.Params[1]).Warn("Server sent supported SASL mechanisms")
+}
@@ -0,0 +1,100 @@
+package sasl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+const testConfig = `
+[sasl]
+mechanism = "plain"
+username = "seabird"
+password = "hunter2"
+`
+
+// newTestServer starts a bot with the given config and waits for it to
+// start registering.
+func newTestServer(t *testing.T, config string) *testbot.Server {
+	s := testbot.Start(t, []string{"cap", "sasl"}, config, nil)
+
+	s.Expect("CAP LS 302")
+	s.Expect("NICK :seabird")
+	s.Expect("USER seabird 0 * :seabird")
+
+	return s
+}
+
+func TestPlain(t *testing.T) {
+	s := newTestServer(t, testConfig)
+
+	s.Send(":irc.example.com CAP * LS :sasl=PLAIN,EXTERNAL")
+	s.Expect("CAP REQ :sasl")
+
+	// Registration should be held until we're logged in.
+	s.Send(":irc.example.com CAP * ACK :sasl")
+	s.Expect("AUTHENTICATE PLAIN")
+
+	s.Send("AUTHENTICATE +")
+	s.Expect("AUTHENTICATE c2VhYmlyZABzZWFiaXJkAGh1bnRlcjI=")
+
+	s.Send(
+		":irc.example.com 900 seabird seabird!seabird@example.com seabird :You are now logged in as seabird",
+		":irc.example.com 903 seabird :SASL authentication successful",
+	)
+	s.Expect("CAP END")
+
+	// Once we're done, the server can't ask for the password again.
+	s.Send("AUTHENTICATE +", "PING :sync")
+	s.Expect("PONG sync")
+}
+
+func TestFailure(t *testing.T) {
+	s := newTestServer(t, strings.Replace(testConfig, `"plain"`, `"external"`, 1))
+
+	s.Send(":irc.example.com CAP * LS :sasl")
+	s.Expect("CAP REQ :sasl")
+
+	s.Send(":irc.example.com CAP * ACK :sasl")
+	s.Expect("AUTHENTICATE EXTERNAL")
+
+	s.Send("AUTHENTICATE +")
+	s.Expect("AUTHENTICATE +")
+
+	// A failure should still let registration finish.
+	s.Send(":irc.example.com 904 seabird :SASL authentication failed")
+	s.Expect("CAP END")
+}
+
+func TestUnsupportedMechanism(t *testing.T) {
+	s := newTestServer(t, testConfig)
+
+	s.Send(":irc.example.com CAP * LS :sasl=EXTERNAL")
+	s.Expect("CAP REQ :sasl")
+
+	s.Send(":irc.example.com CAP * ACK :sasl")
+	s.Expect("CAP END")
+
+	// We never started authenticating, so the credentials shouldn't be
+	// sent.
+	s.Send("AUTHENTICATE +", "PING :sync")
+	s.Expect("PONG sync")
+}
+
+func TestChunkPayload(t *testing.T) {
+	require.Equal(t, []string{"+"}, chunkPayload(nil))
+
+	// 300 bytes encodes to exactly 400 characters, so we need a + after it.
+	chunks := chunkPayload([]byte(strings.Repeat("a", 300)))
+	require.Len(t, chunks, 2)
+	require.Len(t, chunks[0], 400)
+	require.Equal(t, "+", chunks[1])
+
+	chunks = chunkPayload([]byte(strings.Repeat("a", 400)))
+	require.Len(t, chunks, 2)
+	require.Len(t, chunks[0], 400)
+	require.NotEqual(t, "+", chunks[1])
+}
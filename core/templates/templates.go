@@ -0,0 +1,95 @@
+package templates
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+func init() {
+	seabird.RegisterPlugin("templates", newTemplatesPlugin)
+}
+
+// templateExt is the extension of files in the templates directory. The rest
+// of the file name is the name of the template it overrides.
+const templateExt = ".tmpl"
+
+type templatesConfig struct {
+	// Directory is an optional directory of <name>.tmpl files.
+	Directory string
+
+	// Overrides maps template names to their new text. These take priority
+	// over anything in Directory.
+	Overrides map[string]string
+}
+
+func newTemplatesPlugin(b *seabird.Bot) error {
+	if err := loadTemplates(b); err != nil {
+		return err
+	}
+
+	// Overrides can be changed without reconnecting. If any of them are
+	// broken, the old ones are kept.
+	internal.BotLifecycle(b).OnReload("templates", loadTemplates)
+
+	return nil
+}
+
+// loadTemplates reads every override from the config and applies them.
+func loadTemplates(b *seabird.Bot) error {
+	config := &templatesConfig{}
+
+	err := internal.OptionalConfig(b, "templates", config)
+	if err != nil {
+		return err
+	}
+
+	overrides, err := loadDirectory(config.Directory)
+	if err != nil {
+		return err
+	}
+
+	for name, text := range config.Overrides {
+		overrides[name] = text
+	}
+
+	// This checks every override against the template's sample data, so a
+	// broken template stops the bot now rather than when it's first used.
+	if err := internal.SetTemplateOverrides(overrides); err != nil {
+		return fmt.Errorf("templates: %w", err)
+	}
+
+	return nil
+}
+
+func loadDirectory(dir string) (map[string]string, error) {
+	ret := make(map[string]string)
+
+	if dir == "" {
+		return ret, nil
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("templates: %w", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != templateExt {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("templates: %w", err)
+		}
+
+		ret[strings.TrimSuffix(file.Name(), templateExt)] = string(data)
+	}
+
+	return ret, nil
+}
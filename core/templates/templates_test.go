@@ -0,0 +1,74 @@
+package templates
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+	"github.com/belak/go-seabird-plugins/testbot"
+
+	// Load every plugin so all the templates are registered.
+	_ "github.com/belak/go-seabird-plugins/extra/all"
+	_ "github.com/belak/go-seabird-plugins/url/all"
+)
+
+const testConfig = `
+[templates]
+directory = "%DIR%"
+
+[templates.overrides]
+karmaChanged = "{{ .name }} now has {{ .score }} karma"
+`
+
+func newTestBot(t *testing.T, dir string) *seabird.Bot {
+	return testbot.NewBot(t, []string{"templates"}, strings.Replace(testConfig, "%DIR%", dir, 1))
+}
+
+func render(t *testing.T, name string, vars map[string]interface{}) string {
+	out, err := internal.RenderTemplate(internal.LookupTemplate(name), vars)
+	require.NoError(t, err)
+
+	return out
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	// Every default template needs to work with its own sample data, or no
+	// overrides could ever pass validation.
+	require.NoError(t, internal.ValidateTemplates())
+}
+
+func TestTemplatesPlugin(t *testing.T) {
+	defer func() {
+		require.NoError(t, internal.SetTemplateOverrides(nil))
+	}()
+
+	dir := t.TempDir()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "karma.tmpl"), []byte("{{ .name }}: {{ .score }}\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "karmaChanged.tmpl"), []byte("ignored"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("{{"), 0600))
+
+	require.NoError(t, newTemplatesPlugin(newTestBot(t, dir)))
+
+	vars := map[string]interface{}{"name": "seabird", "score": 42}
+
+	require.Equal(t, "seabird: 42", render(t, "karma", vars))
+	require.Equal(t, "seabird now has 42 karma", render(t, "karmaChanged", vars))
+
+	// A broken file should stop the plugin from loading and leave the
+	// current templates alone.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "uptime.tmpl"), []byte("{{ .missing }}"), 0600))
+
+	err := newTemplatesPlugin(newTestBot(t, dir))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `template "uptime"`)
+	require.Equal(t, "seabird: 42", render(t, "karma", vars))
+
+	// So should a missing directory.
+	require.Error(t, newTemplatesPlugin(newTestBot(t, filepath.Join(dir, "missing"))))
+}
@@ -2,9 +2,9 @@ package chance
 
 import (
 	"math/rand"
-	"strings"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
@@ -16,13 +16,47 @@ var coinNames = []string{
 	"tails",
 }
 
+var (
+	bangTemplate = internal.TemplateMustCompile("rouletteBang", `
+{{ if .reloaded }}Reloading the gun... {{ end }}BANG!
+`).WithSample(map[string]interface{}{
+		"reloaded": true,
+	})
+
+	clickTemplate = internal.TemplateMustCompile("rouletteClick", `
+{{ if .reloaded }}Reloading the gun... {{ end }}Click.
+`).WithSample(map[string]interface{}{
+		"reloaded": true,
+	})
+
+	luckyTemplate = internal.TemplateMustCompile("coinLucky", `
+Lucky guess!
+`).WithSample(map[string]interface{}{
+		"side": coinNames[0],
+	})
+
+	// Kick reasons for a bad guess.
+	invalidSideTemplate = internal.TemplateMustCompile("coinInvalidSide", `
+That's not a valid coin side. Options are:
+{{- range $i, $side := .sides }}{{ if $i }},{{ end }} {{ $side }}{{ end }}
+`).WithSample(map[string]interface{}{
+		"sides": coinNames,
+	})
+
+	unluckyTemplate = internal.TemplateMustCompile("coinUnlucky", `
+Sorry! Better luck next time!
+`).WithSample(map[string]interface{}{
+		"side": coinNames[0],
+	})
+)
+
 type chancePlugin struct {
 	RouletteGunSize   int
 	rouletteShotsLeft map[string]int
 }
 
 func newChancePlugin(b *seabird.Bot) error {
-	cm := b.CommandMux()
+	cm := internal.NewCommandMux(b)
 
 	p := &chancePlugin{
 		6,
@@ -49,20 +83,24 @@ func (p *chancePlugin) rouletteCallback(r *seabird.Request) {
 
 	shotsLeft := p.rouletteShotsLeft[r.Message.Params[0]]
 
-	var msg string
+	reloaded := false
 
 	if shotsLeft < 1 {
 		shotsLeft = rand.Intn(p.RouletteGunSize) + 1
-		msg = "Reloading the gun... "
+		reloaded = true
 	}
 
 	shotsLeft--
 
+	vars := map[string]interface{}{
+		"reloaded": reloaded,
+	}
+
 	if shotsLeft < 1 {
-		r.MentionReplyf("%sBANG!", msg)
+		internal.MentionReplyTemplate(r, bangTemplate, vars)
 		r.Writef("KICK %s %s", r.Message.Params[0], r.Message.Prefix.Name)
 	} else {
-		r.MentionReplyf("%sClick.", msg)
+		internal.MentionReplyTemplate(r, clickTemplate, vars)
 	}
 
 	p.rouletteShotsLeft[r.Message.Params[0]] = shotsLeft
@@ -80,11 +118,9 @@ func (p *chancePlugin) coinCallback(r *seabird.Request) {
 	}
 
 	if guess == -1 {
-		r.Writef(
-			"KICK %s %s :That's not a valid coin side. Options are: %s",
-			r.Message.Params[0],
-			r.Message.Prefix.Name,
-			strings.Join(coinNames, ", "))
+		p.kick(r, invalidSideTemplate, map[string]interface{}{
+			"sides": coinNames,
+		})
 
 		return
 	}
@@ -92,8 +128,24 @@ func (p *chancePlugin) coinCallback(r *seabird.Request) {
 	flip := rand.Intn(2)
 
 	if flip == guess {
-		r.MentionReplyf("Lucky guess!")
+		internal.MentionReplyTemplate(r, luckyTemplate, map[string]interface{}{
+			"side": coinNames[flip],
+		})
 	} else {
-		r.Writef("KICK %s %s :%s", r.Message.Params[0], r.Message.Prefix.Name, "Sorry! Better luck next time!")
+		p.kick(r, unluckyTemplate, map[string]interface{}{
+			"side": coinNames[flip],
+		})
 	}
 }
+
+// kick removes the sender from the channel with the rendered template as the
+// reason.
+func (p *chancePlugin) kick(r *seabird.Request, t *internal.Template, vars interface{}) {
+	reason, err := internal.RenderTemplate(t, vars)
+	if err != nil {
+		r.GetLogger("chance").WithError(err).Error("Failed to render template")
+		return
+	}
+
+	r.Writef("KICK %s %s :%s", r.Message.Params[0], r.Message.Prefix.Name, reason)
+}
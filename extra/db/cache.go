@@ -0,0 +1,84 @@
+package db
+
+import (
+	"time"
+
+	"xorm.io/xorm"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+func init() {
+	internal.RegisterCacheBackend("db", newCacheBackend)
+	RegisterModels("db", CacheEntry{})
+}
+
+// CacheEntry is a single cached value. This lets the cache survive
+// restarts.
+type CacheEntry struct {
+	Key     string `xorm:"pk"`
+	Value   []byte
+	Missing bool
+	Expires time.Time `xorm:"index"`
+}
+
+type cacheBackend struct {
+	db *xorm.Engine
+}
+
+func newCacheBackend(b *seabird.Bot) (internal.CacheBackend, error) {
+	if err := b.EnsurePlugin("db"); err != nil {
+		return nil, err
+	}
+
+	c := &cacheBackend{db: CtxDB(b.Context())}
+
+	// Anything which expired while we weren't running can go.
+	if _, err := c.db.Where("expires < ?", time.Now()).Delete(&CacheEntry{}); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *cacheBackend) Get(key string) (*internal.CacheEntry, error) {
+	entry := &CacheEntry{Key: key}
+
+	found, err := c.db.Get(entry)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	if time.Now().After(entry.Expires) {
+		return nil, c.Delete(key)
+	}
+
+	return &internal.CacheEntry{
+		Value:   entry.Value,
+		Missing: entry.Missing,
+		Expires: entry.Expires,
+	}, nil
+}
+
+func (c *cacheBackend) Set(key string, entry *internal.CacheEntry) error {
+	_, err := c.db.Transaction(func(s *xorm.Session) (interface{}, error) {
+		if _, err := s.Delete(&CacheEntry{Key: key}); err != nil {
+			return nil, err
+		}
+
+		return s.InsertOne(&CacheEntry{
+			Key:     key,
+			Value:   entry.Value,
+			Missing: entry.Missing,
+			Expires: entry.Expires,
+		})
+	})
+
+	return err
+}
+
+func (c *cacheBackend) Delete(key string) error {
+	_, err := c.db.Delete(&CacheEntry{Key: key})
+	return err
+}
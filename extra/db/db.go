@@ -2,9 +2,12 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 
 	"xorm.io/core"
 	"xorm.io/xorm"
+	"xorm.io/xorm/contexts"
 
 	seabird "github.com/belak/go-seabird"
 	"github.com/belak/go-seabird-plugins/internal"
@@ -36,11 +39,60 @@ func NewDBPlugin(b *seabird.Bot) error {
 		return err
 	}
 
-	engine, err := xorm.NewEngine(dbc.Driver, dbc.DataSource)
+	engine, err := NewEngine(dbc.Driver, dbc.DataSource, dbc.TablePrefix)
 	if err != nil {
 		return err
 	}
 
+	engine.AddHook(&metricsHook{
+		errors: internal.BotMetrics(b).Counter("seabird_db_errors_total", "Database queries which failed."),
+	})
+
+	internal.AddHealthCheck(b, "db", engine.PingContext)
+
+	// This runs after the plugins using the db have finished, so nothing
+	// is cut off mid-transaction.
+	internal.BotLifecycle(b).OnShutdown("db", func(ctx context.Context) error {
+		return engine.Close()
+	})
+
+	// The cache and stores use our own tables, and they can be set up
+	// before any plugin which would call Migrate.
+	if _, err := ApplyMigrations(engine, seabird.CtxLogger(b.Context(), "db"), "db", false); err != nil {
+		return err
+	}
+
+	b.SetValue(contextKeyDB, engine)
+
+	return nil
+}
+
+// metricsHook counts failed queries.
+type metricsHook struct {
+	errors *internal.Counter
+}
+
+func (h *metricsHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	return c.Ctx, nil
+}
+
+func (h *metricsHook) AfterProcess(c *contexts.ContextHook) error {
+	if c.Err != nil && !errors.Is(c.Err, sql.ErrNoRows) {
+		h.errors.Inc()
+	}
+
+	return nil
+}
+
+// NewEngine opens a database with the same mappings the db plugin uses.
+// This is mostly useful for tools which need to talk to more than one
+// database.
+func NewEngine(driver, dataSource, tablePrefix string) (*xorm.Engine, error) {
+	engine, err := xorm.NewEngine(driver, dataSource)
+	if err != nil {
+		return nil, err
+	}
+
 	// Ensure table and column mapping is set up how we want it. This means
 	// using the GonicMapper as a base (so stuff like ID is converted properly)
 	// but also adding a table prefix (if set) and caching the results (similar
@@ -50,8 +102,8 @@ func NewDBPlugin(b *seabird.Bot) error {
 		tableMapper  core.IMapper = core.GonicMapper{}
 	)
 
-	if dbc.TablePrefix != "" {
-		tableMapper = core.NewPrefixMapper(tableMapper, dbc.TablePrefix)
+	if tablePrefix != "" {
+		tableMapper = core.NewPrefixMapper(tableMapper, tablePrefix)
 	}
 
 	tableMapper = core.NewCacheMapper(tableMapper)
@@ -59,7 +111,5 @@ func NewDBPlugin(b *seabird.Bot) error {
 	engine.SetColumnMapper(columnMapper)
 	engine.SetTableMapper(tableMapper)
 
-	b.SetValue(contextKeyDB, engine)
-
-	return nil
+	return engine, nil
 }
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"xorm.io/xorm"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/core/ignore"
+)
+
+func init() {
+	ignore.RegisterStore("db", newIgnoreStore)
+	RegisterModels("db", IgnoreEntry{})
+}
+
+// IgnoreEntry is a pattern the bot ignores, added from IRC.
+type IgnoreEntry struct {
+	ID      int64
+	Pattern string `xorm:"unique"`
+}
+
+type ignoreStore struct {
+	db *xorm.Engine
+}
+
+func newIgnoreStore(b *seabird.Bot) (ignore.Store, error) {
+	if err := b.EnsurePlugin("db"); err != nil {
+		return nil, err
+	}
+
+	return &ignoreStore{db: CtxDB(b.Context())}, nil
+}
+
+func (s *ignoreStore) Ignores() ([]string, error) {
+	var rows []IgnoreEntry
+
+	if err := s.db.Find(&rows); err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ret = append(ret, row.Pattern)
+	}
+
+	return ret, nil
+}
+
+func (s *ignoreStore) AddIgnore(pattern string) error {
+	_, err := s.db.Transaction(func(sess *xorm.Session) (interface{}, error) {
+		row := &IgnoreEntry{Pattern: pattern}
+
+		found, err := sess.Get(row)
+		if err != nil || found {
+			return nil, err
+		}
+
+		return sess.InsertOne(row)
+	})
+
+	return err
+}
+
+func (s *ignoreStore) RemoveIgnore(pattern string) (bool, error) {
+	// An empty bean would delete everything.
+	if pattern == "" {
+		return false, nil
+	}
+
+	count, err := s.db.Delete(&IgnoreEntry{Pattern: pattern})
+	return count > 0, err
+}
@@ -0,0 +1,297 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"xorm.io/xorm"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+func init() {
+	RegisterModels("db", SchemaMigration{})
+}
+
+// Migration is a single change to the tables or data for a plugin.
+type Migration struct {
+	// Version orders the migrations for a plugin. Versions must be unique
+	// and should never change once they've been released.
+	Version int
+
+	// Description says what the migration does.
+	Description string
+
+	// Up applies the migration. It is run in a transaction, so if it fails
+	// nothing it did will be kept. Migrations shouldn't use the plugin's
+	// current models, as those will change over time, and should create
+	// tables with CreateTables rather than Sync2.
+	Up func(s *xorm.Session) error
+}
+
+// CreateTables creates any of the given tables which don't exist yet, along
+// with their indexes. Tables which already exist are left alone, so tables
+// created before a plugin had migrations are kept. Unlike Sync2, everything
+// goes through the session, so this works in the transaction of a dry run.
+func CreateTables(s *xorm.Session, beans ...interface{}) error {
+	for _, bean := range beans {
+		exists, err := s.IsTableExist(bean)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			continue
+		}
+
+		if err = s.CreateTable(bean); err != nil {
+			return err
+		}
+
+		if err = s.CreateIndexes(bean); err != nil {
+			return err
+		}
+
+		if err = s.CreateUniques(bean); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SchemaMigration records a migration which has been applied.
+type SchemaMigration struct {
+	ID          int64
+	Plugin      string `xorm:"unique(plugin_version)"`
+	Version     int    `xorm:"unique(plugin_version)"`
+	Description string
+	AppliedAt   time.Time
+}
+
+// MigrationStatus is whether a single migration has been applied.
+type MigrationStatus struct {
+	Plugin      string
+	Version     int
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+var (
+	migrationsLock sync.Mutex
+	migrations     = make(map[string][]Migration)
+)
+
+// RegisterMigrations adds migrations for a plugin. It should be called from
+// init. It will panic if a version is registered twice.
+func RegisterMigrations(plugin string, m ...Migration) {
+	migrationsLock.Lock()
+	defer migrationsLock.Unlock()
+
+	for _, migration := range m {
+		for _, existing := range migrations[plugin] {
+			if existing.Version == migration.Version {
+				panic(fmt.Sprintf("db: migration %d for %s registered twice", migration.Version, plugin))
+			}
+		}
+
+		migrations[plugin] = append(migrations[plugin], migration)
+	}
+
+	sort.Slice(migrations[plugin], func(i, j int) bool {
+		return migrations[plugin][i].Version < migrations[plugin][j].Version
+	})
+}
+
+// MigrationPlugins returns the name of every plugin with migrations, sorted.
+func MigrationPlugins() []string {
+	migrationsLock.Lock()
+	defer migrationsLock.Unlock()
+
+	ret := make([]string, 0, len(migrations))
+	for plugin := range migrations {
+		ret = append(ret, plugin)
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+func pluginMigrations(plugin string) []Migration {
+	migrationsLock.Lock()
+	defer migrationsLock.Unlock()
+
+	return append([]Migration(nil), migrations[plugin]...)
+}
+
+// MigrationStatuses returns the status of every migration for the given
+// plugin, in order. It doesn't change anything, so if nothing has ever been
+// migrated, every migration is pending.
+func MigrationStatuses(x *xorm.Engine, plugin string) ([]MigrationStatus, error) {
+	exists, err := x.IsTableExist(SchemaMigration{})
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []SchemaMigration
+
+	if exists {
+		if err := x.Where("plugin = ?", plugin).Find(&applied); err != nil {
+			return nil, err
+		}
+	}
+
+	appliedAt := make(map[int]time.Time)
+	for _, m := range applied {
+		appliedAt[m.Version] = m.AppliedAt
+	}
+
+	var ret []MigrationStatus
+
+	for _, m := range pluginMigrations(plugin) {
+		at, ok := appliedAt[m.Version]
+
+		ret = append(ret, MigrationStatus{
+			Plugin:      plugin,
+			Version:     m.Version,
+			Description: m.Description,
+			Applied:     ok,
+			AppliedAt:   at,
+		})
+	}
+
+	return ret, nil
+}
+
+// ApplyMigrations runs any pending migrations for the given plugin and
+// returns the ones which were run. Each migration runs in its own
+// transaction. With dryRun set, every pending migration is run in a single
+// transaction which is then rolled back, so nothing is changed.
+func ApplyMigrations(x *xorm.Engine, logger *logrus.Entry, plugin string, dryRun bool) ([]MigrationStatus, error) {
+	statuses, err := MigrationStatuses(x, plugin)
+	if err != nil {
+		return nil, err
+	}
+
+	all := pluginMigrations(plugin)
+
+	var pending []Migration
+
+	for i, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, all[i])
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	s := x.NewSession()
+	defer s.Close()
+
+	if dryRun {
+		if err := s.Begin(); err != nil {
+			return nil, err
+		}
+
+		// Closing the session rolls back anything which wasn't committed,
+		// but doing it explicitly makes it clear that's what we want.
+		defer func() { _ = s.Rollback() }()
+	}
+
+	// This is the one table which can't be created by a migration. On a dry
+	// run it's created in the transaction, so it's rolled back with
+	// everything else.
+	if dryRun {
+		err = CreateTables(s, SchemaMigration{})
+	} else {
+		err = x.Sync(SchemaMigration{})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []MigrationStatus
+
+	for _, m := range pending {
+		logger := logger.WithFields(logrus.Fields{
+			"plugin":  plugin,
+			"version": m.Version,
+		})
+
+		logger.Infof("Applying migration: %s", m.Description)
+
+		status := MigrationStatus{
+			Plugin:      plugin,
+			Version:     m.Version,
+			Description: m.Description,
+			Applied:     true,
+			AppliedAt:   time.Now(),
+		}
+
+		if dryRun {
+			err = applyMigration(s, m, status)
+		} else {
+			err = runInTransaction(s, func() error {
+				return applyMigration(s, m, status)
+			})
+		}
+
+		if err != nil {
+			return ret, fmt.Errorf("db: migration %d for %s failed: %w", m.Version, plugin, err)
+		}
+
+		ret = append(ret, status)
+	}
+
+	return ret, nil
+}
+
+// applyMigration runs a migration and records that it was applied.
+func applyMigration(s *xorm.Session, m Migration, status MigrationStatus) error {
+	if err := m.Up(s); err != nil {
+		return err
+	}
+
+	_, err := s.InsertOne(&SchemaMigration{
+		Plugin:      status.Plugin,
+		Version:     status.Version,
+		Description: status.Description,
+		AppliedAt:   status.AppliedAt,
+	})
+
+	return err
+}
+
+func runInTransaction(s *xorm.Session, f func() error) error {
+	if err := s.Begin(); err != nil {
+		return err
+	}
+
+	if err := f(); err != nil {
+		_ = s.Rollback()
+		return err
+	}
+
+	return s.Commit()
+}
+
+// Migrate applies any pending migrations for the given plugin. Plugins
+// should call this when they're loaded, rather than syncing their tables
+// directly.
+func Migrate(b *seabird.Bot, plugin string) error {
+	if err := b.EnsurePlugin("db"); err != nil {
+		return err
+	}
+
+	_, err := ApplyMigrations(CtxDB(b.Context()), seabird.CtxLogger(b.Context(), "db"), plugin, false)
+
+	return err
+}
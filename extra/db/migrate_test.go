@@ -0,0 +1,119 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+	"xorm.io/xorm"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+type migrationTest struct {
+	ID   int64
+	Name string
+}
+
+func newTestDB(t *testing.T) *seabird.Bot {
+	b := testbot.NewBot(t, []string{"db"}, "")
+
+	require.NoError(t, NewDBPlugin(b))
+
+	return b
+}
+
+func TestMigrations(t *testing.T) {
+	b := newTestDB(t)
+	x := CtxDB(b.Context())
+	logger := seabird.CtxLogger(b.Context(), "db")
+
+	fail := true
+
+	// These are registered out of order to make sure they get sorted.
+	RegisterMigrations("migration_test",
+		Migration{
+			Version:     2,
+			Description: "Add a row",
+			Up: func(s *xorm.Session) error {
+				_, err := s.InsertOne(&migrationTest{Name: "seabird"})
+				return err
+			},
+		},
+		Migration{
+			Version:     1,
+			Description: "Create the table",
+			Up: func(s *xorm.Session) error {
+				return CreateTables(s, migrationTest{})
+			},
+		},
+	)
+
+	RegisterMigrations("migration_test", Migration{
+		Version:     3,
+		Description: "Fail after adding a row",
+		Up: func(s *xorm.Session) error {
+			if _, err := s.InsertOne(&migrationTest{Name: "broken"}); err != nil {
+				return err
+			}
+
+			if fail {
+				return errors.New("failed")
+			}
+
+			return nil
+		},
+	})
+
+	require.Panics(t, func() {
+		RegisterMigrations("migration_test", Migration{Version: 1})
+	})
+
+	require.Contains(t, MigrationPlugins(), "migration_test")
+
+	// A dry run should go through everything, then leave the database
+	// alone.
+	applied, err := ApplyMigrations(x, logger, "migration_test", true)
+	require.Error(t, err)
+	require.Len(t, applied, 2)
+
+	exists, err := x.IsTableExist(migrationTest{})
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// A failed migration should be rolled back, but the ones before it
+	// should stick.
+	applied, err = ApplyMigrations(x, logger, "migration_test", false)
+	require.Error(t, err)
+	require.Len(t, applied, 2)
+
+	var rows []migrationTest
+	require.NoError(t, x.Find(&rows))
+	require.Equal(t, []migrationTest{{ID: 1, Name: "seabird"}}, rows)
+
+	statuses, err := MigrationStatuses(x, "migration_test")
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	require.True(t, statuses[0].Applied)
+	require.True(t, statuses[1].Applied)
+	require.False(t, statuses[2].Applied)
+	require.Equal(t, "Fail after adding a row", statuses[2].Description)
+
+	// Only the pending migration should be run once it's fixed.
+	fail = false
+
+	applied, err = ApplyMigrations(x, logger, "migration_test", false)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	require.Equal(t, 3, applied[0].Version)
+
+	applied, err = ApplyMigrations(x, logger, "migration_test", false)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	count, err := x.Count(migrationTest{})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+}
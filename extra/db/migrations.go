@@ -0,0 +1,54 @@
+package db
+
+import (
+	"time"
+
+	"xorm.io/xorm"
+)
+
+func init() {
+	// These are declared in each migration so the migrations keep working
+	// as the models change.
+	RegisterMigrations("db",
+		Migration{
+			Version:     1,
+			Description: "Create the cache_entry table",
+			Up: func(s *xorm.Session) error {
+				type CacheEntry struct {
+					Key     string `xorm:"pk"`
+					Value   []byte
+					Missing bool
+					Expires time.Time `xorm:"index"`
+				}
+
+				return CreateTables(s, CacheEntry{})
+			},
+		},
+		Migration{
+			Version:     2,
+			Description: "Create the ignore_entry table",
+			Up: func(s *xorm.Session) error {
+				type IgnoreEntry struct {
+					ID      int64
+					Pattern string `xorm:"unique"`
+				}
+
+				return CreateTables(s, IgnoreEntry{})
+			},
+		},
+		Migration{
+			Version:     3,
+			Description: "Create the permission_grant table",
+			Up: func(s *xorm.Session) error {
+				type PermissionGrant struct {
+					ID      int64
+					Role    string
+					Subject string `xorm:"index"`
+					Channel string
+				}
+
+				return CreateTables(s, PermissionGrant{})
+			},
+		},
+	)
+}
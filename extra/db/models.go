@@ -0,0 +1,51 @@
+package db
+
+import (
+	"sort"
+	"sync"
+)
+
+// Model is a table owned by a plugin.
+type Model struct {
+	Plugin string
+	Bean   interface{}
+}
+
+var (
+	modelsLock sync.Mutex
+	models     = make(map[string][]interface{})
+)
+
+// RegisterModels records the tables a plugin stores data in, so tools like
+// seabird-migrate can find every table without knowing about every plugin.
+// It should be called from init with the plugin's current models.
+func RegisterModels(plugin string, beans ...interface{}) {
+	modelsLock.Lock()
+	defer modelsLock.Unlock()
+
+	models[plugin] = append(models[plugin], beans...)
+}
+
+// Models returns every registered model, sorted by plugin and then in the
+// order they were registered.
+func Models() []Model {
+	modelsLock.Lock()
+	defer modelsLock.Unlock()
+
+	plugins := make([]string, 0, len(models))
+	for plugin := range models {
+		plugins = append(plugins, plugin)
+	}
+
+	sort.Strings(plugins)
+
+	var ret []Model
+
+	for _, plugin := range plugins {
+		for _, bean := range models[plugin] {
+			ret = append(ret, Model{Plugin: plugin, Bean: bean})
+		}
+	}
+
+	return ret
+}
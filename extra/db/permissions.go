@@ -0,0 +1,89 @@
+package db
+
+import (
+	"xorm.io/xorm"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/core/permissions"
+)
+
+func init() {
+	permissions.RegisterGrantStore("db", newGrantStore)
+	RegisterModels("db", PermissionGrant{})
+}
+
+// PermissionGrant is a role granted from IRC.
+type PermissionGrant struct {
+	ID      int64
+	Role    string
+	Subject string `xorm:"index"`
+	Channel string
+}
+
+type grantStore struct {
+	db *xorm.Engine
+}
+
+func newGrantStore(b *seabird.Bot) (permissions.GrantStore, error) {
+	if err := b.EnsurePlugin("db"); err != nil {
+		return nil, err
+	}
+
+	return &grantStore{db: CtxDB(b.Context())}, nil
+}
+
+func (s *grantStore) Grants() ([]permissions.Grant, error) {
+	var rows []PermissionGrant
+
+	if err := s.db.Find(&rows); err != nil {
+		return nil, err
+	}
+
+	ret := make([]permissions.Grant, 0, len(rows))
+
+	for _, row := range rows {
+		role, err := permissions.ParseRole(row.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, permissions.Grant{
+			Role:    role,
+			Subject: row.Subject,
+			Channel: row.Channel,
+		})
+	}
+
+	return ret, nil
+}
+
+// AddGrant skips grants which already exist. Channel has to be checked
+// explicitly, as xorm skips empty fields when building conditions from a
+// bean.
+func (s *grantStore) AddGrant(g permissions.Grant) error {
+	_, err := s.db.Transaction(func(sess *xorm.Session) (interface{}, error) {
+		row := &PermissionGrant{
+			Role:    g.Role.String(),
+			Subject: g.Subject,
+			Channel: g.Channel,
+		}
+
+		found, err := sess.Where("channel = ?", g.Channel).Get(row)
+		if err != nil || found {
+			return nil, err
+		}
+
+		return sess.InsertOne(row)
+	})
+
+	return err
+}
+
+func (s *grantStore) RemoveGrant(g permissions.Grant) (bool, error) {
+	count, err := s.db.Where("channel = ?", g.Channel).Delete(&PermissionGrant{
+		Role:    g.Role.String(),
+		Subject: g.Subject,
+	})
+
+	return count > 0, err
+}
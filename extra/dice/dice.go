@@ -1,13 +1,12 @@
 package dice
 
 import (
-	"fmt"
 	"math/rand"
 	"regexp"
 	"strconv"
-	"strings"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
@@ -16,8 +15,52 @@ func init() {
 
 var diceRe = regexp.MustCompile(`(?:^|\b)(\d*)d(\d+)\b`)
 
+const (
+	maxDice     = 100
+	maxDiceSize = 100
+)
+
+// diceRoll is every die rolled for one match, like 2d6.
+type diceRoll struct {
+	Count int
+	Size  int
+	Dice  []int
+}
+
+var (
+	// 2d6: 3, 5 1d20: 17
+	rollsTemplate = internal.TemplateMustCompile("diceRolls", `
+{{ range $i, $roll := .rolls }}{{ if $i }} {{ end }}{{ $roll.Count }}d{{ $roll.Size }}: {{ range $j, $die := $roll.Dice }}{{ if $j }}, {{ end }}{{ $die }}{{ end }}{{ end }}
+`).WithSample(map[string]interface{}{
+		"rolls": []diceRoll{
+			{Count: 2, Size: 6, Dice: []int{3, 5}},
+			{Count: 1, Size: 20, Dice: []int{17}},
+		},
+	})
+
+	negativeTemplate = internal.TemplateMustCompile("diceNegative", `
+You cannot request a negative number of rolls
+`).WithSample(map[string]interface{}{})
+
+	tooManyTemplate = internal.TemplateMustCompile("diceTooMany", `
+You cannot request more than {{ .max }} dice
+`).WithSample(map[string]interface{}{
+		"max": maxDice,
+	})
+
+	tooLargeTemplate = internal.TemplateMustCompile("diceTooLarge", `
+You cannot request dice larger than {{ .max }}
+`).WithSample(map[string]interface{}{
+		"max": maxDiceSize,
+	})
+
+	tooSmallTemplate = internal.TemplateMustCompile("diceTooSmall", `
+You cannot request dice smaller than 1
+`).WithSample(map[string]interface{}{})
+)
+
 func newDicePlugin(b *seabird.Bot) error {
-	mm := b.MentionMux()
+	mm := internal.NewMentionMux(b)
 
 	mm.Event(diceCallback)
 
@@ -25,7 +68,7 @@ func newDicePlugin(b *seabird.Bot) error {
 }
 
 func diceCallback(r *seabird.Request) {
-	var rolls []string
+	var rolls []diceRoll
 
 	totalCount := 0
 
@@ -43,39 +86,47 @@ func diceCallback(r *seabird.Request) {
 
 		// Clamp count
 		if count < 0 {
-			r.MentionReplyf("You cannot request a negative number of rolls")
+			internal.MentionReplyTemplate(r, negativeTemplate, nil)
 			return
 		}
 
 		totalCount += count
-		if totalCount > 100 {
-			r.MentionReplyf("You cannot request more than 100 dice")
+		if totalCount > maxDice {
+			internal.MentionReplyTemplate(r, tooManyTemplate, map[string]interface{}{
+				"max": maxDice,
+			})
+
 			return
 		}
 
 		// How big is the die?
 		size, _ := strconv.Atoi(match[2])
 
-		if size > 100 {
-			r.MentionReplyf("You cannot request dice larger than 100")
+		if size > maxDiceSize {
+			internal.MentionReplyTemplate(r, tooLargeTemplate, map[string]interface{}{
+				"max": maxDiceSize,
+			})
+
 			return
 		}
 
 		// Clamp size
 		if size < 1 {
-			r.MentionReplyf("You cannot request dice smaller than 1")
+			internal.MentionReplyTemplate(r, tooSmallTemplate, nil)
 			return
 		}
 
-		var dice []string
+		roll := diceRoll{Count: count, Size: size}
 		for i := 0; i < count; i++ {
-			dice = append(dice, fmt.Sprintf("%d", rand.Intn(size)+1))
+			roll.Dice = append(roll.Dice, rand.Intn(size)+1)
 		}
 
-		rolls = append(rolls, fmt.Sprintf("%dd%d: %s", count, size, strings.Join(dice, ", ")))
+		rolls = append(rolls, roll)
 	}
 
 	if len(rolls) > 0 {
-		r.MentionReplyf("%s", strings.Join(rolls, " "))
+		internal.MentionReplyTemplate(r, rollsTemplate, map[string]interface{}{
+			"rolls": rolls,
+		})
 	}
 }
@@ -1,7 +1,10 @@
 package fcc
 
 import (
+	"context"
+	"errors"
 	"net/url"
+	"strings"
 
 	seabird "github.com/belak/go-seabird"
 	"github.com/belak/go-seabird-plugins/internal"
@@ -11,7 +14,11 @@ func init() {
 	seabird.RegisterPlugin("fcc", newFccPlugin)
 }
 
-type fccPlugin struct{}
+type fccPlugin struct {
+	client    *internal.HTTPClient
+	cache     *internal.Cache
+	lifecycle *internal.Lifecycle
+}
 
 type fccLicense struct {
 	Name       string `json:"licName"`
@@ -33,15 +40,54 @@ type fccLicenses struct {
 	Licenses   []fccLicense `json:"License"`
 }
 
+// W1AW (Amateur): ARRL HQ OPERATORS CLUB, Active, expires 08/05/2030
+var licenseTemplate = internal.TemplateMustCompile("fccLicense", `
+{{ .license.Callsign }} ({{ .license.Service }}): {{ .license.Name }}, {{ .license.Status }}, expires {{ .license.ExpireDate }}
+`).WithSample(map[string]interface{}{
+	"license": &fccLicense{
+		Name:       "ARRL HQ OPERATORS CLUB",
+		Callsign:   "W1AW",
+		Service:    "Amateur",
+		Status:     "Active",
+		ExpireDate: "08/05/2030",
+	},
+})
+
+var (
+	callsignRequiredTemplate = internal.TemplateMustCompile("fccCallsignRequired", `
+Callsign required
+`).WithSample(map[string]interface{}{})
+
+	notFoundTemplate = internal.TemplateMustCompile("fccNotFound", `
+No licenses found
+`).WithSample(map[string]interface{}{})
+
+	errorTemplate = internal.TemplateMustCompile("fccError", `
+{{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("context deadline exceeded"),
+	})
+)
+
 type fccResponse struct {
 	Status      string      `json:"status"`
 	LicenseData fccLicenses `json:"Licenses"`
 }
 
 func newFccPlugin(b *seabird.Bot) error {
-	cm := b.CommandMux()
+	cm := internal.NewCommandMux(b)
+
+	client, err := internal.NewHTTPClient(b, "fcc")
+	if err != nil {
+		return err
+	}
+
+	cache, err := internal.NewCache(b, "fcc")
+	if err != nil {
+		return err
+	}
 
-	p := &fccPlugin{}
+	p := &fccPlugin{client: client, cache: cache, lifecycle: internal.BotLifecycle(b)}
 
 	cm.Event("callsign", p.Search, &seabird.HelpInfo{
 		Usage:       "<callsign>",
@@ -52,27 +98,40 @@ func newFccPlugin(b *seabird.Bot) error {
 }
 
 func (p *fccPlugin) Search(r *seabird.Request) {
-	go func() {
+	p.lifecycle.Go(func(ctx context.Context) {
 		if r.Message.Trailing() == "" {
-			r.MentionReplyf("Callsign required")
+			internal.MentionReplyTemplate(r, callsignRequiredTemplate, nil)
 			return
 		}
 
-		url := "http://data.fcc.gov/api/license-view/basicSearch/getLicenses?format=json&searchValue=" + url.QueryEscape(r.Message.Trailing())
+		callsign := r.Message.Trailing()
+		url := "http://data.fcc.gov/api/license-view/basicSearch/getLicenses?format=json&searchValue=" + url.QueryEscape(callsign)
 
 		fr := &fccResponse{}
-		err := internal.GetJSON(url, fr)
-		if err != nil {
-			r.MentionReplyf("%s", err)
-			return
-		}
 
-		if len(fr.LicenseData.Licenses) == 0 {
-			r.MentionReplyf("No licenses found")
+		err := p.cache.Fetch(strings.ToUpper(callsign), fr, func() error {
+			if err := p.client.GetJSON(ctx, url, fr); err != nil {
+				return err
+			}
+
+			if len(fr.LicenseData.Licenses) == 0 {
+				return internal.ErrNotFound
+			}
+
+			return nil
+		})
+		if errors.Is(err, internal.ErrNotFound) {
+			internal.MentionReplyTemplate(r, notFoundTemplate, nil)
+			return
+		} else if err != nil {
+			internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+				"error": err,
+			})
 			return
 		}
 
-		license := fr.LicenseData.Licenses[0]
-		r.MentionReplyf("%s (%s): %s, %s, expires %s", license.Callsign, license.Service, license.Name, license.Status, license.ExpireDate)
-	}()
+		internal.MentionReplyTemplate(r, licenseTemplate, map[string]interface{}{
+			"license": fr.LicenseData.Licenses[0],
+		})
+	})
 }
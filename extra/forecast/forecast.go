@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	darksky "github.com/mlbright/darksky/v2"
@@ -12,11 +13,14 @@ import (
 	"xorm.io/xorm"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/core/isupport"
 	"github.com/belak/go-seabird-plugins/extra/db"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
 	seabird.RegisterPlugin("forecast", newForecastPlugin)
+	db.RegisterModels("forecast", ForecastLocation{})
 }
 
 const defaultUnitString = "°"
@@ -39,12 +43,64 @@ func getUnit(unit darksky.Units) string {
 	return defaultUnitString
 }
 
+var (
+	sampleLocation  = &ForecastLocation{Address: "Seattle, WA, USA"}
+	sampleDataPoint = darksky.DataPoint{
+		Summary:        "Light rain",
+		Temperature:    51.2,
+		TemperatureMax: 54.3,
+		TemperatureMin: 45.1,
+		Humidity:       0.83,
+	}
+)
+
+var (
+	forecastTemplate = internal.TemplateMustCompile("forecast", `
+3 day forecast for {{ .location.Address }}.
+`).WithSample(map[string]interface{}{
+		"location": sampleLocation,
+	})
+
+	// Rendered once for each of the 3 days.
+	forecastDayTemplate = internal.TemplateMustCompile("forecastDay", `
+{{ .day }}: High {{ printf "%.2f" .data.TemperatureMax }}{{ .unit }}, Low {{ printf "%.2f" .data.TemperatureMin }}{{ .unit }}, Humidity {{ printf "%.f" .humidity }}%. {{ .data.Summary }}
+`).WithSample(map[string]interface{}{
+		"day":      time.Monday,
+		"data":     sampleDataPoint,
+		"unit":     "°F",
+		"humidity": sampleDataPoint.Humidity * 100,
+	})
+
+	weatherTemplate = internal.TemplateMustCompile("weather", `
+{{ .location.Address }}. Currently {{ printf "%.1f" .current.Temperature }}{{ .unit }}. High {{ printf "%.2f" .today.TemperatureMax }}{{ .unit }}, Low {{ printf "%.2f" .today.TemperatureMin }}{{ .unit }}, Humidity {{ printf "%.f" .humidity }}%. {{ .current.Summary }}.
+`).WithSample(map[string]interface{}{
+		"location": sampleLocation,
+		"current":  sampleDataPoint,
+		"today":    sampleDataPoint,
+		"unit":     "°F",
+		"humidity": sampleDataPoint.Humidity * 100,
+	})
+
+	errorTemplate = internal.TemplateMustCompile("forecastError", `
+{{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("Could not find a location for \"belak\""),
+	})
+)
+
 type forecastPlugin struct {
 	Key        string
 	MapsKey    string
 	db         *xorm.Engine
+	isupport   *isupport.Plugin
 	mapsClient *maps.Client
-	// CacheDuration string
+	client     *internal.HTTPClient
+	cache      *internal.Cache
+	lifecycle  *internal.Lifecycle
+
+	// lock protects the keys and mapsClient, which can change when the
+	// config is reloaded.
+	lock sync.RWMutex
 }
 
 // ForecastLocation is a simple cache which will store the lat and lon of a
@@ -63,22 +119,25 @@ func newForecastPlugin(b *seabird.Bot) error {
 		return err
 	}
 
+	if err := b.EnsurePlugin("isupport"); err != nil {
+		return err
+	}
+
 	p := &forecastPlugin{
-		db: db.CtxDB(b.Context()),
+		db:       db.CtxDB(b.Context()),
+		isupport: isupport.CtxISupport(b.Context()),
 	}
 
-	// Ensure DB tables are up to date
-	err := p.db.Sync(ForecastLocation{})
-	if err != nil {
+	if err := db.Migrate(b, "forecast"); err != nil {
 		return err
 	}
 
-	err = b.Config("forecast", p)
+	err := b.Config("forecast", p)
 	if err != nil {
 		return err
 	}
 
-	cm := b.CommandMux()
+	cm := internal.NewCommandMux(b)
 
 	cm.Event("weather", p.weatherCallback, &seabird.HelpInfo{
 		Usage:       "<location>",
@@ -90,33 +149,96 @@ func newForecastPlugin(b *seabird.Bot) error {
 		Description: "Retrieves three-day forecast for given location",
 	})
 
-	options := []maps.ClientOption{}
-	if p.MapsKey != "" {
-		options = append(options, maps.WithAPIKey(p.MapsKey))
+	p.client, err = internal.NewHTTPClient(b, "forecast")
+	if err != nil {
+		return err
 	}
 
-	p.mapsClient, err = maps.NewClient(options...)
+	p.cache, err = internal.NewCache(b, "forecast")
 	if err != nil {
 		return err
 	}
 
+	p.mapsClient, err = p.newMapsClient(p.MapsKey)
+	if err != nil {
+		return err
+	}
+
+	p.lifecycle = internal.BotLifecycle(b)
+	p.lifecycle.OnReload("forecast", p.reload)
+
 	return nil
 }
 
-func (p *forecastPlugin) forecastQuery(loc *ForecastLocation) (*darksky.Forecast, error) {
-	return darksky.Get(
-		p.Key,
-		strconv.FormatFloat(loc.Lat, 'f', 4, 64),
-		strconv.FormatFloat(loc.Lon, 'f', 4, 64),
-		"now",
+func (p *forecastPlugin) newMapsClient(key string) (*maps.Client, error) {
+	options := []maps.ClientOption{maps.WithHTTPClient(p.client.Client())}
+	if key != "" {
+		options = append(options, maps.WithAPIKey(key))
+	}
+
+	return maps.NewClient(options...)
+}
+
+func (p *forecastPlugin) reload(conf *seabird.Bot) error {
+	config := &forecastPlugin{}
+	if err := conf.Config("forecast", config); err != nil {
+		return err
+	}
+
+	mapsClient, err := p.newMapsClient(config.MapsKey)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.Key = config.Key
+	p.MapsKey = config.MapsKey
+	p.mapsClient = mapsClient
+
+	return nil
+}
+
+func (p *forecastPlugin) forecastQuery(ctx context.Context, loc *ForecastLocation) (*darksky.Forecast, error) {
+	lat := strconv.FormatFloat(loc.Lat, 'f', 4, 64)
+	lon := strconv.FormatFloat(loc.Lon, 'f', 4, 64)
+
+	p.lock.RLock()
+	key := p.Key
+	p.lock.RUnlock()
+
+	// This is the same request darksky.Get makes, but it needs to go through
+	// our client.
+	url := fmt.Sprintf(
+		"%s/%s/%s,%s?units=%s&lang=%s",
+		darksky.BASEURL,
+		key,
+		lat,
+		lon,
 		darksky.AUTO,
 		darksky.English)
+
+	fc := &darksky.Forecast{}
+
+	err := p.cache.Fetch(lat+","+lon, fc, func() error {
+		return p.client.GetJSON(ctx, url, fc)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fc, nil
 }
 
-func (p *forecastPlugin) getLocation(r *seabird.Request) (*ForecastLocation, error) {
+func (p *forecastPlugin) getLocation(ctx context.Context, r *seabird.Request) (*ForecastLocation, error) {
 	l := r.Message.Trailing()
 
-	target := &ForecastLocation{Nick: r.Message.Prefix.Name}
+	// Nicks are folded so the stored value follows the user no matter
+	// how their nick is capitalized.
+	nick := p.isupport.CaseFold(r.Message.Prefix.Name)
+
+	target := &ForecastLocation{Nick: nick}
 
 	// If it's an empty string, check the cache
 	if l == "" {
@@ -130,7 +252,11 @@ func (p *forecastPlugin) getLocation(r *seabird.Request) (*ForecastLocation, err
 
 	// If it's not an empty string, we have to look up the location and store
 	// it.
-	res, err := p.mapsClient.Geocode(context.TODO(), &maps.GeocodingRequest{
+	p.lock.RLock()
+	mapsClient := p.mapsClient
+	p.lock.RUnlock()
+
+	res, err := mapsClient.Geocode(ctx, &maps.GeocodingRequest{
 		Address: l,
 	})
 	//nolint:gocritic
@@ -143,7 +269,7 @@ func (p *forecastPlugin) getLocation(r *seabird.Request) (*ForecastLocation, err
 	}
 
 	newLocation := &ForecastLocation{
-		Nick:    r.Message.Prefix.Name,
+		Nick:    nick,
 		Address: res[0].FormattedAddress,
 		Lat:     res[0].Geometry.Location.Lat,
 		Lon:     res[0].Geometry.Location.Lng,
@@ -162,62 +288,66 @@ func (p *forecastPlugin) getLocation(r *seabird.Request) (*ForecastLocation, err
 }
 
 func (p *forecastPlugin) forecastCallback(r *seabird.Request) {
-	loc, err := p.getLocation(r)
-	if err != nil {
-		r.MentionReplyf("%s", err.Error())
-		return
-	}
-
-	fc, err := p.forecastQuery(loc)
-	if err != nil {
-		r.MentionReplyf("%s", err.Error())
-		return
-	}
+	p.lifecycle.Go(func(ctx context.Context) {
+		loc, err := p.getLocation(ctx, r)
+		if err != nil {
+			internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+				"error": err,
+			})
+			return
+		}
 
-	unit := getUnit(darksky.Units(fc.Flags.Units))
+		fc, err := p.forecastQuery(ctx, loc)
+		if err != nil {
+			internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+				"error": err,
+			})
+			return
+		}
 
-	r.MentionReplyf("3 day forecast for %s.", loc.Address)
+		unit := getUnit(darksky.Units(fc.Flags.Units))
 
-	for _, block := range fc.Daily.Data[1:4] {
-		day := time.Unix(block.Time, 0).Weekday()
+		internal.MentionReplyTemplate(r, forecastTemplate, map[string]interface{}{
+			"location": loc,
+		})
 
-		r.MentionReplyf(
-			"%s: High %.2f%s, Low %.2f%s, Humidity %.f%%. %s",
-			day,
-			block.TemperatureMax,
-			unit,
-			block.TemperatureMin,
-			unit,
-			block.Humidity*100,
-			block.Summary)
-	}
+		for _, block := range fc.Daily.Data[1:4] {
+			internal.MentionReplyTemplate(r, forecastDayTemplate, map[string]interface{}{
+				"day":      time.Unix(block.Time, 0).Weekday(),
+				"data":     block,
+				"unit":     unit,
+				"humidity": block.Humidity * 100,
+			})
+		}
+	})
 }
 
 func (p *forecastPlugin) weatherCallback(r *seabird.Request) {
-	loc, err := p.getLocation(r)
-	if err != nil {
-		r.MentionReplyf("%s", err.Error())
-		return
-	}
+	p.lifecycle.Go(func(ctx context.Context) {
+		loc, err := p.getLocation(ctx, r)
+		if err != nil {
+			internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+				"error": err,
+			})
+			return
+		}
 
-	fc, err := p.forecastQuery(loc)
-	if err != nil {
-		r.MentionReplyf("%s", err.Error())
-		return
-	}
-
-	unit := getUnit(darksky.Units(fc.Flags.Units))
-
-	today := fc.Daily.Data[0]
-	r.MentionReplyf(
-		"%s. Currently %.1f%s. High %.2f%s, Low %.2f%s, Humidity %.f%%. %s.",
-		loc.Address,
-		fc.Currently.Temperature,
-		unit,
-		today.TemperatureMax,
-		unit,
-		today.TemperatureMin,
-		unit,
-		fc.Currently.Humidity*100,
-		fc.Currently.Summary)
+		fc, err := p.forecastQuery(ctx, loc)
+		if err != nil {
+			internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+				"error": err,
+			})
+			return
+		}
+
+		unit := getUnit(darksky.Units(fc.Flags.Units))
+
+		internal.MentionReplyTemplate(r, weatherTemplate, map[string]interface{}{
+			"location": loc,
+			"current":  fc.Currently,
+			"today":    fc.Daily.Data[0],
+			"unit":     unit,
+			"humidity": fc.Currently.Humidity * 100,
+		})
+	})
 }
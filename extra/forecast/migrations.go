@@ -0,0 +1,27 @@
+package forecast
+
+import (
+	"xorm.io/xorm"
+
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+func init() {
+	db.RegisterMigrations("forecast",
+		db.Migration{
+			Version:     1,
+			Description: "Create the forecast_location table",
+			Up: func(s *xorm.Session) error {
+				type ForecastLocation struct {
+					ID      int64
+					Nick    string `xorm:"unique"`
+					Address string
+					Lat     float64
+					Lon     float64
+				}
+
+				return db.CreateTables(s, ForecastLocation{})
+			},
+		},
+	)
+}
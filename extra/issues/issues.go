@@ -2,13 +2,18 @@ package issues
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/core/permissions"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
@@ -17,16 +22,72 @@ func init() {
 
 // var issueTagRegex = regexp.MustCompile(`^(.+)(?: ([@#].+)){0,2}$`)
 
-type issuesPlugin struct {
+var sampleTime = time.Date(2015, time.January, 2, 0, 0, 0, 0, time.UTC)
+
+var sampleIssue = &github.Issue{
+	Number:    github.Int(42),
+	State:     github.String("open"),
+	Assignee:  &github.User{Login: github.String("jsvana")},
+	Title:     github.String("Issue title"),
+	CreatedAt: &sampleTime,
+	HTMLURL:   github.String("https://github.com/belak/go-seabird/issues/42"),
+}
+
+var (
+	createdTemplate = internal.TemplateMustCompile("issueCreated", `
+Issue created. {{ .issue.HTMLURL }}
+`).WithSample(map[string]interface{}{
+		"issue": sampleIssue,
+	})
+
+	resultCountTemplate = internal.TemplateMustCompile("issueResultCount", `
+{{ if eq .total 1 }}There was {{ .total }} result.{{ else }}There were {{ .total }} results.{{ end }}
+`).WithSample(map[string]interface{}{
+		"total": 2,
+	})
+
+	// Issue #42 on belak/go-seabird [open] (assigned to jsvana) - Issue title [created 2 Jan 2015] - https://github.com/belak/go-seabird/issues/42
+	resultTemplate = internal.TemplateMustCompile("issueResult", `
+Issue #{{ .issue.Number }} on {{ .user }}/{{ .repo }} [{{ .issue.State }}]
+{{- with .issue.Assignee }} (assigned to {{ .Login }}){{ end }}
+{{- with .issue.Title }} - {{ . }}{{ end }}
+{{- with .issue.CreatedAt }} [created {{ . | dateFormat "2 Jan 2006" }}]{{ end }}
+{{- with .issue.HTMLURL }} - {{ . }}{{ end }}
+`).WithSample(map[string]interface{}{
+		"issue": sampleIssue,
+		"user":  "belak",
+		"repo":  "go-seabird",
+	})
+
+	titleRequiredTemplate = internal.TemplateMustCompile("issueTitleRequired", `
+Issue title required
+`).WithSample(map[string]interface{}{})
+
+	errorTemplate = internal.TemplateMustCompile("issueError", `
+{{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("401 Bad credentials"),
+	})
+)
+
+type issuesConfig struct {
 	Token       string
 	DefaultRepo string
 	RepoTags    map[string]string
+}
 
-	api *github.Client
+type issuesPlugin struct {
+	client    *internal.HTTPClient
+	lifecycle *internal.Lifecycle
+
+	// These can change when the config is reloaded.
+	lock   sync.RWMutex
+	config *issuesConfig
+	api    *github.Client
 }
 
-func newIssuesPlugin(b *seabird.Bot) error {
-	p := &issuesPlugin{
+func loadIssuesConfig(b *seabird.Bot) (*issuesConfig, error) {
+	config := &issuesConfig{
 		DefaultRepo: "belak/go-seabird",
 		RepoTags: map[string]string{
 			"irc":     "go-irc/irc",
@@ -35,30 +96,50 @@ func newIssuesPlugin(b *seabird.Bot) error {
 		},
 	}
 
-	if err := b.Config("github", p); err != nil {
-		return err
+	if err := b.Config("github", config); err != nil {
+		return nil, err
 	}
 
-	for k, v := range p.RepoTags {
+	for k, v := range config.RepoTags {
 		if strings.Count(v, "/") != 1 {
-			return fmt.Errorf("Invalid repo spec %q for key %q", v, k)
+			return nil, fmt.Errorf("Invalid repo spec %q for key %q", v, k)
 		}
 	}
 
-	// Create an oauth2 client
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: p.Token},
-	)
-	tc := oauth2.NewClient(context.TODO(), ts)
+	return config, nil
+}
 
-	// Create a github client from the oauth2 client
-	p.api = github.NewClient(tc)
+func newIssuesPlugin(b *seabird.Bot) error {
+	config, err := loadIssuesConfig(b)
+	if err != nil {
+		return err
+	}
+
+	if err = b.EnsurePlugin("permissions"); err != nil {
+		return err
+	}
+
+	p := &issuesPlugin{
+		config:    config,
+		lifecycle: internal.BotLifecycle(b),
+	}
+
+	p.client, err = internal.NewHTTPClient(b, "issues")
+	if err != nil {
+		return err
+	}
 
-	cm := b.CommandMux()
+	p.api = p.newAPI(config.Token)
 
-	cm.Event("issue", p.CreateIssue, &seabird.HelpInfo{
+	p.lifecycle.OnReload("issues", p.reload)
+
+	cm := internal.NewCommandMux(b)
+
+	perms := permissions.CtxPermissions(b.Context())
+
+	cm.Event("issue", perms.Require(permissions.RoleTrusted, p.CreateIssue), &seabird.HelpInfo{
 		Usage:       "<issue title> [#repo_tag] [@user]",
-		Description: "Creates a new issue for seabird. Be nice. Abuse this and it will be removed.",
+		Description: "Creates a new issue for seabird. Requires the trusted role.",
 	})
 
 	cm.Event("isearch", p.IssueSearch, &seabird.HelpInfo{
@@ -69,8 +150,48 @@ func newIssuesPlugin(b *seabird.Bot) error {
 	return nil
 }
 
+// newAPI creates a github client which authenticates with the given token.
+func (p *issuesPlugin) newAPI(token string) *github.Client {
+	// Create an oauth2 client on top of our own client
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, p.client.Client())
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: token},
+	)
+	tc := oauth2.NewClient(ctx, ts)
+
+	// Create a github client from the oauth2 client
+	return github.NewClient(tc)
+}
+
+func (p *issuesPlugin) reload(conf *seabird.Bot) error {
+	config, err := loadIssuesConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	api := p.newAPI(config.Token)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.config = config
+	p.api = api
+
+	return nil
+}
+
+// settings returns the current config and github client.
+func (p *issuesPlugin) settings() (*issuesConfig, *github.Client) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.config, p.api
+}
+
 func (p *issuesPlugin) CreateIssue(r *seabird.Request) {
-	go func() {
+	p.lifecycle.Go(func(ctx context.Context) {
+		config, api := p.settings()
+
 		req := &github.IssueRequest{}
 
 		// This will be what we eventually send to the server
@@ -79,7 +200,7 @@ func (p *issuesPlugin) CreateIssue(r *seabird.Request) {
 
 		title := strings.TrimSpace(r.Message.Trailing())
 		searchChars := "#@"
-		targetRepo := p.DefaultRepo
+		targetRepo := config.DefaultRepo
 		for idx := strings.LastIndexAny(title, searchChars); idx > -1; idx = strings.LastIndexAny(title, searchChars) {
 			if strings.Contains(title[idx+1:], " ") {
 				break
@@ -91,7 +212,7 @@ func (p *issuesPlugin) CreateIssue(r *seabird.Request) {
 
 			switch char {
 			case '#':
-				if repoPath, ok := p.RepoTags[data]; ok {
+				if repoPath, ok := config.RepoTags[data]; ok {
 					targetRepo = repoPath
 				}
 			case '@':
@@ -106,7 +227,7 @@ func (p *issuesPlugin) CreateIssue(r *seabird.Request) {
 		}
 
 		if title == "" {
-			r.MentionReplyf("Issue title required")
+			internal.MentionReplyTemplate(r, titleRequiredTemplate, nil)
 			return
 		}
 
@@ -114,14 +235,18 @@ func (p *issuesPlugin) CreateIssue(r *seabird.Request) {
 
 		pathSegments := strings.SplitN(targetRepo, "/", 2)
 
-		issue, _, err := p.api.Issues.Create(context.TODO(), pathSegments[0], pathSegments[1], req)
+		issue, _, err := api.Issues.Create(ctx, pathSegments[0], pathSegments[1], req)
 		if err != nil {
-			r.MentionReplyf("%s", err.Error())
+			internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+				"error": err,
+			})
 			return
 		}
 
-		r.MentionReplyf("Issue created. %s", *issue.HTMLURL)
-	}()
+		internal.MentionReplyTemplate(r, createdTemplate, map[string]interface{}{
+			"issue": issue,
+		})
+	})
 }
 
 func (p *issuesPlugin) IssueSearch(r *seabird.Request) {
@@ -148,9 +273,13 @@ func (p *issuesPlugin) IssueSearch(r *seabird.Request) {
 
 	opt := &github.SearchOptions{}
 
-	issues, _, err := p.api.Search.Issues(context.TODO(), strings.Join(split, " "), opt)
+	_, api := p.settings()
+
+	issues, _, err := api.Search.Issues(context.TODO(), strings.Join(split, " "), opt)
 	if err != nil {
-		r.MentionReplyf("%s", err.Error())
+		internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+			"error": err,
+		})
 		return
 	}
 
@@ -159,43 +288,24 @@ func (p *issuesPlugin) IssueSearch(r *seabird.Request) {
 		total = *issues.Total
 	}
 
-	if total == 1 {
-		r.MentionReplyf("There was %d result.", total)
-	} else {
-		r.MentionReplyf("There were %d results.", total)
-	}
+	internal.MentionReplyTemplate(r, resultCountTemplate, map[string]interface{}{
+		"total": total,
+	})
 
 	if total > 3 {
 		total = 3
 	}
 
 	for _, issue := range issues.Issues[:total] {
-		r.MentionReplyf("%s", encodeIssue(issue))
-	}
-}
-
-func encodeIssue(issue github.Issue) string {
-	// Issue #42 on belak/go-seabird [open] (assigned to jsvana) - Issue title [created 2 Jan 2015]
-	urlparts := strings.Split(*issue.HTMLURL, "/")
-	user := urlparts[len(urlparts)-4]
-	repo := urlparts[len(urlparts)-3]
-
-	out := fmt.Sprintf("Issue #%d on %s/%s [%s]", *issue.Number, user, repo, *issue.State)
-	if issue.Assignee != nil {
-		out += " (assigned to " + *issue.Assignee.Login + ")"
-	}
-
-	if issue.Title != nil && *issue.Title != "" {
-		out += " - " + *issue.Title
-	}
-
-	if issue.CreatedAt != nil {
-		out += " [created " + issue.CreatedAt.Format("2 Jan 2006") + "]"
-	}
+		urlparts := strings.Split(issue.GetHTMLURL(), "/")
+		if len(urlparts) < 4 {
+			continue
+		}
 
-	if issue.HTMLURL != nil {
-		out += " - " + *issue.HTMLURL
+		internal.MentionReplyTemplate(r, resultTemplate, map[string]interface{}{
+			"issue": issue,
+			"user":  urlparts[len(urlparts)-4],
+			"repo":  urlparts[len(urlparts)-3],
+		})
 	}
-
-	return out
 }
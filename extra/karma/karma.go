@@ -8,15 +8,19 @@ import (
 	"xorm.io/xorm"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/core/isupport"
 	"github.com/belak/go-seabird-plugins/extra/db"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
 	seabird.RegisterPlugin("karma", newKarmaPlugin)
+	db.RegisterModels("karma", Karma{})
 }
 
 type karmaPlugin struct {
-	db *xorm.Engine
+	db       *xorm.Engine
+	isupport *isupport.Plugin
 }
 
 // Karma represents an item with a karma count
@@ -28,23 +32,57 @@ type Karma struct {
 
 var karmaRegex = regexp.MustCompile(`([\w]{2,}|".+?")(\+\++|--+)(?:\s|$)`)
 
+// maxChange is the most karma can change by in a single message.
+const maxChange = 5
+
+var (
+	karmaTemplate = internal.TemplateMustCompile("karma", `
+{{ .name }}'s karma is {{ bold .score }}
+`).WithSample(map[string]interface{}{
+		"name":  "seabird",
+		"score": 42,
+	})
+
+	changedTemplate = internal.TemplateMustCompile("karmaChanged", `
+{{ .name }}'s karma is now {{ bold .score }}
+`).WithSample(map[string]interface{}{
+		"name":  "seabird",
+		"score": 43,
+	})
+
+	buzzkillTemplate = internal.TemplateMustCompile("karmaBuzzkill", `
+Buzzkill Mode (tm) enforced a maximum karma change of {{ .max }}
+`).WithSample(map[string]interface{}{
+		"max": maxChange,
+	})
+
+	jerkModeTemplate = internal.TemplateMustCompile("karmaJerkMode", `
+Don't Be a Jerk Mode (tm) enforced a maximum karma change of {{ .max }}
+`).WithSample(map[string]interface{}{
+		"max": maxChange,
+	})
+)
+
 func newKarmaPlugin(b *seabird.Bot) error {
 	if err := b.EnsurePlugin("db"); err != nil {
 		return err
 	}
 
+	if err := b.EnsurePlugin("isupport"); err != nil {
+		return err
+	}
+
 	p := &karmaPlugin{
-		db: db.CtxDB(b.Context()),
+		db:       db.CtxDB(b.Context()),
+		isupport: isupport.CtxISupport(b.Context()),
 	}
 
-	// Migrate any relevant tables
-	err := p.db.Sync(Karma{})
-	if err != nil {
+	if err := db.Migrate(b, "karma"); err != nil {
 		return err
 	}
 
-	bm := b.BasicMux()
-	cm := b.CommandMux()
+	bm := internal.NewBasicMux(b)
+	cm := internal.NewCommandMux(b)
 
 	cm.Event("karma", p.karmaCallback, &seabird.HelpInfo{
 		Usage:       "<nick>",
@@ -57,7 +95,9 @@ func newKarmaPlugin(b *seabird.Bot) error {
 }
 
 func (p *karmaPlugin) cleanedName(name string) string {
-	return strings.TrimFunc(strings.ToLower(name), unicode.IsSpace)
+	// Names are folded using the server's CASEMAPPING so karma for a nick
+	// matches no matter how it's written.
+	return strings.TrimFunc(p.isupport.CaseFold(name), unicode.IsSpace)
 }
 
 // GetKarmaFor returns the karma for the given name.
@@ -88,14 +128,17 @@ func (p *karmaPlugin) UpdateKarma(name string, diff int) int {
 }
 
 func (p *karmaPlugin) karmaCallback(r *seabird.Request) {
-	term := strings.TrimSpace(r.Message.Trailing())
+	term := strings.TrimSpace(internal.StripFormatting(r.Message.Trailing()))
 
 	// If we don't provide a term, search for the current nick
 	if term == "" {
 		term = r.Message.Prefix.Name
 	}
 
-	r.MentionReplyf("%s's karma is %d", term, p.GetKarmaFor(term))
+	internal.MentionReplyTemplate(r, karmaTemplate, map[string]interface{}{
+		"name":  term,
+		"score": p.GetKarmaFor(term),
+	})
 }
 
 func (p *karmaPlugin) callback(r *seabird.Request) {
@@ -109,7 +152,9 @@ func (p *karmaPlugin) callback(r *seabird.Request) {
 
 	var changes = make(map[string]int)
 
-	matches := karmaRegex.FindAllStringSubmatch(r.Message.Trailing(), -1)
+	var names = make(map[string]string)
+
+	matches := karmaRegex.FindAllStringSubmatch(internal.StripFormatting(r.Message.Trailing()), -1)
 	for _, v := range matches {
 		// If it starts with a ", we know it also ends with a quote so we
 		// can chop them off.
@@ -127,28 +172,44 @@ func (p *karmaPlugin) callback(r *seabird.Request) {
 			diff *= -1
 		}
 
-		changes[v[1]] += diff
+		// Changes are combined using the cleaned name so writing a name a
+		// few different ways can't get around the limit. The first way it
+		// was written is the one we reply with.
+		if _, ok := changes[cleanedName]; !ok {
+			names[cleanedName] = v[1]
+		}
+
+		changes[cleanedName] += diff
 	}
 
-	for name, diff := range changes {
-		if diff > 5 {
+	for cleanedName, diff := range changes {
+		name := names[cleanedName]
+
+		if diff > maxChange {
 			buzzkillTriggered = true
-			diff = 5
+			diff = maxChange
 		}
 
-		if diff < -5 {
+		if diff < -maxChange {
 			jerkModeTriggered = true
-			diff = -5
+			diff = -maxChange
 		}
 
-		r.Replyf("%s's karma is now %d", name, p.UpdateKarma(name, diff))
+		internal.ReplyTemplate(r, changedTemplate, map[string]interface{}{
+			"name":  name,
+			"score": p.UpdateKarma(name, diff),
+		})
 	}
 
 	if buzzkillTriggered {
-		r.Replyf("Buzzkill Mode (tm) enforced a maximum karma change of 5")
+		internal.ReplyTemplate(r, buzzkillTemplate, map[string]interface{}{
+			"max": maxChange,
+		})
 	}
 
 	if jerkModeTriggered {
-		r.Replyf("Don't Be a Jerk Mode (tm) enforced a maximum karma change of 5")
+		internal.ReplyTemplate(r, jerkModeTemplate, map[string]interface{}{
+			"max": maxChange,
+		})
 	}
 }
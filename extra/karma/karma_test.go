@@ -0,0 +1,52 @@
+package karma
+
+import (
+	"testing"
+
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+func TestKarma(t *testing.T) {
+	b := testbot.New(t, []string{"db", "isupport", "karma"}, "")
+
+	b.Privmsg("someone", testbot.Channel, "go++")
+	b.ExpectPrivmsg(testbot.Channel, "go's karma is now 1")
+
+	// Names are case folded, so this is the same as go.
+	b.Privmsg("someone", testbot.Channel, "GO---")
+	b.ExpectPrivmsg(testbot.Channel, "GO's karma is now -1")
+
+	b.Privmsg("someone", testbot.Channel, "!karma go")
+	b.ExpectPrivmsg(testbot.Channel, "someone: go's karma is -1")
+
+	// Karma isn't changed in private.
+	b.Privmsg("someone", testbot.Nick, "go++")
+	b.ExpectNothing()
+}
+
+func TestKarmaSelf(t *testing.T) {
+	b := testbot.New(t, []string{"db", "isupport", "karma"}, "")
+
+	b.Privmsg("someone", testbot.Channel, "someone++")
+	b.ExpectPrivmsg(testbot.Channel, "someone's karma is now -1")
+
+	b.Privmsg("someone", testbot.Channel, "!karma")
+	b.ExpectPrivmsg(testbot.Channel, "someone: someone's karma is -1")
+}
+
+func TestKarmaLimits(t *testing.T) {
+	b := testbot.New(t, []string{"db", "isupport", "karma"}, "")
+
+	b.Privmsg("someone", testbot.Channel, "go++++++++++")
+	b.ExpectPrivmsg(testbot.Channel, "go's karma is now 5")
+	b.ExpectPrivmsg(testbot.Channel, "Buzzkill Mode (tm) enforced a maximum karma change of 5")
+
+	b.Privmsg("someone", testbot.Channel, "go----------")
+	b.ExpectPrivmsg(testbot.Channel, "go's karma is now 0")
+	b.ExpectPrivmsg(testbot.Channel, "Don't Be a Jerk Mode (tm) enforced a maximum karma change of 5")
+
+	// Writing a name a few different ways doesn't get around the limit.
+	b.Privmsg("someone", testbot.Channel, "Go+++ go+++ GO+++")
+	b.ExpectPrivmsg(testbot.Channel, "Go's karma is now 5")
+	b.ExpectPrivmsg(testbot.Channel, "Buzzkill Mode (tm) enforced a maximum karma change of 5")
+}
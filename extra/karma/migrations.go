@@ -0,0 +1,91 @@
+package karma
+
+import (
+	"strings"
+	"unicode"
+
+	"xorm.io/xorm"
+
+	"github.com/belak/go-seabird-plugins/core/isupport"
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+func init() {
+	db.RegisterMigrations("karma",
+		db.Migration{
+			Version:     1,
+			Description: "Create the karma table",
+			Up: func(s *xorm.Session) error {
+				type Karma struct {
+					ID    int64
+					Name  string `xorm:"unique"`
+					Score int
+				}
+
+				return db.CreateTables(s, Karma{})
+			},
+		},
+		db.Migration{
+			Version:     2,
+			Description: "Merge karma for names which only differ by case or whitespace",
+			Up:          mergeFoldedNames,
+		},
+	)
+}
+
+// mergeFoldedNames combines rows whose names are the same once they've been
+// cleaned, from before names were case folded.
+//
+// Migrations run before the bot connects, so the server's CASEMAPPING isn't
+// known and names are folded using rfc1459, the default. On a server using
+// ascii, names which only differ by []\~ and {}|^ will have been merged and
+// stored using the folded name, so karma for the ones containing []\~ won't
+// be found afterwards.
+func mergeFoldedNames(s *xorm.Session) error {
+	type Karma struct {
+		ID    int64
+		Name  string
+		Score int
+	}
+
+	var rows []Karma
+	if err := s.Asc("id").Find(&rows); err != nil {
+		return err
+	}
+
+	// The oldest row for each name is kept.
+	keep := make(map[string]*Karma)
+	var order []string
+
+	for i := range rows {
+		row := &rows[i]
+		name := strings.TrimFunc(isupport.FoldCase(isupport.CaseMappingRFC1459, row.Name), unicode.IsSpace)
+
+		kept, ok := keep[name]
+		if !ok {
+			keep[name] = row
+			order = append(order, name)
+
+			continue
+		}
+
+		kept.Score += row.Score
+
+		if _, err := s.ID(row.ID).Delete(&Karma{}); err != nil {
+			return err
+		}
+	}
+
+	// Duplicates have to be gone before any names change, or we'd break
+	// the unique index on name.
+	for _, name := range order {
+		row := keep[name]
+		row.Name = name
+
+		if _, err := s.ID(row.ID).Cols("name", "score").Update(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
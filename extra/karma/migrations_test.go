@@ -0,0 +1,82 @@
+package karma
+
+import (
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+func TestMigrations(t *testing.T) {
+	x, err := db.NewEngine("sqlite3", filepath.Join(t.TempDir(), "seabird.db"), "")
+	require.NoError(t, err)
+
+	defer x.Close()
+
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.SetLevel(logrus.ErrorLevel)
+
+	// A dry run should go through every migration without creating the
+	// table.
+	applied, err := db.ApplyMigrations(x, logger, "karma", true)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+
+	exists, err := x.IsTableExist(Karma{})
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	statuses, err := db.MigrationStatuses(x, "karma")
+	require.NoError(t, err)
+
+	for _, status := range statuses {
+		require.False(t, status.Applied)
+	}
+
+	// Neither the dry run nor checking the status should create the
+	// migrations table.
+	exists, err = x.IsTableExist(db.SchemaMigration{})
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Tables from before karma had migrations are kept, and names which
+	// only differ by case or whitespace are merged.
+	type oldKarma struct {
+		ID    int64
+		Name  string `xorm:"unique"`
+		Score int
+	}
+
+	require.NoError(t, x.Table("karma").Sync2(oldKarma{}))
+
+	_, err = x.Table("karma").Insert(
+		&oldKarma{Name: "Go", Score: 2},
+		&oldKarma{Name: "rust", Score: 1},
+		&oldKarma{Name: "go ", Score: 3},
+	)
+	require.NoError(t, err)
+
+	// A dry run against existing data shouldn't change it either.
+	applied, err = db.ApplyMigrations(x, logger, "karma", true)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+
+	count, err := x.Count(&Karma{})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+
+	applied, err = db.ApplyMigrations(x, logger, "karma", false)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+
+	var rows []Karma
+	require.NoError(t, x.Asc("id").Find(&rows))
+	require.Equal(t, []Karma{
+		{ID: 1, Name: "go", Score: 5},
+		{ID: 2, Name: "rust", Score: 1},
+	}, rows)
+}
@@ -1,47 +1,80 @@
 package lastseen
 
 import (
-	"fmt"
-	"strings"
 	"time"
 
 	"xorm.io/xorm"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/core/isupport"
 	"github.com/belak/go-seabird-plugins/extra/db"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
 	seabird.RegisterPlugin("lastseen", newLastSeenPlugin)
+	db.RegisterModels("lastseen", LastSeen{})
 }
 
 type lastSeenPlugin struct {
-	db *xorm.Engine
+	db       *xorm.Engine
+	isupport *isupport.Plugin
 }
 
 // LastSeen is the xorm model for the lastseen plugin
 type LastSeen struct {
 	ID      int64
-	Channel string
-	Nick    string
+	Channel string `xorm:"unique(channel_nick)"`
+	Nick    string `xorm:"unique(channel_nick)"`
 	Time    time.Time
 }
 
+var (
+	// belak was last active on 2 January 2015 at 15:04:05
+	seenTemplate = internal.TemplateMustCompile("lastSeen", `
+{{ .nick }} was last active on {{ .seen.Time | dateFormat "2 January 2006" }} at {{ .seen.Time | dateFormat "15:04:05" }}
+`).WithSample(map[string]interface{}{
+		"nick":    "belak",
+		"channel": "#encoded",
+		"seen": &LastSeen{
+			Channel: "#encoded",
+			Nick:    "belak",
+			Time:    time.Date(2015, time.January, 2, 15, 4, 5, 0, time.UTC),
+		},
+	})
+
+	notSeenTemplate = internal.TemplateMustCompile("lastSeenNever", `
+{{ .nick }} has not been seen in {{ .channel }}
+`).WithSample(map[string]interface{}{
+		"nick":    "belak",
+		"channel": "#encoded",
+	})
+
+	nickRequiredTemplate = internal.TemplateMustCompile("lastSeenNickRequired", `
+Nick required
+`).WithSample(map[string]interface{}{})
+)
+
 func newLastSeenPlugin(b *seabird.Bot) error {
 	if err := b.EnsurePlugin("db"); err != nil {
 		return err
 	}
 
+	if err := b.EnsurePlugin("isupport"); err != nil {
+		return err
+	}
+
 	p := &lastSeenPlugin{
-		db: db.CtxDB(b.Context()),
+		db:       db.CtxDB(b.Context()),
+		isupport: isupport.CtxISupport(b.Context()),
 	}
 
-	if err := p.db.Sync(LastSeen{}); err != nil {
+	if err := db.Migrate(b, "lastseen"); err != nil {
 		return err
 	}
 
-	bm := b.BasicMux()
-	cm := b.CommandMux()
+	bm := internal.NewBasicMux(b)
+	cm := internal.NewCommandMux(b)
 
 	cm.Event("active", p.activeCallback, &seabird.HelpInfo{
 		Usage:       "<nick>",
@@ -56,35 +89,42 @@ func newLastSeenPlugin(b *seabird.Bot) error {
 func (p *lastSeenPlugin) activeCallback(r *seabird.Request) {
 	nick := r.Message.Trailing()
 	if nick == "" {
-		r.MentionReplyf("Nick required")
+		internal.MentionReplyTemplate(r, nickRequiredTemplate, nil)
 		return
 	}
 
 	channel := r.Message.Params[0]
 
-	r.MentionReplyf("%s", p.getLastSeen(nick, channel))
-}
-
-func (p *lastSeenPlugin) getLastSeen(rawNick, rawChannel string) string {
-	search := LastSeen{
-		Channel: strings.ToLower(rawChannel),
-		Nick:    strings.ToLower(rawNick),
+	vars := map[string]interface{}{
+		"nick":    nick,
+		"channel": channel,
 	}
 
-	found, err := p.db.Get(&search)
-	if err != nil || !found {
-		return rawNick + " has not been seen in " + rawChannel
+	seen := p.getLastSeen(nick, channel)
+	if seen == nil {
+		internal.MentionReplyTemplate(r, notSeenTemplate, vars)
+		return
 	}
 
-	return rawNick + " was last active on " + formatDate(search.Time) + " at " + formatTime(search.Time)
-}
+	vars["seen"] = seen
 
-func formatTime(t time.Time) string {
-	return fmt.Sprintf("%02d:%02d:%02d", t.Hour(), t.Minute(), t.Second())
+	internal.MentionReplyTemplate(r, seenTemplate, vars)
 }
 
-func formatDate(t time.Time) string {
-	return fmt.Sprintf("%d %s %d", t.Day(), t.Month().String(), t.Year())
+// getLastSeen returns when the nick was last seen in the channel, or nil if
+// they haven't been.
+func (p *lastSeenPlugin) getLastSeen(rawNick, rawChannel string) *LastSeen {
+	search := &LastSeen{
+		Channel: p.isupport.CaseFold(rawChannel),
+		Nick:    p.isupport.CaseFold(rawNick),
+	}
+
+	found, err := p.db.Get(search)
+	if err != nil || !found {
+		return nil
+	}
+
+	return search
 }
 
 func (p *lastSeenPlugin) msgCallback(r *seabird.Request) {
@@ -103,8 +143,8 @@ func (p *lastSeenPlugin) updateLastSeen(r *seabird.Request, rawNick, rawChannel
 	l := r.GetLogger("lastseen")
 
 	search := LastSeen{
-		Channel: strings.ToLower(rawChannel),
-		Nick:    strings.ToLower(rawNick),
+		Channel: p.isupport.CaseFold(rawChannel),
+		Nick:    p.isupport.CaseFold(rawNick),
 	}
 
 	_, err := p.db.Transaction(func(s *xorm.Session) (interface{}, error) {
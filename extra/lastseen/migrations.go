@@ -0,0 +1,101 @@
+package lastseen
+
+import (
+	"time"
+
+	"xorm.io/xorm"
+
+	"github.com/belak/go-seabird-plugins/core/isupport"
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+func init() {
+	db.RegisterMigrations("lastseen",
+		db.Migration{
+			Version:     1,
+			Description: "Create the last_seen table",
+			Up: func(s *xorm.Session) error {
+				type LastSeen struct {
+					ID      int64
+					Channel string
+					Nick    string
+					Time    time.Time
+				}
+
+				return db.CreateTables(s, LastSeen{})
+			},
+		},
+		db.Migration{
+			Version:     2,
+			Description: "Remove duplicate rows and add a unique index on channel and nick",
+			Up:          removeDuplicates,
+		},
+	)
+}
+
+// removeDuplicates keeps the most recent row for each channel and nick,
+// then adds a unique index so duplicates can't come back.
+//
+// Migrations run before the bot connects, so the server's CASEMAPPING isn't
+// known and rows from before names were case folded are folded using
+// rfc1459, the default. On a server using ascii, nicks containing []\~ will
+// be stored as their {}|^ forms and won't be found afterwards.
+func removeDuplicates(s *xorm.Session) error {
+	type LastSeen struct {
+		ID      int64
+		Channel string `xorm:"unique(channel_nick)"`
+		Nick    string `xorm:"unique(channel_nick)"`
+		Time    time.Time
+	}
+
+	var rows []LastSeen
+	if err := s.Asc("id").Find(&rows); err != nil {
+		return err
+	}
+
+	type key struct {
+		channel, nick string
+	}
+
+	keep := make(map[key]*LastSeen)
+	var order []key
+
+	for i := range rows {
+		row := &rows[i]
+		k := key{
+			channel: isupport.FoldCase(isupport.CaseMappingRFC1459, row.Channel),
+			nick:    isupport.FoldCase(isupport.CaseMappingRFC1459, row.Nick),
+		}
+
+		kept, ok := keep[k]
+		if !ok {
+			keep[k] = row
+			order = append(order, k)
+
+			continue
+		}
+
+		// Whichever row we drop, the latest time is the one to keep.
+		if row.Time.After(kept.Time) {
+			kept.Time = row.Time
+		}
+
+		if _, err := s.ID(row.ID).Delete(&LastSeen{}); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range order {
+		row := keep[k]
+		row.Channel = k.channel
+		row.Nick = k.nick
+
+		if _, err := s.ID(row.ID).Cols("channel", "nick", "time").Update(row); err != nil {
+			return err
+		}
+	}
+
+	// The table already exists, so CreateTables would skip it and the index
+	// is created directly.
+	return s.CreateUniques(LastSeen{})
+}
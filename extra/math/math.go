@@ -1,20 +1,36 @@
 package math
 
 import (
+	"errors"
 	"math/big"
 	"strings"
 
 	"github.com/soudy/mathcat"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
 	seabird.RegisterPlugin("math", newMathPlugin)
 }
 
+var (
+	resultTemplate = internal.TemplateMustCompile("mathResult", `
+{{ .result }}
+`).WithSample(map[string]interface{}{
+		"result": "7/2",
+	})
+
+	errorTemplate = internal.TemplateMustCompile("mathError", `
+{{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("unexpected EOF"),
+	})
+)
+
 func newMathPlugin(b *seabird.Bot) error {
-	cm := b.CommandMux()
+	cm := internal.NewCommandMux(b)
 
 	cm.Event("math", exprCallback, &seabird.HelpInfo{
 		Usage:       "<expr>",
@@ -34,9 +50,15 @@ func exprCallback(r *seabird.Request) {
 	for _, expr := range strings.Split(r.Message.Trailing(), ";") {
 		res, err = mc.Run(expr)
 		if err != nil {
-			r.MentionReplyf("%s", err)
+			internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+				"error": err,
+			})
+
+			return
 		}
 	}
 
-	r.MentionReplyf("%s", res.RatString())
+	internal.MentionReplyTemplate(r, resultTemplate, map[string]interface{}{
+		"result": res.RatString(),
+	})
 }
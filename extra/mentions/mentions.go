@@ -2,14 +2,33 @@ package mentions
 
 import (
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
 	seabird.RegisterPlugin("mentions", newMentionsPlugin)
 }
 
+var (
+	pongTemplate = internal.TemplateMustCompile("mentionsPong", `
+pong
+`).WithSample(map[string]interface{}{})
+
+	scoobySnackTemplate = internal.TemplateMustCompile("mentionsScoobySnack", `
+Scooby Dooby Doo!
+`).WithSample(map[string]interface{}{})
+
+	botSnackTemplate = internal.TemplateMustCompile("mentionsBotSnack", `
+:)
+`).WithSample(map[string]interface{}{})
+
+	pizzaHouseSnackTemplate = internal.TemplateMustCompile("mentionsPizzaHouseSnack", `
+HECK YEAHHHHHHHHHHHH OMG I LOVE U THE WORLD IS GREAT
+`).WithSample(map[string]interface{}{})
+)
+
 func newMentionsPlugin(b *seabird.Bot) error {
-	mm := b.MentionMux()
+	mm := internal.NewMentionMux(b)
 
 	mm.Event(mentionsCallback)
 
@@ -19,12 +38,12 @@ func newMentionsPlugin(b *seabird.Bot) error {
 func mentionsCallback(r *seabird.Request) {
 	switch r.Message.Trailing() {
 	case "ping":
-		r.MentionReplyf("pong")
+		internal.MentionReplyTemplate(r, pongTemplate, nil)
 	case "scoobysnack", "scooby snack":
-		r.Replyf("Scooby Dooby Doo!")
+		internal.ReplyTemplate(r, scoobySnackTemplate, nil)
 	case "botsnack", "bot snack":
-		r.Replyf(":)")
+		internal.ReplyTemplate(r, botSnackTemplate, nil)
 	case "pizzahousesnack":
-		r.Replyf("HECK YEAHHHHHHHHHHHH OMG I LOVE U THE WORLD IS GREAT")
+		internal.ReplyTemplate(r, pizzaHouseSnackTemplate, nil)
 	}
 }
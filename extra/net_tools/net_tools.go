@@ -1,11 +1,14 @@
 package nettools
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"net"
-	"net/http"
 	"net/url"
 	"os/exec"
+	"sync"
+	"time"
 
 	ping "github.com/belak/go-ping"
 
@@ -20,17 +23,110 @@ func init() {
 type netToolsPlugin struct {
 	Key            string
 	PrivilegedPing bool
+
+	client    *internal.HTTPClient
+	lifecycle *internal.Lifecycle
+
+	// lock protects Key and PrivilegedPing, which can change when the
+	// config is reloaded.
+	lock sync.RWMutex
 }
 
+var (
+	// 24 bytes from 1.1.1.1: icmp_seq=0 time=12ms
+	pingTemplate = internal.TemplateMustCompile("netToolsPing", `
+{{ .packet.Nbytes }} bytes from {{ .packet.IPAddr }}: icmp_seq={{ .packet.Seq }} time={{ .packet.Rtt }}
+`).WithSample(map[string]interface{}{
+		"packet": &ping.Packet{
+			Nbytes: 24,
+			IPAddr: &net.IPAddr{IP: net.IPv4(1, 1, 1, 1)},
+			Rtt:    12 * time.Millisecond,
+		},
+	})
+
+	// #13335 (1.1.1.0 - 1.1.1.255) - CLOUDFLARENET - Cloudflare, Inc. (US)
+	asnTemplate = internal.TemplateMustCompile("netToolsASN", `
+#{{ .asn.AsNumber }} ({{ .asn.FirstIP }} - {{ .asn.LastIP }}) - {{ .asn.AsDescription }} ({{ .asn.AsCountryCode }})
+`).WithSample(map[string]interface{}{
+		"asn": asnResponse{
+			Announced:     true,
+			AsCountryCode: "US",
+			AsDescription: "CLOUDFLARENET - Cloudflare, Inc.",
+			AsNumber:      13335,
+			FirstIP:       "1.1.1.0",
+			LastIP:        "1.1.1.255",
+		},
+	})
+
+	// Used for each result from rdns and dig.
+	resultTemplate = internal.TemplateMustCompile("netToolsResult", `
+{{ .result }}
+`).WithSample(map[string]interface{}{
+		"result": "one.one.one.one.",
+	})
+
+	pasteTemplate = internal.TemplateMustCompile("netToolsPaste", `
+{{ .url }}
+`).WithSample(map[string]interface{}{
+		"url": "https://pastebin.com/abcd1234",
+	})
+
+	dnsCheckTemplate = internal.TemplateMustCompile("netToolsDNSCheck", `
+https://www.whatsmydns.net/#A/{{ .domain }}
+`).WithSample(map[string]interface{}{
+		"domain": "example.com",
+	})
+
+	noResultsTemplate = internal.TemplateMustCompile("netToolsNoResults", `
+No results found
+`).WithSample(map[string]interface{}{})
+
+	asnUnavailableTemplate = internal.TemplateMustCompile("netToolsASNUnavailable", `
+ASN information not available
+`).WithSample(map[string]interface{}{})
+
+	errorTemplate = internal.TemplateMustCompile("netToolsError", `
+{{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("lookup example.invalid: no such host"),
+	})
+)
+
+// Replies for commands which were called without an argument.
+var (
+	argumentRequiredTemplate = internal.TemplateMustCompile("netToolsArgumentRequired", `
+Argument required
+`).WithSample(map[string]interface{}{})
+
+	domainRequiredTemplate = internal.TemplateMustCompile("netToolsDomainRequired", `
+Domain required
+`).WithSample(map[string]interface{}{})
+
+	hostRequiredTemplate = internal.TemplateMustCompile("netToolsHostRequired", `
+Host required
+`).WithSample(map[string]interface{}{})
+
+	ipRequiredTemplate = internal.TemplateMustCompile("netToolsIPRequired", `
+IP required
+`).WithSample(map[string]interface{}{})
+)
+
 func newNetToolsPlugin(b *seabird.Bot) error {
-	p := &netToolsPlugin{}
+	p := &netToolsPlugin{lifecycle: internal.BotLifecycle(b)}
 
 	err := b.Config("net_tools", p)
 	if err != nil {
 		return err
 	}
 
-	cm := b.CommandMux()
+	p.client, err = internal.NewHTTPClient(b, "nettools")
+	if err != nil {
+		return err
+	}
+
+	p.lifecycle.OnReload("nettools", p.reload)
+
+	cm := internal.NewCommandMux(b)
 
 	cm.Event("rdns", p.RDNS, &seabird.HelpInfo{
 		Usage:       "<ip>",
@@ -64,91 +160,124 @@ func newNetToolsPlugin(b *seabird.Bot) error {
 	return nil
 }
 
+func (p *netToolsPlugin) reload(conf *seabird.Bot) error {
+	config := &netToolsPlugin{}
+	if err := conf.Config("net_tools", config); err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.Key = config.Key
+	p.PrivilegedPing = config.PrivilegedPing
+
+	return nil
+}
+
+// replyError replies with an error from a lookup.
+func replyError(r *seabird.Request, err error) {
+	internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+		"error": err,
+	})
+}
+
+// replyResults replies with the first result and sends any others to the
+// sender as notices, so channels don't get flooded.
+func replyResults(r *seabird.Request, results []string) {
+	if len(results) == 0 {
+		internal.MentionReplyTemplate(r, noResultsTemplate, nil)
+		return
+	}
+
+	internal.MentionReplyTemplate(r, resultTemplate, map[string]interface{}{
+		"result": results[0],
+	})
+
+	for _, result := range results[1:] {
+		text, err := internal.RenderTemplate(resultTemplate, map[string]interface{}{
+			"result": result,
+		})
+		if err != nil {
+			r.GetLogger("nettools").WithError(err).Error("Failed to render template")
+			return
+		}
+
+		r.Writef("NOTICE %s :%s", r.Message.Prefix.Name, text)
+	}
+}
+
 func (p *netToolsPlugin) RDNS(r *seabird.Request) {
-	go func() {
+	p.lifecycle.Go(func(ctx context.Context) {
 		if r.Message.Trailing() == "" {
-			r.MentionReplyf("Argument required")
+			internal.MentionReplyTemplate(r, argumentRequiredTemplate, nil)
 			return
 		}
-		names, err := net.LookupAddr(r.Message.Trailing())
+		names, err := net.DefaultResolver.LookupAddr(ctx, r.Message.Trailing())
 		if err != nil {
-			r.MentionReplyf(err.Error())
-			return
-		}
-
-		if len(names) == 0 {
-			r.MentionReplyf("No results found")
+			replyError(r, err)
 			return
 		}
 
-		r.MentionReplyf(names[0])
-
-		if len(names) > 1 {
-			for _, name := range names[1:] {
-				r.Writef("NOTICE %s :%s", r.Message.Prefix.Name, name)
-			}
-		}
-	}()
+		replyResults(r, names)
+	})
 }
 
 func (p *netToolsPlugin) Dig(r *seabird.Request) {
-	go func() {
+	p.lifecycle.Go(func(ctx context.Context) {
 		if r.Message.Trailing() == "" {
-			r.MentionReplyf("Domain required")
+			internal.MentionReplyTemplate(r, domainRequiredTemplate, nil)
 			return
 		}
 
-		addrs, err := net.LookupHost(r.Message.Trailing())
+		addrs, err := net.DefaultResolver.LookupHost(ctx, r.Message.Trailing())
 		if err != nil {
-			r.MentionReplyf("%s", err)
-			return
-		}
-
-		if len(addrs) == 0 {
-			r.MentionReplyf("No results found")
+			replyError(r, err)
 			return
 		}
 
-		r.MentionReplyf(addrs[0])
-
-		if len(addrs) > 1 {
-			for _, addr := range addrs[1:] {
-				r.Writef("NOTICE %s :%s", r.Message.Prefix.Name, addr)
-			}
-		}
-	}()
+		replyResults(r, addrs)
+	})
 }
 
 func (p *netToolsPlugin) Ping(r *seabird.Request) {
-	go func() {
+	p.lifecycle.Go(func(ctx context.Context) {
 		if r.Message.Trailing() == "" {
-			r.MentionReplyf("Host required")
+			internal.MentionReplyTemplate(r, hostRequiredTemplate, nil)
 			return
 		}
 
 		pinger, err := ping.NewPinger(r.Message.Trailing())
 		if err != nil {
-			r.MentionReplyf("%s", err)
+			replyError(r, err)
 			return
 		}
 		pinger.Count = 1
+
+		p.lock.RLock()
 		pinger.SetPrivileged(p.PrivilegedPing)
+		p.lock.RUnlock()
 
 		pinger.OnRecv = func(pkt *ping.Packet) {
-			r.MentionReplyf("%d bytes from %s: icmp_seq=%d time=%s",
-				pkt.Nbytes, pkt.IPAddr, pkt.Seq, pkt.Rtt)
+			internal.MentionReplyTemplate(r, pingTemplate, map[string]interface{}{
+				"packet": pkt,
+			})
 		}
-		err = pinger.Run()
+		err = pinger.RunContext(ctx)
 		if err != nil {
-			r.MentionReplyf("%s", err)
+			replyError(r, err)
 			return
 		}
-	}()
+	})
 }
 
-func (p *netToolsPlugin) pasteData(data string) (string, error) {
-	resp, err := http.PostForm("http://pastebin.com/api/api_post.php", url.Values{
-		"api_dev_key":    {p.Key},
+func (p *netToolsPlugin) pasteData(ctx context.Context, data string) (string, error) {
+	p.lock.RLock()
+	key := p.Key
+	p.lock.RUnlock()
+
+	resp, err := p.client.PostForm(ctx, "http://pastebin.com/api/api_post.php", url.Values{
+		"api_dev_key":    {key},
 		"api_option":     {"paste"},
 		"api_paste_code": {data},
 	})
@@ -162,45 +291,53 @@ func (p *netToolsPlugin) pasteData(data string) (string, error) {
 	return string(body), err
 }
 
-func (p *netToolsPlugin) runCommand(cmd string, args ...string) (string, error) {
-	out, err := exec.Command(cmd, args...).Output()
+func (p *netToolsPlugin) runCommand(ctx context.Context, cmd string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, cmd, args...).Output()
 	if err != nil {
 		return "", err
 	}
 
-	return p.pasteData(string(out))
+	return p.pasteData(ctx, string(out))
 }
 
-func (p *netToolsPlugin) handleCommand(r *seabird.Request, command string, emptyMsg string) {
+// handleCommand runs a command in the background and replies with a paste
+// of its output. The command is killed if the bot shuts down first.
+func (p *netToolsPlugin) handleCommand(r *seabird.Request, command string, emptyTemplate *internal.Template) {
 	if r.Message.Trailing() == "" {
-		r.MentionReplyf("Host required")
+		internal.MentionReplyTemplate(r, emptyTemplate, nil)
 		return
 	}
 
-	url, err := p.runCommand(command, r.Message.Trailing())
-	if err != nil {
-		r.MentionReplyf("%s", err)
-		return
-	}
+	p.lifecycle.Go(func(ctx context.Context) {
+		url, err := p.runCommand(ctx, command, r.Message.Trailing())
+		if err != nil {
+			replyError(r, err)
+			return
+		}
 
-	r.MentionReplyf("%s", url)
+		internal.MentionReplyTemplate(r, pasteTemplate, map[string]interface{}{
+			"url": url,
+		})
+	})
 }
 
 func (p *netToolsPlugin) Traceroute(r *seabird.Request) {
-	go p.handleCommand(r, "traceroute", "Host required")
+	p.handleCommand(r, "traceroute", hostRequiredTemplate)
 }
 
 func (p *netToolsPlugin) Whois(r *seabird.Request) {
-	go p.handleCommand(r, "whois", "Domain required")
+	p.handleCommand(r, "whois", domainRequiredTemplate)
 }
 
 func (p *netToolsPlugin) DNSCheck(r *seabird.Request) {
 	if r.Message.Trailing() == "" {
-		r.MentionReplyf("Domain required")
+		internal.MentionReplyTemplate(r, domainRequiredTemplate, nil)
 		return
 	}
 
-	r.MentionReplyf("https://www.whatsmydns.net/#A/" + r.Message.Trailing())
+	internal.MentionReplyTemplate(r, dnsCheckTemplate, map[string]interface{}{
+		"domain": r.Message.Trailing(),
+	})
 }
 
 type asnResponse struct {
@@ -214,30 +351,29 @@ type asnResponse struct {
 
 func (p *netToolsPlugin) ASNLookup(r *seabird.Request) {
 	if r.Message.Trailing() == "" {
-		r.MentionReplyf("IP required")
+		internal.MentionReplyTemplate(r, ipRequiredTemplate, nil)
 		return
 	}
 
-	asnResp := asnResponse{}
+	p.lifecycle.Go(func(ctx context.Context) {
+		asnResp := asnResponse{}
 
-	err := internal.GetJSON(
-		"https://api.iptoasn.com/v1/as/ip/"+r.Message.Trailing(),
-		&asnResp)
-	if err != nil {
-		r.MentionReplyf("%s", err)
-		return
-	}
+		err := p.client.GetJSON(
+			ctx,
+			"https://api.iptoasn.com/v1/as/ip/"+url.PathEscape(r.Message.Trailing()),
+			&asnResp)
+		if err != nil {
+			replyError(r, err)
+			return
+		}
 
-	if !asnResp.Announced {
-		r.MentionReplyf("ASN information not available")
-		return
-	}
+		if !asnResp.Announced {
+			internal.MentionReplyTemplate(r, asnUnavailableTemplate, nil)
+			return
+		}
 
-	r.MentionReplyf(
-		"#%d (%s - %s) - %s (%s)",
-		asnResp.AsNumber,
-		asnResp.FirstIP,
-		asnResp.LastIP,
-		asnResp.AsDescription,
-		asnResp.AsCountryCode)
+		internal.MentionReplyTemplate(r, asnTemplate, map[string]interface{}{
+			"asn": asnResp,
+		})
+	})
 }
@@ -0,0 +1,25 @@
+package noaa
+
+import (
+	"xorm.io/xorm"
+
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+func init() {
+	db.RegisterMigrations("noaa",
+		db.Migration{
+			Version:     1,
+			Description: "Create the noaa_station table",
+			Up: func(s *xorm.Session) error {
+				type NOAAStation struct {
+					ID      int64
+					Nick    string `xorm:"unique"`
+					Station string
+				}
+
+				return db.CreateTables(s, NOAAStation{})
+			},
+		},
+	)
+}
@@ -3,6 +3,7 @@ package noaa
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -13,7 +14,9 @@ import (
 	"xorm.io/xorm"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/core/isupport"
 	"github.com/belak/go-seabird-plugins/extra/db"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 // NOAAStation is a simple cache which will store a user's last-requested
@@ -25,11 +28,42 @@ type NOAAStation struct { //nolint:golint
 }
 
 type noaaPlugin struct {
-	db *xorm.Engine
+	db       *xorm.Engine
+	isupport *isupport.Plugin
+	client   *internal.HTTPClient
+
+	lifecycle *internal.Lifecycle
 }
 
+// errNoStation is returned when a user doesn't give a station and we don't
+// have one stored for them.
+var errNoStation = errors.New("noaa: no stored station")
+
+var (
+	// KSEA 021553Z 16008KT 10SM FEW020 BKN250 09/04 A3012
+	reportTemplate = internal.TemplateMustCompile("noaaReport", `
+{{ .report }}
+`).WithSample(map[string]interface{}{
+		"station": "KSEA",
+		"report":  "KSEA 021553Z 16008KT 10SM FEW020 BKN250 09/04 A3012",
+	})
+
+	noStationTemplate = internal.TemplateMustCompile("noaaNoStation", `
+Could not find a location for {{ printf "%q" .nick }}
+`).WithSample(map[string]interface{}{
+		"nick": "belak",
+	})
+
+	errorTemplate = internal.TemplateMustCompile("noaaError", `
+Error: {{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("Station does not exist"),
+	})
+)
+
 func init() {
 	seabird.RegisterPlugin("noaa", newMetarPlugin)
+	db.RegisterModels("noaa", NOAAStation{})
 }
 
 func newMetarPlugin(b *seabird.Bot) error {
@@ -37,17 +71,28 @@ func newMetarPlugin(b *seabird.Bot) error {
 		return err
 	}
 
-	p := &noaaPlugin{
-		db: db.CtxDB(b.Context()),
+	if err := b.EnsurePlugin("isupport"); err != nil {
+		return err
 	}
 
-	// Ensure DB tables are up to date
-	err := p.db.Sync(NOAAStation{})
+	client, err := internal.NewHTTPClient(b, "noaa")
 	if err != nil {
 		return err
 	}
 
-	cm := b.CommandMux()
+	p := &noaaPlugin{
+		db:       db.CtxDB(b.Context()),
+		isupport: isupport.CtxISupport(b.Context()),
+		client:   client,
+
+		lifecycle: internal.BotLifecycle(b),
+	}
+
+	if err := db.Migrate(b, "noaa"); err != nil {
+		return err
+	}
+
+	cm := internal.NewCommandMux(b)
 
 	cm.Event("metar", p.metarCallback, &seabird.HelpInfo{
 		Usage:       "<station>",
@@ -64,20 +109,24 @@ func newMetarPlugin(b *seabird.Bot) error {
 func (p *noaaPlugin) getStation(r *seabird.Request) (string, error) {
 	l := r.Message.Trailing()
 
-	target := &NOAAStation{Nick: r.Message.Prefix.Name}
+	// Nicks are folded so the stored value follows the user no matter
+	// how their nick is capitalized.
+	nick := p.isupport.CaseFold(r.Message.Prefix.Name)
+
+	target := &NOAAStation{Nick: nick}
 
 	// If it's an empty string, check the cache
 	if l == "" {
 		found, err := p.db.Get(target)
 		if err != nil || !found {
-			return "", fmt.Errorf("Could not find a location for %q", r.Message.Prefix.Name)
+			return "", errNoStation
 		}
 
 		return target.Station, nil
 	}
 
 	newStation := &NOAAStation{
-		Nick:    r.Message.Prefix.Name,
+		Nick:    nick,
 		Station: strings.ToUpper(l),
 	}
 
@@ -94,42 +143,53 @@ func (p *noaaPlugin) getStation(r *seabird.Request) (string, error) {
 }
 
 func (p *noaaPlugin) metarCallback(r *seabird.Request) {
-	station, err := p.getStation(r)
-	if err != nil {
-		r.MentionReplyf("%s", err.Error())
-		return
-	}
-
-	resp, err := noaaLookup("http://tgftp.nws.noaa.gov/data/observations/metar/stations/%s.TXT", station)
-	if err != nil {
-		r.MentionReplyf("Error: %s", err)
-		return
-	}
-
-	r.MentionReplyf("%s", resp)
+	p.lookupCallback(r, "http://tgftp.nws.noaa.gov/data/observations/metar/stations/%s.TXT")
 }
 
 func (p *noaaPlugin) tafCallback(r *seabird.Request) {
+	p.lookupCallback(r, "http://tgftp.nws.noaa.gov/data/forecasts/taf/stations/%s.TXT")
+}
+
+// lookupCallback replies with the data for the requested station. The lookup
+// happens in the background.
+func (p *noaaPlugin) lookupCallback(r *seabird.Request, urlFormat string) {
 	station, err := p.getStation(r)
-	if err != nil {
-		r.MentionReplyf("%s", err.Error())
+	if errors.Is(err, errNoStation) {
+		internal.MentionReplyTemplate(r, noStationTemplate, map[string]interface{}{
+			"nick": r.Message.Prefix.Name,
+		})
+
 		return
-	}
+	} else if err != nil {
+		internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+			"error": err,
+		})
 
-	resp, err := noaaLookup("http://tgftp.nws.noaa.gov/data/forecasts/taf/stations/%s.TXT", station)
-	if err != nil {
-		r.MentionReplyf("Error: %s", err)
 		return
 	}
 
-	r.MentionReplyf("%s", resp)
+	p.lifecycle.Go(func(ctx context.Context) {
+		resp, err := p.noaaLookup(ctx, urlFormat, station)
+		if err != nil {
+			internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+				"error": err,
+			})
+
+			return
+		}
+
+		internal.MentionReplyTemplate(r, reportTemplate, map[string]interface{}{
+			"station": station,
+			"report":  resp,
+		})
+	})
 }
 
 // noaaLookup takes the given formatted url and an airport code and tries to
 // look up the raw data. The first line is skipped, as that is generally the
 // date and the rest of the lines are joined together with a maximum of one
 // space between them.
-func noaaLookup(urlFormat, code string) (string, error) {
+func (p *noaaPlugin) noaaLookup(ctx context.Context, urlFormat, code string) (string, error) {
 	code = strings.ToUpper(code)
 
 	for _, letter := range code {
@@ -138,7 +198,7 @@ func noaaLookup(urlFormat, code string) (string, error) {
 		}
 	}
 
-	resp, err := http.Get(fmt.Sprintf(urlFormat, code))
+	resp, err := p.client.Get(ctx, fmt.Sprintf(urlFormat, code))
 	if err != nil {
 		return "", errors.New("NOAA appears to be down")
 	}
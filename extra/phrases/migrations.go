@@ -0,0 +1,27 @@
+package phrases
+
+import (
+	"xorm.io/xorm"
+
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+func init() {
+	db.RegisterMigrations("phrases",
+		db.Migration{
+			Version:     1,
+			Description: "Create the phrase table",
+			Up: func(s *xorm.Session) error {
+				type Phrase struct {
+					ID        int64
+					Name      string `xorm:"index"`
+					Value     string
+					Submitter string
+					Deleted   bool
+				}
+
+				return db.CreateTables(s, Phrase{})
+			},
+		},
+	)
+}
@@ -9,10 +9,12 @@ import (
 
 	seabird "github.com/belak/go-seabird"
 	"github.com/belak/go-seabird-plugins/extra/db"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
 	seabird.RegisterPlugin("phrases", newPhrasesPlugin)
+	db.RegisterModels("phrases", Phrase{})
 }
 
 type phrasesPlugin struct {
@@ -28,6 +30,65 @@ type Phrase struct {
 	Deleted   bool
 }
 
+var samplePhrase = &Phrase{
+	Name:      "seabird",
+	Value:     "a bird which lives by the sea",
+	Submitter: "belak",
+}
+
+var (
+	getTemplate = internal.TemplateMustCompile("phrasesGet", `
+{{ .phrase.Value }}
+`).WithSample(map[string]interface{}{
+		"phrase": samplePhrase,
+	})
+
+	giveTemplate = internal.TemplateMustCompile("phrasesGive", `
+{{ .target }}: {{ .phrase.Value }}
+`).WithSample(map[string]interface{}{
+		"target": "jsvana",
+		"phrase": samplePhrase,
+	})
+
+	setTemplate = internal.TemplateMustCompile("phrasesSet", `
+{{ .phrase.Name }} set to {{ .phrase.Value }}
+`).WithSample(map[string]interface{}{
+		"phrase": samplePhrase,
+	})
+
+	forgetTemplate = internal.TemplateMustCompile("phrasesForget", `
+Forgot {{ .phrase.Name }}
+`).WithSample(map[string]interface{}{
+		"phrase": samplePhrase,
+	})
+
+	// Rendered once for every change to a phrase.
+	historyTemplate = internal.TemplateMustCompile("phrasesHistory", `
+{{ if .phrase.Deleted -}}
+{{ .name }} deleted by {{ .phrase.Submitter }}
+{{- else -}}
+{{ .name }} set by {{ .phrase.Submitter }} to {{ .phrase.Value }}
+{{- end }}
+`).WithSample(map[string]interface{}{
+		"name":   "seabird",
+		"phrase": samplePhrase,
+	})
+
+	noKeyTemplate = internal.TemplateMustCompile("phrasesNoKey", `
+No key provided
+`).WithSample(map[string]interface{}{})
+
+	notEnoughArgsTemplate = internal.TemplateMustCompile("phrasesNotEnoughArgs", `
+Not enough args
+`).WithSample(map[string]interface{}{})
+
+	errorTemplate = internal.TemplateMustCompile("phrasesError", `
+{{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("No results for given key"),
+	})
+)
+
 func newPhrasesPlugin(b *seabird.Bot) error {
 	if err := b.EnsurePlugin("db"); err != nil {
 		return err
@@ -37,12 +98,11 @@ func newPhrasesPlugin(b *seabird.Bot) error {
 		db: db.CtxDB(b.Context()),
 	}
 
-	err := p.db.Sync(Phrase{})
-	if err != nil {
+	if err := db.Migrate(b, "phrases"); err != nil {
 		return err
 	}
 
-	cm := b.CommandMux()
+	cm := internal.NewCommandMux(b)
 
 	cm.Event("forget", p.forgetCallback, &seabird.HelpInfo{
 		Usage:       "<key>",
@@ -100,72 +160,86 @@ func (p *phrasesPlugin) forgetCallback(r *seabird.Request) {
 	}
 
 	if len(entry.Name) == 0 {
-		r.MentionReplyf("No key supplied")
+		internal.MentionReplyTemplate(r, noKeyTemplate, nil)
 		return
 	}
 
 	_, err := p.db.InsertOne(entry)
 	if err != nil {
-		r.MentionReplyf("%s", err.Error())
+		internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+			"error": err,
+		})
 		return
 	}
 
-	r.MentionReplyf("Forgot %s", entry.Name)
+	internal.MentionReplyTemplate(r, forgetTemplate, map[string]interface{}{
+		"phrase": entry,
+	})
 }
 
 func (p *phrasesPlugin) getCallback(r *seabird.Request) {
 	row, err := p.getKey(r.Message.Trailing())
 	if err != nil {
-		r.MentionReplyf("%s", err.Error())
+		internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+			"error": err,
+		})
 		return
 	}
 
-	r.MentionReplyf("%s", row.Value)
+	internal.MentionReplyTemplate(r, getTemplate, map[string]interface{}{
+		"phrase": row,
+	})
 }
 
 func (p *phrasesPlugin) giveCallback(r *seabird.Request) {
 	split := strings.SplitN(r.Message.Trailing(), " ", 2)
 	if len(split) < 2 {
-		r.MentionReplyf("Not enough args")
+		internal.MentionReplyTemplate(r, notEnoughArgsTemplate, nil)
 		return
 	}
 
 	row, err := p.getKey(split[1])
 	if err != nil {
-		r.MentionReplyf("%s", err.Error())
+		internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+			"error": err,
+		})
 		return
 	}
 
-	r.Replyf("%s: %s", split[0], row.Value)
+	internal.ReplyTemplate(r, giveTemplate, map[string]interface{}{
+		"target": split[0],
+		"phrase": row,
+	})
 }
 
 func (p *phrasesPlugin) historyCallback(r *seabird.Request) {
 	search := &Phrase{Name: p.cleanedName(r.Message.Trailing())}
 	if len(search.Name) == 0 {
-		r.MentionReplyf("No key provided")
+		internal.MentionReplyTemplate(r, noKeyTemplate, nil)
 		return
 	}
 
 	var data []Phrase
 
 	if err := p.db.Find(&data, search); err != nil {
-		r.MentionReplyf("%s", err.Error())
+		internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+			"error": err,
+		})
 		return
 	}
 
 	for _, entry := range data {
-		if entry.Deleted {
-			r.MentionReplyf("%s deleted by %s", search.Name, entry.Submitter)
-		} else {
-			r.MentionReplyf("%s set by %s to %s", search.Name, entry.Submitter, entry.Value)
-		}
+		internal.MentionReplyTemplate(r, historyTemplate, map[string]interface{}{
+			"name":   search.Name,
+			"phrase": entry,
+		})
 	}
 }
 
 func (p *phrasesPlugin) setCallback(r *seabird.Request) {
 	split := strings.SplitN(r.Message.Trailing(), " ", 2)
 	if len(split) < 2 {
-		r.MentionReplyf("Not enough args")
+		internal.MentionReplyTemplate(r, notEnoughArgsTemplate, nil)
 		return
 	}
 
@@ -176,15 +250,19 @@ func (p *phrasesPlugin) setCallback(r *seabird.Request) {
 	}
 
 	if len(entry.Name) == 0 {
-		r.MentionReplyf("No key provided")
+		internal.MentionReplyTemplate(r, noKeyTemplate, nil)
 		return
 	}
 
 	_, err := p.db.InsertOne(entry)
 	if err != nil {
-		r.MentionReplyf("%s", err.Error())
+		internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+			"error": err,
+		})
 		return
 	}
 
-	r.MentionReplyf("%s set to %s", entry.Name, entry.Value)
+	internal.MentionReplyTemplate(r, setTemplate, map[string]interface{}{
+		"phrase": entry,
+	})
 }
@@ -0,0 +1,29 @@
+package remind
+
+import (
+	"time"
+
+	"xorm.io/xorm"
+
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+func init() {
+	db.RegisterMigrations("remind",
+		db.Migration{
+			Version:     1,
+			Description: "Create the reminder table",
+			Up: func(s *xorm.Session) error {
+				type Reminder struct {
+					ID           int64
+					Target       string
+					TargetType   int
+					Content      string
+					ReminderTime time.Time
+				}
+
+				return db.CreateTables(s, Reminder{})
+			},
+		},
+	)
+}
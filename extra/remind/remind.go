@@ -7,22 +7,27 @@ import (
 	"sync"
 	"time"
 
-	irc "gopkg.in/irc.v3"
 	"xorm.io/xorm"
 
 	seabird "github.com/belak/go-seabird"
+	channeltrack "github.com/belak/go-seabird-plugins/core/channel_track"
+	"github.com/belak/go-seabird-plugins/core/isupport"
 	"github.com/belak/go-seabird-plugins/extra/db"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
 	seabird.RegisterPlugin("remind", newReminderPlugin)
+	db.RegisterModels("remind", Reminder{})
 }
 
 var timeRegexp = regexp.MustCompile(`\d+[smhd]`)
 
 type reminderPlugin struct {
-	db *xorm.Engine
+	db       *xorm.Engine
+	isupport *isupport.Plugin
 
+	// rooms is keyed on the case folded channel name.
 	roomLock *sync.Mutex
 	rooms    map[string]bool
 
@@ -46,31 +51,70 @@ type Reminder struct {
 	ReminderTime time.Time
 }
 
+var (
+	storedTemplate = internal.TemplateMustCompile("remindStored", `
+Event stored
+`).WithSample(map[string]interface{}{
+		"reminder": &Reminder{
+			Target:       "#encoded",
+			TargetType:   channelTarget,
+			Content:      "belak: check the oven",
+			ReminderTime: time.Date(2015, time.January, 2, 15, 4, 5, 0, time.UTC),
+		},
+	})
+
+	notEnoughArgsTemplate = internal.TemplateMustCompile("remindNotEnoughArgs", `
+Not enough args
+`).WithSample(map[string]interface{}{})
+
+	invalidDurationTemplate = internal.TemplateMustCompile("remindInvalidDuration", `
+Invalid duration: {{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("Unknown time type"),
+	})
+
+	storeErrorTemplate = internal.TemplateMustCompile("remindStoreError", `
+Failed to store reminder: {{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("database is locked"),
+	})
+)
+
 func newReminderPlugin(b *seabird.Bot) error {
-	bm := b.BasicMux()
-	cm := b.CommandMux()
+	bm := internal.NewBasicMux(b)
+	cm := internal.NewCommandMux(b)
 
 	if err := b.EnsurePlugin("db"); err != nil {
 		return err
 	}
 
+	if err := b.EnsurePlugin("isupport"); err != nil {
+		return err
+	}
+
+	if err := b.EnsurePlugin("channel_track"); err != nil {
+		return err
+	}
+
 	p := &reminderPlugin{
 		roomLock:   &sync.Mutex{},
 		rooms:      make(map[string]bool),
 		updateChan: make(chan struct{}, 1),
 
-		db: db.CtxDB(b.Context()),
+		db:       db.CtxDB(b.Context()),
+		isupport: isupport.CtxISupport(b.Context()),
 	}
 
-	err := p.db.Sync(Reminder{})
-	if err != nil {
+	if err := db.Migrate(b, "remind"); err != nil {
 		return err
 	}
 
 	bm.Event("001", p.InitialDispatch)
-	bm.Event("JOIN", p.joinHandler)
-	bm.Event("PART", p.partHandler)
-	bm.Event("KICK", p.kickHandler)
+
+	tracker := channeltrack.CtxChannelTracker(b.Context())
+	tracker.OnBotJoinedChannel(p.joinHandler)
+	tracker.OnUserParted(p.partHandler)
+	tracker.OnUserKicked(p.kickHandler)
 
 	cm.Event("remind", p.RemindCommand, &seabird.HelpInfo{
 		Usage:       "<duration> <message>",
@@ -80,38 +124,34 @@ func newReminderPlugin(b *seabird.Bot) error {
 	return nil
 }
 
-func (p *reminderPlugin) joinHandler(r *seabird.Request) {
-	if r.Message.Prefix.Name != r.CurrentNick() {
-		return
-	}
-
+func (p *reminderPlugin) joinHandler(r *seabird.Request, e *channeltrack.BotJoinedChannelEvent) {
 	p.roomLock.Lock()
 	defer p.roomLock.Unlock()
-	p.rooms[r.Message.Params[0]] = true
+	p.rooms[p.isupport.CaseFold(e.Channel)] = true
 
 	p.updateChan <- struct{}{}
 }
 
-func (p *reminderPlugin) partHandler(r *seabird.Request) {
-	if r.Message.Prefix.Name != r.CurrentNick() {
+func (p *reminderPlugin) partHandler(r *seabird.Request, e *channeltrack.UserPartedEvent) {
+	if !p.isupport.CaseEqual(e.User.Nick, r.CurrentNick()) {
 		return
 	}
 
-	p.roomLock.Lock()
-	defer p.roomLock.Unlock()
-	delete(p.rooms, r.Message.Params[0])
-
-	p.updateChan <- struct{}{}
+	p.leaveRoom(e.Channel)
 }
 
-func (p *reminderPlugin) kickHandler(r *seabird.Request) {
-	if r.Message.Params[1] != r.CurrentNick() {
+func (p *reminderPlugin) kickHandler(r *seabird.Request, e *channeltrack.UserKickedEvent) {
+	if !p.isupport.CaseEqual(e.User.Nick, r.CurrentNick()) {
 		return
 	}
 
+	p.leaveRoom(e.Channel)
+}
+
+func (p *reminderPlugin) leaveRoom(channel string) {
 	p.roomLock.Lock()
 	defer p.roomLock.Unlock()
-	delete(p.rooms, r.Message.Params[0])
+	delete(p.rooms, p.isupport.CaseFold(channel))
 
 	p.updateChan <- struct{}{}
 }
@@ -170,11 +210,7 @@ func (p *reminderPlugin) dispatch(r *seabird.Request, reminder *Reminder) {
 	logger := r.GetLogger("remind").WithField("reminder", r)
 
 	// Send the message
-	r.WriteMessage(&irc.Message{
-		Prefix:  &irc.Prefix{},
-		Command: "PRIVMSG",
-		Params:  []string{reminder.Target, reminder.Content},
-	})
+	internal.Privmsgf(r, reminder.Target, "%s", reminder.Content)
 
 	// Nuke the reminder now that it's been sent
 	_, err := p.db.Delete(reminder)
@@ -225,13 +261,15 @@ func (p *reminderPlugin) ParseTime(timeStr string) (time.Duration, error) {
 func (p *reminderPlugin) RemindCommand(r *seabird.Request) {
 	split := strings.SplitN(r.Message.Trailing(), " ", 2)
 	if len(split) != 2 {
-		r.MentionReplyf("Not enough args")
+		internal.MentionReplyTemplate(r, notEnoughArgsTemplate, nil)
 		return
 	}
 
 	dur, err := p.ParseTime(split[0])
 	if err != nil {
-		r.MentionReplyf("Invalid duration: %s", err)
+		internal.MentionReplyTemplate(r, invalidDurationTemplate, map[string]interface{}{
+			"error": err,
+		})
 		return
 	}
 
@@ -251,11 +289,15 @@ func (p *reminderPlugin) RemindCommand(r *seabird.Request) {
 
 	_, err = p.db.Insert(rem)
 	if err != nil {
-		r.MentionReplyf("Failed to store reminder: %s", err)
+		internal.MentionReplyTemplate(r, storeErrorTemplate, map[string]interface{}{
+			"error": err,
+		})
 		return
 	}
 
-	r.MentionReplyf("Event stored")
+	internal.MentionReplyTemplate(r, storedTemplate, map[string]interface{}{
+		"reminder": rem,
+	})
 
 	logger := r.GetLogger("remind")
 	logger.WithField("reminder", rem).Debug("Stored reminder")
@@ -0,0 +1,39 @@
+package remind
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+func TestRemind(t *testing.T) {
+	b := testbot.New(t, []string{"db", "cap", "isupport", "channel_track", "remind"}, "")
+
+	b.Privmsg("someone", testbot.Channel, "!remind 1s check the oven")
+	b.ExpectPrivmsg(testbot.Channel, "someone: Event stored")
+	b.ExpectPrivmsg(testbot.Channel, "someone: check the oven")
+
+	// Reminders from private messages are sent privately.
+	b.Privmsg("someone", testbot.Nick, "!remind 1s take out the trash")
+	b.ExpectPrivmsg("someone", "Event stored")
+	b.ExpectPrivmsg("someone", "take out the trash")
+}
+
+func TestRemindErrors(t *testing.T) {
+	b := testbot.New(t, []string{"db", "cap", "isupport", "channel_track", "remind"}, "")
+
+	b.Privmsg("someone", testbot.Channel, "!remind 1s")
+	b.ExpectPrivmsg(testbot.Channel, "someone: Not enough args")
+	b.ExpectNothing()
+}
+
+func TestParseTime(t *testing.T) {
+	p := &reminderPlugin{}
+
+	dur, err := p.ParseTime("1d2h3m4s")
+	require.NoError(t, err)
+	require.Equal(t, 26*time.Hour+3*time.Minute+4*time.Second, dur)
+}
@@ -1,6 +1,7 @@
 package runescape
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -77,7 +78,45 @@ type runescapeLevelMetadata struct {
 	Skill  string
 }
 
-type runescapePlugin struct{}
+var sampleSkills = map[string]interface{}{
+	"player": "zezima",
+	"skills": []runescapeLevelMetadata{
+		{Rank: 1, Level: 99, Exp: 13034431, Player: "zezima", Skill: "attack"},
+		{Rank: 2, Level: 99, Exp: 13034431, Player: "zezima", Skill: "defence"},
+	},
+}
+
+var (
+	// zezima has level 99 attack, level 99 defence
+	levelTemplate = internal.TemplateMustCompile("runescapeLevel", `
+{{ .player }} has
+{{- range $i, $s := .skills }}{{ if $i }},{{ end }} level {{ prettifyNumber $s.Level }} {{ $s.Skill }}{{ end }}
+`).WithSample(sampleSkills)
+
+	// zezima has 13M experience in attack, 13M experience in defence
+	expTemplate = internal.TemplateMustCompile("runescapeExp", `
+{{ .player }} has
+{{- range $i, $s := .skills }}{{ if $i }},{{ end }} {{ prettifySuffix $s.Exp }} experience in {{ $s.Skill }}{{ end }}
+`).WithSample(sampleSkills)
+
+	// zezima has rank 1 in attack, rank 2 in defence
+	rankTemplate = internal.TemplateMustCompile("runescapeRank", `
+{{ .player }} has
+{{- range $i, $s := .skills }}{{ if $i }},{{ end }} rank {{ prettifyNumber $s.Rank }} in {{ $s.Skill }}{{ end }}
+`).WithSample(sampleSkills)
+
+	errorTemplate = internal.TemplateMustCompile("runescapeError", `
+{{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("Unable to parse player or skill"),
+	})
+)
+
+type runescapePlugin struct {
+	client    *internal.HTTPClient
+	cache     *internal.Cache
+	lifecycle *internal.Lifecycle
+}
 
 var levelRegex = regexp.MustCompile(`(\w{2,}|".+?")\s+((\w+\s*)+)$`)
 
@@ -118,9 +157,19 @@ func newRunescapeLevelMetadata(name, player, line string) (runescapeLevelMetadat
 }
 
 func newRunescapePlugin(b *seabird.Bot) error {
-	p := &runescapePlugin{}
+	client, err := internal.NewHTTPClient(b, "runescape")
+	if err != nil {
+		return err
+	}
+
+	cache, err := internal.NewCache(b, "runescape")
+	if err != nil {
+		return err
+	}
 
-	cm := b.CommandMux()
+	p := &runescapePlugin{client: client, cache: cache, lifecycle: internal.BotLifecycle(b)}
+
+	cm := internal.NewCommandMux(b)
 
 	cm.Event("rlvl", p.levelCallback, &seabird.HelpInfo{
 		Usage:       "<player> <skill>",
@@ -159,7 +208,7 @@ func resolveAlias(possibleAlias string) string {
 }
 
 //nolint:funlen
-func (p *runescapePlugin) getPlayerSkills(search string) (map[string]runescapeLevelMetadata, error) {
+func (p *runescapePlugin) getPlayerSkills(ctx context.Context, search string) (map[string]runescapeLevelMetadata, error) {
 	var emptySkills map[string]runescapeLevelMetadata
 
 	var (
@@ -191,18 +240,14 @@ func (p *runescapePlugin) getPlayerSkills(search string) (map[string]runescapeLe
 		return emptySkills, errors.New("Unable to parse player or skill")
 	}
 
-	resp, err := http.Get("https://secure.runescape.com/m=hiscore_oldschool/index_lite.ws?player=" + player)
-	if err != nil {
+	body, err := p.lookupPlayer(ctx, player)
+	if errors.Is(err, internal.ErrNotFound) {
+		return emptySkills, fmt.Errorf("Player %q not found", player)
+	} else if err != nil {
 		return emptySkills, err
 	}
-	defer resp.Body.Close()
 
-	bytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return emptySkills, err
-	}
-
-	data := strings.Split(strings.TrimSpace(string(bytes)), "\n")
+	data := strings.Split(strings.TrimSpace(body), "\n")
 
 	// It's not strictly needed to build all this up, but it may be useful later.
 	var ret = make(map[string]runescapeLevelMetadata)
@@ -255,6 +300,34 @@ func (p *runescapePlugin) getPlayerSkills(search string) (map[string]runescapeLe
 	return returnedSkills, nil
 }
 
+// lookupPlayer returns the raw hiscore data for the given player.
+func (p *runescapePlugin) lookupPlayer(ctx context.Context, player string) (string, error) {
+	var body string
+
+	err := p.cache.Fetch(strings.ToLower(player), &body, func() error {
+		resp, err := p.client.Get(ctx, "https://secure.runescape.com/m=hiscore_oldschool/index_lite.ws?player="+player)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			return internal.ErrNotFound
+		}
+
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+
+		body = string(data)
+
+		return nil
+	})
+
+	return body, err
+}
+
 func sortedSkillNames(skills map[string]runescapeLevelMetadata) []string {
 	var names []string
 	for name := range skills {
@@ -267,76 +340,44 @@ func sortedSkillNames(skills map[string]runescapeLevelMetadata) []string {
 }
 
 func (p *runescapePlugin) levelCallback(r *seabird.Request) {
-	trailing := strings.ToLower(r.Message.Trailing())
-
-	go func() {
-		skills, err := p.getPlayerSkills(trailing)
-		if err != nil {
-			r.MentionReplyf("%s", err)
-			return
-		}
-
-		playerName := ""
-		names := sortedSkillNames(skills)
-
-		var responses []string
-		var skill runescapeLevelMetadata
-		for _, name := range names {
-			skill = skills[name]
-			playerName = skill.Player
-			responses = append(responses, fmt.Sprintf("level %s %s", internal.PrettifyNumber(skill.Level), skill.Skill))
-		}
-
-		r.MentionReplyf("%s has %s", playerName, strings.Join(responses, ", "))
-	}()
+	p.skillsCallback(r, levelTemplate)
 }
 
 func (p *runescapePlugin) expCallback(r *seabird.Request) {
-	trailing := strings.ToLower(r.Message.Trailing())
-
-	go func() {
-		skills, err := p.getPlayerSkills(trailing)
-		if err != nil {
-			r.MentionReplyf("%s", err)
-			return
-		}
-
-		playerName := ""
-		names := sortedSkillNames(skills)
-
-		var responses []string
-		var skill runescapeLevelMetadata
-		for _, name := range names {
-			skill = skills[name]
-			playerName = skill.Player
-			responses = append(responses, fmt.Sprintf("%s experience in %s", internal.PrettifySuffix(skill.Exp), skill.Skill))
-		}
-
-		r.MentionReplyf("%s has %s", playerName, strings.Join(responses, ", "))
-	}()
+	p.skillsCallback(r, expTemplate)
 }
 
 func (p *runescapePlugin) rankCallback(r *seabird.Request) {
+	p.skillsCallback(r, rankTemplate)
+}
+
+// skillsCallback looks up the player and renders every skill they have
+// using the given template.
+func (p *runescapePlugin) skillsCallback(r *seabird.Request, t *internal.Template) {
 	trailing := strings.ToLower(r.Message.Trailing())
 
-	go func() {
-		skills, err := p.getPlayerSkills(trailing)
+	p.lifecycle.Go(func(ctx context.Context) {
+		skills, err := p.getPlayerSkills(ctx, trailing)
 		if err != nil {
-			r.MentionReplyf("%s", err)
+			internal.MentionReplyTemplate(r, errorTemplate, map[string]interface{}{
+				"error": err,
+			})
 			return
 		}
 
+		var sorted []runescapeLevelMetadata
+		for _, name := range sortedSkillNames(skills) {
+			sorted = append(sorted, skills[name])
+		}
+
 		playerName := ""
-		names := sortedSkillNames(skills)
-
-		var responses []string
-		var skill runescapeLevelMetadata
-		for _, name := range names {
-			skill = skills[name]
-			playerName = skill.Player
-			responses = append(responses, fmt.Sprintf("rank %s in %s", internal.PrettifyNumber(skill.Rank), skill.Skill))
+		if len(sorted) > 0 {
+			playerName = sorted[0].Player
 		}
 
-		r.MentionReplyf("%s has %s", playerName, strings.Join(responses, ", "))
-	}()
+		internal.MentionReplyTemplate(r, t, map[string]interface{}{
+			"player": playerName,
+			"skills": sorted,
+		})
+	})
 }
@@ -4,8 +4,15 @@ import (
 	"time"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
+var uptimeTemplate = internal.TemplateMustCompile("uptime", `
+I have been running for {{ .uptime }}
+`).WithSample(map[string]interface{}{
+	"uptime": 26*time.Hour + 3*time.Minute,
+})
+
 type uptimePlugin struct {
 	startTime time.Time
 }
@@ -23,7 +30,7 @@ func newUptimePlugin(b *seabird.Bot) error {
 		startTime: time.Now(),
 	}
 
-	cm := b.CommandMux()
+	cm := internal.NewCommandMux(b)
 
 	cm.Event("uptime", p.uptimeCallback, &seabird.HelpInfo{
 		Description: "Display how long the bot has been running",
@@ -33,5 +40,7 @@ func newUptimePlugin(b *seabird.Bot) error {
 }
 
 func (p *uptimePlugin) uptimeCallback(r *seabird.Request) {
-	r.MentionReplyf("I have been running for %s", time.Since(p.startTime).Truncate(time.Second))
+	internal.MentionReplyTemplate(r, uptimeTemplate, map[string]interface{}{
+		"uptime": time.Since(p.startTime).Truncate(time.Second),
+	})
 }
@@ -0,0 +1,27 @@
+package watchdog
+
+import (
+	"time"
+
+	"xorm.io/xorm"
+
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+func init() {
+	db.RegisterMigrations("watchdog",
+		db.Migration{
+			Version:     1,
+			Description: "Create the watchdog_check table",
+			Up: func(s *xorm.Session) error {
+				type watchdogCheck struct {
+					Time   time.Time `xorm:"created"`
+					Entity string
+					Nonce  string
+				}
+
+				return db.CreateTables(s, watchdogCheck{})
+			},
+		},
+	)
+}
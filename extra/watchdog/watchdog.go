@@ -1,16 +1,20 @@
 package watchdog
 
 import (
+	"errors"
 	"time"
 
 	"xorm.io/xorm"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/core/permissions"
 	"github.com/belak/go-seabird-plugins/extra/db"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
 	seabird.RegisterPlugin("watchdog", newWatchdogPlugin)
+	db.RegisterModels("watchdog", watchdogCheck{})
 }
 
 type watchdogPlugin struct {
@@ -23,25 +27,48 @@ type watchdogCheck struct {
 	Nonce  string
 }
 
+var (
+	// 1420210800 abc123
+	responseTemplate = internal.TemplateMustCompile("watchdogResponse", `
+{{ .time }} {{ .nonce }}
+`).WithSample(map[string]interface{}{
+		"time":  int64(1420210800),
+		"nonce": "abc123",
+	})
+
+	missingNonceTemplate = internal.TemplateMustCompile("watchdogMissingNonce", `
+Error: missing nonce argument
+`).WithSample(map[string]interface{}{})
+
+	dbErrorTemplate = internal.TemplateMustCompile("watchdogDBError", `
+Error writing check to DB: "{{ .error }}"
+`).WithSample(map[string]interface{}{
+		"error": errors.New("database is locked"),
+	})
+)
+
 func newWatchdogPlugin(b *seabird.Bot) error {
 	if err := b.EnsurePlugin("db"); err != nil {
 		return err
 	}
 
+	if err := b.EnsurePlugin("permissions"); err != nil {
+		return err
+	}
+
 	p := &watchdogPlugin{
 		db: db.CtxDB(b.Context()),
 	}
 
-	// Migrate any relevant tables
-	err := p.db.Sync(watchdogCheck{})
-	if err != nil {
+	if err := db.Migrate(b, "watchdog"); err != nil {
 		return err
 	}
 
-	cm := b.CommandMux()
+	cm := internal.NewCommandMux(b)
+	perms := permissions.CtxPermissions(b.Context())
 
-	cm.Event("watchdog-check", p.check, &seabird.HelpInfo{
-		Description: "Used to check availability of Seabird optionally including its DB",
+	cm.Event("watchdog-check", perms.Require(permissions.RoleTrusted, p.check), &seabird.HelpInfo{
+		Description: "Used to check availability of Seabird optionally including its DB. Requires the trusted role.",
 	})
 
 	return nil
@@ -58,7 +85,10 @@ func (p *watchdogPlugin) checkDb(r *seabird.Request, nonce string) bool {
 	})
 
 	if err != nil {
-		r.MentionReplyf("Error writing check to DB: \"%s\"", err)
+		internal.MentionReplyTemplate(r, dbErrorTemplate, map[string]interface{}{
+			"error": err,
+		})
+
 		return false
 	}
 
@@ -70,7 +100,7 @@ func (p *watchdogPlugin) check(r *seabird.Request) {
 	defer timer.Done()
 
 	if len(r.Message.Trailing()) == 0 {
-		r.MentionReplyf("Error: missing nonce argument")
+		internal.MentionReplyTemplate(r, missingNonceTemplate, nil)
 		return
 	}
 
@@ -80,5 +110,8 @@ func (p *watchdogPlugin) check(r *seabird.Request) {
 		return
 	}
 
-	r.MentionReplyf("%d %s", time.Now().Unix(), nonce)
+	internal.MentionReplyTemplate(r, responseTemplate, map[string]interface{}{
+		"time":  time.Now().Unix(),
+		"nonce": nonce,
+	})
 }
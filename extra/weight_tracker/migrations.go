@@ -0,0 +1,27 @@
+package weighttracker
+
+import (
+	"time"
+
+	"xorm.io/xorm"
+
+	"github.com/belak/go-seabird-plugins/extra/db"
+)
+
+func init() {
+	db.RegisterMigrations("weight_tracker",
+		db.Migration{
+			Version:     1,
+			Description: "Create the measurement table",
+			Up: func(s *xorm.Session) error {
+				type Measurement struct {
+					Name   string
+					Date   time.Time `xorm:"created"`
+					Weight float64
+				}
+
+				return db.CreateTables(s, Measurement{})
+			},
+		},
+	)
+}
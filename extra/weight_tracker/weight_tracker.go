@@ -1,6 +1,7 @@
 package weighttracker
 
 import (
+	"errors"
 	"strconv"
 	"time"
 
@@ -8,10 +9,12 @@ import (
 
 	seabird "github.com/belak/go-seabird"
 	"github.com/belak/go-seabird-plugins/extra/db"
+	"github.com/belak/go-seabird-plugins/internal"
 )
 
 func init() {
 	seabird.RegisterPlugin("weight_tracker", newWeightPlugin)
+	db.RegisterModels("weight_tracker", Measurement{})
 }
 
 type weightPlugin struct {
@@ -24,6 +27,46 @@ type Measurement struct {
 	Weight float64
 }
 
+var sampleMeasurement = &Measurement{
+	Name:   "belak",
+	Date:   time.Date(2015, time.January, 2, 0, 0, 0, 0, time.UTC),
+	Weight: 150,
+}
+
+var (
+	addedTemplate = internal.TemplateMustCompile("weightAdded", `
+Measurement added
+`).WithSample(map[string]interface{}{
+		"measurement": sampleMeasurement,
+	})
+
+	lastTemplate = internal.TemplateMustCompile("weightLast", `
+Last measurement for {{ .measurement.Name }} was {{ printf "%.2f" .measurement.Weight }} lbs
+`).WithSample(map[string]interface{}{
+		"measurement": sampleMeasurement,
+	})
+
+	missingTemplate = internal.TemplateMustCompile("weightMissing", `
+You must specify a new weight measurement
+`).WithSample(map[string]interface{}{})
+
+	invalidTemplate = internal.TemplateMustCompile("weightInvalid", `
+Invalid weight measurement
+`).WithSample(map[string]interface{}{})
+
+	addErrorTemplate = internal.TemplateMustCompile("weightAddError", `
+Error inserting new weight measurement: {{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("database is locked"),
+	})
+
+	lastErrorTemplate = internal.TemplateMustCompile("weightLastError", `
+Error fetching measurement value: {{ .error }}
+`).WithSample(map[string]interface{}{
+		"error": errors.New("database is locked"),
+	})
+)
+
 func newWeightPlugin(b *seabird.Bot) error {
 	if err := b.EnsurePlugin("db"); err != nil {
 		return err
@@ -33,13 +76,11 @@ func newWeightPlugin(b *seabird.Bot) error {
 		db: db.CtxDB(b.Context()),
 	}
 
-	// Migrate any relevant tables
-	err := p.db.Sync(Measurement{})
-	if err != nil {
+	if err := db.Migrate(b, "weight_tracker"); err != nil {
 		return err
 	}
 
-	cm := b.CommandMux()
+	cm := internal.NewCommandMux(b)
 
 	cm.Event("add-weight", p.addWeight, &seabird.HelpInfo{
 		Usage:       "<value>",
@@ -56,27 +97,32 @@ func newWeightPlugin(b *seabird.Bot) error {
 
 func (p *weightPlugin) addWeight(r *seabird.Request) {
 	if len(r.Message.Trailing()) == 0 {
-		r.MentionReplyf("You must specify a new weight measurement")
+		internal.MentionReplyTemplate(r, missingTemplate, nil)
 		return
 	}
 
 	weight, err := strconv.ParseFloat(r.Message.Trailing(), 64)
 	if err != nil {
-		r.MentionReplyf("Invalid weight measurement")
+		internal.MentionReplyTemplate(r, invalidTemplate, nil)
 		return
 	}
 
 	measurement := &Measurement{Name: r.Message.Prefix.Name, Weight: weight}
 
-	p.db.Transaction(func(s *xorm.Session) (interface{}, error) {
-		res, err := s.Insert(measurement)
-		if err != nil {
-			r.MentionReplyf("Error inserting new weight measurement: %v", err)
-		}
-		return res, err
+	_, err = p.db.Transaction(func(s *xorm.Session) (interface{}, error) {
+		return s.Insert(measurement)
 	})
+	if err != nil {
+		internal.MentionReplyTemplate(r, addErrorTemplate, map[string]interface{}{
+			"error": err,
+		})
+
+		return
+	}
 
-	r.MentionReplyf("Measurement added")
+	internal.MentionReplyTemplate(r, addedTemplate, map[string]interface{}{
+		"measurement": measurement,
+	})
 }
 
 func (p *weightPlugin) lastWeight(r *seabird.Request) {
@@ -85,9 +131,14 @@ func (p *weightPlugin) lastWeight(r *seabird.Request) {
 
 	_, err := p.db.Desc("date").Limit(1).Get(measurement)
 	if err != nil {
-		r.MentionReplyf("Error fetching measurement value: %v", err)
+		internal.MentionReplyTemplate(r, lastErrorTemplate, map[string]interface{}{
+			"error": err,
+		})
+
 		return
 	}
 
-	r.MentionReplyf("Last measurement for %s was %.2f lbs", user, measurement.Weight)
+	internal.MentionReplyTemplate(r, lastTemplate, map[string]interface{}{
+		"measurement": measurement,
+	})
 }
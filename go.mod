@@ -17,7 +17,7 @@ require (
 	github.com/sirupsen/logrus v1.6.0
 	github.com/soudy/mathcat v0.0.0-20190121135055-f636e7f09e6c
 	github.com/spf13/cast v1.3.1
-	github.com/unknwon/com v1.0.1
+	github.com/stretchr/testify v1.6.1
 	github.com/yhat/scrape v0.0.0-20161128144610-24b7890b0945
 	github.com/zmb3/spotify v0.0.0-20200814173021-9bec46940cc0
 	golang.org/x/net v0.0.0-20200813134508-3edf25e44fcc
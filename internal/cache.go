@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+const contextKeyCache = ContextKey("seabird-cache")
+
+// ErrNotFound is returned by a Cache when the value being looked up is known
+// not to exist. Fetch functions should return an error matching it (using
+// errors.Is) so misses can be cached as well.
+var ErrNotFound = errors.New("not found")
+
+// CacheEntry is a single value stored in a CacheBackend.
+type CacheEntry struct {
+	// Value is the json encoded value. It is empty if Missing is true.
+	Value []byte
+
+	// Missing is true if this entry records that the value doesn't exist.
+	Missing bool
+
+	Expires time.Time
+}
+
+// CacheBackend is where cached values are actually stored. Backends may
+// return expired entries, but they should clean them up eventually. All
+// methods must be safe to call from multiple goroutines.
+type CacheBackend interface {
+	// Get returns the entry for the given key, or nil if there isn't one.
+	Get(key string) (*CacheEntry, error)
+	Set(key string, entry *CacheEntry) error
+	Delete(key string) error
+}
+
+// CacheBackendFactory creates a CacheBackend. It is called when the first
+// plugin asks for a cache, so it can depend on other plugins.
+type CacheBackendFactory func(b *seabird.Bot) (CacheBackend, error)
+
+var (
+	cacheBackendsLock sync.Mutex
+	cacheBackends     = map[string]CacheBackendFactory{
+		"memory": newMemoryCacheBackend,
+	}
+)
+
+// RegisterCacheBackend makes a backend available to use in the cache config.
+// It should be called from init.
+func RegisterCacheBackend(name string, factory CacheBackendFactory) {
+	cacheBackendsLock.Lock()
+	defer cacheBackendsLock.Unlock()
+
+	cacheBackends[name] = factory
+}
+
+// cacheSettings are the TTLs used for a single source. Fields are pointers
+// so we can tell which ones a source actually sets.
+type cacheSettings struct {
+	// TTL is how long values are kept. A TTL of 0 disables caching.
+	TTL *Duration
+
+	// NegativeTTL is how long we remember that something doesn't exist.
+	NegativeTTL *Duration
+}
+
+type cacheConfig struct {
+	cacheSettings
+
+	Backend string
+
+	// Size is the number of entries the memory backend will hold.
+	Size int
+
+	Sources map[string]cacheSettings
+}
+
+// CacheStats counts how lookups for a single source went.
+type CacheStats struct {
+	Source       string
+	Hits         int64
+	NegativeHits int64
+	Misses       int64
+	Errors       int64
+}
+
+// CacheManager holds the backend shared by every Cache along with the stats
+// for each source.
+type CacheManager struct {
+	backend CacheBackend
+	config  *cacheConfig
+
+	lock  sync.Mutex
+	stats map[string]*CacheStats
+}
+
+// CtxCache returns the CacheManager for the bot, or nil if no plugins have
+// created a Cache.
+func CtxCache(ctx context.Context) *CacheManager {
+	ret, _ := ctx.Value(contextKeyCache).(*CacheManager)
+	return ret
+}
+
+// Stats returns a copy of the stats for every source, sorted by name.
+func (m *CacheManager) Stats() []CacheStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ret := make([]CacheStats, 0, len(m.stats))
+	for _, stats := range m.stats {
+		ret = append(ret, *stats)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Source < ret[j].Source
+	})
+
+	return ret
+}
+
+func (m *CacheManager) record(source string, f func(s *CacheStats)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stats, ok := m.stats[source]
+	if !ok {
+		stats = &CacheStats{Source: source}
+		m.stats[source] = stats
+	}
+
+	f(stats)
+}
+
+func cacheManager(b *seabird.Bot) (*CacheManager, error) {
+	if m := CtxCache(b.Context()); m != nil {
+		return m, nil
+	}
+
+	config := &cacheConfig{Backend: "memory", Size: 1000}
+
+	err := OptionalConfig(b, "cache", config)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheBackendsLock.Lock()
+	factory, ok := cacheBackends[config.Backend]
+	cacheBackendsLock.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("cache: unknown backend %q", config.Backend)
+	}
+
+	backend, err := factory(b)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &CacheManager{
+		backend: backend,
+		config:  config,
+		stats:   make(map[string]*CacheStats),
+	}
+
+	b.SetValue(contextKeyCache, m)
+
+	return m, nil
+}
+
+// Cache stores the results of lookups for a single source, like a plugin or
+// an API. Keys only need to be unique within a source.
+type Cache struct {
+	manager *CacheManager
+	source  string
+
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+// NewCache returns a Cache for the given source. The backend and default
+// TTLs come from the [cache] section and can be overridden for a single
+// source in [cache.sources.<source>]. The [cache] section is optional.
+func NewCache(b *seabird.Bot, source string) (*Cache, error) {
+	m, err := cacheManager(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ttl         = Duration{10 * time.Minute}
+		negativeTTL = Duration{time.Minute}
+	)
+
+	settings := m.config.Sources[source]
+	settings.merge(m.config.cacheSettings)
+	settings.merge(cacheSettings{TTL: &ttl, NegativeTTL: &negativeTTL})
+
+	return &Cache{
+		manager:     m,
+		source:      source,
+		ttl:         settings.TTL.Duration,
+		negativeTTL: settings.NegativeTTL.Duration,
+	}, nil
+}
+
+// merge fills in any unset values in s from other.
+func (s *cacheSettings) merge(other cacheSettings) {
+	if s.TTL == nil {
+		s.TTL = other.TTL
+	}
+
+	if s.NegativeTTL == nil {
+		s.NegativeTTL = other.NegativeTTL
+	}
+}
+
+// Fetch looks up key in the cache and decodes it into v. If it isn't there,
+// fetch is called to fill in v and the result is stored. If fetch returns
+// ErrNotFound, that is cached as well and returned by later lookups until
+// it expires. Problems with the cache itself are never returned, we just
+// fall back to calling fetch.
+func (c *Cache) Fetch(key string, v interface{}, fetch func() error) error {
+	if c.ttl <= 0 {
+		return fetch()
+	}
+
+	fullKey := c.source + ":" + key
+
+	entry, err := c.manager.backend.Get(fullKey)
+	if err != nil {
+		c.manager.record(c.source, func(s *CacheStats) { s.Errors++ })
+	}
+
+	if entry != nil && time.Now().Before(entry.Expires) {
+		if entry.Missing {
+			c.manager.record(c.source, func(s *CacheStats) { s.NegativeHits++ })
+			return ErrNotFound
+		}
+
+		if err = json.Unmarshal(entry.Value, v); err == nil {
+			c.manager.record(c.source, func(s *CacheStats) { s.Hits++ })
+			return nil
+		}
+
+		c.manager.record(c.source, func(s *CacheStats) { s.Errors++ })
+	}
+
+	c.manager.record(c.source, func(s *CacheStats) { s.Misses++ })
+
+	err = fetch()
+
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if c.negativeTTL > 0 {
+			c.store(fullKey, &CacheEntry{
+				Missing: true,
+				Expires: time.Now().Add(c.negativeTTL),
+			})
+		}
+	case err == nil:
+		data, jsonErr := json.Marshal(v)
+		if jsonErr != nil {
+			c.manager.record(c.source, func(s *CacheStats) { s.Errors++ })
+			break
+		}
+
+		c.store(fullKey, &CacheEntry{
+			Value:   data,
+			Expires: time.Now().Add(c.ttl),
+		})
+	}
+
+	return err
+}
+
+// Invalidate removes key from the cache.
+func (c *Cache) Invalidate(key string) {
+	if err := c.manager.backend.Delete(c.source + ":" + key); err != nil {
+		c.manager.record(c.source, func(s *CacheStats) { s.Errors++ })
+	}
+}
+
+func (c *Cache) store(key string, entry *CacheEntry) {
+	if err := c.manager.backend.Set(key, entry); err != nil {
+		c.manager.record(c.source, func(s *CacheStats) { s.Errors++ })
+	}
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"container/list"
+	"sync"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+// memoryCacheBackend is an LRU cache which holds a fixed number of entries.
+type memoryCacheBackend struct {
+	lock    sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+func newMemoryCacheBackend(b *seabird.Bot) (CacheBackend, error) {
+	config := &cacheConfig{Size: 1000}
+
+	err := OptionalConfig(b, "cache", config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMemoryCache(config.Size), nil
+}
+
+func newMemoryCache(size int) *memoryCacheBackend {
+	if size < 1 {
+		size = 1
+	}
+
+	return &memoryCacheBackend{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *memoryCacheBackend) Get(key string) (*CacheEntry, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+
+	c.order.MoveToFront(elem)
+
+	return elem.Value.(*memoryCacheItem).entry, nil
+}
+
+func (c *memoryCacheBackend) Set(key string, entry *CacheEntry) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*memoryCacheItem).entry = entry
+		c.order.MoveToFront(elem)
+
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+
+	return nil
+}
+
+func (c *memoryCacheBackend) Delete(key string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+const testCacheConfig = `
+[core]
+nick = "seabird"
+user = "seabird"
+name = "seabird"
+loglevel = "error"
+
+[cache]
+size = 2
+
+[cache.sources.disabled]
+ttl = "0s"
+`
+
+func TestMemoryCacheBackend(t *testing.T) {
+	c := newMemoryCache(2)
+
+	require.NoError(t, c.Set("a", &CacheEntry{Value: []byte("1")}))
+	require.NoError(t, c.Set("b", &CacheEntry{Value: []byte("2")}))
+
+	// Looking up a makes b the oldest, so it should be evicted.
+	entry, err := c.Get("a")
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), entry.Value)
+
+	require.NoError(t, c.Set("c", &CacheEntry{Value: []byte("3")}))
+
+	entry, err = c.Get("b")
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	entry, err = c.Get("a")
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+
+	require.NoError(t, c.Delete("a"))
+
+	entry, err = c.Get("a")
+	require.NoError(t, err)
+	require.Nil(t, entry)
+}
+
+func TestCacheFetch(t *testing.T) {
+	b, err := seabird.NewBot(strings.NewReader(testCacheConfig))
+	require.NoError(t, err)
+
+	c, err := NewCache(b, "test")
+	require.NoError(t, err)
+
+	calls := 0
+	fetch := func(v *string, value string, err error) func() error {
+		return func() error {
+			calls++
+			*v = value
+
+			return err
+		}
+	}
+
+	var value string
+
+	require.NoError(t, c.Fetch("key", &value, fetch(&value, "hello", nil)))
+	require.Equal(t, "hello", value)
+
+	value = ""
+	require.NoError(t, c.Fetch("key", &value, fetch(&value, "world", nil)))
+	require.Equal(t, "hello", value)
+	require.Equal(t, 1, calls)
+
+	// Errors aren't cached, but misses are.
+	failure := errors.New("failure")
+	require.Equal(t, failure, c.Fetch("error", &value, fetch(&value, "", failure)))
+	require.Equal(t, failure, c.Fetch("error", &value, fetch(&value, "", failure)))
+	require.Equal(t, 3, calls)
+
+	require.Equal(t, ErrNotFound, c.Fetch("missing", &value, fetch(&value, "", ErrNotFound)))
+	require.Equal(t, ErrNotFound, c.Fetch("missing", &value, fetch(&value, "found", nil)))
+	require.Equal(t, 4, calls)
+
+	c.Invalidate("missing")
+	require.NoError(t, c.Fetch("missing", &value, fetch(&value, "found", nil)))
+	require.Equal(t, 5, calls)
+
+	// Sources share a backend, but not keys.
+	other, err := NewCache(b, "other")
+	require.NoError(t, err)
+	require.NoError(t, other.Fetch("key", &value, fetch(&value, "other", nil)))
+	require.Equal(t, "other", value)
+
+	disabled, err := NewCache(b, "disabled")
+	require.NoError(t, err)
+	require.NoError(t, disabled.Fetch("key", &value, fetch(&value, "a", nil)))
+	require.NoError(t, disabled.Fetch("key", &value, fetch(&value, "b", nil)))
+	require.Equal(t, "b", value)
+
+	require.Equal(t, []CacheStats{
+		{Source: "other", Misses: 1},
+		{Source: "test", Hits: 1, NegativeHits: 1, Misses: 5},
+	}, CtxCache(b.Context()).Stats())
+}
+
+func TestCacheUnknownBackend(t *testing.T) {
+	b, err := seabird.NewBot(strings.NewReader(strings.Replace(testCacheConfig, "size = 2", "backend = \"missing\"", 1)))
+	require.NoError(t, err)
+
+	_, err = NewCache(b, "test")
+	require.Error(t, err)
+}
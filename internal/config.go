@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+// Duration is a time.Duration which can be read from a config file as a
+// string like "30s" or "1h".
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+
+	return err
+}
+
+// OptionalConfig loads the given config section into c. If the section is
+// missing, c is left alone so any defaults it was created with are used.
+func OptionalConfig(b *seabird.Bot, name string, c interface{}) error {
+	err := b.Config(name, c)
+
+	// The bot doesn't give us a way to check for a section, so we have to
+	// match the error it returns.
+	if err != nil && err.Error() == fmt.Sprintf("Config section for %q missing", name) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+const contextKeyConn = ContextKey("seabird-conn")
+
+// CtxConn returns the Conn the bot is running on, or nil if the bot was
+// started without going through RunBot.
+func CtxConn(ctx context.Context) *Conn {
+	ret, _ := ctx.Value(contextKeyConn).(*Conn)
+	return ret
+}
+
+// Conn wraps the connection to the server so plugins can send lines before
+// the client registers with PASS, NICK and USER. This is needed for things
+// like CAP LS, which should come before registration.
+type Conn struct {
+	io.ReadWriteCloser
+
+	lock       sync.Mutex
+	registered bool
+	hooks      []func() []string
+}
+
+// NewConn wraps the given connection.
+func NewConn(rwc io.ReadWriteCloser) *Conn {
+	return &Conn{ReadWriteCloser: rwc}
+}
+
+// BeforeRegistration registers a hook which is called right before the
+// client sends its first line. Any lines it returns are sent to the server
+// first.
+func (c *Conn) BeforeRegistration(hook func() []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.hooks = append(c.hooks, hook)
+}
+
+// Write implements io.Writer.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.registered {
+		c.registered = true
+
+		for _, hook := range c.hooks {
+			for _, line := range hook() {
+				if _, err := fmt.Fprintf(c.ReadWriteCloser, "%s\r\n", line); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+
+	return c.ReadWriteCloser.Write(p)
+}
+
+// RunBot runs the bot on the given connection, wrapped in a Conn so plugins
+// can use it.
+func RunBot(b *seabird.Bot, rwc io.ReadWriteCloser) error {
+	conn := NewConn(rwc)
+
+	b.SetValue(contextKeyConn, conn)
+	BotLifecycle(b).setConn(conn)
+
+	return b.Run(conn)
+}
+
+// connConfig is the part of the core config needed to connect.
+type connConfig struct {
+	Host        string
+	TLS         bool
+	TLSNoVerify bool
+	TLSCert     string
+	TLSKey      string
+}
+
+// ConnectAndRun connects to the server in the core config and runs the bot
+// using RunBot. It should be used in place of Bot.ConnectAndRun.
+func ConnectAndRun(b *seabird.Bot) error {
+	config := &connConfig{}
+
+	err := b.Config("core", config)
+	if err != nil {
+		return err
+	}
+
+	// The ReadWriteCloser will contain either a *net.Conn or *tls.Conn
+	var c io.ReadWriteCloser
+
+	if config.TLS {
+		conf := &tls.Config{
+			InsecureSkipVerify: config.TLSNoVerify, //nolint:gosec
+		}
+
+		if config.TLSCert != "" && config.TLSKey != "" {
+			var cert tls.Certificate
+
+			cert, err = tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+			if err != nil {
+				return err
+			}
+
+			conf.Certificates = []tls.Certificate{cert}
+		}
+
+		c, err = tls.Dial("tcp", config.Host, conf)
+	} else {
+		c, err = net.Dial("tcp", config.Host)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return RunBot(b, c)
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"sync"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+const contextKeyFilters = ContextKey("seabird-filters")
+
+// MessageFilter returns false for messages plugins shouldn't respond to.
+type MessageFilter func(r *seabird.Request) bool
+
+type filterChain struct {
+	lock    sync.RWMutex
+	filters []MessageFilter
+}
+
+// AddMessageFilter adds a filter which is checked before any command,
+// mention or message handler registered through this package runs.
+func AddMessageFilter(b *seabird.Bot, f MessageFilter) {
+	chain, ok := b.Context().Value(contextKeyFilters).(*filterChain)
+	if !ok {
+		chain = &filterChain{}
+		b.SetValue(contextKeyFilters, chain)
+	}
+
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+
+	chain.filters = append(chain.filters, f)
+}
+
+// MessageAllowed returns true if every filter allows the message.
+func MessageAllowed(r *seabird.Request) bool {
+	chain, ok := r.Context().Value(contextKeyFilters).(*filterChain)
+	if !ok {
+		return true
+	}
+
+	chain.lock.RLock()
+	filters := chain.filters
+	chain.lock.RUnlock()
+
+	for _, f := range filters {
+		if !f(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filterMessages wraps a handler so it only runs for allowed messages.
+func filterMessages(h seabird.HandlerFunc) seabird.HandlerFunc {
+	return func(r *seabird.Request) {
+		if MessageAllowed(r) {
+			h(r)
+		}
+	}
+}
+
+// BasicMux registers handlers with the bot's basic mux. Handlers for
+// PRIVMSG and NOTICE only run for messages which pass the filters, while
+// everything else is passed through as is.
+type BasicMux struct {
+	mux *seabird.BasicMux
+}
+
+// NewBasicMux returns a BasicMux for the given bot.
+func NewBasicMux(b *seabird.Bot) *BasicMux {
+	return &BasicMux{mux: b.BasicMux()}
+}
+
+// Event registers a handler for the given IRC command.
+func (m *BasicMux) Event(command string, h seabird.HandlerFunc) {
+	if command == "PRIVMSG" || command == "NOTICE" {
+		h = filterMessages(h)
+	}
+
+	m.mux.Event(command, h)
+}
+
+// MentionMux registers handlers with the bot's mention mux. Handlers only
+// run for messages which pass the filters.
+type MentionMux struct {
+	mux *seabird.MentionMux
+}
+
+// NewMentionMux returns a MentionMux for the given bot.
+func NewMentionMux(b *seabird.Bot) *MentionMux {
+	return &MentionMux{mux: b.MentionMux()}
+}
+
+// Event registers a handler for messages which mention the bot.
+func (m *MentionMux) Event(h seabird.HandlerFunc) {
+	m.mux.Event(filterMessages(h))
+}
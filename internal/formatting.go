@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+const contextKeyFormatting = ContextKey("seabird-formatting")
+
+// IRC formatting codes. Most of these toggle the style on or off, but Reset
+// turns off everything, including colors.
+const (
+	FormatBold          = "\x02"
+	FormatItalic        = "\x1d"
+	FormatUnderline     = "\x1f"
+	FormatStrikethrough = "\x1e"
+	FormatMonospace     = "\x11"
+	FormatReverse       = "\x16"
+	FormatColor         = "\x03"
+	FormatHexColor      = "\x04"
+	FormatReset         = "\x0f"
+)
+
+// Color is one of the 16 standard mIRC colors.
+type Color int
+
+// The standard mIRC colors.
+const (
+	White Color = iota
+	Black
+	Blue
+	Green
+	Red
+	Brown
+	Magenta
+	Orange
+	Yellow
+	LightGreen
+	Cyan
+	LightCyan
+	LightBlue
+	Pink
+	Grey
+	LightGrey
+)
+
+var colorNames = map[string]Color{
+	"white":      White,
+	"black":      Black,
+	"blue":       Blue,
+	"green":      Green,
+	"red":        Red,
+	"brown":      Brown,
+	"magenta":    Magenta,
+	"orange":     Orange,
+	"yellow":     Yellow,
+	"lightgreen": LightGreen,
+	"cyan":       Cyan,
+	"lightcyan":  LightCyan,
+	"lightblue":  LightBlue,
+	"pink":       Pink,
+	"grey":       Grey,
+	"gray":       Grey,
+	"lightgrey":  LightGrey,
+	"lightgray":  LightGrey,
+}
+
+// ParseColor looks up a color by name, like "red" or "lightblue", or by its
+// number.
+func ParseColor(name string) (Color, error) {
+	if c, ok := colorNames[strings.ToLower(name)]; ok {
+		return c, nil
+	}
+
+	n, err := strconv.Atoi(name)
+	if err != nil || n < 0 || n > 98 {
+		return 0, fmt.Errorf("unknown color %q", name)
+	}
+
+	return Color(n), nil
+}
+
+// code returns the color as two digits. Using two digits means text which
+// starts with a number won't be read as part of the color.
+func (c Color) code() string {
+	return fmt.Sprintf("%02d", int(c))
+}
+
+// Bold makes the given text bold.
+func Bold(s string) string {
+	return FormatBold + s + FormatBold
+}
+
+// Italic makes the given text italic.
+func Italic(s string) string {
+	return FormatItalic + s + FormatItalic
+}
+
+// Underline underlines the given text.
+func Underline(s string) string {
+	return FormatUnderline + s + FormatUnderline
+}
+
+// Colorize sets the color of the given text.
+func Colorize(fg Color, s string) string {
+	return FormatColor + fg.code() + s + FormatColor
+}
+
+// ColorizeBackground sets the color and background color of the given text.
+func ColorizeBackground(fg, bg Color, s string) string {
+	return FormatColor + fg.code() + "," + bg.code() + s + FormatColor
+}
+
+// StripFormatting removes all formatting codes from the given text. This
+// should be used on incoming text before trying to parse it.
+func StripFormatting(s string) string {
+	if !strings.ContainsAny(s, "\x02\x1d\x1f\x1e\x11\x16\x03\x04\x0f") {
+		return s
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\x02', '\x1d', '\x1f', '\x1e', '\x11', '\x16', '\x0f':
+		case '\x03':
+			i = skipColor(s, i, 2, isDigit)
+		case '\x04':
+			i = skipColor(s, i, 6, isHexDigit)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
+
+// skipColor skips over the foreground and optional background colors after
+// the color code at s[i], each of which is up to n characters. It returns
+// the index of the last character of the color.
+func skipColor(s string, i, n int, valid func(c byte) bool) int {
+	skip := func(start int) int {
+		end := start
+		for end < len(s) && end-start < n && valid(s[end]) {
+			end++
+		}
+
+		return end
+	}
+
+	end := skip(i + 1)
+
+	// A background is only there if there was a foreground and a valid
+	// color after the comma.
+	if end > i+1 && end+1 < len(s) && s[end] == ',' && valid(s[end+1]) {
+		end = skip(end + 1)
+	}
+
+	return end - 1
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// FormattingCheck reports whether formatting can be sent to the given
+// target.
+type FormattingCheck func(target string) bool
+
+// SetFormattingCheck registers a function which decides where formatting is
+// allowed. Replies to any target it rejects have their formatting stripped.
+// If there isn't one, formatting is always sent.
+func SetFormattingCheck(b *seabird.Bot, f FormattingCheck) {
+	b.SetValue(contextKeyFormatting, f)
+}
+
+// allowFormatting returns true if formatting can be sent to the target.
+func allowFormatting(r *seabird.Request, target string) bool {
+	check, ok := r.Context().Value(contextKeyFormatting).(FormattingCheck)
+	return !ok || check(target)
+}
+
+// templateText converts a template value to a string. Pointers, like the
+// ones from the github API, are followed so we don't print an address.
+func templateText(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return ""
+	}
+
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return ""
+		}
+
+		rv = rv.Elem()
+	}
+
+	return fmt.Sprint(rv.Interface())
+}
+
+// templateColor is the color template function. The color can either be a
+// single color or a color and background separated by a comma, like
+// "white,red".
+func templateColor(color string, v interface{}) (string, error) {
+	colors := strings.SplitN(color, ",", 2)
+
+	fg, err := ParseColor(colors[0])
+	if err != nil {
+		return "", err
+	}
+
+	if len(colors) == 1 {
+		return Colorize(fg, templateText(v)), nil
+	}
+
+	bg, err := ParseColor(colors[1])
+	if err != nil {
+		return "", err
+	}
+
+	return ColorizeBackground(fg, bg, templateText(v)), nil
+}
+
+var formattingFuncs = template.FuncMap{
+	"bold":      func(v interface{}) string { return Bold(templateText(v)) },
+	"italic":    func(v interface{}) string { return Italic(templateText(v)) },
+	"underline": func(v interface{}) string { return Underline(templateText(v)) },
+	"color":     templateColor,
+	"reset":     func() string { return FormatReset },
+	"strip":     func(v interface{}) string { return StripFormatting(templateText(v)) },
+}
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripFormatting(t *testing.T) {
+	var tests = []struct {
+		in, out string
+	}{
+		{"plain text", "plain text"},
+		{"\x02bold\x02 \x1ditalic\x1d \x1funderline\x1f", "bold italic underline"},
+		{"\x1estrike\x1e \x11mono\x11 \x16reverse\x16\x0f", "strike mono reverse"},
+		{"\x034red\x03 text", "red text"},
+		{"\x0304,01red on black\x03", "red on black"},
+		{"\x0312345", "345"},
+		{"\x034,", ","},
+		{"\x03,4", ",4"},
+		{"\x034,123", "3"},
+		{"\x03", ""},
+		{"\x04FF0000red\x04", "red"},
+		{"\x04ff0000,00FF00red on green\x04", "red on green"},
+		{"ends with color\x0312", "ends with color"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.out, StripFormatting(test.in), "%q", test.in)
+	}
+}
+
+func TestFormattingHelpers(t *testing.T) {
+	require.Equal(t, "\x02a\x02", Bold("a"))
+	require.Equal(t, "\x1da\x1d", Italic("a"))
+	require.Equal(t, "\x1fa\x1f", Underline("a"))
+	require.Equal(t, "\x03041st\x03", Colorize(Red, "1st"))
+	require.Equal(t, "\x0300,04a\x03", ColorizeBackground(White, Red, "a"))
+
+	c, err := ParseColor("LightBlue")
+	require.NoError(t, err)
+	require.Equal(t, LightBlue, c)
+
+	c, err = ParseColor("7")
+	require.NoError(t, err)
+	require.Equal(t, Orange, c)
+
+	_, err = ParseColor("chartreuse")
+	require.Error(t, err)
+}
+
+func TestFormattingTemplateFuncs(t *testing.T) {
+	tmpl, err := compileTemplate("formattingTest", `
+{{ bold .name }} {{ .count | italic }} {{ .login | underline }} {{ color "red,black" .name }}{{ reset }} {{ strip .formatted }}
+`)
+	require.NoError(t, err)
+
+	var out strings.Builder
+
+	err = tmpl.Execute(&out, map[string]interface{}{
+		"name":      "seabird",
+		"count":     42,
+		"login":     github.String("belak"),
+		"formatted": "\x02bold\x02",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "\x02seabird\x02 \x1d42\x1d \x1fbelak\x1f \x0304,01seabird\x03\x0f bold", out.String())
+
+	// Bad colors should fail when the template is rendered, which means
+	// overrides using them won't pass validation.
+	tmpl, err = compileTemplate("formattingTest", `{{ color "chartreuse" "text" }}`)
+	require.NoError(t, err)
+
+	err = tmpl.Execute(&out, nil)
+	require.Error(t, err)
+}
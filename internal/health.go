@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+const contextKeyHealthChecks = ContextKey("seabird-health-checks")
+
+// HealthCheck returns an error if something the bot needs isn't working.
+type HealthCheck func(ctx context.Context) error
+
+// HealthResult is the result of a single HealthCheck.
+type HealthResult struct {
+	Name string
+	Err  error
+}
+
+type healthChecks struct {
+	lock   sync.RWMutex
+	checks map[string]HealthCheck
+}
+
+// AddHealthCheck registers a check which is run whenever the bot's health
+// is checked. Adding a check with the same name replaces the old one.
+func AddHealthCheck(b *seabird.Bot, name string, check HealthCheck) {
+	checks, ok := b.Context().Value(contextKeyHealthChecks).(*healthChecks)
+	if !ok {
+		checks = &healthChecks{checks: make(map[string]HealthCheck)}
+		b.SetValue(contextKeyHealthChecks, checks)
+	}
+
+	checks.lock.Lock()
+	defer checks.lock.Unlock()
+
+	checks.checks[name] = check
+}
+
+// CheckHealth runs every health check and returns the results, sorted by
+// name.
+func CheckHealth(ctx context.Context) []HealthResult {
+	checks, ok := ctx.Value(contextKeyHealthChecks).(*healthChecks)
+	if !ok {
+		return nil
+	}
+
+	checks.lock.RLock()
+
+	ret := make([]HealthResult, 0, len(checks.checks))
+	funcs := make(map[string]HealthCheck, len(checks.checks))
+
+	for name, check := range checks.checks {
+		ret = append(ret, HealthResult{Name: name})
+		funcs[name] = check
+	}
+
+	checks.lock.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+
+	for i := range ret {
+		ret[i].Err = funcs[ret[i].Name](ctx)
+	}
+
+	return ret
+}
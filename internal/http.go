@@ -1,18 +1,424 @@
 package internal
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
-	//nolint:misspell
-	"github.com/unknwon/com"
+	seabird "github.com/belak/go-seabird"
 )
 
-// PostJSON is a simple wrapper to post and get JSON from a given url.
-func PostJSON(url string, data, resp interface{}) error {
-	return com.HttpPostJSON(&http.Client{}, url, data, resp)
+// ErrResponseTooLarge is returned when reading a response body which is
+// bigger than the configured maxsize.
+var ErrResponseTooLarge = errors.New("http: response body too large")
+
+// HTTPStatusError is returned by the JSON helpers when the server responds
+// with anything other than a 2xx.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return "http: unexpected status " + e.Status
+}
+
+// Is makes a 404 match ErrNotFound, so lookups which don't exist can be
+// cached.
+func (e *HTTPStatusError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// httpSettings are the options for HTTP clients. The [http] section sets the
+// defaults and [http.plugins.<name>] overrides them for a single plugin.
+// Fields are pointers so we can tell which ones an override actually sets.
+type httpSettings struct {
+	// Timeout applies to the whole request, including any retries.
+	Timeout *Duration
+
+	UserAgent *string
+
+	// MaxSize is the largest response body, in bytes, we will read. 0 means
+	// there is no limit.
+	MaxSize *int64
+
+	// Retries is how many times to retry a request which fails with a 5xx
+	// or 429. RetryWait is how long to wait before the first retry, and it
+	// doubles every time after that.
+	Retries   *int
+	RetryWait *Duration
+
+	// Proxy is the URL of a proxy to use. If it's empty, the standard proxy
+	// environment variables are used.
+	Proxy *string
+
+	TLSNoVerify *bool
 }
 
-// GetJSON is a simple wrapper to get a json object from a given URL.
-func GetJSON(url string, resp interface{}) error {
-	return com.HttpGetJSON(&http.Client{}, url, resp)
+type httpConfig struct {
+	httpSettings
+
+	Plugins map[string]httpSettings
+}
+
+// merge fills in any unset values in s from other.
+func (s *httpSettings) merge(other httpSettings) {
+	if s.Timeout == nil {
+		s.Timeout = other.Timeout
+	}
+
+	if s.UserAgent == nil {
+		s.UserAgent = other.UserAgent
+	}
+
+	if s.MaxSize == nil {
+		s.MaxSize = other.MaxSize
+	}
+
+	if s.Retries == nil {
+		s.Retries = other.Retries
+	}
+
+	if s.RetryWait == nil {
+		s.RetryWait = other.RetryWait
+	}
+
+	if s.Proxy == nil {
+		s.Proxy = other.Proxy
+	}
+
+	if s.TLSNoVerify == nil {
+		s.TLSNoVerify = other.TLSNoVerify
+	}
+}
+
+func defaultHTTPSettings() httpSettings {
+	var (
+		timeout     = Duration{10 * time.Second}
+		userAgent   = "go-seabird"
+		maxSize     = int64(5 * 1024 * 1024)
+		retries     = 2
+		retryWait   = Duration{500 * time.Millisecond}
+		proxy       = ""
+		tlsNoVerify = false
+	)
+
+	return httpSettings{
+		Timeout:     &timeout,
+		UserAgent:   &userAgent,
+		MaxSize:     &maxSize,
+		Retries:     &retries,
+		RetryWait:   &retryWait,
+		Proxy:       &proxy,
+		TLSNoVerify: &tlsNoVerify,
+	}
+}
+
+const contextKeyHTTPTransport = ContextKey("seabird-http-transport")
+
+// SetHTTPTransport replaces the transport every HTTPClient for the bot sends
+// requests with. It's meant for tests, so requests can be answered without a
+// network, and it has to be called before any plugins are loaded. Retries,
+// size limits and metrics still apply.
+func SetHTTPTransport(b *seabird.Bot, rt http.RoundTripper) {
+	b.SetValue(contextKeyHTTPTransport, rt)
+}
+
+// HTTPClient is an HTTP client configured for a single plugin. Every plugin
+// which talks to the outside world should use one of these, so requests
+// can't hang forever and responses can't eat all our memory.
+type HTTPClient struct {
+	client *http.Client
+}
+
+// NewHTTPClient creates an HTTPClient for the given plugin, using the
+// settings in the [http] section and any overrides in
+// [http.plugins.<plugin>]. The [http] section is optional.
+func NewHTTPClient(b *seabird.Bot, plugin string) (*HTTPClient, error) {
+	config := &httpConfig{}
+
+	err := OptionalConfig(b, "http", config)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := config.Plugins[plugin]
+	settings.merge(config.httpSettings)
+	settings.merge(defaultHTTPSettings())
+
+	client, err := newHTTPClient(settings, plugin, BotMetrics(b))
+	if err != nil {
+		return nil, err
+	}
+
+	if rt, ok := b.Context().Value(contextKeyHTTPTransport).(http.RoundTripper); ok {
+		client.client.Transport.(*httpTransport).base = rt
+	}
+
+	return client, nil
+}
+
+func newHTTPClient(settings httpSettings, plugin string, metrics *Metrics) (*HTTPClient, error) {
+	proxy := http.ProxyFromEnvironment
+
+	if *settings.Proxy != "" {
+		proxyURL, err := url.Parse(*settings.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("http: invalid proxy: %w", err)
+		}
+
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.Proxy = proxy
+	base.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: *settings.TLSNoVerify, //nolint:gosec
+	}
+
+	return &HTTPClient{
+		client: &http.Client{
+			Transport: &httpTransport{
+				base:      base,
+				userAgent: *settings.UserAgent,
+				maxSize:   *settings.MaxSize,
+				retries:   *settings.Retries,
+				retryWait: settings.RetryWait.Duration,
+				plugin:    plugin,
+				requests: metrics.Counter("seabird_http_requests_total",
+					"Outbound HTTP requests, by plugin and status code.", "plugin", "code"),
+				latency: metrics.Histogram("seabird_http_request_duration_seconds",
+					"How long outbound HTTP requests took, including retries.", DefaultBuckets, "plugin"),
+			},
+			Timeout: settings.Timeout.Duration,
+		},
+	}, nil
+}
+
+// Client returns a standard http.Client with all the settings applied. This
+// is meant for passing to libraries which take their own client.
+func (c *HTTPClient) Client() *http.Client {
+	return c.client
+}
+
+// Do sends the given request. The caller is responsible for closing the
+// body of the response.
+func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req)
+}
+
+// Get makes a GET request to the given URL.
+func (c *HTTPClient) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.client.Do(req)
+}
+
+// Head makes a HEAD request to the given URL.
+func (c *HTTPClient) Head(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.client.Do(req)
+}
+
+// PostForm posts the given values as a form to the given URL.
+func (c *HTTPClient) PostForm(ctx context.Context, url string, data url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return c.client.Do(req)
+}
+
+// GetJSON gets a json object from the given URL.
+func (c *HTTPClient) GetJSON(ctx context.Context, url string, resp interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, resp)
+}
+
+// PostJSON posts data as json to the given URL and reads a json object
+// from the response.
+func (c *HTTPClient) PostJSON(ctx context.Context, url string, data, resp interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.doJSON(req, resp)
+}
+
+func (c *HTTPClient) doJSON(req *http.Request, resp interface{}) error {
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &HTTPStatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+
+	return json.NewDecoder(res.Body).Decode(resp)
+}
+
+// httpTransport wraps an http.RoundTripper to set the User-Agent, retry
+// failed requests, limit the size of responses and record metrics.
+type httpTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	maxSize   int64
+	retries   int
+	retryWait time.Duration
+
+	plugin   string
+	requests *Counter
+	latency  *Histogram
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *httpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	res, err := t.roundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(res.StatusCode)
+	}
+
+	t.requests.Inc(t.plugin, code)
+	t.latency.ObserveDuration(time.Since(start), t.plugin)
+
+	return res, err
+}
+
+func (t *httpTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" && t.userAgent != "" {
+		// RoundTrippers aren't allowed to modify the request.
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+
+	wait := t.retryWait
+
+	// We can only retry if we can get the body again.
+	canRetry := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	for attempt := 0; ; attempt++ {
+		res, err := t.base.RoundTrip(req)
+		if err != nil || !canRetry || attempt >= t.retries || !shouldRetry(res.StatusCode) {
+			if res != nil && t.maxSize > 0 {
+				res.Body = &limitedBody{ReadCloser: res.Body, remaining: t.maxSize}
+			}
+
+			return res, err
+		}
+
+		delay := wait
+		if after := retryAfter(res); after > delay {
+			delay = after
+		}
+
+		// Drain a little of the body so the connection can be reused.
+		_, _ = io.CopyN(ioutil.Discard, res.Body, 4096)
+		res.Body.Close()
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		wait *= 2
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+func shouldRetry(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryAfter returns how long the server asked us to wait, if it told us in
+// seconds.
+func retryAfter(res *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// limitedBody returns ErrResponseTooLarge rather than reading more than
+// remaining bytes from the response.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Check if there's anything left before we complain.
+		var buf [1]byte
+
+		n, err := b.ReadCloser.Read(buf[:])
+		if n > 0 {
+			return 0, ErrResponseTooLarge
+		}
+
+		return 0, err
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+
+	return n, err
 }
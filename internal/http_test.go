@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+const testHTTPConfig = `
+[core]
+nick = "seabird"
+user = "seabird"
+name = "seabird"
+loglevel = "error"
+
+[http]
+useragent = "test-agent"
+maxsize = 16
+retries = 3
+retrywait = "1ms"
+
+[http.plugins.other]
+useragent = "other-agent"
+retries = 0
+`
+
+func newTestHTTPClient(t *testing.T, plugin string) *HTTPClient {
+	b, err := seabird.NewBot(strings.NewReader(testHTTPConfig))
+	require.NoError(t, err)
+
+	c, err := NewHTTPClient(b, plugin)
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestHTTPConfig(t *testing.T) {
+	b, err := seabird.NewBot(strings.NewReader(testHTTPConfig))
+	require.NoError(t, err)
+
+	config := &httpConfig{}
+	require.NoError(t, b.Config("http", config))
+
+	settings := config.Plugins["other"]
+	settings.merge(config.httpSettings)
+	settings.merge(defaultHTTPSettings())
+
+	require.Equal(t, "other-agent", *settings.UserAgent)
+	require.Equal(t, 0, *settings.Retries)
+	require.Equal(t, int64(16), *settings.MaxSize)
+	require.Equal(t, time.Millisecond, settings.RetryWait.Duration)
+	require.Equal(t, 10*time.Second, settings.Timeout.Duration)
+
+	// The section is optional.
+	b, err = seabird.NewBot(strings.NewReader("[core]\nnick = \"seabird\""))
+	require.NoError(t, err)
+
+	_, err = NewHTTPClient(b, "test")
+	require.NoError(t, err)
+}
+
+func TestHTTPRetry(t *testing.T) {
+	var (
+		calls     int32
+		userAgent atomic.Value
+	)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent.Store(r.Header.Get("User-Agent"))
+
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"value": 42}`))
+	}))
+	defer s.Close()
+
+	var resp struct {
+		Value int
+	}
+
+	c := newTestHTTPClient(t, "test")
+	require.NoError(t, c.GetJSON(context.Background(), s.URL, &resp))
+	require.Equal(t, 42, resp.Value)
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	require.Equal(t, "test-agent", userAgent.Load())
+
+	// Without retries, we should get the error straight away.
+	atomic.StoreInt32(&calls, 0)
+
+	c = newTestHTTPClient(t, "other")
+	require.Error(t, c.GetJSON(context.Background(), s.URL, &resp))
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	require.Equal(t, "other-agent", userAgent.Load())
+}
+
+func TestHTTPMaxSize(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("a", 17)))
+	}))
+	defer s.Close()
+
+	c := newTestHTTPClient(t, "test")
+
+	resp, err := c.Get(context.Background(), s.URL)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	_, err = ioutil.ReadAll(resp.Body)
+	require.Equal(t, ErrResponseTooLarge, err)
+}
+
+func TestHTTPCancel(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer s.Close()
+
+	c := newTestHTTPClient(t, "test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := c.Get(ctx, s.URL)
+	require.Error(t, err)
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSetHTTPTransport(t *testing.T) {
+	b, err := seabird.NewBot(strings.NewReader(testHTTPConfig))
+	require.NoError(t, err)
+
+	SetHTTPTransport(b, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(req.Header.Get("User-Agent"))),
+			Request:    req,
+		}, nil
+	}))
+
+	c, err := NewHTTPClient(b, "test")
+	require.NoError(t, err)
+
+	// Requests never leave the process, but our settings still apply.
+	resp, err := c.Get(context.Background(), "http://example.invalid/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "test-agent", string(body))
+}
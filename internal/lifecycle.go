@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+const contextKeyLifecycle = ContextKey("seabird-lifecycle")
+
+// ShutdownFunc is called when the bot shuts down, after running work has
+// finished or the deadline has passed. The context expires at the deadline.
+type ShutdownFunc func(ctx context.Context) error
+
+// ReloadFunc is called when the config file is reloaded. conf is a bot
+// created from the new config. Only its config should be used, it's never
+// run. If the new config is bad, the old settings should be left alone.
+type ReloadFunc func(conf *seabird.Bot) error
+
+type namedShutdown struct {
+	name string
+	f    ShutdownFunc
+}
+
+type namedReload struct {
+	name string
+	f    ReloadFunc
+}
+
+// Lifecycle tracks background work and what plugins need to do when the
+// config is reloaded or the bot shuts down.
+type Lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	logger *logrus.Entry
+
+	lock     sync.Mutex
+	stopping bool
+	running  int
+	idle     chan struct{}
+	conn     *Conn
+	shutdown []namedShutdown
+	reload   []namedReload
+}
+
+// CtxLifecycle returns the Lifecycle for the bot, or nil if nothing has
+// used one.
+func CtxLifecycle(ctx context.Context) *Lifecycle {
+	ret, _ := ctx.Value(contextKeyLifecycle).(*Lifecycle)
+	return ret
+}
+
+// BotLifecycle returns the Lifecycle for the bot, creating it if needed.
+func BotLifecycle(b *seabird.Bot) *Lifecycle {
+	if l := CtxLifecycle(b.Context()); l != nil {
+		return l
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	l := &Lifecycle{
+		ctx:    ctx,
+		cancel: cancel,
+		logger: seabird.CtxLogger(b.Context(), "lifecycle"),
+	}
+
+	b.SetValue(contextKeyLifecycle, l)
+
+	return l
+}
+
+// Go runs f in a goroutine which shutdown waits for. The context passed to
+// f is cancelled if it's still running when the deadline passes. Once
+// shutdown has started, f isn't run at all.
+func (l *Lifecycle) Go(f func(ctx context.Context)) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.stopping {
+		return
+	}
+
+	l.running++
+
+	go func() {
+		defer l.done()
+		f(l.ctx)
+	}()
+}
+
+func (l *Lifecycle) done() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.running--
+
+	if l.running == 0 && l.idle != nil {
+		close(l.idle)
+		l.idle = nil
+	}
+}
+
+// OnShutdown registers a hook to run when the bot shuts down. Hooks are run
+// in the reverse order they were added, so plugins are stopped before
+// anything they depend on.
+func (l *Lifecycle) OnShutdown(name string, f ShutdownFunc) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.shutdown = append(l.shutdown, namedShutdown{name: name, f: f})
+}
+
+// OnReload registers a hook to run when the config is reloaded.
+func (l *Lifecycle) OnReload(name string, f ReloadFunc) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.reload = append(l.reload, namedReload{name: name, f: f})
+}
+
+// setConn is called by RunBot so we can send QUIT.
+func (l *Lifecycle) setConn(c *Conn) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.conn = c
+}
+
+// Quit asks the server to close the connection with the given message.
+func (l *Lifecycle) Quit(message string) error {
+	l.lock.Lock()
+	conn := l.conn
+	l.lock.Unlock()
+
+	if conn == nil {
+		return errors.New("not connected")
+	}
+
+	_, err := fmt.Fprintf(conn, "QUIT :%s\r\n", message)
+
+	return err
+}
+
+// CloseConn closes the connection without waiting for the server.
+func (l *Lifecycle) CloseConn() error {
+	l.lock.Lock()
+	conn := l.conn
+	l.lock.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	return conn.Close()
+}
+
+// Reload runs every reload hook with the new config. A failing hook doesn't
+// stop the rest from running.
+func (l *Lifecycle) Reload(conf *seabird.Bot) error {
+	l.lock.Lock()
+	hooks := append([]namedReload(nil), l.reload...)
+	l.lock.Unlock()
+
+	failed := 0
+
+	for _, hook := range hooks {
+		if err := hook.f(conf); err != nil {
+			l.logger.WithError(err).WithField("plugin", hook.name).Error("Failed to reload config")
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d plugins failed to reload", failed, len(hooks))
+	}
+
+	return nil
+}
+
+// Shutdown stops anything new from being started with Go, waits for running
+// work until ctx expires and then runs every shutdown hook.
+func (l *Lifecycle) Shutdown(ctx context.Context) error {
+	l.lock.Lock()
+	l.stopping = true
+	hooks := append([]namedShutdown(nil), l.shutdown...)
+
+	idle := l.idle
+	if l.running > 0 && idle == nil {
+		idle = make(chan struct{})
+		l.idle = idle
+	}
+	l.lock.Unlock()
+
+	var ret error
+
+	if idle != nil {
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			ret = fmt.Errorf("gave up waiting for running work: %w", ctx.Err())
+		}
+	}
+
+	// Anything still running is told to give up.
+	l.cancel()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hook := hooks[i]
+
+		start := time.Now()
+
+		err := hook.f(ctx)
+		if err != nil {
+			l.logger.WithError(err).WithField("plugin", hook.name).Error("Failed to shut down")
+
+			if ret == nil {
+				ret = err
+			}
+
+			continue
+		}
+
+		l.logger.WithField("plugin", hook.name).Debugf("Shut down in %s", time.Since(start))
+	}
+
+	return ret
+}
+
+// ShutdownConfig controls how the bot quits.
+type ShutdownConfig struct {
+	// QuitMessage is sent with QUIT.
+	QuitMessage string
+
+	// Timeout is how long we wait for the server to close the connection
+	// and for running work to finish.
+	Timeout Duration
+}
+
+// LoadShutdownConfig loads the optional shutdown section.
+func LoadShutdownConfig(b *seabird.Bot) (*ShutdownConfig, error) {
+	config := &ShutdownConfig{
+		QuitMessage: "Shutting down",
+		Timeout:     Duration{Duration: 10 * time.Second},
+	}
+
+	err := OptionalConfig(b, "shutdown", config)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+func newLifecycleTestBot(t *testing.T, extra string) *seabird.Bot {
+	b, err := seabird.NewBot(strings.NewReader(`
+[core]
+nick = "seabird"
+user = "seabird"
+name = "seabird"
+prefix = "!"
+loglevel = "error"
+` + extra))
+	require.NoError(t, err)
+
+	return b
+}
+
+type bufferConn struct {
+	bytes.Buffer
+}
+
+func (c *bufferConn) Close() error {
+	return nil
+}
+
+func TestLifecycleShutdown(t *testing.T) {
+	b := newLifecycleTestBot(t, "")
+
+	l := BotLifecycle(b)
+	require.Same(t, l, BotLifecycle(b))
+	require.Same(t, l, CtxLifecycle(b.Context()))
+
+	var calls []string
+
+	for _, name := range []string{"first", "second"} {
+		name := name
+
+		l.OnShutdown(name, func(ctx context.Context) error {
+			calls = append(calls, name)
+			return nil
+		})
+	}
+
+	// Running work is finished before any hooks are run.
+	release := make(chan struct{})
+
+	l.Go(func(ctx context.Context) {
+		<-release
+		calls = append(calls, "work")
+	})
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+
+	require.NoError(t, l.Shutdown(context.Background()))
+	require.Equal(t, []string{"work", "second", "first"}, calls)
+
+	// Once we've started shutting down, nothing new is started.
+	ran := false
+
+	l.Go(func(ctx context.Context) {
+		ran = true
+	})
+
+	require.NoError(t, l.Shutdown(context.Background()))
+	require.False(t, ran)
+}
+
+func TestLifecycleShutdownDeadline(t *testing.T) {
+	b := newLifecycleTestBot(t, "")
+	l := BotLifecycle(b)
+
+	cancelled := make(chan struct{})
+
+	l.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})
+
+	hookErr := errors.New("hook failed")
+	hookRan := false
+
+	l.OnShutdown("broken", func(ctx context.Context) error {
+		return hookErr
+	})
+	l.OnShutdown("fine", func(ctx context.Context) error {
+		hookRan = true
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Work which is still running at the deadline is cancelled and hooks
+	// are still run.
+	err := l.Shutdown(ctx)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.True(t, hookRan)
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("work wasn't cancelled")
+	}
+}
+
+func TestLifecycleReload(t *testing.T) {
+	b := newLifecycleTestBot(t, "")
+	l := BotLifecycle(b)
+
+	type testConfig struct {
+		Value string
+	}
+
+	var value string
+
+	l.OnReload("broken", func(conf *seabird.Bot) error {
+		return errors.New("reload failed")
+	})
+	l.OnReload("test", func(conf *seabird.Bot) error {
+		config := &testConfig{}
+		if err := conf.Config("test", config); err != nil {
+			return err
+		}
+
+		value = config.Value
+
+		return nil
+	})
+
+	conf := newLifecycleTestBot(t, `
+[test]
+value = "reloaded"
+`)
+
+	// A failing hook doesn't stop the others.
+	err := l.Reload(conf)
+	require.EqualError(t, err, "1 of 2 plugins failed to reload")
+	require.Equal(t, "reloaded", value)
+}
+
+func TestLifecycleQuit(t *testing.T) {
+	b := newLifecycleTestBot(t, "")
+	l := BotLifecycle(b)
+
+	require.Error(t, l.Quit("bye"))
+	require.NoError(t, l.CloseConn())
+
+	rwc := &bufferConn{}
+	l.setConn(NewConn(rwc))
+
+	require.NoError(t, l.Quit("See you later"))
+	require.Equal(t, "QUIT :See you later\r\n", rwc.String())
+}
+
+func TestLoadShutdownConfig(t *testing.T) {
+	config, err := LoadShutdownConfig(newLifecycleTestBot(t, ""))
+	require.NoError(t, err)
+	require.Equal(t, "Shutting down", config.QuitMessage)
+	require.Equal(t, 10*time.Second, config.Timeout.Duration)
+
+	config, err = LoadShutdownConfig(newLifecycleTestBot(t, `
+[shutdown]
+quitmessage = "Bye"
+timeout = "1s"
+`))
+	require.NoError(t, err)
+	require.Equal(t, "Bye", config.QuitMessage)
+	require.Equal(t, time.Second, config.Timeout.Duration)
+}
@@ -0,0 +1,48 @@
+package internal
+
+// MatchMask matches s against a pattern where * matches any number of
+// characters and ? matches exactly one. Callers should case fold both
+// sides first.
+func MatchMask(pattern, s string) bool {
+	var px, sx, nextPx, nextSx int
+
+	for px < len(pattern) || sx < len(s) {
+		if px < len(pattern) {
+			switch c := pattern[px]; c {
+			case '*':
+				// Try matching nothing first, but remember where to
+				// come back to if that doesn't work out.
+				nextPx = px
+				nextSx = sx + 1
+				px++
+
+				continue
+			case '?':
+				if sx < len(s) {
+					px++
+					sx++
+
+					continue
+				}
+			default:
+				if sx < len(s) && s[sx] == c {
+					px++
+					sx++
+
+					continue
+				}
+			}
+		}
+
+		if nextSx > 0 && nextSx <= len(s) {
+			px = nextPx
+			sx = nextSx
+
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
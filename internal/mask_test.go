@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchMask(t *testing.T) {
+	var tests = []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*", "", true},
+		{"*", "nick!user@host", true},
+		{"nick!user@host", "nick!user@host", true},
+		{"nick!user@host", "nick!user@other", false},
+		{"*!*@example.com", "belak!belak@example.com", true},
+		{"*!*@example.com", "belak!belak@example.com.evil", false},
+		{"*!*@*.example.com", "belak!belak@example.com", false},
+		{"*!*@*.example.com", "belak!belak@a.example.com", true},
+		{"be?ak!*", "belak!belak@example.com", true},
+		{"be?ak!*", "beak!belak@example.com", false},
+		{"*a*b*", "xaxxbx", true},
+		{"*a*b", "xaxxbx", false},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.match, MatchMask(test.pattern, test.s), "%q %q", test.pattern, test.s)
+	}
+}
@@ -0,0 +1,364 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+const contextKeyMetrics = ContextKey("seabird-metrics")
+
+// DefaultBuckets are the histogram buckets used for latencies, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics holds every counter, gauge and histogram for a bot. They're
+// written out in the Prometheus text format.
+type Metrics struct {
+	lock    sync.Mutex
+	metrics map[string]metric
+}
+
+type metric interface {
+	write(w *bufio.Writer, name string)
+}
+
+// CtxMetrics returns the Metrics for the bot, or nil if nothing has
+// recorded any. Every method on a nil Metrics does nothing, so callers
+// don't need to check.
+func CtxMetrics(ctx context.Context) *Metrics {
+	ret, _ := ctx.Value(contextKeyMetrics).(*Metrics)
+	return ret
+}
+
+// BotMetrics returns the Metrics for the bot, creating them if needed.
+func BotMetrics(b *seabird.Bot) *Metrics {
+	if m := CtxMetrics(b.Context()); m != nil {
+		return m
+	}
+
+	m := &Metrics{metrics: make(map[string]metric)}
+	b.SetValue(contextKeyMetrics, m)
+
+	return m
+}
+
+// register returns the metric with the given name, adding it with create
+// if it doesn't exist yet.
+func (m *Metrics) register(name string, create func() metric) metric {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ret, ok := m.metrics[name]
+	if !ok {
+		ret = create()
+		m.metrics[name] = ret
+	}
+
+	return ret
+}
+
+// Counter returns the counter with the given name, creating it if needed.
+// Values passed to Add have to match up with labels.
+func (m *Metrics) Counter(name, help string, labels ...string) *Counter {
+	if m == nil {
+		return nil
+	}
+
+	ret, _ := m.register(name, func() metric {
+		c := &Counter{help: help, labels: labels, values: make(map[string]*series)}
+
+		// Counters without labels start at 0, rather than being missing.
+		if len(labels) == 0 {
+			seriesFor(c.values, nil, nil)
+		}
+
+		return c
+	}).(*Counter)
+
+	return ret
+}
+
+// GaugeFunc adds a gauge whose value is read from f whenever the metrics
+// are written.
+func (m *Metrics) GaugeFunc(name, help string, f func() float64) {
+	if m == nil {
+		return
+	}
+
+	m.register(name, func() metric {
+		return &gaugeFunc{help: help, f: f}
+	})
+}
+
+// Histogram returns the histogram with the given name, creating it if
+// needed. Values passed to Observe have to match up with labels.
+func (m *Metrics) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if m == nil {
+		return nil
+	}
+
+	ret, _ := m.register(name, func() metric {
+		return &Histogram{help: help, buckets: buckets, labels: labels, values: make(map[string]*series)}
+	}).(*Histogram)
+
+	return ret
+}
+
+// WriteTo writes every metric in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	if m == nil {
+		return 0, nil
+	}
+
+	m.lock.Lock()
+
+	names := make([]string, 0, len(m.metrics))
+	for name := range m.metrics {
+		names = append(names, name)
+	}
+
+	metrics := make(map[string]metric, len(m.metrics))
+	for name, metric := range m.metrics {
+		metrics[name] = metric
+	}
+
+	m.lock.Unlock()
+
+	sort.Strings(names)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	for _, name := range names {
+		metrics[name].write(bw, name)
+	}
+
+	err := bw.Flush()
+
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// series is the value for a single set of label values.
+type series struct {
+	labels []string
+
+	value float64
+
+	// These are only used by histograms.
+	counts []uint64
+	count  uint64
+}
+
+// seriesFor returns the series for the given label values, creating it if
+// needed. The lock for the metric must be held.
+func seriesFor(values map[string]*series, labels []string, labelValues []string) *series {
+	if len(labelValues) != len(labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(labelValues), len(labels)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	s, ok := values[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), labelValues...)}
+		values[key] = s
+	}
+
+	return s
+}
+
+// sortedSeries returns every series, sorted by label values, so the output
+// is stable.
+func sortedSeries(values map[string]*series) []*series {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	ret := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		ret = append(ret, values[key])
+	}
+
+	return ret
+}
+
+// Counter is a value which only goes up.
+type Counter struct {
+	help   string
+	labels []string
+
+	lock   sync.Mutex
+	values map[string]*series
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the counter.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	seriesFor(c.values, c.labels, labelValues).value += v
+}
+
+func (c *Counter) write(w *bufio.Writer, name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	writeHeader(w, name, c.help, "counter")
+
+	for _, s := range sortedSeries(c.values) {
+		writeSample(w, name, c.labels, s.labels, "", "", s.value)
+	}
+}
+
+type gaugeFunc struct {
+	help string
+	f    func() float64
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer, name string) {
+	writeHeader(w, name, g.help, "gauge")
+	writeSample(w, name, nil, nil, "", "", g.f())
+}
+
+// Histogram counts values into buckets. It's mostly used for latencies.
+type Histogram struct {
+	help    string
+	buckets []float64
+	labels  []string
+
+	lock   sync.Mutex
+	values map[string]*series
+}
+
+// Observe records a single value.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	s := seriesFor(h.values, h.labels, labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+
+	s.value += v
+	s.count++
+}
+
+// ObserveDuration records a duration in seconds.
+func (h *Histogram) ObserveDuration(d time.Duration, labelValues ...string) {
+	h.Observe(d.Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w *bufio.Writer, name string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	writeHeader(w, name, h.help, "histogram")
+
+	for _, s := range sortedSeries(h.values) {
+		for i, bound := range h.buckets {
+			writeSample(w, name+"_bucket", h.labels, s.labels, "le", formatFloat(bound), float64(s.counts[i]))
+		}
+
+		writeSample(w, name+"_bucket", h.labels, s.labels, "le", "+Inf", float64(s.count))
+		writeSample(w, name+"_sum", h.labels, s.labels, "", "", s.value)
+		writeSample(w, name+"_count", h.labels, s.labels, "", "", float64(s.count))
+	}
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// writeSample writes a single line. extraLabel is used for the le label on
+// histogram buckets.
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+
+			fmt.Fprintf(w, `%s="%s"`, label, labelEscaper.Replace(values[i]))
+		}
+
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+
+			fmt.Fprintf(w, `%s="%s"`, extraLabel, extraValue)
+		}
+
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
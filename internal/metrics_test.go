@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	m := &Metrics{metrics: make(map[string]metric)}
+
+	requests := m.Counter("test_requests_total", "Requests.", "plugin", "code")
+	requests.Inc("url", "200")
+	requests.Inc("url", "200")
+	requests.Inc("github", `odd"value`)
+
+	// Asking for the same counter again returns the existing one.
+	require.Equal(t, requests, m.Counter("test_requests_total", "Requests.", "plugin", "code"))
+
+	m.Counter("test_errors_total", "Errors.")
+
+	latency := m.Histogram("test_seconds", "Latency.", []float64{0.1, 1}, "plugin")
+	latency.ObserveDuration(50*time.Millisecond, "url")
+	latency.Observe(0.5, "url")
+	latency.Observe(2, "url")
+
+	m.GaugeFunc("test_connected", "Connected.", func() float64 { return 1 })
+
+	var buf bytes.Buffer
+
+	_, err := m.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Equal(t, `# HELP test_connected Connected.
+# TYPE test_connected gauge
+test_connected 1
+# HELP test_errors_total Errors.
+# TYPE test_errors_total counter
+test_errors_total 0
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{plugin="github",code="odd\"value"} 1
+test_requests_total{plugin="url",code="200"} 2
+# HELP test_seconds Latency.
+# TYPE test_seconds histogram
+test_seconds_bucket{plugin="url",le="0.1"} 1
+test_seconds_bucket{plugin="url",le="1"} 2
+test_seconds_bucket{plugin="url",le="+Inf"} 3
+test_seconds_sum{plugin="url"} 2.55
+test_seconds_count{plugin="url"} 3
+`, buf.String())
+
+	// Nothing should break if metrics were never set up.
+	var empty *Metrics
+
+	empty.Counter("test_total", "Test.").Inc()
+	empty.Histogram("test_seconds", "Test.", DefaultBuckets).Observe(1)
+	require.Nil(t, CtxMetrics(context.Background()))
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"strings"
+	"sync"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+const contextKeyMiddleware = ContextKey("seabird-middleware")
+
+// Middleware wraps the handler for a command. It can stop the command from
+// running by not calling next.
+type Middleware func(command string, next seabird.HandlerFunc) seabird.HandlerFunc
+
+type middlewareChain struct {
+	lock       sync.RWMutex
+	middleware []Middleware
+}
+
+// UseMiddleware adds middleware which runs around every command registered
+// through a CommandMux. Middleware runs in the order it was added, so the
+// first one added sees a command first.
+func UseMiddleware(b *seabird.Bot, m Middleware) {
+	chain, ok := b.Context().Value(contextKeyMiddleware).(*middlewareChain)
+	if !ok {
+		chain = &middlewareChain{}
+		b.SetValue(contextKeyMiddleware, chain)
+	}
+
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+
+	chain.middleware = append(chain.middleware, m)
+}
+
+// CommandMux registers commands with the bot's command mux, running them
+// through the message filters and any middleware. Plugins should use this
+// rather than the bot's mux directly.
+type CommandMux struct {
+	mux *seabird.CommandMux
+}
+
+// NewCommandMux returns a CommandMux for the given bot.
+func NewCommandMux(b *seabird.Bot) *CommandMux {
+	// Make sure there's somewhere to record command metrics.
+	BotMetrics(b)
+
+	return &CommandMux{mux: b.CommandMux()}
+}
+
+// Event registers a command which works in channels and private messages.
+func (m *CommandMux) Event(command string, h seabird.HandlerFunc, help *seabird.HelpInfo) {
+	m.mux.Event(command, wrapCommand(command, h), help)
+}
+
+// Channel registers a command which only works in channels.
+func (m *CommandMux) Channel(command string, h seabird.HandlerFunc, help *seabird.HelpInfo) {
+	m.mux.Channel(command, wrapCommand(command, h), help)
+}
+
+// Private registers a command which only works in private messages.
+func (m *CommandMux) Private(command string, h seabird.HandlerFunc, help *seabird.HelpInfo) {
+	m.mux.Private(command, wrapCommand(command, h), help)
+}
+
+// wrapCommand runs a handler through the filters and middleware. Both are
+// looked up when the command runs, as plugins adding them may be loaded
+// after the ones adding commands.
+func wrapCommand(command string, h seabird.HandlerFunc) seabird.HandlerFunc {
+	command = strings.ToLower(command)
+	h = timeCommand(command, h)
+
+	return func(r *seabird.Request) {
+		if !MessageAllowed(r) {
+			return
+		}
+
+		chain, ok := r.Context().Value(contextKeyMiddleware).(*middlewareChain)
+		if !ok {
+			h(r)
+			return
+		}
+
+		chain.lock.RLock()
+		middleware := chain.middleware
+		chain.lock.RUnlock()
+
+		next := h
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](command, next)
+		}
+
+		next(r)
+	}
+}
+
+// timeCommand records how often a command runs and how long it takes. It
+// runs inside the middleware, so commands which were stopped aren't
+// counted.
+func timeCommand(command string, h seabird.HandlerFunc) seabird.HandlerFunc {
+	return func(r *seabird.Request) {
+		timer := r.Timer("command:" + command)
+		h(r)
+		timer.Done()
+
+		m := CtxMetrics(r.Context())
+		m.Counter("seabird_commands_total",
+			"Commands run, by command.", "command").Inc(command)
+		m.Histogram("seabird_command_duration_seconds",
+			"How long commands took to run.", DefaultBuckets, "command").ObserveDuration(timer.Elapsed(), command)
+	}
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	irc "gopkg.in/irc.v3"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+func TestMiddleware(t *testing.T) {
+	b, err := seabird.NewBot(strings.NewReader(`
+[core]
+nick = "seabird"
+user = "seabird"
+name = "seabird"
+prefix = "!"
+loglevel = "error"
+`))
+	require.NoError(t, err)
+
+	var calls []string
+
+	cm := NewCommandMux(b)
+	cm.Event("Test", func(r *seabird.Request) {
+		calls = append(calls, "handler "+r.Message.Trailing())
+	}, nil)
+
+	run := func(line string) {
+		m := irc.MustParseMessage(line)
+		b.CommandMux().HandleEvent(seabird.NewRequest(b.Context(), b, "seabird", m))
+	}
+
+	// Without any middleware, commands run as normal.
+	run(":someone!user@host PRIVMSG #channel :!test one")
+	require.Equal(t, []string{"handler one"}, calls)
+
+	// Middleware added after the command was registered should still be
+	// used, in the order it was added.
+	for _, name := range []string{"first", "second"} {
+		name := name
+
+		UseMiddleware(b, func(command string, next seabird.HandlerFunc) seabird.HandlerFunc {
+			return func(r *seabird.Request) {
+				calls = append(calls, name+" "+command)
+
+				if r.Message.Trailing() != "blocked" {
+					next(r)
+				}
+			}
+		})
+	}
+
+	calls = nil
+
+	run(":someone!user@host PRIVMSG #channel :!test two")
+	require.Equal(t, []string{"first test", "second test", "handler two"}, calls)
+
+	calls = nil
+
+	run(":someone!user@host PRIVMSG seabird :test blocked")
+	require.Equal(t, []string{"first test"}, calls)
+}
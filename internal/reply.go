@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	irc "gopkg.in/irc.v3"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+const contextKeyHostmask = ContextKey("seabird-hostmask")
+
+// maxLineLength is the longest line the server will accept, including the
+// trailing \r\n.
+const maxLineLength = 512
+
+// unknownHostmaskLength is how much room we leave for the ident and host if
+// we don't know the bot's hostmask. This covers a 10 character ident, a 63
+// character host and the ! and @ separators.
+const unknownHostmaskLength = 75
+
+// MaxContinuationLines is the number of extra lines a single line of a reply
+// can be split into. Anything past that is cut off.
+var MaxContinuationLines = 3
+
+// HostmaskLookup returns the full nick!ident@host for the given nick, or an
+// empty string if it's not known.
+type HostmaskLookup func(nick string) string
+
+// SetHostmaskLookup registers a function which can be used to find the bot's
+// hostmask. This is how the server will prefix anything we send, so it needs
+// to be taken into account when splitting replies.
+func SetHostmaskLookup(b *seabird.Bot, f HostmaskLookup) {
+	b.SetValue(contextKeyHostmask, f)
+}
+
+// Replyf replies to the given request, splitting the reply into as many
+// lines as are needed to fit within the server's line limit.
+func Replyf(r *seabird.Request, format string, v ...interface{}) error {
+	target, err := replyTarget(r)
+	if err != nil {
+		return err
+	}
+
+	sendLines(r, target, "", fmt.Sprintf(format, v...))
+
+	return nil
+}
+
+// MentionReplyf is the same as Replyf but, like Request.MentionReplyf, it
+// will prefix every line with the user's nick if we are in a channel.
+func MentionReplyf(r *seabird.Request, format string, v ...interface{}) error {
+	target, err := replyTarget(r)
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if r.FromChannel() {
+		prefix = r.Message.Prefix.Name + ": "
+	}
+
+	sendLines(r, target, prefix, fmt.Sprintf(format, v...))
+
+	return nil
+}
+
+// Privmsgf sends a message to the given target, split the same way as
+// Replyf. It's for messages which aren't replies, like reminders.
+func Privmsgf(r *seabird.Request, target, format string, v ...interface{}) {
+	sendLines(r, target, "", fmt.Sprintf(format, v...))
+}
+
+func replyTarget(r *seabird.Request) (string, error) {
+	if len(r.Message.Params) < 1 || len(r.Message.Params[0]) < 1 {
+		return "", errors.New("Invalid IRC message")
+	}
+
+	if r.FromChannel() {
+		return r.Message.Params[0], nil
+	}
+
+	return r.Message.Prefix.Name, nil
+}
+
+func sendLines(r *seabird.Request, target, prefix, msg string) {
+	limit := ReplyLimit(r, target) - len(prefix)
+
+	if !allowFormatting(r, target) {
+		msg = StripFormatting(msg)
+	}
+
+	for _, line := range strings.Split(msg, "\n") {
+		for _, chunk := range SplitLine(line, limit, MaxContinuationLines+1) {
+			r.WriteMessage(&irc.Message{
+				Prefix:  &irc.Prefix{},
+				Command: "PRIVMSG",
+				Params: []string{
+					target,
+					prefix + chunk,
+				},
+			})
+		}
+	}
+}
+
+// ReplyLimit returns how many bytes of text can be sent in a PRIVMSG to the
+// given target. The server relays the message with our full hostmask as the
+// prefix, so that counts against the limit as well.
+func ReplyLimit(r *seabird.Request, target string) int {
+	nick := r.CurrentNick()
+
+	hostmask := ""
+	if lookup, ok := r.Context().Value(contextKeyHostmask).(HostmaskLookup); ok {
+		hostmask = lookup(nick)
+	}
+
+	hostmaskLength := len(hostmask)
+	if hostmask == "" || !strings.Contains(hostmask, "@") {
+		hostmaskLength = len(nick) + unknownHostmaskLength
+	}
+
+	// :<hostmask> PRIVMSG <target> :<text>\r\n
+	return maxLineLength - len(":") - hostmaskLength - len(" PRIVMSG ") - len(target) - len(" :") - len("\r\n")
+}
+
+// SplitLine splits text into chunks of at most limit bytes, breaking at
+// spaces where possible and never in the middle of a UTF-8 character. If
+// there would be more than maxLines chunks, the last one is cut short and
+// ends with "...". A maxLines of 0 or less means there is no cap.
+func SplitLine(text string, limit, maxLines int) []string {
+	// Something has gone very wrong if we can't fit a single character, but
+	// we still need to make progress.
+	if limit < utf8.UTFMax {
+		limit = utf8.UTFMax
+	}
+
+	var ret []string
+
+	for len(text) > limit {
+		if maxLines > 0 && len(ret) == maxLines-1 {
+			cut := truncateBytes(text, limit-len("..."))
+			if i := strings.LastIndexByte(cut, ' '); i > 0 {
+				cut = cut[:i]
+			}
+
+			return append(ret, strings.TrimRight(cut, " ")+"...")
+		}
+
+		cut := truncateBytes(text, limit)
+		next := text[len(cut):]
+
+		// If we're in the middle of a word, try to back up to the last
+		// space. Words longer than a whole line have to be broken up.
+		if next[0] != ' ' {
+			if i := strings.LastIndexByte(cut, ' '); i > 0 {
+				cut = cut[:i]
+				next = text[i:]
+			}
+		}
+
+		ret = append(ret, strings.TrimRight(cut, " "))
+		text = strings.TrimLeft(next, " ")
+	}
+
+	return append(ret, text)
+}
+
+// truncateBytes returns the longest prefix of s which is at most n bytes and
+// doesn't end in the middle of a UTF-8 character. If s isn't valid UTF-8
+// around n, it's cut at n so callers always make progress.
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	// A character is at most UTFMax bytes, so if there's no start of one
+	// that close to n, it's not a character we could break.
+	for i := n; i > 0 && i > n-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			return s[:i]
+		}
+	}
+
+	return s[:n]
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	irc "gopkg.in/irc.v3"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+func TestSplitLine(t *testing.T) {
+	require.Equal(t, []string{"hello world"}, SplitLine("hello world", 20, 0))
+	require.Equal(t, []string{""}, SplitLine("", 20, 0))
+
+	// Splits happen on word boundaries and drop the space.
+	require.Equal(t, []string{"hello", "world"}, SplitLine("hello world", 8, 0))
+	require.Equal(t, []string{"aaa bbb", "ccc"}, SplitLine("aaa bbb ccc", 7, 0))
+
+	// Words which are too long get broken up.
+	require.Equal(t, []string{"aaaa", "aaaa", "aa"}, SplitLine("aaaaaaaaaa", 4, 0))
+
+	// Multi-byte characters are never split.
+	for _, line := range SplitLine(strings.Repeat("é", 10), 5, 0) {
+		require.Equal(t, "éé", line)
+	}
+
+	// Invalid UTF-8 is cut wherever it has to be, rather than looping
+	// forever.
+	require.Equal(t, []string{"\x80\x80\x80\x80", "\x80\x80\x80\x80", "\x80\x80"}, SplitLine(strings.Repeat("\x80", 10), 4, 0))
+	require.Equal(t, []string{"a\x80\x80\x80\x80", "\x80"}, SplitLine("a"+strings.Repeat("\x80", 5), 5, 0))
+
+	// Anything past the line cap is cut off.
+	require.Equal(t, []string{"aaa bbb", "ccc..."}, SplitLine("aaa bbb ccc ddd eee", 7, 2))
+	require.Equal(t, []string{"aaa bbb ccc"}, SplitLine("aaa bbb ccc", 11, 1))
+
+	for _, line := range SplitLine(strings.Repeat("word ", 500), 100, 0) {
+		require.True(t, len(line) <= 100)
+	}
+}
+
+func TestReplyLimit(t *testing.T) {
+	b, err := seabird.NewBot(strings.NewReader(`
+[core]
+nick = "seabird"
+user = "seabird"
+name = "seabird"
+loglevel = "error"
+`))
+	require.NoError(t, err)
+
+	m := irc.MustParseMessage(":someone!user@host PRIVMSG #channel :hello")
+
+	// Without a hostmask, we leave room for the longest one we could have.
+	r := seabird.NewRequest(b.Context(), b, "seabird", m)
+	require.Equal(t, 512-len(":seabird")-unknownHostmaskLength-len(" PRIVMSG #channel :\r\n"), ReplyLimit(r, "#channel"))
+
+	SetHostmaskLookup(b, func(nick string) string {
+		return nick + "!bot@example.com"
+	})
+
+	r = seabird.NewRequest(b.Context(), b, "seabird", m)
+	require.Equal(t, 512-len(":seabird!bot@example.com PRIVMSG #channel :\r\n"), ReplyLimit(r, "#channel"))
+}
@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+
+	seabird "github.com/belak/go-seabird"
+)
+
+// Template is a named response template. Plugins define them with
+// TemplateMustCompile and operators can replace the text of any of them by
+// name with SetTemplateOverrides.
+type Template struct {
+	name   string
+	sample interface{}
+
+	lock     sync.RWMutex
+	fallback *template.Template
+	current  *template.Template
+}
+
+var (
+	templatesLock sync.Mutex
+	templates     = make(map[string]*Template)
+)
+
+// TemplateMustCompile will add all the helpers to a new template,
+// compile it and panic if that fails. Note that it will also trim
+// space from the start and end of the template to make definitions
+// easier. The name must be unique as it is what operators use to
+// override the template.
+//
+// Provided functions:
+// - dateFormat - takes one argument, the format of the date (in golang format)
+// - pluralize - takes one argument, the number of something this is describing
+// - bold, italic, underline - format their argument
+// - color - takes a color name like "red" or "white,red" for a background
+// - reset - clears all formatting
+// - strip - removes any formatting from its argument
+func TemplateMustCompile(name, data string) *Template {
+	compiled, err := compileTemplate(name, data)
+	if err != nil {
+		panic(err)
+	}
+
+	t := &Template{
+		name:     name,
+		fallback: compiled,
+		current:  compiled,
+	}
+
+	templatesLock.Lock()
+	defer templatesLock.Unlock()
+
+	if _, ok := templates[name]; ok {
+		panic(fmt.Sprintf("template %q defined more than once", name))
+	}
+
+	templates[name] = t
+
+	return t
+}
+
+func compileTemplate(name, data string) (*template.Template, error) {
+	ret := template.New(name)
+	ret.Funcs(template.FuncMap{
+		"dateFormat":     dateFormat,
+		"pluralize":      templatePluralize,
+		"pluralizeWord":  templatePluralizeWord,
+		"prettifyNumber": PrettifyNumber,
+		"prettifySuffix": templatePrettifySuffix,
+	})
+	ret.Funcs(formattingFuncs)
+
+	// Overrides are validated against sample data, so we want typos in map
+	// keys to fail rather than render "<no value>".
+	ret.Option("missingkey=error")
+
+	return ret.Parse(strings.TrimSpace(data))
+}
+
+// WithSample sets the data overrides are rendered with to check they work.
+// It should be called along with TemplateMustCompile and the sample should
+// look like what the plugin actually renders.
+func (t *Template) WithSample(sample interface{}) *Template {
+	t.sample = sample
+	return t
+}
+
+// Name returns the name used to override this template.
+func (t *Template) Name() string {
+	return t.name
+}
+
+// Execute renders the template, using the override if there is one.
+func (t *Template) Execute(w io.Writer, vars interface{}) error {
+	t.lock.RLock()
+	current := t.current
+	t.lock.RUnlock()
+
+	return current.Execute(w, vars)
+}
+
+// LookupTemplate returns the template with the given name or nil if there
+// isn't one.
+func LookupTemplate(name string) *Template {
+	templatesLock.Lock()
+	defer templatesLock.Unlock()
+
+	return templates[name]
+}
+
+// TemplateNames returns the names of all the templates, sorted.
+func TemplateNames() []string {
+	templatesLock.Lock()
+	defer templatesLock.Unlock()
+
+	ret := make([]string, 0, len(templates))
+	for name := range templates {
+		ret = append(ret, name)
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+// SetTemplateOverrides replaces the text of the given templates. Every
+// override is compiled and rendered with its sample data before any of them
+// are used, so if one is broken nothing changes. Templates which aren't in
+// overrides go back to their default.
+func SetTemplateOverrides(overrides map[string]string) error {
+	compiled := make(map[*Template]*template.Template)
+
+	for name, text := range overrides {
+		t := LookupTemplate(name)
+		if t == nil {
+			return fmt.Errorf("template %q: unknown template", name)
+		}
+
+		ret, err := compileTemplate(name, text)
+		if err != nil {
+			return fmt.Errorf("template %q: %w", name, err)
+		}
+
+		if t.sample != nil {
+			if err = ret.Execute(ioutil.Discard, t.sample); err != nil {
+				return fmt.Errorf("template %q: failed to render sample data: %w", name, err)
+			}
+		}
+
+		compiled[t] = ret
+	}
+
+	templatesLock.Lock()
+	defer templatesLock.Unlock()
+
+	for _, t := range templates {
+		t.lock.Lock()
+
+		if ret, ok := compiled[t]; ok {
+			t.current = ret
+		} else {
+			t.current = t.fallback
+		}
+
+		t.lock.Unlock()
+	}
+
+	return nil
+}
+
+// ValidateTemplates renders every template which has sample data and returns
+// the first error. This is mostly useful in tests, to make sure the defaults
+// work with their samples.
+func ValidateTemplates() error {
+	for _, name := range TemplateNames() {
+		t := LookupTemplate(name)
+		if t.sample == nil {
+			continue
+		}
+
+		if err := t.Execute(ioutil.Discard, t.sample); err != nil {
+			return fmt.Errorf("template %q: failed to render sample data: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// RenderTemplate is a wrapper to render a template to a string.
+func RenderTemplate(t *Template, vars interface{}) (string, error) {
+	b := bytes.NewBuffer(nil)
+
+	err := t.Execute(b, vars)
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// RenderRespond is a wrapper around RenderTemplate which will render a template
+// and respond to the given message, splitting it up if it's too long. It will
+// return true on success and false on failure.
+func RenderRespond(r *seabird.Request, logger *logrus.Entry, t *Template, prefix string, vars interface{}) bool {
+	out, err := RenderTemplate(t, vars)
+	if err != nil {
+		logger.WithError(err).Error("Failed to render template")
+		return false
+	}
+
+	_ = Replyf(r, "%s %s", prefix, out)
+
+	return true
+}
+
+// ReplyTemplate renders a template and replies with it like Replyf. Render
+// failures are logged as well as returned, so most callers can ignore them.
+func ReplyTemplate(r *seabird.Request, t *Template, vars interface{}) error {
+	out, err := renderForReply(r, t, vars)
+	if err != nil {
+		return err
+	}
+
+	return Replyf(r, "%s", out)
+}
+
+// MentionReplyTemplate is the same as ReplyTemplate but replies like
+// MentionReplyf.
+func MentionReplyTemplate(r *seabird.Request, t *Template, vars interface{}) error {
+	out, err := renderForReply(r, t, vars)
+	if err != nil {
+		return err
+	}
+
+	return MentionReplyf(r, "%s", out)
+}
+
+func renderForReply(r *seabird.Request, t *Template, vars interface{}) (string, error) {
+	out, err := RenderTemplate(t, vars)
+	if err != nil {
+		r.GetLogger("template").WithError(err).WithField("template", t.Name()).Error("Failed to render template")
+	}
+
+	return out, err
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testTemplateData struct {
+	Name  string
+	Count int
+}
+
+var testTemplate = TemplateMustCompile("internalTest", `
+{{ .data.Name }} has {{ pluralize .data.Count "thing" }}
+`).WithSample(map[string]interface{}{
+	"data": &testTemplateData{Name: "seabird", Count: 1},
+})
+
+func renderTestTemplate(t *testing.T) string {
+	out, err := RenderTemplate(testTemplate, map[string]interface{}{
+		"data": &testTemplateData{Name: "belak", Count: 2},
+	})
+	require.NoError(t, err)
+
+	return out
+}
+
+func TestTemplateOverrides(t *testing.T) {
+	defer func() {
+		require.NoError(t, SetTemplateOverrides(nil))
+	}()
+
+	require.Equal(t, "belak has 2 things", renderTestTemplate(t))
+	require.Same(t, testTemplate, LookupTemplate("internalTest"))
+	require.Contains(t, TemplateNames(), "internalTest")
+
+	err := SetTemplateOverrides(map[string]string{
+		"internalTest": "  {{ .data.Name }}: {{ .data.Count }}\n",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "belak: 2", renderTestTemplate(t))
+
+	// Clearing the overrides goes back to the default.
+	require.NoError(t, SetTemplateOverrides(nil))
+	require.Equal(t, "belak has 2 things", renderTestTemplate(t))
+}
+
+func TestTemplateOverrideErrors(t *testing.T) {
+	defer func() {
+		require.NoError(t, SetTemplateOverrides(nil))
+	}()
+
+	var tests = []struct {
+		overrides map[string]string
+		err       string
+	}{
+		{
+			overrides: map[string]string{"internalMissing": "hello"},
+			err:       `template "internalMissing": unknown template`,
+		},
+		{
+			overrides: map[string]string{"internalTest": "{{ .data.Name"},
+			err:       `template "internalTest": template: internalTest:1: unclosed action`,
+		},
+		{
+			overrides: map[string]string{"internalTest": "{{ .data.Nick }}"},
+			err:       `template "internalTest": failed to render sample data`,
+		},
+		{
+			overrides: map[string]string{"internalTest": "{{ .nick }}"},
+			err:       `map has no entry for key "nick"`,
+		},
+	}
+
+	for _, test := range tests {
+		err := SetTemplateOverrides(test.overrides)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), test.err)
+
+		// A broken override shouldn't change anything.
+		require.Equal(t, "belak has 2 things", renderTestTemplate(t))
+	}
+}
+
+func TestTemplateDuplicateName(t *testing.T) {
+	require.Panics(t, func() {
+		TemplateMustCompile("internalTest", "")
+	})
+}
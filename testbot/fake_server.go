@@ -0,0 +1,418 @@
+package testbot
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	irc "gopkg.in/irc.v3"
+)
+
+// fakeServerHost is the host every client on a FakeServer appears to be
+// connecting from.
+const fakeServerHost = "localhost"
+
+// FakeServer is a tiny IRC server for running a bot in the same process
+// without a network. It handles registration, PING, JOIN, PART, NICK and
+// QUIT the way a real server would, so plugins like channel_track work, and
+// passes every line the bot sends to a callback. It uses ascii case
+// mapping, so channel and nick lookups are simply lowercased.
+//
+// It's used by New and by seabird-console. Server uses a scripted one,
+// which leaves every answer to the test.
+type FakeServer struct {
+	name     string
+	scripted bool
+	conn     net.Conn
+	client   net.Conn
+	onLine   func(line string, m *irc.Message)
+
+	out        chan string
+	done       chan struct{}
+	closeOnce  sync.Once
+	registered chan struct{}
+
+	lock     sync.Mutex
+	nick     string
+	user     string
+	welcomed bool
+	channels map[string]map[string]string
+
+	// pings are waiting for a PONG, keyed by token.
+	pingID int
+	pings  map[string]chan struct{}
+}
+
+// NewFakeServer starts a server with the given name. onLine is called with
+// every line the bot sends, after the server has handled it. It may be nil.
+func NewFakeServer(name string, onLine func(m *irc.Message)) *FakeServer {
+	return newFakeServer(name, false, func(line string, m *irc.Message) {
+		if onLine != nil {
+			onLine(m)
+		}
+	})
+}
+
+// newFakeServer starts a server. If scripted is true, it doesn't answer
+// anything the bot sends, but still keeps track of channels and Sync.
+// onLine is called with every line exactly as the bot sent it, as well as
+// parsed.
+func newFakeServer(name string, scripted bool, onLine func(line string, m *irc.Message)) *FakeServer {
+	conn, client := net.Pipe()
+
+	s := &FakeServer{
+		name:       name,
+		scripted:   scripted,
+		conn:       conn,
+		client:     client,
+		onLine:     onLine,
+		out:        make(chan string, 1024),
+		done:       make(chan struct{}),
+		registered: make(chan struct{}),
+		channels:   make(map[string]map[string]string),
+		pings:      make(map[string]chan struct{}),
+	}
+
+	go s.readLoop()
+	go s.writeLoop()
+
+	return s
+}
+
+// Conn returns the connection the bot should be run on.
+func (s *FakeServer) Conn() net.Conn {
+	return s.client
+}
+
+// Registered is closed once the bot has registered and been welcomed.
+func (s *FakeServer) Registered() <-chan struct{} {
+	return s.registered
+}
+
+// Done is closed once the connection has been closed.
+func (s *FakeServer) Done() <-chan struct{} {
+	return s.done
+}
+
+// Nick returns the bot's current nick.
+func (s *FakeServer) Nick() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.nick
+}
+
+// Members returns the nicks in a channel, sorted.
+func (s *FakeServer) Members(channel string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.members(channel)
+}
+
+func (s *FakeServer) members(channel string) []string {
+	ret := make([]string, 0, len(s.channels[strings.ToLower(channel)]))
+	for _, nick := range s.channels[strings.ToLower(channel)] {
+		ret = append(ret, nick)
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+// Sync waits for the bot to handle every line sent before it. It works by
+// sending a PING and waiting for the PONG. Plugins which do work in the
+// background may still be running.
+func (s *FakeServer) Sync(ctx context.Context) error {
+	s.lock.Lock()
+	s.pingID++
+	token := "sync-" + strconv.Itoa(s.pingID)
+	pong := make(chan struct{})
+	s.pings[token] = pong
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.pings, token)
+		s.lock.Unlock()
+	}()
+
+	s.Send("PING :" + token)
+
+	select {
+	case <-pong:
+		return nil
+	case <-s.done:
+		return io.EOF
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the connection.
+func (s *FakeServer) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+
+	return s.conn.Close()
+}
+
+// Send sends a raw line to the bot. JOIN, PART, KICK, NICK and QUIT lines
+// update who the server thinks is in each channel.
+func (s *FakeServer) Send(line string) {
+	m, err := irc.ParseMessage(line)
+	if err != nil {
+		return
+	}
+
+	s.lock.Lock()
+	s.apply(m)
+	s.lock.Unlock()
+
+	s.queue(m.String())
+}
+
+func (s *FakeServer) queue(line string) {
+	select {
+	case s.out <- line:
+	case <-s.done:
+	}
+}
+
+// reply sends a numeric to the bot.
+func (s *FakeServer) reply(command string, params ...string) {
+	s.Send((&irc.Message{
+		Prefix:  &irc.Prefix{Name: s.name},
+		Command: command,
+		Params:  append([]string{s.Nick()}, params...),
+	}).String())
+}
+
+// param returns a param from the message, or an empty string if it doesn't
+// have that many.
+func param(m *irc.Message, i int) string {
+	if i < len(m.Params) {
+		return m.Params[i]
+	}
+
+	return ""
+}
+
+// apply updates channel membership. The lock must be held.
+func (s *FakeServer) apply(m *irc.Message) {
+	if m.Prefix == nil {
+		return
+	}
+
+	nick := m.Prefix.Name
+
+	switch m.Command {
+	case "JOIN":
+		for _, channel := range strings.Split(param(m, 0), ",") {
+			key := strings.ToLower(channel)
+			if s.channels[key] == nil {
+				s.channels[key] = make(map[string]string)
+			}
+
+			s.channels[key][strings.ToLower(nick)] = nick
+		}
+	case "PART":
+		for _, channel := range strings.Split(param(m, 0), ",") {
+			s.removeMember(channel, nick)
+		}
+	case "KICK":
+		s.removeMember(param(m, 0), param(m, 1))
+	case "NICK":
+		for _, members := range s.channels {
+			if _, ok := members[strings.ToLower(nick)]; ok {
+				delete(members, strings.ToLower(nick))
+				members[strings.ToLower(param(m, 0))] = param(m, 0)
+			}
+		}
+
+		if strings.EqualFold(nick, s.nick) {
+			s.nick = param(m, 0)
+		}
+	case "QUIT":
+		for channel := range s.channels {
+			s.removeMember(channel, nick)
+		}
+	}
+}
+
+func (s *FakeServer) removeMember(channel, nick string) {
+	key := strings.ToLower(channel)
+
+	delete(s.channels[key], strings.ToLower(nick))
+
+	if len(s.channels[key]) == 0 {
+		delete(s.channels, key)
+	}
+}
+
+// botPrefix returns the prefix the bot's own lines are echoed with.
+func (s *FakeServer) botPrefix() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return (&irc.Prefix{Name: s.nick, User: s.user, Host: fakeServerHost}).String()
+}
+
+func (s *FakeServer) isMember(channel, nick string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.channels[strings.ToLower(channel)][strings.ToLower(nick)]
+
+	return ok
+}
+
+// ForceJoin puts the bot in a channel, the same as if it had sent a JOIN.
+// It does nothing if the bot is already there.
+func (s *FakeServer) ForceJoin(channel string) {
+	if s.isMember(channel, s.Nick()) {
+		return
+	}
+
+	s.Send(":" + s.botPrefix() + " JOIN " + channel)
+
+	s.lock.Lock()
+	names := strings.Join(s.members(channel), " ")
+	s.lock.Unlock()
+
+	s.reply("353", "=", channel, names)
+	s.reply("366", channel, "End of /NAMES list.")
+}
+
+func (s *FakeServer) welcome() {
+	s.lock.Lock()
+	ready := !s.welcomed && s.nick != "" && s.user != ""
+	if ready {
+		s.welcomed = true
+	}
+	s.lock.Unlock()
+
+	if !ready {
+		return
+	}
+
+	s.reply("001", "Welcome to "+s.name)
+	s.reply("005", "CASEMAPPING=ascii", "CHANTYPES=#&", "PREFIX=(ov)@+", "NETWORK="+s.name, "are supported by this server")
+	s.reply("422", "MOTD File is missing")
+
+	close(s.registered)
+}
+
+// handle responds to a line from the bot.
+func (s *FakeServer) handle(m *irc.Message) {
+	if m.Command == "PONG" {
+		s.lock.Lock()
+		if pong, ok := s.pings[m.Trailing()]; ok {
+			close(pong)
+			delete(s.pings, m.Trailing())
+		}
+		s.lock.Unlock()
+
+		return
+	}
+
+	if s.scripted {
+		return
+	}
+
+	switch m.Command {
+	case "CAP":
+		switch param(m, 0) {
+		case "LS":
+			s.Send(":" + s.name + " CAP * LS :")
+		case "REQ":
+			s.Send(":" + s.name + " CAP * NAK :" + m.Trailing())
+		}
+	case "NICK":
+		s.lock.Lock()
+		welcomed := s.welcomed
+		if !welcomed {
+			s.nick = param(m, 0)
+		}
+		s.lock.Unlock()
+
+		if welcomed {
+			s.Send(":" + s.botPrefix() + " NICK :" + param(m, 0))
+		} else {
+			s.welcome()
+		}
+	case "USER":
+		s.lock.Lock()
+		s.user = param(m, 0)
+		s.lock.Unlock()
+
+		s.welcome()
+	case "PING":
+		s.Send(":" + s.name + " PONG " + s.name + " :" + m.Trailing())
+	case "JOIN":
+		for _, channel := range strings.Split(param(m, 0), ",") {
+			s.ForceJoin(channel)
+		}
+	case "PART":
+		for _, channel := range strings.Split(param(m, 0), ",") {
+			if s.isMember(channel, s.Nick()) {
+				s.Send(":" + s.botPrefix() + " PART " + channel)
+			}
+		}
+	case "QUIT":
+		s.queue("ERROR :Closing Link: " + fakeServerHost + " (Quit: " + m.Trailing() + ")")
+
+		// An empty line tells the writer to close the connection once
+		// everything before it has been sent.
+		s.queue("")
+	}
+}
+
+func (s *FakeServer) readLoop() {
+	defer s.Close()
+
+	r := bufio.NewReader(s.conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		m, err := irc.ParseMessage(line)
+		if err != nil {
+			return
+		}
+
+		s.handle(m)
+		s.onLine(line, m)
+	}
+}
+
+func (s *FakeServer) writeLoop() {
+	for {
+		select {
+		case line := <-s.out:
+			if line == "" {
+				_ = s.Close()
+				return
+			}
+
+			if _, err := io.WriteString(s.conn, line+"\r\n"); err != nil {
+				_ = s.Close()
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
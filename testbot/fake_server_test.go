@@ -0,0 +1,99 @@
+package testbot_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	irc "gopkg.in/irc.v3"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+func TestFakeServer(t *testing.T) {
+	b := testbot.NewBot(t, nil, `cmds = ["JOIN #seabird"]`)
+
+	lines := make(chan *irc.Message, 100)
+
+	s := testbot.NewFakeServer("irc.example.com", func(m *irc.Message) {
+		lines <- m
+	})
+	defer s.Close()
+
+	b.BasicMux().Event("PRIVMSG", func(r *seabird.Request) {
+		r.Replyf("Hello %s", r.Message.Prefix.Name)
+	})
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- internal.RunBot(b, s.Conn())
+	}()
+
+	// next returns the next line the bot sends with the given command.
+	next := func(command string) *irc.Message {
+		timeout := time.After(5 * time.Second)
+
+		for {
+			select {
+			case m := <-lines:
+				if m.Command == command {
+					return m
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %s", command)
+				return nil
+			}
+		}
+	}
+
+	select {
+	case <-s.Registered():
+	case <-time.After(5 * time.Second):
+		t.Fatal("bot never registered")
+	}
+
+	require.Equal(t, "seabird", s.Nick())
+
+	// The bot joins the channels in its config and the server remembers.
+	require.Equal(t, []string{"#seabird"}, next("JOIN").Params)
+	require.Equal(t, []string{"seabird"}, s.Members("#seabird"))
+
+	s.Send(":someone!user@host JOIN #seabird")
+	require.Equal(t, []string{"seabird", "someone"}, s.Members("#Seabird"))
+
+	s.Send(":someone!user@host PRIVMSG #seabird :hi there")
+	require.Equal(t, []string{"#seabird", "Hello someone"}, next("PRIVMSG").Params)
+
+	s.Send(":someone!user@host NICK :other")
+	require.Equal(t, []string{"other", "seabird"}, s.Members("#seabird"))
+
+	// Sync returns once everything sent before it was handled.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.Send(":other!user@host PRIVMSG #seabird :again")
+	require.NoError(t, s.Sync(ctx))
+	require.Len(t, lines, 2)
+	require.Equal(t, []string{"#seabird", "Hello other"}, (<-lines).Params)
+	require.Equal(t, "PONG", (<-lines).Command)
+
+	s.ForceJoin("#other")
+	require.Equal(t, []string{"seabird"}, s.Members("#other"))
+
+	s.Send(":other!user@host PART #seabird")
+	require.Equal(t, []string{"seabird"}, s.Members("#seabird"))
+
+	// Quitting closes the connection, which stops the bot.
+	require.NoError(t, internal.BotLifecycle(b).Quit("Bye"))
+	require.Equal(t, []string{"Bye"}, next("QUIT").Params)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bot didn't stop")
+	}
+}
@@ -0,0 +1,161 @@
+package testbot
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// RecordEnv is the environment variable which turns on recording. If it's
+// set, requests matching a Fixture are sent for real and the response is
+// saved to the fixture's file.
+const RecordEnv = "TESTBOT_RECORD"
+
+// Transport answers HTTP requests from stubs and recorded fixtures. Any
+// request which doesn't match one fails the test.
+type Transport struct {
+	t testing.TB
+
+	lock     sync.Mutex
+	fixtures []*fixture
+}
+
+type fixture struct {
+	method string
+	url    *url.URL
+
+	// Either path is set and the response is read from the file, or the
+	// response is built from status and body.
+	path   string
+	status int
+	body   string
+}
+
+func newTransport(t testing.TB) *Transport {
+	return &Transport{t: t}
+}
+
+func (t *Transport) add(f *fixture, rawurl string) {
+	t.t.Helper()
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.t.Fatalf("testbot: invalid fixture url: %v", err)
+	}
+
+	f.url = u
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.fixtures = append(t.fixtures, f)
+}
+
+// Stub answers requests for a URL with the given status and body. Query
+// params have to match, but can be in any order.
+func (t *Transport) Stub(method, rawurl string, status int, body string) {
+	t.t.Helper()
+	t.add(&fixture{method: method, status: status, body: body}, rawurl)
+}
+
+// Fixture answers requests for a URL with a response recorded in a file.
+// The file is a raw HTTP response, like the output of curl -i. Run the
+// tests with TESTBOT_RECORD=1 to record it.
+func (t *Transport) Fixture(method, rawurl, path string) {
+	t.t.Helper()
+	t.add(&fixture{method: method, path: path}, rawurl)
+}
+
+func (f *fixture) matches(req *http.Request) bool {
+	return f.method == req.Method &&
+		f.url.Scheme == req.URL.Scheme &&
+		f.url.Host == req.URL.Host &&
+		f.url.Path == req.URL.Path &&
+		reflect.DeepEqual(f.url.Query(), req.URL.Query())
+}
+
+func (t *Transport) lookup(req *http.Request) *fixture {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, f := range t.fixtures {
+		if f.matches(req) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f := t.lookup(req)
+	if f == nil {
+		// Errorf is safe to call from the goroutine a plugin is making the
+		// request on, unlike Fatalf.
+		t.t.Errorf("testbot: unexpected request %s %s", req.Method, req.URL)
+		return nil, fmt.Errorf("testbot: no fixture for %s %s", req.Method, req.URL)
+	}
+
+	if f.path == "" {
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", f.status, http.StatusText(f.status)),
+			StatusCode:    f.status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        make(http.Header),
+			Body:          ioutil.NopCloser(strings.NewReader(f.body)),
+			ContentLength: int64(len(f.body)),
+			Request:       req,
+		}, nil
+	}
+
+	if os.Getenv(RecordEnv) != "" {
+		if err := record(req, f.path); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("testbot: %w", err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		return nil, fmt.Errorf("testbot: failed to read %s: %w", f.path, err)
+	}
+
+	return resp, nil
+}
+
+// record sends a request for real and saves the response to path.
+func record(req *http.Request, path string) error {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644) //nolint:gosec
+}
@@ -0,0 +1,192 @@
+package testbot
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	irc "gopkg.in/irc.v3"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+// Server is the server side of a bot connection, for tests which need to
+// control every line the bot sees, like capability negotiation. It's a
+// FakeServer which doesn't answer anything, so unlike Bot, every reply is
+// up to the test.
+type Server struct {
+	// Bot is the bot connected to the server, if it was started with Start.
+	Bot *seabird.Bot
+
+	// Timeout is how long to wait for the bot to send something.
+	Timeout time.Duration
+
+	t      testing.TB
+	server *FakeServer
+	lines  chan string
+}
+
+// NewServer calls run in the background with the client side of a new
+// connection. run usually passes it on to internal.RunBot or to the bot's
+// Run method. The connection is closed when the test ends.
+func NewServer(t testing.TB, run func(conn net.Conn) error) *Server {
+	s := &Server{
+		Timeout: DefaultTimeout,
+		t:       t,
+		lines:   make(chan string, 1024),
+	}
+
+	s.server = newFakeServer("irc.example.com", true, func(line string, m *irc.Message) {
+		s.lines <- line
+	})
+
+	go func() {
+		_ = run(s.server.Conn())
+	}()
+
+	t.Cleanup(func() {
+		_ = s.server.Close()
+	})
+
+	return s
+}
+
+// Start creates a bot with NewBot and runs it against a new Server the same
+// way it runs against a real one. If setup isn't nil, it's called once the
+// plugins have been loaded but before the bot has sent anything, so tests
+// can look up plugins or add their own handlers.
+func Start(t testing.TB, plugins []string, config string, setup func(b *seabird.Bot)) *Server {
+	t.Helper()
+
+	b := NewBot(t, plugins, config)
+
+	s := NewServer(t, func(conn net.Conn) error {
+		if setup != nil {
+			// Plugins are loaded before anything is sent, so we can hook
+			// in when the first line is written.
+			conn = &setupConn{Conn: conn, setup: func() {
+				setup(b)
+			}}
+		}
+
+		return internal.RunBot(b, conn)
+	})
+
+	s.Bot = b
+
+	return s
+}
+
+// setupConn calls setup before the first write.
+type setupConn struct {
+	net.Conn
+	setup func()
+	done  bool
+}
+
+func (c *setupConn) Write(p []byte) (int, error) {
+	if !c.done {
+		c.done = true
+		c.setup()
+	}
+
+	return c.Conn.Write(p)
+}
+
+// Send sends raw lines to the bot.
+func (s *Server) Send(lines ...string) {
+	s.t.Helper()
+
+	for _, line := range lines {
+		if _, err := irc.ParseMessage(line); err != nil {
+			s.t.Fatalf("testbot: failed to send %q: %v", line, err)
+		}
+
+		s.server.Send(line)
+	}
+}
+
+// next returns the next line the bot sends, failing the test if the
+// connection is closed or timeout fires first. what is used in the error.
+func (s *Server) next(timeout <-chan time.Time, what string) string {
+	s.t.Helper()
+
+	select {
+	case line := <-s.lines:
+		return line
+	case <-s.server.Done():
+		// Lines may still be waiting even though the connection is closed.
+		select {
+		case line := <-s.lines:
+			return line
+		default:
+			s.t.Fatalf("testbot: connection closed waiting for %s", what)
+		}
+	case <-timeout:
+		s.t.Fatalf("testbot: timed out waiting for %s", what)
+	}
+
+	return ""
+}
+
+// Next returns the next line the bot sends.
+func (s *Server) Next() string {
+	s.t.Helper()
+
+	return s.next(time.After(s.Timeout), "the bot to send something")
+}
+
+// Expect checks the next line the bot sends.
+func (s *Server) Expect(line string) {
+	s.t.Helper()
+
+	if actual := s.Next(); actual != line {
+		s.t.Fatalf("testbot: expected %q, got %q", line, actual)
+	}
+}
+
+// WaitForPrefix skips lines until the bot sends one starting with prefix
+// and returns it.
+func (s *Server) WaitForPrefix(prefix string) string {
+	s.t.Helper()
+
+	timeout := time.After(s.Timeout)
+
+	for {
+		line := s.next(timeout, strconv.Quote(prefix))
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+}
+
+// WaitFor skips lines until the bot sends the given one.
+func (s *Server) WaitFor(line string) {
+	s.t.Helper()
+
+	for s.WaitForPrefix(line) != line {
+	}
+}
+
+// Sync waits for the bot to handle every line sent so far. Anything the bot
+// sends before it gets to the PING is skipped.
+func (s *Server) Sync() {
+	s.t.Helper()
+
+	s.Send("PING :testbot-sync")
+	s.WaitFor("PONG testbot-sync")
+}
+
+// Register gets a bot with the cap plugin through registration without
+// enabling any capabilities.
+func (s *Server) Register() {
+	s.t.Helper()
+
+	s.WaitFor("CAP LS 302")
+	s.Send(":irc.example.com CAP * LS :")
+	s.WaitFor("CAP END")
+	s.Send(":irc.example.com 001 seabird :Welcome")
+}
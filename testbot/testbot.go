@@ -0,0 +1,296 @@
+// Package testbot runs a bot against a fake IRC server so plugins can be
+// tested without a network. Every bot gets its own in-memory sqlite db and
+// its HTTP requests are answered from fixtures.
+//
+// A test usually looks something like this:
+//
+//	b := testbot.New(t, []string{"db", "isupport", "karma"}, "")
+//	b.Privmsg("someone", testbot.Channel, "seabird++")
+//	b.ExpectPrivmsg(testbot.Channel, "seabird's karma is now 1")
+//
+// Tests which need to control every line the bot sees, like ones for
+// capability negotiation, can use Start to get a Server instead.
+package testbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // The in-memory db uses sqlite
+	irc "gopkg.in/irc.v3"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+)
+
+const (
+	// Nick is the bot's nick.
+	Nick = "seabird"
+
+	// Channel is joined by the bot when it starts.
+	Channel = "#seabird"
+
+	// Prefix is the command prefix.
+	Prefix = "!"
+)
+
+// DefaultTimeout is how long a bot waits for something to happen before
+// failing the test.
+var DefaultTimeout = 5 * time.Second
+
+// dbCount is used to give every bot its own db.
+var dbCount int64
+
+// Bot is a bot connected to a fake server.
+type Bot struct {
+	*seabird.Bot
+
+	// HTTP answers every HTTP request made by plugins.
+	HTTP *Transport
+
+	// Timeout is how long to wait for the bot to do something.
+	Timeout time.Duration
+
+	t         testing.TB
+	server    *FakeServer
+	lifecycle *internal.Lifecycle
+	lines     chan *irc.Message
+	done      chan error
+}
+
+// NewBot creates a bot with the given plugins without running it, for
+// tests which start it some other way. Dependencies aren't loaded
+// automatically, so they have to be listed as well. config is added to the
+// end of the config file, right after the core section, so it can set other
+// core options as well as configure plugins. Every bot gets its own
+// in-memory sqlite db.
+func NewBot(t testing.TB, plugins []string, config string) *seabird.Bot {
+	t.Helper()
+
+	quoted := make([]string, 0, len(plugins))
+	for _, plugin := range plugins {
+		quoted = append(quoted, fmt.Sprintf("%q", plugin))
+	}
+
+	// Every connection to a shared cache in-memory db with the same name
+	// sees the same data, so this stays around as long as the pool has a
+	// connection open.
+	dataSource := fmt.Sprintf("file:testbot-%d?mode=memory&cache=shared", atomic.AddInt64(&dbCount, 1))
+
+	b, err := seabird.NewBot(strings.NewReader(fmt.Sprintf(`
+[db]
+driver = "sqlite3"
+datasource = %q
+
+[core]
+nick = %q
+user = %q
+name = %q
+prefix = %q
+loglevel = "error"
+plugins = [%s]
+`, dataSource, Nick, Nick, Nick, Prefix, strings.Join(quoted, ", ")) + config))
+	if err != nil {
+		t.Fatalf("testbot: failed to create bot: %v", err)
+	}
+
+	return b
+}
+
+// New starts a bot with the given plugins against a fake server which
+// answers the way a real one would. plugins and config are the same as for
+// NewBot. New returns once the bot has joined Channel. The bot is shut down
+// when the test ends.
+func New(t testing.TB, plugins []string, config string) *Bot {
+	t.Helper()
+
+	sb := NewBot(t, plugins, fmt.Sprintf("cmds = [%q]\n", "JOIN "+Channel)+config)
+
+	b := &Bot{
+		Bot:       sb,
+		HTTP:      newTransport(t),
+		Timeout:   DefaultTimeout,
+		t:         t,
+		lifecycle: internal.BotLifecycle(sb),
+		lines:     make(chan *irc.Message, 1024),
+		done:      make(chan error, 1),
+	}
+
+	internal.SetHTTPTransport(sb, b.HTTP)
+
+	b.server = NewFakeServer("irc.example.com", func(m *irc.Message) {
+		b.lines <- m
+	})
+
+	go func() {
+		b.done <- internal.RunBot(sb, b.server.Conn())
+	}()
+
+	t.Cleanup(b.stop)
+
+	select {
+	case <-b.server.Registered():
+	case err := <-b.done:
+		t.Fatalf("testbot: bot failed to start: %v", err)
+	case <-time.After(b.Timeout):
+		t.Fatal("testbot: timed out waiting for the bot to register")
+	}
+
+	// The first sync makes sure the bot has sent its JOIN, the second that
+	// it has seen the server's reply.
+	b.Sync()
+	b.Sync()
+
+	return b
+}
+
+// stop shuts the bot down the same way it would on SIGTERM.
+func (b *Bot) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), b.Timeout)
+	defer cancel()
+
+	if err := b.lifecycle.Quit("Test finished"); err == nil {
+		select {
+		case <-b.server.Done():
+		case <-ctx.Done():
+			_ = b.lifecycle.CloseConn()
+		}
+	}
+
+	if err := b.lifecycle.Shutdown(ctx); err != nil {
+		b.t.Errorf("testbot: failed to shut down: %v", err)
+	}
+
+	_ = b.server.Close()
+}
+
+// Send sends a raw line to the bot, as if it came from the server.
+func (b *Bot) Send(line string) {
+	b.server.Send(line)
+}
+
+func prefix(nick string) string {
+	return (&irc.Prefix{Name: nick, User: nick, Host: strings.ToLower(nick) + ".example.com"}).String()
+}
+
+// Privmsg sends a message from nick to a channel or the bot.
+func (b *Bot) Privmsg(nick, target, text string) {
+	b.Send(fmt.Sprintf(":%s PRIVMSG %s :%s", prefix(nick), target, text))
+}
+
+// Join has nick join a channel.
+func (b *Bot) Join(nick, channel string) {
+	b.Send(fmt.Sprintf(":%s JOIN %s", prefix(nick), channel))
+}
+
+// Part has nick leave a channel.
+func (b *Bot) Part(nick, channel, reason string) {
+	b.Send(fmt.Sprintf(":%s PART %s :%s", prefix(nick), channel, reason))
+}
+
+// Rename changes nick to newNick.
+func (b *Bot) Rename(nick, newNick string) {
+	b.Send(fmt.Sprintf(":%s NICK :%s", prefix(nick), newNick))
+}
+
+// Members returns the nicks the server thinks are in a channel, sorted.
+func (b *Bot) Members(channel string) []string {
+	return b.server.Members(channel)
+}
+
+// Sync waits for the bot to handle everything sent to it so far. Work
+// plugins do in the background may still be running.
+func (b *Bot) Sync() {
+	b.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.Timeout)
+	defer cancel()
+
+	if err := b.server.Sync(ctx); err != nil {
+		b.t.Fatalf("testbot: failed to sync: %v", err)
+	}
+}
+
+// Next returns the next line the bot sends.
+func (b *Bot) Next() *irc.Message {
+	b.t.Helper()
+
+	select {
+	case m := <-b.lines:
+		return m
+	case <-time.After(b.Timeout):
+		b.t.Fatal("testbot: timed out waiting for the bot to send something")
+		return nil
+	}
+}
+
+// NextCommand returns the next line the bot sends with the given command,
+// skipping anything else.
+func (b *Bot) NextCommand(command string) *irc.Message {
+	b.t.Helper()
+
+	timeout := time.After(b.Timeout)
+
+	for {
+		select {
+		case m := <-b.lines:
+			if m.Command == command {
+				return m
+			}
+		case <-timeout:
+			b.t.Fatalf("testbot: timed out waiting for the bot to send %s", command)
+			return nil
+		}
+	}
+}
+
+func (b *Bot) expect(command, target, text string) {
+	b.t.Helper()
+
+	m := b.NextCommand(command)
+
+	got := fmt.Sprintf("%s %s :%s", command, m.Params[0], internal.StripFormatting(m.Trailing()))
+	want := fmt.Sprintf("%s %s :%s", command, target, text)
+
+	if got != want {
+		b.t.Fatalf("testbot: expected %q, got %q", want, got)
+	}
+}
+
+// ExpectPrivmsg checks the next PRIVMSG the bot sends. Formatting is
+// stripped before comparing.
+func (b *Bot) ExpectPrivmsg(target, text string) {
+	b.t.Helper()
+	b.expect("PRIVMSG", target, text)
+}
+
+// ExpectNotice checks the next NOTICE the bot sends. Formatting is stripped
+// before comparing.
+func (b *Bot) ExpectNotice(target, text string) {
+	b.t.Helper()
+	b.expect("NOTICE", target, text)
+}
+
+// ExpectNothing checks the bot hasn't sent any messages or notices which
+// haven't already been checked. It waits for the bot to handle everything
+// sent to it first, but can't wait for work plugins do in the background.
+func (b *Bot) ExpectNothing() {
+	b.t.Helper()
+
+	b.Sync()
+
+	for {
+		select {
+		case m := <-b.lines:
+			if m.Command == "PRIVMSG" || m.Command == "NOTICE" {
+				b.t.Fatalf("testbot: expected nothing, got %q", m.String())
+			}
+		default:
+			return
+		}
+	}
+}
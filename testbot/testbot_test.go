@@ -0,0 +1,93 @@
+package testbot_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+func init() {
+	seabird.RegisterPlugin("testbot_echo", newEchoPlugin)
+}
+
+// newEchoPlugin is a tiny plugin to run the harness against. echo replies
+// with its arguments and fetch replies with the body of a URL.
+func newEchoPlugin(b *seabird.Bot) error {
+	client, err := internal.NewHTTPClient(b, "testbot_echo")
+	if err != nil {
+		return err
+	}
+
+	cm := internal.NewCommandMux(b)
+
+	cm.Event("echo", func(r *seabird.Request) {
+		r.MentionReplyf("%s", r.Message.Trailing())
+	}, nil)
+
+	cm.Event("fetch", func(r *seabird.Request) {
+		resp, err := client.Get(r.Context(), r.Message.Trailing())
+		if err != nil {
+			r.MentionReplyf("Error: %s", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			r.MentionReplyf("Error: %s", err)
+			return
+		}
+
+		r.MentionReplyf("%d %s", resp.StatusCode, body)
+	}, nil)
+
+	return nil
+}
+
+func TestMessages(t *testing.T) {
+	b := testbot.New(t, []string{"testbot_echo"}, "")
+
+	b.Privmsg("someone", testbot.Channel, "!echo hello world")
+	b.ExpectPrivmsg(testbot.Channel, "someone: hello world")
+
+	// Private messages are answered privately.
+	b.Privmsg("someone", testbot.Nick, "!echo hi")
+	b.ExpectPrivmsg("someone", "hi")
+
+	b.Privmsg("someone", testbot.Channel, "not a command")
+	b.ExpectNothing()
+}
+
+func TestMembers(t *testing.T) {
+	b := testbot.New(t, []string{"testbot_echo"}, "")
+
+	require.Equal(t, []string{testbot.Nick}, b.Members(testbot.Channel))
+
+	b.Join("someone", testbot.Channel)
+	b.Join("other", testbot.Channel)
+	require.Equal(t, []string{"other", testbot.Nick, "someone"}, b.Members(testbot.Channel))
+
+	b.Rename("other", "another")
+	b.Part("someone", testbot.Channel, "bye")
+	require.Equal(t, []string{"another", testbot.Nick}, b.Members(testbot.Channel))
+}
+
+func TestHTTP(t *testing.T) {
+	b := testbot.New(t, []string{"testbot_echo"}, "")
+
+	b.HTTP.Stub("GET", "https://example.com/stub?b=2&a=1", http.StatusTeapot, "short and stout")
+	b.HTTP.Fixture("GET", "https://example.com/fixture", "testdata/hello.http")
+
+	// Query params can be in any order.
+	b.Privmsg("someone", testbot.Channel, "!fetch https://example.com/stub?a=1&b=2")
+	b.ExpectPrivmsg(testbot.Channel, "someone: 418 short and stout")
+
+	b.Privmsg("someone", testbot.Channel, "!fetch https://example.com/fixture")
+	b.ExpectPrivmsg(testbot.Channel, "someone: 200 Hello from a fixture")
+}
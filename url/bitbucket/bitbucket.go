@@ -1,6 +1,7 @@
 package bitbucket
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"regexp"
@@ -55,7 +56,7 @@ var (
 	bitbucketIssueRegex = regexp.MustCompile(`^/([^/]+)/([^/]+)/issue/([^/]+)/[^/]+$`)
 	bitbucketPullRegex  = regexp.MustCompile(`^/([^/]+)/([^/]+)/pull-request/([^/]+)/.*$`)
 
-	bitbucketPrefix = "[Bitbucket]"
+	bitbucketPrefix = internal.Bold("[Bitbucket]")
 
 	userURL             = "https://bitbucket.org/api/2.0/users/%s"
 	repoURL             = "https://bitbucket.org/api/2.0/repositories/%s/%s"
@@ -63,6 +64,70 @@ var (
 	repoPullRequestsURL = "https://bitbucket.org/api/2.0/repositories/%s/%s/pullrequests/%s"
 )
 
+// Sample data used to check template overrides.
+var (
+	sampleTime = time.Date(2015, time.January, 3, 0, 0, 0, 0, time.UTC)
+	sampleUser = &bitbucketUser{Username: "jsvana", DisplayName: "Jay Vana"}
+)
+
+// Jay Vana (@jsvana)
+var userTemplate = internal.TemplateMustCompile("bitbucketUser", `
+{{ .user.DisplayName }} (@{{ .user.Username }})
+`).WithSample(map[string]interface{}{
+	"user": sampleUser,
+})
+
+// chriskempson/base16-iterm2 [Shell] Last pushed to 15 Nov 2014
+var repoTemplate = internal.TemplateMustCompile("bitbucketRepo", `
+{{- .repo.FullName -}}
+{{- with .repo.Language }} [{{ . }}]{{ end }} Last pushed to {{ .updated | dateFormat "2 Jan 2006" }}
+`).WithSample(map[string]interface{}{
+	"repo": &bitbucketRepo{
+		FullName: "chriskempson/base16-iterm2",
+		Language: "Shell",
+	},
+	"updated": sampleTime,
+})
+
+// Issue #51 on belak/go-seabird [open] - Expand issues plugin with more of Bitbucket [created 3 Jan 2015]
+var issueTemplate = internal.TemplateMustCompile("bitbucketIssue", `
+Issue #{{ .number }} on {{ .user }}/{{ .repo }} [{{ .issue.Status }}]
+{{- if and .issue.Priority .issue.Metadata.Kind }} [{{ .issue.Priority }} - {{ .issue.Metadata.Kind }}]{{ end }} by {{ .issue.ReportedBy.Username }}
+{{- with .issue.Title }} - {{ . }}{{ end }} [created {{ .created | dateFormat "2 Jan 2006" }}]
+`).WithSample(map[string]interface{}{
+	"issue": &bitbucketIssue{
+		Status:     "open",
+		Priority:   "major",
+		Title:      "Expand issues plugin with more of Bitbucket",
+		ReportedBy: *sampleUser,
+	},
+	"number":  "51",
+	"user":    "belak",
+	"repo":    "go-seabird",
+	"created": sampleTime,
+})
+
+// Pull request #59 on belak/go-seabird created by jsvana [open] - Add stuff to links [created 4 Jan 2015]
+var pullTemplate = internal.TemplateMustCompile("bitbucketPull", `
+Pull request #{{ .number }} on {{ .user }}/{{ .repo }} created by {{ .pull.Author.Username }} [{{ .state }}]
+{{- with .pull.Title }} - {{ . }}{{ end }} [created {{ .created | dateFormat "2 Jan 2006" }}]
+`).WithSample(map[string]interface{}{
+	"pull": &bitbucketPullRequest{
+		Title:  "Add stuff to links",
+		Author: *sampleUser,
+	},
+	"state":   "open",
+	"number":  "59",
+	"user":    "belak",
+	"repo":    "go-seabird",
+	"created": sampleTime,
+})
+
+type bitbucketProvider struct {
+	client *internal.HTTPClient
+	cache  *internal.Cache
+}
+
 func newBitbucketProvider(b *seabird.Bot) error {
 	err := b.EnsurePlugin("url")
 	if err != nil {
@@ -71,27 +136,46 @@ func newBitbucketProvider(b *seabird.Bot) error {
 
 	urlPlugin := urlPlugin.CtxPlugin(b.Context())
 
-	urlPlugin.RegisterProvider("bitbucket.org", bitbucketCallback)
+	client, err := internal.NewHTTPClient(b, "url/bitbucket")
+	if err != nil {
+		return err
+	}
+
+	cache, err := internal.NewCache(b, "url/bitbucket")
+	if err != nil {
+		return err
+	}
+
+	p := &bitbucketProvider{client: client, cache: cache}
+
+	urlPlugin.RegisterProvider("bitbucket.org", p.bitbucketCallback)
 
 	return nil
 }
 
-func bitbucketCallback(r *seabird.Request, url *url.URL) bool {
+// getJSON looks up the given url, going through the cache.
+func (p *bitbucketProvider) getJSON(ctx context.Context, url string, resp interface{}) error {
+	return p.cache.Fetch(url, resp, func() error {
+		return p.client.GetJSON(ctx, url, resp)
+	})
+}
+
+func (p *bitbucketProvider) bitbucketCallback(ctx context.Context, r *seabird.Request, url *url.URL) bool {
 	//nolint:gocritic
 	if bitbucketUserRegex.MatchString(url.Path) {
-		return bitbucketGetUser(r, url)
+		return p.bitbucketGetUser(ctx, r, url)
 	} else if bitbucketRepoRegex.MatchString(url.Path) {
-		return bitbucketGetRepo(r, url)
+		return p.bitbucketGetRepo(ctx, r, url)
 	} else if bitbucketIssueRegex.MatchString(url.Path) {
-		return bitbucketGetIssue(r, url)
+		return p.bitbucketGetIssue(ctx, r, url)
 	} else if bitbucketPullRegex.MatchString(url.Path) {
-		return bitbucketGetPull(r, url)
+		return p.bitbucketGetPull(ctx, r, url)
 	}
 
 	return false
 }
 
-func bitbucketGetUser(r *seabird.Request, url *url.URL) bool {
+func (p *bitbucketProvider) bitbucketGetUser(ctx context.Context, r *seabird.Request, url *url.URL) bool {
 	matches := bitbucketUserRegex.FindStringSubmatch(url.Path)
 	if len(matches) != 2 {
 		return false
@@ -100,17 +184,19 @@ func bitbucketGetUser(r *seabird.Request, url *url.URL) bool {
 	user := matches[1]
 
 	bu := &bitbucketUser{}
-	if err := internal.GetJSON(fmt.Sprintf(userURL, user), bu); err != nil {
+	if err := p.getJSON(ctx, fmt.Sprintf(userURL, user), bu); err != nil {
 		return false
 	}
 
-	// Jay Vana @jsvana
-	r.Replyf("%s %s (@%s)", bitbucketPrefix, bu.DisplayName, bu.Username)
-
-	return true
+	return internal.RenderRespond(
+		r, r.GetLogger("url/bitbucket"), userTemplate, bitbucketPrefix,
+		map[string]interface{}{
+			"user": bu,
+		},
+	)
 }
 
-func bitbucketGetRepo(r *seabird.Request, url *url.URL) bool {
+func (p *bitbucketProvider) bitbucketGetRepo(ctx context.Context, r *seabird.Request, url *url.URL) bool {
 	matches := bitbucketRepoRegex.FindStringSubmatch(url.Path)
 	if len(matches) != 3 {
 		return false
@@ -120,29 +206,25 @@ func bitbucketGetRepo(r *seabird.Request, url *url.URL) bool {
 	repo := matches[2]
 
 	br := &bitbucketRepo{}
-	if err := internal.GetJSON(fmt.Sprintf(repoURL, user, repo), br); err != nil {
+	if err := p.getJSON(ctx, fmt.Sprintf(repoURL, user, repo), br); err != nil {
 		return false
 	}
 
-	// chriskempson/base16-iterm2 [Shell] Last pushed to 15 Nov 2014 - Base16 for iTerm2
-	out := br.FullName
-	if br.Language != "" {
-		out += " [" + br.Language + "]"
-	}
-
 	tm, err := time.Parse(time.RFC3339, br.UpdatedOn)
 	if err != nil {
 		return false
 	}
 
-	out += " Last pushed to " + tm.Format("2 Jan 2006")
-
-	r.Replyf("%s %s", bitbucketPrefix, out)
-
-	return true
+	return internal.RenderRespond(
+		r, r.GetLogger("url/bitbucket"), repoTemplate, bitbucketPrefix,
+		map[string]interface{}{
+			"repo":    br,
+			"updated": tm,
+		},
+	)
 }
 
-func bitbucketGetIssue(r *seabird.Request, url *url.URL) bool {
+func (p *bitbucketProvider) bitbucketGetIssue(ctx context.Context, r *seabird.Request, url *url.URL) bool {
 	matches := bitbucketIssueRegex.FindStringSubmatch(url.Path)
 	if len(matches) != 4 {
 		return false
@@ -153,7 +235,7 @@ func bitbucketGetIssue(r *seabird.Request, url *url.URL) bool {
 	issueNum := matches[3]
 
 	bi := &bitbucketIssue{}
-	if err := internal.GetJSON(fmt.Sprintf(repoIssuesURL, user, repo, issueNum), bi); err != nil {
+	if err := p.getJSON(ctx, fmt.Sprintf(repoIssuesURL, user, repo, issueNum), bi); err != nil {
 		return false
 	}
 
@@ -162,30 +244,24 @@ func bitbucketGetIssue(r *seabird.Request, url *url.URL) bool {
 		bi.ReportedBy.Username = "Anonymous"
 	}
 
-	// Issue #51 on belak/go-seabird [open] - Expand issues plugin with more of Bitbucket [created 3 Jan 2015]
-	out := fmt.Sprintf("Issue #%s on %s/%s [%s]", issueNum, user, repo, bi.Status)
-	if bi.Priority != "" && bi.Metadata.Kind != "" {
-		out += " [" + bi.Priority + " - " + bi.Metadata.Kind + "]"
-	}
-
-	out += " by " + bi.ReportedBy.Username
-
-	if bi.Title != "" {
-		out += " - " + bi.Title
-	}
-
 	tm, err := time.Parse("2006-01-02T15:04:05.000", bi.CreatedOn)
 	if err != nil {
 		return false
 	}
 
-	out += " [created " + tm.Format("2 Jan 2006") + "]"
-	r.Replyf("%s %s", bitbucketPrefix, out)
-
-	return true
+	return internal.RenderRespond(
+		r, r.GetLogger("url/bitbucket"), issueTemplate, bitbucketPrefix,
+		map[string]interface{}{
+			"issue":   bi,
+			"number":  issueNum,
+			"user":    user,
+			"repo":    repo,
+			"created": tm,
+		},
+	)
 }
 
-func bitbucketGetPull(r *seabird.Request, url *url.URL) bool {
+func (p *bitbucketProvider) bitbucketGetPull(ctx context.Context, r *seabird.Request, url *url.URL) bool {
 	matches := bitbucketPullRegex.FindStringSubmatch(url.Path)
 	if len(matches) != 4 {
 		return false
@@ -196,24 +272,24 @@ func bitbucketGetPull(r *seabird.Request, url *url.URL) bool {
 	pullNum := matches[3]
 
 	bpr := &bitbucketPullRequest{}
-	if err := internal.GetJSON(fmt.Sprintf(repoPullRequestsURL, user, repo, pullNum), bpr); err != nil {
+	if err := p.getJSON(ctx, fmt.Sprintf(repoPullRequestsURL, user, repo, pullNum), bpr); err != nil {
 		return false
 	}
 
-	// Pull request #59 on belak/go-seabird created by jsvana [open] - Add stuff to links [created 4 Jan 2015]
-	out := fmt.Sprintf("Pull request #%s on %s/%s created by %s [%s]", pullNum, user, repo, bpr.Author.Username, strings.ToLower(bpr.State))
-	if bpr.Title != "" {
-		out += " - " + bpr.Title
-	}
-
 	tm, err := time.Parse("2006-01-02T15:04:05.000000-07:00", bpr.CreatedOn)
 	if err != nil {
 		return false
 	}
 
-	out += " [created " + tm.Format("2 Jan 2006") + "]"
-
-	r.Replyf("%s %s", bitbucketPrefix, out)
-
-	return true
+	return internal.RenderRespond(
+		r, r.GetLogger("url/bitbucket"), pullTemplate, bitbucketPrefix,
+		map[string]interface{}{
+			"pull":    bpr,
+			"state":   strings.ToLower(bpr.State),
+			"number":  pullNum,
+			"user":    user,
+			"repo":    repo,
+			"created": tm,
+		},
+	)
 }
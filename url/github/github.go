@@ -3,9 +3,13 @@ package github
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
@@ -24,7 +28,12 @@ type githubConfig struct {
 }
 
 type githubProvider struct {
-	api *github.Client
+	client *internal.HTTPClient
+	cache  *internal.Cache
+
+	// lock protects api, which is replaced when the config is reloaded.
+	lock sync.RWMutex
+	api  *github.Client
 }
 
 var (
@@ -34,9 +43,19 @@ var (
 	githubPullRegex  = regexp.MustCompile(`^/([^/]+)/([^/]+)/pull/([^/]+)$`)
 	githubGistRegex  = regexp.MustCompile(`^/([^/]+)/([^/]+)$`)
 
-	githubPrefix = "[Github]"
+	githubPrefix = internal.Bold("[Github]")
 )
 
+// notFound converts a 404 from github into internal.ErrNotFound so it can
+// be cached.
+func notFound(resp *github.Response, err error) error {
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return internal.ErrNotFound
+	}
+
+	return err
+}
+
 func parseUserRepoNum(matches []string) (string, string, int, error) {
 	if len(matches) != 4 {
 		return "", "", 0, errors.New("Incorrect number of matches")
@@ -65,44 +84,95 @@ func newGithubProvider(b *seabird.Bot) error {
 		return err
 	}
 
-	// Create an oauth2 client
+	t.client, err = internal.NewHTTPClient(b, "url/github")
+	if err != nil {
+		return err
+	}
+
+	t.api = t.newAPI(gc.Token)
+
+	t.cache, err = internal.NewCache(b, "url/github")
+	if err != nil {
+		return err
+	}
+
+	internal.BotLifecycle(b).OnReload("url/github", t.reload)
+
+	urlPlugin.RegisterProvider("github.com", t.githubCallback)
+	urlPlugin.RegisterProvider("gist.github.com", t.gistCallback)
+
+	return nil
+}
+
+func (t *githubProvider) newAPI(token string) *github.Client {
+	// Create an oauth2 client on top of our own client
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, t.client.Client())
 	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: gc.Token},
+		&oauth2.Token{AccessToken: token},
 	)
-	tc := oauth2.NewClient(context.TODO(), ts)
+	tc := oauth2.NewClient(ctx, ts)
 
 	// Create a github client from the oauth2 client
-	t.api = github.NewClient(tc)
+	return github.NewClient(tc)
+}
 
-	urlPlugin.RegisterProvider("github.com", t.githubCallback)
-	urlPlugin.RegisterProvider("gist.github.com", t.gistCallback)
+func (t *githubProvider) reload(conf *seabird.Bot) error {
+	gc := &githubConfig{}
+	if err := conf.Config("github", gc); err != nil {
+		return err
+	}
+
+	api := t.newAPI(gc.Token)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.api = api
 
 	return nil
 }
 
-func (t *githubProvider) githubCallback(r *seabird.Request, url *url.URL) bool {
+func (t *githubProvider) getAPI() *github.Client {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.api
+}
+
+func (t *githubProvider) githubCallback(ctx context.Context, r *seabird.Request, url *url.URL) bool {
 	//nolint:gocritic
 	if githubUserRegex.MatchString(url.Path) {
-		return t.getUser(r, url.Path)
+		return t.getUser(ctx, r, url.Path)
 	} else if githubRepoRegex.MatchString(url.Path) {
-		return t.getRepo(r, url.Path)
+		return t.getRepo(ctx, r, url.Path)
 	} else if githubIssueRegex.MatchString(url.Path) {
-		return t.getIssue(r, url.Path)
+		return t.getIssue(ctx, r, url.Path)
 	} else if githubPullRegex.MatchString(url.Path) {
-		return t.getPull(r, url.Path)
+		return t.getPull(ctx, r, url.Path)
 	}
 
 	return false
 }
 
-func (t *githubProvider) gistCallback(r *seabird.Request, url *url.URL) bool {
+func (t *githubProvider) gistCallback(ctx context.Context, r *seabird.Request, url *url.URL) bool {
 	if githubGistRegex.MatchString(url.Path) {
-		return t.getGist(r, url.Path)
+		return t.getGist(ctx, r, url.Path)
 	}
 
 	return false
 }
 
+// Sample data used to check template overrides.
+var (
+	sampleTime = github.Timestamp{Time: time.Date(2015, time.January, 2, 0, 0, 0, 0, time.UTC)}
+	sampleUser = &github.User{
+		Login:   github.String("jsvana"),
+		Name:    github.String("Jay Vana"),
+		Company: github.String("Facebook"),
+		Bio:     github.String("Bio bio bio"),
+	}
+)
+
 // Jay Vana (@jsvana) at Facebook - Bio bio bio
 var userTemplate = internal.TemplateMustCompile("githubUser", `
 {{- if .user.Name -}}
@@ -113,9 +183,11 @@ var userTemplate = internal.TemplateMustCompile("githubUser", `
 {{- end -}}
 {{- with .user.Company }} at {{ . }}{{ end -}}
 {{- with .user.Bio }} - {{ . }}{{ end -}}
-`)
+`).WithSample(map[string]interface{}{
+	"user": sampleUser,
+})
 
-func (t *githubProvider) getUser(r *seabird.Request, url string) bool {
+func (t *githubProvider) getUser(ctx context.Context, r *seabird.Request, url string) bool {
 	logger := r.GetLogger("url/github")
 
 	matches := githubUserRegex.FindStringSubmatch(url)
@@ -123,14 +195,25 @@ func (t *githubProvider) getUser(r *seabird.Request, url string) bool {
 		return false
 	}
 
-	user, _, err := t.api.Users.Get(context.TODO(), matches[1])
+	user := &github.User{}
+
+	err := t.cache.Fetch("user:"+matches[1], user, func() error {
+		ret, resp, err := t.getAPI().Users.Get(ctx, matches[1])
+		if err != nil {
+			return notFound(resp, err)
+		}
+
+		*user = *ret
+
+		return nil
+	})
 	if err != nil {
 		logger.WithError(err).Error("Failed to get user from github")
 		return false
 	}
 
 	return internal.RenderRespond(
-		r.Replyf, logger, userTemplate, githubPrefix,
+		r, logger, userTemplate, githubPrefix,
 		map[string]interface{}{
 			"user": user,
 		},
@@ -147,9 +230,21 @@ var repoTemplate = internal.TemplateMustCompile("githubRepo", `
 {{- with .repo.ForksCount }}, {{ prettifySuffix . }} {{ pluralizeWord . "fork" }}{{ end }}
 {{- with .repo.OpenIssuesCount }}, {{ prettifySuffix . }} {{ pluralizeWord . "open issue" }}{{ end }}
 {{- with .repo.StargazersCount }}, {{ prettifySuffix . }} {{ pluralizeWord . "star" }}{{ end }}
-`)
-
-func (t *githubProvider) getRepo(r *seabird.Request, url string) bool {
+`).WithSample(map[string]interface{}{
+	"repo": &github.Repository{
+		FullName:        github.String("jsvana/alfred"),
+		Language:        github.String("PHP"),
+		Fork:            github.Bool(true),
+		Parent:          &github.Repository{FullName: github.String("belak/alfred")},
+		PushedAt:        &sampleTime,
+		Description:     github.String("Description"),
+		ForksCount:      github.Int(1),
+		OpenIssuesCount: github.Int(2),
+		StargazersCount: github.Int(4),
+	},
+})
+
+func (t *githubProvider) getRepo(ctx context.Context, r *seabird.Request, url string) bool {
 	logger := r.GetLogger("url/github")
 
 	matches := githubRepoRegex.FindStringSubmatch(url)
@@ -159,8 +254,18 @@ func (t *githubProvider) getRepo(r *seabird.Request, url string) bool {
 
 	user := matches[1]
 	repoName := matches[2]
-	repo, _, err := t.api.Repositories.Get(context.TODO(), user, repoName)
+	repo := &github.Repository{}
+
+	err := t.cache.Fetch("repo:"+user+"/"+repoName, repo, func() error {
+		ret, resp, err := t.getAPI().Repositories.Get(ctx, user, repoName)
+		if err != nil {
+			return notFound(resp, err)
+		}
 
+		*repo = *ret
+
+		return nil
+	})
 	if err != nil {
 		logger.WithError(err).Error("Failed to get repo from github")
 		return false
@@ -175,7 +280,7 @@ func (t *githubProvider) getRepo(r *seabird.Request, url string) bool {
 	}
 
 	return internal.RenderRespond(
-		r.Replyf, logger, repoTemplate, githubPrefix,
+		r, logger, repoTemplate, githubPrefix,
 		map[string]interface{}{
 			"repo": repo,
 		},
@@ -188,9 +293,19 @@ Issue #{{ .issue.Number }} on {{ .user }}/{{ .repo }} [{{ .issue.State }}]
 {{- with .issue.Assignee }} (assigned to {{ .Login }}){{ end }}
 {{- with .issue.Title }} - {{ . }}{{ end }}
 {{- with .issue.CreatedAt }} [created {{ . | dateFormat "2 Jan 2006" }}]{{ end }}
-`)
-
-func (t *githubProvider) getIssue(r *seabird.Request, url string) bool {
+`).WithSample(map[string]interface{}{
+	"issue": &github.Issue{
+		Number:    github.Int(42),
+		State:     github.String("open"),
+		Assignee:  sampleUser,
+		Title:     github.String("Issue title"),
+		CreatedAt: &sampleTime.Time,
+	},
+	"user": "belak",
+	"repo": "go-seabird",
+})
+
+func (t *githubProvider) getIssue(ctx context.Context, r *seabird.Request, url string) bool {
 	logger := r.GetLogger("url/github")
 
 	matches := githubIssueRegex.FindStringSubmatch(url)
@@ -201,14 +316,25 @@ func (t *githubProvider) getIssue(r *seabird.Request, url string) bool {
 		return false
 	}
 
-	issue, _, err := t.api.Issues.Get(context.TODO(), user, repo, issueNum)
+	issue := &github.Issue{}
+
+	err = t.cache.Fetch(fmt.Sprintf("issue:%s/%s#%d", user, repo, issueNum), issue, func() error {
+		ret, resp, err := t.getAPI().Issues.Get(ctx, user, repo, issueNum)
+		if err != nil {
+			return notFound(resp, err)
+		}
+
+		*issue = *ret
+
+		return nil
+	})
 	if err != nil {
 		logger.WithError(err).Error("Failed to get issue from github")
 		return false
 	}
 
 	return internal.RenderRespond(
-		r.Replyf, logger, issueTemplate, githubPrefix,
+		r, logger, issueTemplate, githubPrefix,
 		map[string]interface{}{
 			"issue": issue,
 			"user":  user,
@@ -218,7 +344,7 @@ func (t *githubProvider) getIssue(r *seabird.Request, url string) bool {
 }
 
 // Pull request #59 on belak/go-seabird [open] - Title title title [created 4 Jan 2015], 1 commit, 4 comments, 2 changed files
-var prTemplate = internal.TemplateMustCompile("githubPRTemplate", `
+var prTemplate = internal.TemplateMustCompile("githubPull", `
 Pull request #{{ .pull.Number }} on {{ .user }}/{{ .repo }} [{{ .pull.State }}]
 {{- with .pull.User.Login }} created by {{ . }}{{ end }}
 {{- with .pull.Title }} - {{ . }}{{ end }}
@@ -226,9 +352,22 @@ Pull request #{{ .pull.Number }} on {{ .user }}/{{ .repo }} [{{ .pull.State }}]
 {{- with .pull.Commits }}, {{ pluralize . "commit" }}{{ end }}
 {{- with .pull.Comments }}, {{ pluralize . "comment" }}{{ end }}
 {{- with .pull.ChangedFiles }}, {{ pluralize . "changed file" }}{{ end }}
-`)
-
-func (t *githubProvider) getPull(r *seabird.Request, url string) bool {
+`).WithSample(map[string]interface{}{
+	"pull": &github.PullRequest{
+		Number:       github.Int(59),
+		State:        github.String("open"),
+		User:         sampleUser,
+		Title:        github.String("Title title title"),
+		CreatedAt:    &sampleTime.Time,
+		Commits:      github.Int(1),
+		Comments:     github.Int(4),
+		ChangedFiles: github.Int(2),
+	},
+	"user": "belak",
+	"repo": "go-seabird",
+})
+
+func (t *githubProvider) getPull(ctx context.Context, r *seabird.Request, url string) bool {
 	logger := r.GetLogger("url/github")
 
 	matches := githubPullRegex.FindStringSubmatch(url)
@@ -239,14 +378,25 @@ func (t *githubProvider) getPull(r *seabird.Request, url string) bool {
 		return false
 	}
 
-	pull, _, err := t.api.PullRequests.Get(context.TODO(), user, repo, pullNum)
+	pull := &github.PullRequest{}
+
+	err = t.cache.Fetch(fmt.Sprintf("pull:%s/%s#%d", user, repo, pullNum), pull, func() error {
+		ret, resp, err := t.getAPI().PullRequests.Get(ctx, user, repo, pullNum)
+		if err != nil {
+			return notFound(resp, err)
+		}
+
+		*pull = *ret
+
+		return nil
+	})
 	if err != nil {
 		logger.WithError(err).Error("Failed to get github pr")
 		return false
 	}
 
 	return internal.RenderRespond(
-		r.Replyf, logger, prTemplate, githubPrefix,
+		r, logger, prTemplate, githubPrefix,
 		map[string]interface{}{
 			"user": user,
 			"repo": repo,
@@ -256,14 +406,21 @@ func (t *githubProvider) getPull(r *seabird.Request, url string) bool {
 }
 
 // Created 3 Jan 2015 by belak - Description description, 1 file, 3 comments
-var gistTemplate = internal.TemplateMustCompile("gist", `
+var gistTemplate = internal.TemplateMustCompile("githubGist", `
 Created {{ .gist.CreatedAt | dateFormat "2 Jan 2006" }}
 {{- with .gist.Owner.Login }} by {{ . }}{{ end }}
 {{- with .gist.Description }} - {{ . }}{{ end }}
 {{- with .gist.Comments }}, {{ pluralize . "comment" }}{{ end }}
-`)
-
-func (t *githubProvider) getGist(r *seabird.Request, url string) bool {
+`).WithSample(map[string]interface{}{
+	"gist": &github.Gist{
+		CreatedAt:   &sampleTime.Time,
+		Owner:       sampleUser,
+		Description: github.String("Description description"),
+		Comments:    github.Int(3),
+	},
+})
+
+func (t *githubProvider) getGist(ctx context.Context, r *seabird.Request, url string) bool {
 	logger := r.GetLogger("url/github")
 
 	matches := githubGistRegex.FindStringSubmatch(url)
@@ -273,14 +430,25 @@ func (t *githubProvider) getGist(r *seabird.Request, url string) bool {
 
 	id := matches[2]
 
-	gist, _, err := t.api.Gists.Get(context.TODO(), id)
+	gist := &github.Gist{}
+
+	err := t.cache.Fetch("gist:"+id, gist, func() error {
+		ret, resp, err := t.getAPI().Gists.Get(ctx, id)
+		if err != nil {
+			return notFound(resp, err)
+		}
+
+		*gist = *ret
+
+		return nil
+	})
 	if err != nil {
 		logger.WithError(err).Error("Failed to get gist")
 		return false
 	}
 
 	return internal.RenderRespond(
-		r.Replyf, logger, gistTemplate, githubPrefix,
+		r, logger, gistTemplate, githubPrefix,
 		map[string]interface{}{
 			"gist": gist,
 		},
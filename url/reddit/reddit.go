@@ -1,6 +1,7 @@
 package reddit
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"regexp"
@@ -47,7 +48,7 @@ type redditComment struct {
 }
 
 var (
-	redditPrefix = "[Reddit]"
+	redditPrefix = internal.Bold("[Reddit]")
 
 	// /r/subreddit
 	redditPrivmsgSubRegex = regexp.MustCompile(`(?:\s|^)/r/([^\s/]+)`)
@@ -60,94 +61,165 @@ var (
 	redditSubRegex     = regexp.MustCompile(`^/r/([^\s/]+)/?.*$`)
 )
 
+// jsvana [gold] has 1 link karma and 1337 comment karma
+var userTemplate = internal.TemplateMustCompile("redditUser", `
+{{ .name }}{{ if .gold }} [gold]{{ end }} has {{ .linkKarma }} link karma and {{ .commentKarma }} comment karma
+`).WithSample(map[string]interface{}{
+	"name":         "jsvana",
+	"gold":         true,
+	"linkKarma":    1,
+	"commentKarma": 1337,
+})
+
+// Title title - jsvana (/r/vim, score: 5)
+var commentTemplate = internal.TemplateMustCompile("redditComment", `
+{{ .title }} - {{ .author }} (/r/{{ .subreddit }}, score: {{ .score }})
+`).WithSample(map[string]interface{}{
+	"title":     "Title title",
+	"author":    "jsvana",
+	"subreddit": "vim",
+	"score":     5,
+})
+
+// /r/vim - Description description (1 subscriber, 2 actives)
+var subTemplate = internal.TemplateMustCompile("redditSub", `
+{{ .url }} - {{ .description }} ({{ prettifySuffix .subscribers }} {{ pluralizeWord .subscribers "subscriber" }}, {{ prettifySuffix .actives }} {{ pluralizeWord .actives "active" }})
+`).WithSample(map[string]interface{}{
+	"url":         "/r/vim",
+	"description": "Description description",
+	"subscribers": 1,
+	"actives":     2,
+})
+
+type redditProvider struct {
+	client    *internal.HTTPClient
+	cache     *internal.Cache
+	lifecycle *internal.Lifecycle
+}
+
 func newRedditProvider(b *seabird.Bot) error {
 	err := b.EnsurePlugin("url")
 	if err != nil {
 		return err
 	}
 
-	bm := b.BasicMux()
+	bm := internal.NewBasicMux(b)
 	urlPlugin := urlPlugin.CtxPlugin(b.Context())
 
-	bm.Event("PRIVMSG", redditPrivmsgCallback)
-	urlPlugin.RegisterProvider("reddit.com", redditCallback)
+	client, err := internal.NewHTTPClient(b, "url/reddit")
+	if err != nil {
+		return err
+	}
+
+	cache, err := internal.NewCache(b, "url/reddit")
+	if err != nil {
+		return err
+	}
+
+	p := &redditProvider{
+		client:    client,
+		cache:     cache,
+		lifecycle: internal.BotLifecycle(b),
+	}
+
+	bm.Event("PRIVMSG", p.redditPrivmsgCallback)
+	urlPlugin.RegisterProvider("reddit.com", p.redditCallback)
 
 	return nil
 }
 
-func redditPrivmsgCallback(r *seabird.Request) {
+func (p *redditProvider) redditPrivmsgCallback(r *seabird.Request) {
 	content := r.Message.Trailing()
 
-	for _, matches := range redditPrivmsgSubRegex.FindAllStringSubmatch(content, -1) {
-		redditGetSub(r, matches[1])
-	}
+	subs := redditPrivmsgSubRegex.FindAllStringSubmatch(content, -1)
+	users := redditPrivmsgUserRegex.FindAllStringSubmatch(content, -1)
 
-	for _, matches := range redditPrivmsgUserRegex.FindAllStringSubmatch(content, -1) {
-		redditGetUser(r, matches[1])
+	if len(subs) == 0 && len(users) == 0 {
+		return
 	}
+
+	p.lifecycle.Go(func(ctx context.Context) {
+		for _, matches := range subs {
+			p.redditGetSub(ctx, r, matches[1])
+		}
+
+		for _, matches := range users {
+			p.redditGetUser(ctx, r, matches[1])
+		}
+	})
 }
 
-func redditCallback(r *seabird.Request, u *url.URL) bool {
+func (p *redditProvider) redditCallback(ctx context.Context, r *seabird.Request, u *url.URL) bool {
 	text := u.Path
 
 	//nolint:gocritic
 	if matches := redditUserRegex.FindStringSubmatch(text); len(matches) == 2 {
-		return redditGetUser(r, matches[1])
+		return p.redditGetUser(ctx, r, matches[1])
 	} else if matches := redditCommentRegex.FindStringSubmatch(text); len(matches) == 2 {
-		return redditGetComment(r, matches[1])
+		return p.redditGetComment(ctx, r, matches[1])
 	} else if matches := redditSubRegex.FindStringSubmatch(text); len(matches) == 2 {
-		return redditGetSub(r, matches[1])
+		return p.redditGetSub(ctx, r, matches[1])
 	}
 
 	return false
 }
 
-func redditGetUser(r *seabird.Request, text string) bool {
+// getJSON looks up the given url, going through the cache.
+func (p *redditProvider) getJSON(ctx context.Context, url string, resp interface{}) error {
+	return p.cache.Fetch(url, resp, func() error {
+		return p.client.GetJSON(ctx, url, resp)
+	})
+}
+
+func (p *redditProvider) redditGetUser(ctx context.Context, r *seabird.Request, text string) bool {
 	ru := &redditUser{}
-	if err := internal.GetJSON(fmt.Sprintf("https://www.reddit.com/user/%s/about.json", text), ru); err != nil {
+	if err := p.getJSON(ctx, fmt.Sprintf("https://www.reddit.com/user/%s/about.json", text), ru); err != nil {
 		return false
 	}
 
-	// jsvana [gold] has 1 link karma and 1337 comment karma
-	gold := ""
-	if ru.Data.IsGold {
-		gold = " [gold]"
-	}
-
-	r.Replyf("%s %s%s has %d link karma and %d comment karma", redditPrefix, ru.Data.Name, gold, ru.Data.LinkKarma, ru.Data.CommentKarma)
-
-	return true
+	return internal.RenderRespond(
+		r, r.GetLogger("url/reddit"), userTemplate, redditPrefix,
+		map[string]interface{}{
+			"name":         ru.Data.Name,
+			"gold":         ru.Data.IsGold,
+			"linkKarma":    ru.Data.LinkKarma,
+			"commentKarma": ru.Data.CommentKarma,
+		},
+	)
 }
 
-func redditGetComment(r *seabird.Request, text string) bool {
+func (p *redditProvider) redditGetComment(ctx context.Context, r *seabird.Request, text string) bool {
 	rc := []redditComment{}
-	if err := internal.GetJSON(fmt.Sprintf("https://www.reddit.com/comments/%s.json", text), rc); err != nil || len(rc) < 1 {
+	if err := p.getJSON(ctx, fmt.Sprintf("https://www.reddit.com/comments/%s.json", text), &rc); err != nil || len(rc) < 1 {
 		return false
 	}
 
 	cm := rc[0].Data.Children[0].Data
 
-	// Title title - jsvana (/r/vim, score: 5)
-	r.Replyf("%s %s - %s (/r/%s, score: %d)", redditPrefix, cm.Title, cm.Author, cm.Subreddit, cm.Score)
-
-	return true
+	return internal.RenderRespond(
+		r, r.GetLogger("url/reddit"), commentTemplate, redditPrefix,
+		map[string]interface{}{
+			"title":     cm.Title,
+			"author":    cm.Author,
+			"subreddit": cm.Subreddit,
+			"score":     cm.Score,
+		},
+	)
 }
 
-func redditGetSub(r *seabird.Request, text string) bool {
+func (p *redditProvider) redditGetSub(ctx context.Context, r *seabird.Request, text string) bool {
 	rs := &redditSub{}
-	if err := internal.GetJSON(fmt.Sprintf("https://www.reddit.com/r/%s/about.json", text), rs); err != nil {
+	if err := p.getJSON(ctx, fmt.Sprintf("https://www.reddit.com/r/%s/about.json", text), rs); err != nil {
 		return false
 	}
 
-	// /r/vim - Description description (1 subscriber, 2 actives)
-	r.Replyf("%s %s - %s (%s %s, %s %s)",
-		redditPrefix,
-		rs.Data.URL,
-		rs.Data.Description,
-		internal.PrettifySuffix(rs.Data.Subscribers),
-		internal.PluralizeWord(rs.Data.Subscribers, "subscriber"),
-		internal.PrettifySuffix(rs.Data.Actives),
-		internal.PluralizeWord(rs.Data.Actives, "active"))
-
-	return true
+	return internal.RenderRespond(
+		r, r.GetLogger("url/reddit"), subTemplate, redditPrefix,
+		map[string]interface{}{
+			"url":         rs.Data.URL,
+			"description": rs.Data.Description,
+			"subscribers": rs.Data.Subscribers,
+			"actives":     rs.Data.Actives,
+		},
+	)
 }
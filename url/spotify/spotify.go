@@ -2,10 +2,12 @@ package spotify
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"net/url"
+	"reflect"
 	"regexp"
 	"sync"
-	"text/template"
 
 	"github.com/sirupsen/logrus"
 	"github.com/zmb3/spotify"
@@ -30,29 +32,38 @@ type spotifyProvider struct {
 	lock   *sync.RWMutex
 	config *clientcredentials.Config
 	token  *oauth2.Token
+
+	// ctx carries our HTTP client so oauth2 will use it.
+	ctx context.Context
+
+	cache     *internal.Cache
+	lifecycle *internal.Lifecycle
 }
 
-var spotifyPrefix = "[Spotify]"
+var spotifyPrefix = internal.Bold("[Spotify]")
 
 type spotifyMatch struct {
 	regex    *regexp.Regexp
 	uriRegex *regexp.Regexp
-	template *template.Template
-	lookup   func(spotify.Client, *logrus.Entry, []string) interface{}
+	template *internal.Template
+
+	// value returns an empty value of the type lookup returns, so cached
+	// results can be decoded into it.
+	value  func() interface{}
+	lookup func(spotify.Client, []string) (interface{}, error)
 }
 
+var sampleArtists = []spotify.SimpleArtist{{Name: "Daft Punk"}}
+
 var spotifyMatchers = []spotifyMatch{
 	{
 		regex:    regexp.MustCompile(`^/artist/(.+)$`),
 		uriRegex: regexp.MustCompile(`\bspotify:artist:(\w+)\b`),
-		template: internal.TemplateMustCompile("spotifyArtist", `{{- .Name -}}`),
-		lookup: func(api spotify.Client, logger *logrus.Entry, matches []string) interface{} {
-			artist, err := api.GetArtist(spotify.ID(matches[0]))
-			if err != nil {
-				logger.WithError(err).Error("Failed to get artist info from Spotify")
-				return nil
-			}
-			return artist
+		template: internal.TemplateMustCompile("spotifyArtist", `{{- .Name -}}`).
+			WithSample(&spotify.FullArtist{SimpleArtist: sampleArtists[0]}),
+		value: func() interface{} { return &spotify.FullArtist{} },
+		lookup: func(api spotify.Client, matches []string) (interface{}, error) {
+			return api.GetArtist(spotify.ID(matches[0]))
 		},
 	},
 	{
@@ -62,14 +73,11 @@ var spotifyMatchers = []spotifyMatch{
 			{{- .Name }} by
 			{{- range $index, $element := .Artists }}
 			{{- if $index }},{{ end }} {{ $element.Name -}}
-			{{- end }} ({{ pluralize .Tracks.Total "track" }})`),
-		lookup: func(api spotify.Client, logger *logrus.Entry, matches []string) interface{} {
-			album, err := api.GetAlbum(spotify.ID(matches[0]))
-			if err != nil {
-				logger.WithError(err).Error("Failed to get album info from Spotify")
-				return nil
-			}
-			return album
+			{{- end }} ({{ pluralize .Tracks.Total "track" }})`).
+			WithSample(&spotify.FullAlbum{SimpleAlbum: spotify.SimpleAlbum{Name: "Discovery", Artists: sampleArtists}}),
+		value: func() interface{} { return &spotify.FullAlbum{} },
+		lookup: func(api spotify.Client, matches []string) (interface{}, error) {
+			return api.GetAlbum(spotify.ID(matches[0]))
 		},
 	},
 	{
@@ -79,28 +87,28 @@ var spotifyMatchers = []spotifyMatch{
 			"{{ .Name }}" from {{ .Album.Name }} by
 			{{- range $index, $element := .Artists }}
 			{{- if $index }},{{ end }} {{ $element.Name }}
-			{{- end }}`),
-		lookup: func(api spotify.Client, logger *logrus.Entry, matches []string) interface{} {
-			track, err := api.GetTrack(spotify.ID(matches[0]))
-			if err != nil {
-				logger.WithError(err).Error("Failed to get track info from Spotify")
-				return nil
-			}
-			return track
+			{{- end }}`).
+			WithSample(&spotify.FullTrack{
+				SimpleTrack: spotify.SimpleTrack{Name: "One More Time", Artists: sampleArtists},
+				Album:       spotify.SimpleAlbum{Name: "Discovery"},
+			}),
+		value: func() interface{} { return &spotify.FullTrack{} },
+		lookup: func(api spotify.Client, matches []string) (interface{}, error) {
+			return api.GetTrack(spotify.ID(matches[0]))
 		},
 	},
 	{
 		regex:    regexp.MustCompile(`^/playlist/([^/]*)$`),
 		uriRegex: regexp.MustCompile(`\bspotify:playlist:(\w+)\b`),
 		template: internal.TemplateMustCompile("spotifyPlaylist", `
-			"{{- .Name }}" playlist by {{ .Owner.DisplayName }} ({{ pluralize .Tracks.Total "track" }})`),
-		lookup: func(api spotify.Client, logger *logrus.Entry, matches []string) interface{} {
-			playlist, err := api.GetPlaylist(spotify.ID(matches[0]))
-			if err != nil {
-				logger.WithError(err).Error("Failed to get track info from Spotify")
-				return nil
-			}
-			return playlist
+			"{{- .Name }}" playlist by {{ .Owner.DisplayName }} ({{ pluralize .Tracks.Total "track" }})`).
+			WithSample(&spotify.FullPlaylist{SimplePlaylist: spotify.SimplePlaylist{
+				Name:  "Daft Punk Essentials",
+				Owner: spotify.User{DisplayName: "Spotify"},
+			}}),
+		value: func() interface{} { return &spotify.FullPlaylist{} },
+		lookup: func(api spotify.Client, matches []string) (interface{}, error) {
+			return api.GetPlaylist(spotify.ID(matches[0]))
 		},
 	},
 }
@@ -110,11 +118,12 @@ func newSpotifyProvider(b *seabird.Bot) error {
 		return err
 	}
 
-	bm := b.BasicMux()
+	bm := internal.NewBasicMux(b)
 	urlPlugin := urlPlugin.CtxPlugin(b.Context())
 
 	s := &spotifyProvider{
-		lock: &sync.RWMutex{},
+		lock:      &sync.RWMutex{},
+		lifecycle: internal.BotLifecycle(b),
 	}
 
 	sc := &spotifyConfig{}
@@ -122,6 +131,18 @@ func newSpotifyProvider(b *seabird.Bot) error {
 		return err
 	}
 
+	client, err := internal.NewHTTPClient(b, "url/spotify")
+	if err != nil {
+		return err
+	}
+
+	s.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, client.Client())
+
+	s.cache, err = internal.NewCache(b, "url/spotify")
+	if err != nil {
+		return err
+	}
+
 	s.config = &clientcredentials.Config{
 		ClientID:     sc.ClientID,
 		ClientSecret: sc.ClientSecret,
@@ -129,11 +150,13 @@ func newSpotifyProvider(b *seabird.Bot) error {
 	}
 
 	// Ensure we have valid credentials
-	_, err := s.getAPI()
+	_, err = s.getAPI()
 	if err != nil {
 		return err
 	}
 
+	s.lifecycle.OnReload("url/spotify", s.reload)
+
 	bm.Event("PRIVMSG", s.privmsgCallback)
 
 	urlPlugin.RegisterProvider("open.spotify.com", s.HandleURL)
@@ -141,45 +164,83 @@ func newSpotifyProvider(b *seabird.Bot) error {
 	return nil
 }
 
+// reload switches to the new credentials. The token is dropped so the next
+// lookup gets one with them.
+func (s *spotifyProvider) reload(conf *seabird.Bot) error {
+	sc := &spotifyConfig{}
+	if err := conf.Config("spotify", sc); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.config = &clientcredentials.Config{
+		ClientID:     sc.ClientID,
+		ClientSecret: sc.ClientSecret,
+		TokenURL:     spotify.TokenURL,
+	}
+	s.token = nil
+
+	return nil
+}
+
 func (s *spotifyProvider) getAPI() (spotify.Client, error) {
 	// If we already have a valid token, we can bail
 	s.lock.RLock()
 	if s.token != nil && s.token.Valid() {
 		s.lock.RUnlock()
-		return spotify.Authenticator{}.NewClient(s.token), nil
+		return s.newClient(s.token), nil
 	}
 	s.lock.RUnlock()
 
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	token, err := s.config.Token(context.Background())
+	token, err := s.config.Token(s.ctx)
 	if err != nil {
 		return spotify.Client{}, err
 	}
 
 	s.token = token
 
-	return spotify.Authenticator{}.NewClient(s.token), nil
+	return s.newClient(s.token), nil
+}
+
+func (s *spotifyProvider) newClient(token *oauth2.Token) spotify.Client {
+	return spotify.NewClient(oauth2.NewClient(s.ctx, oauth2.StaticTokenSource(token)))
 }
 
 func (s *spotifyProvider) privmsgCallback(r *seabird.Request) {
-	logger := r.GetLogger("url/spotify")
+	matched := false
+	for _, matcher := range spotifyMatchers {
+		matched = matched || matcher.uriRegex.MatchString(r.Message.Trailing())
+	}
 
-	api, err := s.getAPI()
-	if err != nil {
-		logger.WithError(err).Error("Failed to get token from Spotify")
+	if !matched {
 		return
 	}
 
-	for _, matcher := range spotifyMatchers {
-		if s.handleTarget(r, api, logger, matcher, matcher.uriRegex, r.Message.Trailing()) {
+	// The lookups don't take a context, so they can't be cancelled, but
+	// they shouldn't hold up other handlers.
+	s.lifecycle.Go(func(context.Context) {
+		logger := r.GetLogger("url/spotify")
+
+		api, err := s.getAPI()
+		if err != nil {
+			logger.WithError(err).Error("Failed to get token from Spotify")
 			return
 		}
-	}
+
+		for _, matcher := range spotifyMatchers {
+			if s.handleTarget(r, api, logger, matcher, matcher.uriRegex, r.Message.Trailing()) {
+				return
+			}
+		}
+	})
 }
 
-func (s *spotifyProvider) HandleURL(r *seabird.Request, u *url.URL) bool {
+func (s *spotifyProvider) HandleURL(ctx context.Context, r *seabird.Request, u *url.URL) bool {
 	logger := r.GetLogger("url/spotify")
 
 	api, err := s.getAPI()
@@ -207,10 +268,28 @@ func (s *spotifyProvider) handleTarget(r *seabird.Request, api spotify.Client, l
 		return false
 	}
 
-	data := matcher.lookup(api, logger, matches[1:])
-	if data == nil {
+	data := matcher.value()
+
+	err := s.cache.Fetch(matcher.template.Name()+":"+matches[1], data, func() error {
+		ret, err := matcher.lookup(api, matches[1:])
+		if err != nil {
+			var spotifyErr spotify.Error
+			if errors.As(err, &spotifyErr) && spotifyErr.Status == http.StatusNotFound {
+				return internal.ErrNotFound
+			}
+
+			return err
+		}
+
+		// Every lookup returns a pointer to the same type as value.
+		reflect.ValueOf(data).Elem().Set(reflect.ValueOf(ret).Elem())
+
+		return nil
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to get info from Spotify")
 		return false
 	}
 
-	return internal.RenderRespond(r.Replyf, logger, matcher.template, spotifyPrefix, data)
+	return internal.RenderRespond(r, logger, matcher.template, spotifyPrefix, data)
 }
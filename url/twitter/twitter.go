@@ -1,13 +1,16 @@
 package twitter
 
 import (
+	"context"
 	"net/url"
 	"regexp"
 	"strconv"
+	"sync"
 
 	"github.com/ChimeraCoder/anaconda"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
 	urlPlugin "github.com/belak/go-seabird-plugins/url"
 )
 
@@ -22,12 +25,37 @@ type twitterConfig struct {
 	AccessTokenSecret string
 }
 
+// Jay Vana (@jsvana) - Description description
+var userTemplate = internal.TemplateMustCompile("twitterUser", `
+{{ .name }} (@{{ .screenName }}) - {{ .description }}
+`).WithSample(map[string]interface{}{
+	"name":        "Jay Vana",
+	"screenName":  "jsvana",
+	"description": "Description description",
+})
+
+// Tweet text (@jsvana)
+var tweetTemplate = internal.TemplateMustCompile("twitterTweet", `
+{{ .text }} (@{{ .screenName }})
+`).WithSample(map[string]interface{}{
+	"text":       "Tweet text",
+	"screenName": "jsvana",
+})
+
 type twitterProvider struct {
-	api *anaconda.TwitterApi
+	client    *internal.HTTPClient
+	lifecycle *internal.Lifecycle
+
+	// lock protects api and config, which change when the config is
+	// reloaded. It's held for the whole of every lookup, so the old api
+	// can be closed once nothing is using it.
+	lock   sync.RWMutex
+	api    *anaconda.TwitterApi
+	config twitterConfig
 }
 
 var (
-	twitterPrefix = "[Twitter]"
+	twitterPrefix = internal.Bold("[Twitter]")
 
 	// @username
 	twitterPrivmsgUserRegex = regexp.MustCompile(`(?:\s|^)@(\w+)`)
@@ -43,19 +71,23 @@ func newtwitterProvider(b *seabird.Bot) error {
 		return err
 	}
 
-	bm := b.BasicMux()
+	bm := internal.NewBasicMux(b)
 	urlPlugin := urlPlugin.CtxPlugin(b.Context())
 
-	t := &twitterProvider{}
+	t := &twitterProvider{lifecycle: internal.BotLifecycle(b)}
+
+	if err := b.Config("twitter", &t.config); err != nil {
+		return err
+	}
 
-	tc := &twitterConfig{}
-	if err := b.Config("twitter", tc); err != nil {
+	t.client, err = internal.NewHTTPClient(b, "url/twitter")
+	if err != nil {
 		return err
 	}
 
-	anaconda.SetConsumerKey(tc.ConsumerKey)
-	anaconda.SetConsumerSecret(tc.ConsumerSecret)
-	t.api = anaconda.NewTwitterApi(tc.AccessToken, tc.AccessTokenSecret)
+	t.api = t.newAPI(t.config)
+
+	t.lifecycle.OnReload("url/twitter", t.reload)
 
 	bm.Event("PRIVMSG", t.privmsg)
 	urlPlugin.RegisterProvider("twitter.com", t.Handle)
@@ -63,13 +95,53 @@ func newtwitterProvider(b *seabird.Bot) error {
 	return nil
 }
 
+func (t *twitterProvider) newAPI(tc twitterConfig) *anaconda.TwitterApi {
+	api := anaconda.NewTwitterApiWithCredentials(
+		tc.AccessToken, tc.AccessTokenSecret,
+		tc.ConsumerKey, tc.ConsumerSecret)
+	api.HttpClient = t.client.Client()
+
+	return api
+}
+
+func (t *twitterProvider) reload(conf *seabird.Bot) error {
+	tc := twitterConfig{}
+	if err := conf.Config("twitter", &tc); err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Every api runs its own goroutine, so we only replace it if we have
+	// to.
+	if tc == t.config {
+		return nil
+	}
+
+	t.api.Close()
+	t.api = t.newAPI(tc)
+	t.config = tc
+
+	return nil
+}
+
 func (t *twitterProvider) privmsg(r *seabird.Request) {
-	for _, matches := range twitterPrivmsgUserRegex.FindAllStringSubmatch(r.Message.Trailing(), -1) {
-		t.getUser(r, matches[1])
+	users := twitterPrivmsgUserRegex.FindAllStringSubmatch(r.Message.Trailing(), -1)
+	if len(users) == 0 {
+		return
 	}
+
+	// anaconda doesn't take a context, so this can't be cancelled, but it
+	// shouldn't hold up other handlers.
+	t.lifecycle.Go(func(context.Context) {
+		for _, matches := range users {
+			t.getUser(r, matches[1])
+		}
+	})
 }
 
-func (t *twitterProvider) Handle(r *seabird.Request, u *url.URL) bool {
+func (t *twitterProvider) Handle(ctx context.Context, r *seabird.Request, u *url.URL) bool {
 	if matches := twitterUserRegex.FindStringSubmatch(u.Path); len(matches) == 2 {
 		return t.getUser(r, matches[1])
 	} else if matches := twitterStatusRegex.FindStringSubmatch(u.Path); len(matches) == 2 {
@@ -80,15 +152,22 @@ func (t *twitterProvider) Handle(r *seabird.Request, u *url.URL) bool {
 }
 
 func (t *twitterProvider) getUser(r *seabird.Request, text string) bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
 	user, err := t.api.GetUsersShow(text, nil)
 	if err != nil {
 		return false
 	}
 
-	// Jay Vana (@jsvana) - Description description
-	r.Replyf("%s %s (@%s) - %s", twitterPrefix, user.Name, user.ScreenName, user.Description)
-
-	return true
+	return internal.RenderRespond(
+		r, r.GetLogger("url/twitter"), userTemplate, twitterPrefix,
+		map[string]interface{}{
+			"name":        user.Name,
+			"screenName":  user.ScreenName,
+			"description": user.Description,
+		},
+	)
 }
 
 func (t *twitterProvider) getTweet(r *seabird.Request, text string) bool {
@@ -97,13 +176,19 @@ func (t *twitterProvider) getTweet(r *seabird.Request, text string) bool {
 		return false
 	}
 
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
 	tweet, err := t.api.GetTweet(id, nil)
 	if err != nil {
 		return false
 	}
 
-	// Tweet text (@jsvana)
-	r.Replyf("%s %s (@%s)", twitterPrefix, tweet.Text, tweet.User.ScreenName)
-
-	return true
+	return internal.RenderRespond(
+		r, r.GetLogger("url/twitter"), tweetTemplate, twitterPrefix,
+		map[string]interface{}{
+			"text":       tweet.Text,
+			"screenName": tweet.User.ScreenName,
+		},
+	)
 }
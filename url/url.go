@@ -2,13 +2,10 @@ package url
 
 import (
 	"context"
-	"crypto/tls"
 	"io"
-	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
-	"time"
 
 	"github.com/yhat/scrape"
 	"golang.org/x/net/html"
@@ -31,25 +28,42 @@ var (
 	contextKeyURLPlugin = internal.ContextKey("seabird-url-plugin")
 )
 
-// NOTE: This nasty work is done so we ignore invalid ssl certs. We know what
-// we're doing.
-//nolint:gosec
-var client = &http.Client{
-	Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	},
-	Timeout: 5 * time.Second,
-}
+var (
+	titleTemplate = internal.TemplateMustCompile("urlTitle", `
+Title: {{ .title }}
+`).WithSample(map[string]interface{}{
+		"title": "Example Domain",
+	})
+
+	downTemplate = internal.TemplateMustCompile("urlDown", `
+It's not just you! {{ .url }} looks down from here.
+`).WithSample(map[string]interface{}{
+		"url": "http://example.com",
+	})
+
+	upTemplate = internal.TemplateMustCompile("urlUp", `
+It's just you! {{ .url }} looks up from here!
+`).WithSample(map[string]interface{}{
+		"url": "http://example.com",
+	})
+
+	invalidURLTemplate = internal.TemplateMustCompile("urlInvalid", `
+URL doesn't appear to be valid
+`).WithSample(map[string]interface{}{})
+)
 
 // LinkProvider is a callback to be registered with the Plugin. It
 // takes the same parameters as a normal IRC callback in addition to a
-// *url.URL representing the found url. It returns true if it was able
-// to handle that url and false otherwise.
-type LinkProvider func(r *seabird.Request, url *url.URL) bool
+// *url.URL representing the found url. Providers are run in the
+// background and ctx is cancelled if the bot shuts down first. It
+// returns true if it was able to handle that url and false otherwise.
+type LinkProvider func(ctx context.Context, r *seabird.Request, url *url.URL) bool
 
 // Plugin stores all registered URL LinkProviders
 type Plugin struct {
 	providers map[string][]LinkProvider
+	client    *internal.HTTPClient
+	lifecycle *internal.Lifecycle
 }
 
 func CtxPlugin(ctx context.Context) *Plugin {
@@ -57,16 +71,25 @@ func CtxPlugin(ctx context.Context) *Plugin {
 }
 
 func newPlugin(b *seabird.Bot) error {
+	// Titles are fetched from all sorts of sites, so certificate checking
+	// can be turned off with tlsnoverify in [http.plugins.url].
+	client, err := internal.NewHTTPClient(b, "url")
+	if err != nil {
+		return err
+	}
+
 	p := &Plugin{
 		providers: make(map[string][]LinkProvider),
+		client:    client,
+		lifecycle: internal.BotLifecycle(b),
 	}
 
-	bm := b.BasicMux()
-	cm := b.CommandMux()
+	bm := internal.NewBasicMux(b)
+	cm := internal.NewCommandMux(b)
 
 	bm.Event("PRIVMSG", p.callback)
 
-	cm.Event("down", isItDownCallback, &seabird.HelpInfo{
+	cm.Event("down", p.isItDownCallback, &seabird.HelpInfo{
 		Usage:       "<website>",
 		Description: "Checks if given website is down",
 	})
@@ -84,8 +107,10 @@ func (p *Plugin) RegisterProvider(domain string, f LinkProvider) error {
 }
 
 func (p *Plugin) callback(r *seabird.Request) {
-	for _, rawurl := range urlRegex.FindAllString(r.Message.Trailing(), -1) {
-		go func(raw string) {
+	for _, rawurl := range urlRegex.FindAllString(internal.StripFormatting(r.Message.Trailing()), -1) {
+		raw := rawurl
+
+		p.lifecycle.Go(func(ctx context.Context) {
 			u, err := url.ParseRequestURI(raw)
 			if err != nil {
 				return
@@ -95,7 +120,7 @@ func (p *Plugin) callback(r *seabird.Request) {
 			u.Path = strings.TrimRight(u.Path, "/")
 
 			for _, provider := range p.providers[u.Host] {
-				if provider(r, u) {
+				if provider(ctx, r, u) {
 					return
 				}
 			}
@@ -107,19 +132,19 @@ func (p *Plugin) callback(r *seabird.Request) {
 			if strings.HasPrefix(u.Host, "www.") {
 				host := strings.TrimPrefix(u.Host, "www.")
 				for _, provider := range p.providers[host] {
-					if provider(r, u) {
+					if provider(ctx, r, u) {
 						return
 					}
 				}
 			}
 
-			defaultLinkProvider(raw, r)
-		}(rawurl)
+			p.defaultLinkProvider(ctx, raw, r)
+		})
 	}
 }
 
-func defaultLinkProvider(url string, r *seabird.Request) bool {
-	resp, err := client.Get(url)
+func (p *Plugin) defaultLinkProvider(ctx context.Context, url string, r *seabird.Request) bool {
+	resp, err := p.client.Get(ctx, url)
 	if err != nil {
 		return false
 	}
@@ -142,17 +167,19 @@ func defaultLinkProvider(url string, r *seabird.Request) bool {
 	// If we got a result, pull the text from it
 	if ok {
 		title := newlineRegex.ReplaceAllLiteralString(scrape.Text(n), " ")
-		r.Replyf("Title: %s", title)
+		internal.ReplyTemplate(r, titleTemplate, map[string]interface{}{
+			"title": title,
+		})
 	}
 
 	return ok
 }
 
-func isItDownCallback(r *seabird.Request) {
-	go func() {
-		url, err := url.Parse(r.Message.Trailing())
+func (p *Plugin) isItDownCallback(r *seabird.Request) {
+	p.lifecycle.Go(func(ctx context.Context) {
+		url, err := url.Parse(internal.StripFormatting(r.Message.Trailing()))
 		if err != nil {
-			r.Replyf("URL doesn't appear to be valid")
+			internal.ReplyTemplate(r, invalidURLTemplate, nil)
 			return
 		}
 
@@ -160,16 +187,21 @@ func isItDownCallback(r *seabird.Request) {
 			url.Scheme = "http"
 		}
 
-		resp, err := client.Head(url.String())
+		resp, err := p.client.Head(ctx, url.String())
 		if err == nil {
 			defer resp.Body.Close()
 		}
 
 		if err != nil || resp.StatusCode != 200 {
-			r.Replyf("It's not just you! %s looks down from here.", url)
+			internal.ReplyTemplate(r, downTemplate, map[string]interface{}{
+				"url": url.String(),
+			})
+
 			return
 		}
 
-		r.Replyf("It's just you! %s looks up from here!", url)
-	}()
+		internal.ReplyTemplate(r, upTemplate, map[string]interface{}{
+			"url": url.String(),
+		})
+	})
 }
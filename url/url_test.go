@@ -0,0 +1,34 @@
+package url
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+func TestTitle(t *testing.T) {
+	b := testbot.New(t, []string{"url"}, "")
+
+	b.HTTP.Fixture("GET", "https://example.com/", "testdata/example.http")
+	b.HTTP.Stub("GET", "https://example.com/missing", http.StatusNotFound, "")
+
+	// Pages which fail to load are ignored, so the first reply is for the
+	// second link. Newlines in titles are collapsed.
+	b.Privmsg("someone", testbot.Channel, "https://example.com/missing")
+	b.Privmsg("someone", testbot.Channel, "look at https://example.com/")
+	b.ExpectPrivmsg(testbot.Channel, "Title: Example Domain")
+}
+
+func TestDown(t *testing.T) {
+	b := testbot.New(t, []string{"url"}, "")
+
+	b.HTTP.Stub("HEAD", "http://example.com", http.StatusOK, "")
+	b.HTTP.Stub("HEAD", "http://example.org", http.StatusServiceUnavailable, "")
+
+	b.Privmsg("someone", testbot.Channel, "!down example.com")
+	b.ExpectPrivmsg(testbot.Channel, "It's just you! http://example.com looks up from here!")
+
+	b.Privmsg("someone", testbot.Channel, "!down example.org")
+	b.ExpectPrivmsg(testbot.Channel, "It's not just you! http://example.org looks down from here.")
+}
@@ -1,8 +1,8 @@
 package xkcd
 
 import (
+	"context"
 	"io"
-	"net/http"
 	"net/url"
 	"regexp"
 
@@ -11,6 +11,7 @@ import (
 	"golang.org/x/net/html/atom"
 
 	seabird "github.com/belak/go-seabird"
+	"github.com/belak/go-seabird-plugins/internal"
 	urlPlugin "github.com/belak/go-seabird-plugins/url"
 )
 
@@ -19,7 +20,19 @@ func init() {
 }
 
 var xkcdRegex = regexp.MustCompile(`^/([^/]+)$`)
-var xkcdPrefix = "[XKCD]"
+var xkcdPrefix = internal.Bold("[XKCD]")
+
+// Compiling: My code's compiling.
+var comicTemplate = internal.TemplateMustCompile("xkcdComic", `
+{{ .title }}: {{ .alt }}
+`).WithSample(map[string]interface{}{
+	"title": "Compiling",
+	"alt":   "'Are you stealing those LCDs?' 'Yeah, but I'm doing it while my code compiles.'",
+})
+
+type xkcdProvider struct {
+	client *internal.HTTPClient
+}
 
 func newXKCDProvider(b *seabird.Bot) error {
 	err := b.EnsurePlugin("url")
@@ -29,17 +42,24 @@ func newXKCDProvider(b *seabird.Bot) error {
 
 	urlPlugin := urlPlugin.CtxPlugin(b.Context())
 
-	urlPlugin.RegisterProvider("xkcd.com", handleXKCD)
+	client, err := internal.NewHTTPClient(b, "url/xkcd")
+	if err != nil {
+		return err
+	}
+
+	p := &xkcdProvider{client: client}
+
+	urlPlugin.RegisterProvider("xkcd.com", p.handleXKCD)
 
 	return nil
 }
 
-func handleXKCD(r *seabird.Request, url *url.URL) bool {
+func (p *xkcdProvider) handleXKCD(ctx context.Context, r *seabird.Request, url *url.URL) bool {
 	if url.Path != "" && !xkcdRegex.MatchString(url.Path) {
 		return false
 	}
 
-	resp, err := http.Get(url.String())
+	resp, err := p.client.Get(ctx, url.String())
 	if err != nil {
 		return false
 	}
@@ -66,7 +86,13 @@ func handleXKCD(r *seabird.Request, url *url.URL) bool {
 		return false
 	}
 
-	r.Replyf("%s %s: %s", xkcdPrefix, scrape.Attr(n, "alt"), scrape.Attr(n, "title"))
-
-	return ok
+	// The alt attribute is the comic title and the title attribute is the
+	// hover text.
+	return internal.RenderRespond(
+		r, r.GetLogger("url/xkcd"), comicTemplate, xkcdPrefix,
+		map[string]interface{}{
+			"title": scrape.Attr(n, "alt"),
+			"alt":   scrape.Attr(n, "title"),
+		},
+	)
 }
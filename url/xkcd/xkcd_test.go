@@ -0,0 +1,16 @@
+package xkcd
+
+import (
+	"testing"
+
+	"github.com/belak/go-seabird-plugins/testbot"
+)
+
+func TestXKCD(t *testing.T) {
+	b := testbot.New(t, []string{"url", "url/xkcd"}, "")
+
+	b.HTTP.Fixture("GET", "https://xkcd.com/303", "testdata/compiling.http")
+
+	b.Privmsg("someone", testbot.Channel, "https://xkcd.com/303/")
+	b.ExpectPrivmsg(testbot.Channel, "[XKCD] Compiling: 'Are you stealing those LCDs?' 'Yeah, but I'm doing it while my code compiles.'")
+}
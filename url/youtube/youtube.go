@@ -1,9 +1,11 @@
 package youtube
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
 
 	duration "github.com/channelmeter/iso8601duration"
 
@@ -16,10 +18,24 @@ func init() {
 	seabird.RegisterPlugin("url/youtube", newYoutubeProvider)
 }
 
-var youtubePrefix = "[YouTube]"
+var youtubePrefix = internal.Bold("[YouTube]")
+
+// 3:34 ~ Video title
+var videoTemplate = internal.TemplateMustCompile("youtubeVideo", `
+{{ .duration }} ~ {{ .title }}
+`).WithSample(map[string]interface{}{
+	"duration": "3:34",
+	"title":    "Video title",
+})
 
 type youtubePlugin struct {
 	Key string
+
+	client *internal.HTTPClient
+	cache  *internal.Cache
+
+	// lock protects Key, which can change when the config is reloaded.
+	lock sync.RWMutex
 }
 
 // videos was converted using https://github.com/ChimeraCoder/gojson
@@ -79,6 +95,18 @@ func newYoutubeProvider(b *seabird.Bot) error {
 		return err
 	}
 
+	yp.client, err = internal.NewHTTPClient(b, "url/youtube")
+	if err != nil {
+		return err
+	}
+
+	yp.cache, err = internal.NewCache(b, "url/youtube")
+	if err != nil {
+		return err
+	}
+
+	internal.BotLifecycle(b).OnReload("url/youtube", yp.reload)
+
 	// Listen for youtube.com and youtu.be URLs
 	urlPlugin.RegisterProvider("youtube.com", yp.Handle)
 	urlPlugin.RegisterProvider("youtu.be", yp.Handle)
@@ -86,7 +114,7 @@ func newYoutubeProvider(b *seabird.Bot) error {
 	return nil
 }
 
-func (yp *youtubePlugin) Handle(r *seabird.Request, req *url.URL) bool {
+func (yp *youtubePlugin) Handle(ctx context.Context, r *seabird.Request, req *url.URL) bool {
 	// Get the Video ID from the URL
 	p, _ := url.ParseQuery(req.RawQuery)
 
@@ -105,31 +133,59 @@ func (yp *youtubePlugin) Handle(r *seabird.Request, req *url.URL) bool {
 	}
 
 	// Get video duration and title
-	time, title := getVideo(id, yp.Key)
+	time, title := yp.getVideo(ctx, id)
 
 	// Invalid video ID or no results
 	if time == "" && title == "" {
 		return false
 	}
 
-	// Send out the IRC message
-	msg := fmt.Sprintf("%s ~ %s", time, title)
-	r.Replyf("%s %s", youtubePrefix, msg)
+	return internal.RenderRespond(
+		r, r.GetLogger("url/youtube"), videoTemplate, youtubePrefix,
+		map[string]interface{}{
+			"duration": time,
+			"title":    title,
+		},
+	)
+}
 
-	return true
+func (yp *youtubePlugin) reload(conf *seabird.Bot) error {
+	config := &youtubePlugin{}
+	if err := conf.Config("youtube", config); err != nil {
+		return err
+	}
+
+	yp.lock.Lock()
+	defer yp.lock.Unlock()
+
+	yp.Key = config.Key
+
+	return nil
 }
 
-func getVideo(id string, key string) (time string, title string) {
+func (yp *youtubePlugin) getVideo(ctx context.Context, id string) (time string, title string) {
+	yp.lock.RLock()
+	key := yp.Key
+	yp.lock.RUnlock()
+
 	// Build the API call
 	api := fmt.Sprintf("https://www.googleapis.com/youtube/v3/videos?part=contentDetails%%2Csnippet&id=%s&fields=items(contentDetails%%2Csnippet)&key=%s", id, key)
 
 	var videos ytVideos
-	if err := internal.GetJSON(api, &videos); err != nil {
-		return "", ""
-	}
 
-	// Make sure we found a video
-	if len(videos.Items) < 1 {
+	err := yp.cache.Fetch(id, &videos, func() error {
+		if err := yp.client.GetJSON(ctx, api, &videos); err != nil {
+			return err
+		}
+
+		// Make sure we found a video
+		if len(videos.Items) < 1 {
+			return internal.ErrNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
 		return "", ""
 	}
 